@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/nats-io/stan.go"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// userResp is how a user is shown to admins, the password hash is never returned
+type userResp struct {
+	ID                    string   `json:"id"`
+	Email                 string   `json:"email"`
+	Roles                 []string `json:"roles"`
+	Disabled              bool     `json:"disabled"`
+	PasswordResetRequired bool     `json:"passwordResetRequired"`
+}
+
+func newUserResp(u users.User) userResp {
+	return userResp{fmt.Sprint(u.Uid), u.Email, u.Roles, u.Disabled, u.PasswordResetRequired}
+}
+
+// UsersPage is a page of users
+// pass Next as the after query parameter to fetch the following page, it is empty on the last page
+type UsersPage struct {
+	Users []userResp `json:"users"`
+	Next  string     `json:"next,omitempty"`
+}
+
+// userAdmin serves the admin routes, which are only routed for admins
+// every change to a user is published so other services can react
+type userAdmin struct {
+	store         users.AdminStore
+	refreshTokens users.RefreshStore
+	revoker       sessionRevoker
+	eBus          stan.Conn
+}
+
+// List returns a page of users ordered by ID
+func (a *userAdmin) List(ctx context.Context, ginCtx *gin.Context) {
+	q := users.UserQuery{After: ginCtx.Query("after"), Limit: defaultPageSize}
+	if limitParam, ok := ginCtx.GetQuery("limit"); ok {
+		limit, err := strconv.ParseInt(limitParam, 10, 64)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			problem.Abort(ginCtx, problem.Validation(problem.CodeValidation, "query is not valid", problem.InvalidParam{Name: "limit", Reason: fmt.Sprintf("limit must be a number between 1 and %v", maxPageSize)}).WithCause(fmt.Errorf("invalid limit: %v", limitParam)))
+			return
+		}
+		q.Limit = limit
+	}
+
+	// read one extra user to know if there is another page
+	page := q
+	page.Limit++
+	found, err := a.store.List(ctx, page)
+	if err == users.ErrInvalidUserID {
+		problem.Abort(ginCtx, problem.Validation(problem.CodeValidation, "query is not valid", problem.InvalidParam{Name: "after", Reason: "invalid cursor"}).WithCause(err))
+		return
+	} else if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to list users", err))
+		return
+	}
+
+	resp := UsersPage{Users: make([]userResp, 0, len(found))}
+	if int64(len(found)) > q.Limit {
+		found = found[:q.Limit]
+		resp.Next = fmt.Sprint(found[len(found)-1].Uid)
+	}
+	for _, u := range found {
+		resp.Users = append(resp.Users, newUserResp(u))
+	}
+	render(ginCtx, http.StatusOK, resp)
+}
+
+// Get returns the user with the id param
+func (a *userAdmin) Get(ctx context.Context, ginCtx *gin.Context) {
+	u, err := a.store.ReadID(ctx, ginCtx.Param("id"))
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to read user", err))
+		return
+	}
+	if u == nil {
+		problem.Abort(ginCtx, problem.NotFound(codeUserNotFound, "user not found").WithCause(errors.New("user not found")))
+		return
+	}
+	render(ginCtx, http.StatusOK, newUserResp(*u))
+}
+
+// Disable stops the user from signing in and revokes their sessions
+func (a *userAdmin) Disable(ctx context.Context, ginCtx *gin.Context) {
+	if claims, _ := middleware.ClaimsFromContext(ginCtx); claims != nil && claims.ID == ginCtx.Param("id") {
+		problem.Abort(ginCtx, problem.Forbidden(codeCannotDisableSelf, "admins cannot disable themselves").WithCause(errors.New("admin tried to disable themselves")))
+		return
+	}
+	a.update(ctx, ginCtx, subjects.Subject_USER_DISABLED, true, func(id string) (bool, error) {
+		return a.store.SetDisabled(ctx, id, true)
+	})
+}
+
+// Enable lets a disabled user sign in again
+func (a *userAdmin) Enable(ctx context.Context, ginCtx *gin.Context) {
+	a.update(ctx, ginCtx, subjects.Subject_USER_ENABLED, false, func(id string) (bool, error) {
+		return a.store.SetDisabled(ctx, id, false)
+	})
+}
+
+// RequirePasswordReset stops the user from signing in until they reset their password and revokes their sessions
+func (a *userAdmin) RequirePasswordReset(ctx context.Context, ginCtx *gin.Context) {
+	a.update(ctx, ginCtx, subjects.Subject_USER_PASSWORD_RESET_REQUIRED, true, func(id string) (bool, error) {
+		return a.store.RequirePasswordReset(ctx, id)
+	})
+}
+
+// update applies an admin action to the user with the id param
+// if revoke is set every refresh and session token of the user is revoked
+// the action is published as subject once it has been applied
+func (a *userAdmin) update(ctx context.Context, ginCtx *gin.Context, subject subjects.Subject, revoke bool, apply func(string) (bool, error)) {
+	id := ginCtx.Param("id")
+	found, err := apply(id)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to update user", err))
+		return
+	}
+	if !found {
+		problem.Abort(ginCtx, problem.NotFound(codeUserNotFound, "user not found").WithCause(errors.New("user not found")))
+		return
+	}
+
+	if revoke {
+		if err := a.refreshTokens.RevokeUser(ctx, id); err != nil {
+			problem.Abort(ginCtx, problem.Internal("unable to revoke user sessions", err))
+			return
+		}
+		if err := a.revoker.RevokeUser(ctx, id); err != nil {
+			problem.Abort(ginCtx, problem.Internal("unable to revoke user sessions", err))
+			return
+		}
+	}
+
+	var adminID string
+	if claims, ok := middleware.ClaimsFromContext(ginCtx); ok {
+		adminID = claims.ID
+	}
+	if err := a.publish(subject, id, adminID); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to publish user update", err))
+		return
+	}
+	ginCtx.Status(http.StatusNoContent)
+}
+
+func (a *userAdmin) publish(subject subjects.Subject, userID, adminID string) error {
+	subj, err := subjects.StringifySubject(subject)
+	if err != nil {
+		return fmt.Errorf("unable to set NATS subject: %v", err)
+	}
+	changedAt, err := ptypes.TimestampProto(time.Now())
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(&events.UserStatusChanged{
+		Subject:   subject,
+		UserId:    userID,
+		AdminId:   adminID,
+		ChangedAt: changedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to marshal user update: %v", err)
+	}
+	if err := a.eBus.Publish(subj, data); err != nil {
+		return fmt.Errorf("unable to publish user update: %v", err)
+	}
+	return nil
+}
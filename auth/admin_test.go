@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
+)
+
+const adminID = "5f47ec2c86ed3ef991cdfd00"
+
+// adminEngine routes the admin API the way UseUserRoutes does
+func adminEngine(t *testing.T, admin *userAdmin) (*gin.Engine, *middleware.JWTValidator) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	v, err := middleware.NewJWTValidator(key, "HS256")
+	if err != nil {
+		t.Fatalf("middleware.NewJWTValidator: %v", err)
+	}
+	revoker := new(mockRevoker)
+	revoker.On("IsRevoked", mock.Anything, mock.Anything).Return(false, nil)
+
+	eng := gin.New()
+	eng.Use(problem.Handler())
+	adminRoutes := eng.Group("/admin", RequireSession(v, revoker), middleware.RequireRole(middleware.RoleAdmin))
+	adminRoutes.GET("", withTimeout(admin.List))
+	adminRoutes.GET("/:id", withTimeout(admin.Get))
+	adminRoutes.POST("/:id/disable", withTimeout(admin.Disable))
+	adminRoutes.POST("/:id/enable", withTimeout(admin.Enable))
+	adminRoutes.POST("/:id/reset-password", withTimeout(admin.RequirePasswordReset))
+	return eng, v
+}
+
+func adminRequest(t *testing.T, eng *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %v", err)
+	}
+	if token != "" {
+		addSessionCookies(req, token)
+	}
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, req)
+	return w
+}
+
+func adminToken(t *testing.T, v *middleware.JWTValidator, roles ...string) string {
+	t.Helper()
+	token, err := users.NewSessionToken(users.Identity{Email: "admin@example.com", ID: adminID, Roles: roles}, v)
+	if err != nil {
+		t.Fatalf("users.NewSessionToken: %v", err)
+	}
+	return token
+}
+
+func TestAdminRequiresRole(t *testing.T) {
+	eng, v := adminEngine(t, &userAdmin{store: new(mockAdminStore)})
+
+	tests := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{"not an admin", adminToken(t, v, users.DefaultRoles...), http.StatusForbidden},
+		{"not signed in", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			if got, want := adminRequest(currTest, eng, http.MethodGet, "/admin", tt.token).Code, tt.expectedCode; got != want {
+				currTest.Errorf("wrong status code: %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestAdminList(t *testing.T) {
+	store := new(mockAdminStore)
+	eng, v := adminEngine(t, &userAdmin{store: store})
+	token := adminToken(t, v, middleware.RoleAdmin)
+
+	found := []users.User{
+		{Email: email, Hash: passHash, Uid: uid, Roles: users.DefaultRoles},
+		{Email: "bar@example.com", Hash: passHash, Uid: "2", Roles: users.DefaultRoles, Disabled: true},
+		{Email: "baz@example.com", Hash: passHash, Uid: "3", Roles: users.DefaultRoles},
+	}
+	// a page of two reads three users to know there is another page
+	store.On("List", mock.Anything, users.UserQuery{Limit: 3}).Return(found, nil)
+	store.On("List", mock.Anything, users.UserQuery{After: "2", Limit: 3}).Return(found[2:], nil)
+	store.On("List", mock.Anything, users.UserQuery{After: "bad", Limit: defaultPageSize + 1}).Return([]users.User(nil), users.ErrInvalidUserID)
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode int
+		expectedResp *UsersPage
+	}{
+		{
+			"first page",
+			"?limit=2",
+			http.StatusOK,
+			&UsersPage{[]userResp{
+				{uid, email, users.DefaultRoles, false, false},
+				{"2", "bar@example.com", users.DefaultRoles, true, false},
+			}, "2"},
+		},
+		{
+			"last page",
+			"?limit=2&after=2",
+			http.StatusOK,
+			&UsersPage{[]userResp{{"3", "baz@example.com", users.DefaultRoles, false, false}}, ""},
+		},
+		{"bad limit", "?limit=0", http.StatusBadRequest, nil},
+		{"bad cursor", "?after=bad", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			w := adminRequest(currTest, eng, http.MethodGet, "/admin"+tt.query, token)
+			if got, want := w.Code, tt.expectedCode; got != want {
+				currTest.Fatalf("wrong status code: %v, want %v", got, want)
+			}
+			if tt.expectedResp == nil {
+				return
+			}
+			var got UsersPage
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				currTest.Fatalf("json.Unmarshal: %v", err)
+			}
+			if diff := cmp.Diff(*tt.expectedResp, got); diff != "" {
+				currTest.Errorf("List: (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAdminGet(t *testing.T) {
+	store := new(mockAdminStore)
+	eng, v := adminEngine(t, &userAdmin{store: store})
+	token := adminToken(t, v, middleware.RoleAdmin)
+
+	store.On("ReadID", mock.Anything, uid).Return(&users.User{Email: email, Hash: passHash, Uid: uid, Roles: users.DefaultRoles}, nil)
+	store.On("ReadID", mock.Anything, "missing").Return((*users.User)(nil), nil)
+
+	w := adminRequest(t, eng, http.MethodGet, "/admin/"+uid, token)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code: %v, want %v", got, want)
+	}
+	var got userResp
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if diff := cmp.Diff(userResp{uid, email, users.DefaultRoles, false, false}, got); diff != "" {
+		t.Errorf("Get: (-want, +got):\n%s", diff)
+	}
+
+	if got, want := adminRequest(t, eng, http.MethodGet, "/admin/missing", token).Code, http.StatusNotFound; got != want {
+		t.Errorf("wrong status code for a missing user: %v, want %v", got, want)
+	}
+}
+
+func TestAdminActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		subject subjects.Subject
+		// the store method the action calls and its arguments after the user id
+		method string
+		args   []interface{}
+		revoke bool
+	}{
+		{"disable", "/disable", subjects.Subject_USER_DISABLED, "SetDisabled", []interface{}{true}, true},
+		{"enable", "/enable", subjects.Subject_USER_ENABLED, "SetDisabled", []interface{}{false}, false},
+		{"require password reset", "/reset-password", subjects.Subject_USER_PASSWORD_RESET_REQUIRED, "RequirePasswordReset", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			store := new(mockAdminStore)
+			refreshTokens := new(mockRefreshStore)
+			revoker := new(mockRevoker)
+			fakeStan := newFakeNatsConn()
+			eng, v := adminEngine(currTest, &userAdmin{store, refreshTokens, revoker, fakeStan})
+			token := adminToken(currTest, v, middleware.RoleAdmin)
+
+			store.On(tt.method, append([]interface{}{mock.Anything, uid}, tt.args...)...).Return(true, nil)
+			store.On(tt.method, append([]interface{}{mock.Anything, "missing"}, tt.args...)...).Return(false, nil)
+			if tt.revoke {
+				refreshTokens.On("RevokeUser", mock.Anything, uid).Return(nil)
+				revoker.On("RevokeUser", mock.Anything, uid).Return(nil)
+			}
+
+			if got, want := adminRequest(currTest, eng, http.MethodPost, "/admin/"+uid+tt.path, token).Code, http.StatusNoContent; got != want {
+				currTest.Fatalf("wrong status code: %v, want %v", got, want)
+			}
+			if got, want := adminRequest(currTest, eng, http.MethodPost, "/admin/missing"+tt.path, token).Code, http.StatusNotFound; got != want {
+				currTest.Errorf("wrong status code for a missing user: %v, want %v", got, want)
+			}
+			store.AssertExpectations(currTest)
+			refreshTokens.AssertExpectations(currTest)
+			revoker.AssertExpectations(currTest)
+			if !tt.revoke {
+				revoker.AssertNotCalled(currTest, "RevokeUser", mock.Anything, mock.Anything)
+			}
+
+			// only the action that was applied is published
+			subj, _ := subjects.StringifySubject(tt.subject)
+			published := fakeStan.messages[subj]
+			if got, want := len(published), 1; got != want {
+				currTest.Fatalf("wrong number of events published: %v, want %v", got, want)
+			}
+			event := &events.UserStatusChanged{}
+			if err := proto.Unmarshal(published[0], event); err != nil {
+				currTest.Fatalf("proto.Unmarshal: %v", err)
+			}
+			if event.Subject != tt.subject || event.UserId != uid || event.AdminId != adminID {
+				currTest.Errorf("wrong event: %v, want %v for user %v by admin %v", event, tt.subject, uid, adminID)
+			}
+		})
+	}
+}
+
+func TestAdminDisableFails(t *testing.T) {
+	store := new(mockAdminStore)
+	refreshTokens := new(mockRefreshStore)
+	revoker := new(mockRevoker)
+	fakeStan := newFakeNatsConn()
+	eng, v := adminEngine(t, &userAdmin{store, refreshTokens, revoker, fakeStan})
+	token := adminToken(t, v, middleware.RoleAdmin)
+
+	// admins cannot lock themselves out
+	if got, want := adminRequest(t, eng, http.MethodPost, "/admin/"+adminID+"/disable", token).Code, http.StatusForbidden; got != want {
+		t.Errorf("wrong status code disabling yourself: %v, want %v", got, want)
+	}
+
+	// nothing is published unless the user's sessions were revoked
+	store.On("SetDisabled", mock.Anything, uid, true).Return(true, nil)
+	refreshTokens.On("RevokeUser", mock.Anything, uid).Return(nil)
+	revoker.On("RevokeUser", mock.Anything, uid).Return(errors.New("db down"))
+	if got, want := adminRequest(t, eng, http.MethodPost, "/admin/"+uid+"/disable", token).Code, http.StatusInternalServerError; got != want {
+		t.Errorf("wrong status code when revocation fails: %v, want %v", got, want)
+	}
+	if got := len(fakeStan.messages); got != 0 {
+		t.Errorf("%v subjects published to, want 0", got)
+	}
+	store.AssertNotCalled(t, "SetDisabled", mock.Anything, adminID, true)
+}
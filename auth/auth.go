@@ -1,25 +1,47 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/basilnsage/mwn-ticketapp/auth/errors"
-	"github.com/basilnsage/mwn-ticketapp/auth/token"
+	"github.com/basilnsage/mwn-ticketapp/auth/mail"
+	"github.com/basilnsage/mwn-ticketapp/auth/oidc"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
 	prometrics "github.com/basilnsage/prometheus-gin-metrics"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/nats-io/stan.go"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
-	authDB         = "auth"
-	authCollection = "users"
+	authDB            = "auth"
+	authCollection    = "users"
+	refreshCollection = "refreshTokens"
+	revokedCollection = "revokedTokens"
+	revokedUsers      = "revokedUsers"
+	resetCollection   = "passwordResets"
+	verifyCollection  = "emailVerifications"
+	attemptCollection = "signinAttempts"
+	oidcCollection    = "oidcStates"
+	mfaCollection     = "mfaChallenges"
 )
 
 type config struct {
 	collection    userColl
-	authValidator *token.JWTValidator
+	authValidator *middleware.JWTValidator
+	refreshTokens refreshColl
+	revoker       sessionRevoker
+	admin         *userAdmin
+	passwords     *passwordManager
+	verifier      *emailVerifier
+	throttle      *signinThrottle
+	oidc          *oidcLogin
+	twoFactor     *twoFactor
 }
 
 func main() {
@@ -28,34 +50,164 @@ func main() {
 		log.Fatalf("unable to create MongoDB connection: %v", err)
 	}
 	userCollection := GetCollection(GetDatabase(GetClient(), authDB), authCollection)
+	refreshTokens := refreshColl{GetCollection(GetDatabase(GetClient(), authDB), refreshCollection)}
+	passwordResets := resetColl{GetCollection(GetDatabase(GetClient(), authDB), resetCollection)}
+	verifications := verifyColl{GetCollection(GetDatabase(GetClient(), authDB), verifyCollection)}
+	signinAttempts := attemptColl{GetCollection(GetDatabase(GetClient(), authDB), attemptCollection)}
+	oidcStates := oidcStateColl{GetCollection(GetDatabase(GetClient(), authDB), oidcCollection)}
+	mfaChallenges := mfaColl{GetCollection(GetDatabase(GetClient(), authDB), mfaCollection)}
+	revokedTokens := revokedColl{
+		GetCollection(GetDatabase(GetClient(), authDB), revokedCollection),
+		GetCollection(GetDatabase(GetClient(), authDB), revokedUsers),
+	}
 	defer func() {
 		if err := CloseClient(); err != nil {
 			panic(err)
 		}
 	}()
+	indexCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := CreateUserIndexes(indexCtx, userColl{userCollection}); err != nil {
+		log.Fatalf("unable to create user indexes: %v", err)
+	}
+	if err := CreateRefreshIndexes(indexCtx, refreshTokens); err != nil {
+		log.Fatalf("unable to create refresh token indexes: %v", err)
+	}
+	if err := CreateRevokedIndexes(indexCtx, revokedTokens); err != nil {
+		log.Fatalf("unable to create revoked token indexes: %v", err)
+	}
+	if err := CreateResetIndexes(indexCtx, passwordResets); err != nil {
+		log.Fatalf("unable to create password reset indexes: %v", err)
+	}
+	if err := CreateVerifyIndexes(indexCtx, verifications); err != nil {
+		log.Fatalf("unable to create email verification indexes: %v", err)
+	}
+	if err := CreateAttemptIndexes(indexCtx, signinAttempts); err != nil {
+		log.Fatalf("unable to create sign in attempt indexes: %v", err)
+	}
+	if err := CreateOIDCStateIndexes(indexCtx, oidcStates); err != nil {
+		log.Fatalf("unable to create OIDC state indexes: %v", err)
+	}
+	if err := CreateMFAIndexes(indexCtx, mfaChallenges); err != nil {
+		log.Fatalf("unable to create two-factor challenge indexes: %v", err)
+	}
+
+	// init NATS Streaming Server connection, used to publish token revocations and user updates
+	natsEnvs := map[string]string{}
+	for _, key := range []string{"NATS_CLUSTER_ID", "NATS_CLIENT_ID", "NATS_CONN_STR"} {
+		val, ok := os.LookupEnv(key)
+		if !ok {
+			log.Fatalf("please set the %v environment variable", key)
+		}
+		natsEnvs[key] = val
+	}
+	natsClient, err := stan.Connect(natsEnvs["NATS_CLUSTER_ID"], natsEnvs["NATS_CLIENT_ID"], stan.NatsURL(natsEnvs["NATS_CONN_STR"]))
+	if err != nil {
+		log.Fatalf("unable to connect to NATS Streaming Server: %v", err)
+	}
+	defer func() {
+		if err := natsClient.Close(); err != nil {
+			panic(err)
+		}
+	}()
+	revoker, err := newTokenRevoker(revokedTokens, natsClient)
+	if err != nil {
+		log.Fatalf("unable to init token revoker: %v", err)
+	}
 
 	// init JWT validator struct
-	hmacKey, ok := os.LookupEnv("JWT_SIGN_KEY")
+	// tokens are signed with the current key of a keyset, other services verify them with the public keys from the JWKS endpoint
+	// the keyset file is reloaded when it changes so keys can be rotated without a redeploy
+	keySetFile, ok := os.LookupEnv("JWT_KEYSET_FILE")
 	if !ok {
-		log.Fatalf("please set the JWT_SIGN_KEY environment variable")
+		log.Fatalf("please set the JWT_KEYSET_FILE environment variable")
 	}
-	jwtValidtor, err := token.NewJWTValidator([]byte(hmacKey), "HS256")
+	jwtValidtor, err := middleware.NewKeySetFileValidator(keySetFile, middleware.DefaultKeySetReload)
 	if err != nil {
 		log.Fatalf("unable to init JWT Validator: %v", err)
 	}
 
+	// authenticator secrets are encrypted with the key in TOTP_KEY_FILE before they are stored
+	totpKeyFile, ok := os.LookupEnv("TOTP_KEY_FILE")
+	if !ok {
+		log.Fatalf("please set the TOTP_KEY_FILE environment variable")
+	}
+	totpSecrets, err := loadSecretCipher(totpKeyFile)
+	if err != nil {
+		log.Fatalf("unable to load TOTP key: %v", err)
+	}
+
+	// password reset and email verification links point to the client, which sends the token back to auth
+	// there is no mail provider yet, mail is logged and written to MAIL_DIR if it is set
+	appURL, ok := os.LookupEnv("APP_URL")
+	if !ok {
+		log.Fatalf("please set the APP_URL environment variable")
+	}
+	mailer := mail.LogMailer{Dir: os.Getenv("MAIL_DIR")}
+
 	// bundle the mongo DB collection and jwt parser together into a config
-	conf := config{userColl{userCollection}, jwtValidtor}
+	admin := &userAdmin{userColl{userCollection}, refreshTokens, revoker, natsClient}
+	passwords := &passwordManager{
+		crud:          userColl{userCollection},
+		store:         userColl{userCollection},
+		resets:        passwordResets,
+		refreshTokens: refreshTokens,
+		revoker:       revoker,
+		mailer:        mailer,
+		resetURL:      strings.TrimSuffix(appURL, "/") + "/auth/reset-password",
+	}
+	verifier := &emailVerifier{
+		store:         userColl{userCollection},
+		verifications: verifications,
+		mailer:        mailer,
+		verifyURL:     strings.TrimSuffix(appURL, "/") + "/auth/verify-email",
+	}
+
+	// users can also sign in with the OpenID Connect providers listed in OIDC_PROVIDERS_FILE
+	// the file holds client secrets, so it is mounted from a secret rather than set in the environment
+	oidcProviders := map[string]*oidc.Provider{}
+	if providersFile, ok := os.LookupEnv("OIDC_PROVIDERS_FILE"); ok {
+		if oidcProviders, err = loadOIDCProviders(providersFile, appURL); err != nil {
+			log.Fatalf("unable to load OIDC providers: %v", err)
+		}
+	}
 
 	// init gin router and init prometheus metric middleware
+	// the sign in counters have their own registry and are served along with the prometrics metrics
 	metricReg := prometrics.NewRegistry()
+	signinReg := prometheus.NewRegistry()
+	throttle, err := newSigninThrottle(signinAttempts, signinReg)
+	if err != nil {
+		log.Fatalf("unable to init sign in throttle: %v", err)
+	}
+	mfa := &twoFactor{
+		store:         userColl{userCollection},
+		secrets:       totpSecrets,
+		challenges:    mfaChallenges,
+		crud:          userColl{userCollection},
+		signer:        jwtValidtor,
+		refreshTokens: refreshTokens,
+		throttle:      throttle,
+	}
+	oidcSignin := &oidcLogin{
+		providers:     oidcProviders,
+		states:        oidcStates,
+		crud:          userColl{userCollection},
+		linked:        userColl{userCollection},
+		signer:        jwtValidtor,
+		refreshTokens: refreshTokens,
+		verifier:      verifier,
+		twoFactor:     mfa,
+		appURL:        appURL,
+	}
+	conf := config{userColl{userCollection}, jwtValidtor, refreshTokens, revoker, admin, passwords, verifier, throttle, oidcSignin, mfa}
 	router := gin.Default()
 
 	// config gin
 	log.Println("set duration middleware")
 	router.Use(metricReg.ReportDuration(nil))
 	log.Println("set error handling middleware")
-	router.Use(errors.HandleErrors())
+	router.Use(problem.Handler())
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:  []string{"http://localhost:*"},
 		AllowWildcard: true,
@@ -68,7 +220,7 @@ func main() {
 	UseUserRoutes(router, conf)
 
 	// expose prometheus metrics
-	router.GET("/auth/metrics", metricReg.DefaultHandler)
+	router.GET("/auth/metrics", metricsHandler(metricReg, signinReg))
 
 	if err := router.Run(":4000"); err != nil {
 		log.Fatalf("unable to run auth service: %v", err)
@@ -55,9 +55,128 @@ func GetCollection(db *mongo.Database, coll string) *mongo.Collection {
 }
 
 func (uc userColl) Read(ctx context.Context, user users.User) ([]users.User, error) {
+	return uc.find(ctx, bson.M{"email": user.Email})
+}
+
+func (uc userColl) List(ctx context.Context, q users.UserQuery) ([]users.User, error) {
+	filter := bson.M{}
+	if q.After != "" {
+		after, err := primitive.ObjectIDFromHex(q.After)
+		if err != nil {
+			return nil, users.ErrInvalidUserID
+		}
+		filter["_id"] = bson.M{"$gt": after}
+	}
+	return uc.find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(q.Limit))
+}
+
+func (uc userColl) ReadID(ctx context.Context, id string) (*users.User, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+	found, err := uc.find(ctx, bson.M{"_id": oid})
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+func (uc userColl) SetDisabled(ctx context.Context, id string, disabled bool) (bool, error) {
+	return uc.set(ctx, id, bson.M{"disabled": disabled})
+}
+
+func (uc userColl) RequirePasswordReset(ctx context.Context, id string) (bool, error) {
+	return uc.set(ctx, id, bson.M{"passwordResetRequired": true})
+}
+
+func (uc userColl) SetVerified(ctx context.Context, id string) (bool, error) {
+	return uc.set(ctx, id, bson.M{"unverified": false})
+}
+
+func (uc userColl) SetPassword(ctx context.Context, id string, hash []byte) (bool, error) {
+	return uc.set(ctx, id, bson.M{"hash": hash, "passwordResetRequired": false})
+}
+
+// SetTOTPSecret leaves users who already have an authenticator alone, they cannot replace it without their codes
+func (uc userColl) SetTOTPSecret(ctx context.Context, id, secret string) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+	filter := bson.M{"_id": oid, "totpEnabled": bson.M{"$ne": true}}
+	res, err := uc.c.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totpSecret": secret}})
+	if err != nil {
+		return false, fmt.Errorf("mongo.Collection.UpdateOne: %v", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (uc userColl) EnableTOTP(ctx context.Context, id string, recoveryCodes []string, step int64) (bool, error) {
+	return uc.set(ctx, id, bson.M{"totpEnabled": true, "totpLastStep": step, "recoveryCodes": recoveryCodes})
+}
+
+// UseTOTPStep only matches users whose last period is earlier, so concurrent sign ins cannot both use a code
+func (uc userColl) UseTOTPStep(ctx context.Context, id string, step int64) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+	filter := bson.M{"_id": oid, "$or": bson.A{
+		bson.M{"totpLastStep": bson.M{"$lt": step}},
+		bson.M{"totpLastStep": bson.M{"$exists": false}},
+	}}
+	res, err := uc.c.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totpLastStep": step}})
+	if err != nil {
+		return false, fmt.Errorf("mongo.Collection.UpdateOne: %v", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// UseRecoveryCode only matches users who still have the code, so each code can only be used once
+func (uc userColl) UseRecoveryCode(ctx context.Context, id, hash string) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+	res, err := uc.c.UpdateOne(ctx, bson.M{"_id": oid, "recoveryCodes": hash}, bson.M{"$pull": bson.M{"recoveryCodes": hash}})
+	if err != nil {
+		return false, fmt.Errorf("mongo.Collection.UpdateOne: %v", err)
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// DisableTOTP keeps totpLastStep, so codes used before the authenticator was removed still cannot be replayed
+func (uc userColl) DisableTOTP(ctx context.Context, id string) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+	update := bson.M{"$set": bson.M{"totpEnabled": false}, "$unset": bson.M{"totpSecret": "", "recoveryCodes": ""}}
+	res, err := uc.c.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return false, fmt.Errorf("mongo.Collection.UpdateOne: %v", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// set updates fields of the user with id and reports whether the user exists
+func (uc userColl) set(ctx context.Context, id string, fields bson.M) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+	res, err := uc.c.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": fields})
+	if err != nil {
+		return false, fmt.Errorf("mongo.Collection.UpdateOne: %v", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (uc userColl) find(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]users.User, error) {
 	var foundUsers []users.User
 	var res []bson.M
-	cursor, err := uc.c.Find(ctx, bson.M{"email": user.Email})
+	cursor, err := uc.c.Find(ctx, filter, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("mongo.Collection.Find: %v", err)
 	}
@@ -70,10 +189,40 @@ func (uc userColl) Read(ctx context.Context, user users.User) ([]users.User, err
 		if err != nil {
 			return nil, err
 		}
+		roles, err := parseRolesRes(result)
+		if err != nil {
+			return nil, err
+		}
+		// both flags are only stored once an admin sets them
+		disabled, _ := result["disabled"].(bool)
+		resetRequired, _ := result["passwordResetRequired"].(bool)
+		// users who signed up before emails were verified have no flag and count as verified
+		unverified, _ := result["unverified"].(bool)
+		linked, err := parseLinkedRes(result)
+		if err != nil {
+			return nil, err
+		}
+		// the two-factor fields are only stored once the user enrolls an authenticator
+		totpSecret, _ := result["totpSecret"].(string)
+		totpEnabled, _ := result["totpEnabled"].(bool)
+		totpLastStep, _ := result["totpLastStep"].(int64)
+		recoveryCodes, err := parseStringsRes(result, "recoveryCodes")
+		if err != nil {
+			return nil, err
+		}
 		foundUsers = append(foundUsers, users.User{
-			Email: email,
-			Hash:  hash,
-			Uid:   uid,
+			Email:                 email,
+			Hash:                  hash,
+			Uid:                   uid,
+			Roles:                 roles,
+			Disabled:              disabled,
+			PasswordResetRequired: resetRequired,
+			Unverified:            unverified,
+			LinkedAccounts:        linked,
+			TOTPSecret:            totpSecret,
+			TOTPEnabled:           totpEnabled,
+			TOTPLastStep:          totpLastStep,
+			RecoveryCodes:         recoveryCodes,
 		})
 	}
 	return foundUsers, nil
@@ -94,11 +243,9 @@ func parseUserRes(res bson.M) (string, []byte, string, error) {
 		return "", nil, "", errors.New("found Email field but could not cast it to string")
 	}
 
-	hashRes, ok := res["hash"]
-	if !ok {
-		return "", nil, "", errors.New("did not required Hash field from mongo result")
-	}
-	switch t := hashRes.(type) {
+	// users who only sign in with an OpenID Connect provider have no hash
+	switch t := res["hash"].(type) {
+	case nil:
 	case primitive.Binary:
 		hash = t.Data
 	default:
@@ -119,10 +266,582 @@ func parseUserRes(res bson.M) (string, []byte, string, error) {
 	return email, hash, uid, nil
 }
 
+// parseRolesRes reads the user's roles
+// users created before roles were stored have the default roles
+func parseRolesRes(res bson.M) ([]string, error) {
+	rolesRes, ok := res["roles"]
+	if !ok || rolesRes == nil {
+		return append([]string(nil), users.DefaultRoles...), nil
+	}
+	rolesArr, ok := rolesRes.(primitive.A)
+	if !ok {
+		return nil, errors.New("found Roles field but could not cast it to an array")
+	}
+	roles := make([]string, 0, len(rolesArr))
+	for _, r := range rolesArr {
+		role, ok := r.(string)
+		if !ok {
+			return nil, errors.New("found Roles field but could not cast a role to string")
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// parseStringsRes reads an optional array of strings
+func parseStringsRes(res bson.M, field string) ([]string, error) {
+	arrRes, ok := res[field]
+	if !ok || arrRes == nil {
+		return nil, nil
+	}
+	arr, ok := arrRes.(primitive.A)
+	if !ok {
+		return nil, fmt.Errorf("found %v field but could not cast it to an array", field)
+	}
+	strs := make([]string, 0, len(arr))
+	for _, v := range arr {
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("found %v field but could not cast an element to string", field)
+		}
+		strs = append(strs, str)
+	}
+	return strs, nil
+}
+
+// parseLinkedRes reads the user's linked accounts, users who never signed in with a provider have none
+func parseLinkedRes(res bson.M) ([]users.LinkedAccount, error) {
+	linkedRes, ok := res["linkedAccounts"]
+	if !ok || linkedRes == nil {
+		return nil, nil
+	}
+	linkedArr, ok := linkedRes.(primitive.A)
+	if !ok {
+		return nil, errors.New("found LinkedAccounts field but could not cast it to an array")
+	}
+	linked := make([]users.LinkedAccount, 0, len(linkedArr))
+	for _, l := range linkedArr {
+		var doc bson.M
+		switch t := l.(type) {
+		case bson.M:
+			doc = t
+		case bson.D:
+			doc = t.Map()
+		default:
+			return nil, errors.New("found LinkedAccounts field but could not cast an account to a document")
+		}
+		provider, _ := doc["provider"].(string)
+		subject, _ := doc["subject"].(string)
+		if provider == "" || subject == "" {
+			return nil, errors.New("found LinkedAccounts field but an account has no provider or subject")
+		}
+		linked = append(linked, users.LinkedAccount{Provider: provider, Subject: subject})
+	}
+	return linked, nil
+}
+
+type linkedDoc struct {
+	Provider string `bson:"provider"`
+	Subject  string `bson:"subject"`
+}
+
+// CreateUserIndexes makes sure a provider's account can only be linked to one user
+// the index only covers users with linked accounts, as users without them would all share the same missing key
+func CreateUserIndexes(ctx context.Context, uc userColl) error {
+	_, err := uc.c.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "linkedAccounts.provider", Value: 1}, {Key: "linkedAccounts.subject", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"linkedAccounts": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return fmt.Errorf("mongo.IndexView.CreateOne: %v", err)
+	}
+	return nil
+}
+
+func (uc userColl) ReadLinked(ctx context.Context, account users.LinkedAccount) (*users.User, error) {
+	found, err := uc.find(ctx, bson.M{"linkedAccounts": bson.M{"$elemMatch": linkedDoc{account.Provider, account.Subject}}})
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+func (uc userColl) Link(ctx context.Context, id string, account users.LinkedAccount) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+	update := bson.M{"$addToSet": bson.M{"linkedAccounts": linkedDoc{account.Provider, account.Subject}}}
+	res, err := uc.c.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return false, fmt.Errorf("mongo.Collection.UpdateOne: %v", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
 func (uc userColl) Write(ctx context.Context, user users.User) (interface{}, error) {
-	res, err := uc.c.InsertOne(ctx, bson.M{"email": user.Email, "hash": user.Hash})
+	doc := bson.M{"email": user.Email, "hash": user.Hash, "roles": user.Roles, "unverified": user.Unverified}
+	// the linked account index only covers users that have the field
+	if len(user.LinkedAccounts) > 0 {
+		linked := make([]linkedDoc, 0, len(user.LinkedAccounts))
+		for _, l := range user.LinkedAccounts {
+			linked = append(linked, linkedDoc{l.Provider, l.Subject})
+		}
+		doc["linkedAccounts"] = linked
+	}
+	res, err := uc.c.InsertOne(ctx, doc)
 	if err != nil {
 		return nil, fmt.Errorf("mongo.Collection.InsertOne: %v", err)
 	}
+	// return the id as a string, the same as Read does
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		return oid.Hex(), nil
+	}
 	return res.InsertedID, nil
 }
+
+type refreshColl struct {
+	c *mongo.Collection
+}
+
+type refreshDoc struct {
+	Hash      string    `bson:"hash"`
+	UserID    string    `bson:"userId"`
+	Email     string    `bson:"email"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	Used      bool      `bson:"used"`
+}
+
+// CreateRefreshIndexes makes token hashes unique and lets mongo delete expired tokens
+func CreateRefreshIndexes(ctx context.Context, rc refreshColl) error {
+	return createTokenIndexes(ctx, rc.c)
+}
+
+// createTokenIndexes makes the hashes of tokens in c unique and lets mongo delete expired tokens
+func createTokenIndexes(ctx context.Context, c *mongo.Collection) error {
+	_, err := c.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.M{"hash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("mongo.IndexView.CreateMany: %v", err)
+	}
+	return nil
+}
+
+func (rc refreshColl) Create(ctx context.Context, token users.RefreshToken) error {
+	_, err := rc.c.InsertOne(ctx, refreshDoc{
+		Hash:      token.Hash,
+		UserID:    token.UserID,
+		Email:     token.Email,
+		ExpiresAt: token.ExpiresAt,
+		Used:      token.Used,
+	})
+	if err != nil {
+		return fmt.Errorf("mongo.Collection.InsertOne: %v", err)
+	}
+	return nil
+}
+
+func (rc refreshColl) Rotate(ctx context.Context, hash string) (*users.RefreshToken, error) {
+	filter := bson.M{"hash": hash, "used": false, "expiresAt": bson.M{"$gt": time.Now()}}
+	update := bson.M{"$set": bson.M{"used": true}}
+	var doc refreshDoc
+	err := rc.c.FindOneAndUpdate(ctx, filter, update).Decode(&doc)
+	if err == nil {
+		return &users.RefreshToken{
+			Hash:      doc.Hash,
+			UserID:    doc.UserID,
+			Email:     doc.Email,
+			ExpiresAt: doc.ExpiresAt,
+			Used:      true,
+		}, nil
+	} else if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("mongo.Collection.FindOneAndUpdate: %v", err)
+	}
+
+	// the token is unknown, expired or already used
+	// a used token being presented again means it may have leaked, so end all of the user's sessions
+	err = rc.c.FindOne(ctx, bson.M{"hash": hash, "used": true}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, users.ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, fmt.Errorf("mongo.Collection.FindOne: %v", err)
+	}
+	if _, err := rc.c.DeleteMany(ctx, bson.M{"userId": doc.UserID}); err != nil {
+		return nil, fmt.Errorf("mongo.Collection.DeleteMany: %v", err)
+	}
+	return nil, users.ErrRefreshTokenReused
+}
+
+func (rc refreshColl) Revoke(ctx context.Context, hash string) error {
+	if _, err := rc.c.DeleteOne(ctx, bson.M{"hash": hash}); err != nil {
+		return fmt.Errorf("mongo.Collection.DeleteOne: %v", err)
+	}
+	return nil
+}
+
+func (rc refreshColl) RevokeUser(ctx context.Context, userID string) error {
+	if _, err := rc.c.DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+		return fmt.Errorf("mongo.Collection.DeleteMany: %v", err)
+	}
+	return nil
+}
+
+type resetColl struct {
+	c *mongo.Collection
+}
+
+type resetDoc struct {
+	Hash      string    `bson:"hash"`
+	UserID    string    `bson:"userId"`
+	Email     string    `bson:"email"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// CreateResetIndexes makes token hashes unique and lets mongo delete expired tokens
+func CreateResetIndexes(ctx context.Context, rc resetColl) error {
+	return createTokenIndexes(ctx, rc.c)
+}
+
+func (rc resetColl) Create(ctx context.Context, reset users.PasswordReset) error {
+	_, err := rc.c.InsertOne(ctx, resetDoc{
+		Hash:      reset.Hash,
+		UserID:    reset.UserID,
+		Email:     reset.Email,
+		ExpiresAt: reset.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("mongo.Collection.InsertOne: %v", err)
+	}
+	return nil
+}
+
+// Consume deletes the token as it reads it so it can only be used once
+// mongo only removes expired tokens periodically, so the expiry is checked here too
+func (rc resetColl) Consume(ctx context.Context, hash string) (*users.PasswordReset, error) {
+	filter := bson.M{"hash": hash, "expiresAt": bson.M{"$gt": time.Now()}}
+	var doc resetDoc
+	err := rc.c.FindOneAndDelete(ctx, filter).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, users.ErrInvalidResetToken
+	} else if err != nil {
+		return nil, fmt.Errorf("mongo.Collection.FindOneAndDelete: %v", err)
+	}
+	return &users.PasswordReset{
+		Hash:      doc.Hash,
+		UserID:    doc.UserID,
+		Email:     doc.Email,
+		ExpiresAt: doc.ExpiresAt,
+	}, nil
+}
+
+func (rc resetColl) RevokeUser(ctx context.Context, userID string) error {
+	if _, err := rc.c.DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+		return fmt.Errorf("mongo.Collection.DeleteMany: %v", err)
+	}
+	return nil
+}
+
+type verifyColl struct {
+	c *mongo.Collection
+}
+
+type verifyDoc struct {
+	Hash      string    `bson:"hash"`
+	UserID    string    `bson:"userId"`
+	Email     string    `bson:"email"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// CreateVerifyIndexes makes token hashes unique and lets mongo delete expired tokens
+func CreateVerifyIndexes(ctx context.Context, vc verifyColl) error {
+	return createTokenIndexes(ctx, vc.c)
+}
+
+func (vc verifyColl) Create(ctx context.Context, verification users.EmailVerification) error {
+	_, err := vc.c.InsertOne(ctx, verifyDoc{
+		Hash:      verification.Hash,
+		UserID:    verification.UserID,
+		Email:     verification.Email,
+		ExpiresAt: verification.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("mongo.Collection.InsertOne: %v", err)
+	}
+	return nil
+}
+
+// Consume deletes the token as it reads it so it can only be used once
+func (vc verifyColl) Consume(ctx context.Context, hash string) (*users.EmailVerification, error) {
+	filter := bson.M{"hash": hash, "expiresAt": bson.M{"$gt": time.Now()}}
+	var doc verifyDoc
+	err := vc.c.FindOneAndDelete(ctx, filter).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, users.ErrInvalidVerificationToken
+	} else if err != nil {
+		return nil, fmt.Errorf("mongo.Collection.FindOneAndDelete: %v", err)
+	}
+	return &users.EmailVerification{
+		Hash:      doc.Hash,
+		UserID:    doc.UserID,
+		Email:     doc.Email,
+		ExpiresAt: doc.ExpiresAt,
+	}, nil
+}
+
+func (vc verifyColl) RevokeUser(ctx context.Context, userID string) error {
+	if _, err := vc.c.DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+		return fmt.Errorf("mongo.Collection.DeleteMany: %v", err)
+	}
+	return nil
+}
+
+type oidcStateColl struct {
+	c *mongo.Collection
+}
+
+type oidcStateDoc struct {
+	Hash      string    `bson:"hash"`
+	Provider  string    `bson:"provider"`
+	Verifier  string    `bson:"verifier"`
+	Nonce     string    `bson:"nonce"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// CreateOIDCStateIndexes makes state hashes unique and lets mongo delete abandoned sign ins
+func CreateOIDCStateIndexes(ctx context.Context, sc oidcStateColl) error {
+	return createTokenIndexes(ctx, sc.c)
+}
+
+func (sc oidcStateColl) Create(ctx context.Context, state oidcState) error {
+	_, err := sc.c.InsertOne(ctx, oidcStateDoc{
+		Hash:      state.Hash,
+		Provider:  state.Provider,
+		Verifier:  state.Verifier,
+		Nonce:     state.Nonce,
+		ExpiresAt: state.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("mongo.Collection.InsertOne: %v", err)
+	}
+	return nil
+}
+
+// Consume deletes the state as it reads it so each sign in can only be completed once
+func (sc oidcStateColl) Consume(ctx context.Context, hash string) (*oidcState, error) {
+	filter := bson.M{"hash": hash, "expiresAt": bson.M{"$gt": time.Now()}}
+	var doc oidcStateDoc
+	err := sc.c.FindOneAndDelete(ctx, filter).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, errInvalidOIDCState
+	} else if err != nil {
+		return nil, fmt.Errorf("mongo.Collection.FindOneAndDelete: %v", err)
+	}
+	return &oidcState{
+		Hash:      doc.Hash,
+		Provider:  doc.Provider,
+		Verifier:  doc.Verifier,
+		Nonce:     doc.Nonce,
+		ExpiresAt: doc.ExpiresAt,
+	}, nil
+}
+
+type mfaColl struct {
+	c *mongo.Collection
+}
+
+type mfaDoc struct {
+	Hash      string    `bson:"hash"`
+	UserID    string    `bson:"userId"`
+	Email     string    `bson:"email"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+func (d mfaDoc) challenge() *users.MFAChallenge {
+	return &users.MFAChallenge{
+		Hash:      d.Hash,
+		UserID:    d.UserID,
+		Email:     d.Email,
+		ExpiresAt: d.ExpiresAt,
+	}
+}
+
+// CreateMFAIndexes makes challenge hashes unique and lets mongo delete abandoned sign ins
+func CreateMFAIndexes(ctx context.Context, mc mfaColl) error {
+	return createTokenIndexes(ctx, mc.c)
+}
+
+func (mc mfaColl) Create(ctx context.Context, challenge users.MFAChallenge) error {
+	_, err := mc.c.InsertOne(ctx, mfaDoc{
+		Hash:      challenge.Hash,
+		UserID:    challenge.UserID,
+		Email:     challenge.Email,
+		ExpiresAt: challenge.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("mongo.Collection.InsertOne: %v", err)
+	}
+	return nil
+}
+
+func (mc mfaColl) Read(ctx context.Context, hash string) (*users.MFAChallenge, error) {
+	filter := bson.M{"hash": hash, "expiresAt": bson.M{"$gt": time.Now()}}
+	var doc mfaDoc
+	err := mc.c.FindOne(ctx, filter).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, users.ErrInvalidMFAChallenge
+	} else if err != nil {
+		return nil, fmt.Errorf("mongo.Collection.FindOne: %v", err)
+	}
+	return doc.challenge(), nil
+}
+
+// Consume deletes the challenge as it reads it so each challenge starts a single session
+func (mc mfaColl) Consume(ctx context.Context, hash string) (*users.MFAChallenge, error) {
+	filter := bson.M{"hash": hash, "expiresAt": bson.M{"$gt": time.Now()}}
+	var doc mfaDoc
+	err := mc.c.FindOneAndDelete(ctx, filter).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, users.ErrInvalidMFAChallenge
+	} else if err != nil {
+		return nil, fmt.Errorf("mongo.Collection.FindOneAndDelete: %v", err)
+	}
+	return doc.challenge(), nil
+}
+
+type attemptColl struct {
+	c *mongo.Collection
+}
+
+type attemptDoc struct {
+	Key         string    `bson:"key"`
+	Failures    int       `bson:"failures"`
+	LockedUntil time.Time `bson:"lockedUntil"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+// CreateAttemptIndexes makes keys unique and lets mongo delete records once their failures are forgotten
+func CreateAttemptIndexes(ctx context.Context, ac attemptColl) error {
+	_, err := ac.c.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.M{"key": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("mongo.IndexView.CreateMany: %v", err)
+	}
+	return nil
+}
+
+func (ac attemptColl) Get(ctx context.Context, key string) (loginAttempts, error) {
+	var doc attemptDoc
+	err := ac.c.FindOne(ctx, bson.M{"key": key, "expiresAt": bson.M{"$gt": time.Now()}}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return loginAttempts{}, nil
+	} else if err != nil {
+		return loginAttempts{}, fmt.Errorf("mongo.Collection.FindOne: %v", err)
+	}
+	return loginAttempts{doc.Failures, doc.LockedUntil}, nil
+}
+
+// Fail counts the failure atomically so concurrent sign ins cannot lose failures
+func (ac attemptColl) Fail(ctx context.Context, key string, expiresAt time.Time) (loginAttempts, error) {
+	update := bson.M{"$inc": bson.M{"failures": 1}, "$max": bson.M{"expiresAt": expiresAt}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var doc attemptDoc
+	if err := ac.c.FindOneAndUpdate(ctx, bson.M{"key": key}, update, opts).Decode(&doc); err != nil {
+		return loginAttempts{}, fmt.Errorf("mongo.Collection.FindOneAndUpdate: %v", err)
+	}
+	return loginAttempts{doc.Failures, doc.LockedUntil}, nil
+}
+
+// Lock keeps the record at least until the lockout ends
+func (ac attemptColl) Lock(ctx context.Context, key string, until time.Time) error {
+	update := bson.M{"$max": bson.M{"lockedUntil": until, "expiresAt": until}}
+	if _, err := ac.c.UpdateOne(ctx, bson.M{"key": key}, update); err != nil {
+		return fmt.Errorf("mongo.Collection.UpdateOne: %v", err)
+	}
+	return nil
+}
+
+func (ac attemptColl) Reset(ctx context.Context, key string) error {
+	if _, err := ac.c.DeleteOne(ctx, bson.M{"key": key}); err != nil {
+		return fmt.Errorf("mongo.Collection.DeleteOne: %v", err)
+	}
+	return nil
+}
+
+// revokedColl holds revoked tokens in c and revoked users in users
+type revokedColl struct {
+	c     *mongo.Collection
+	users *mongo.Collection
+}
+
+// CreateRevokedIndexes lets mongo delete revoked tokens and users once their tokens expire
+func CreateRevokedIndexes(ctx context.Context, rc revokedColl) error {
+	for key, c := range map[string]*mongo.Collection{"jti": rc.c, "userId": rc.users} {
+		_, err := c.Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{
+				Keys:    bson.M{key: 1},
+				Options: options.Index().SetUnique(true),
+			},
+			{
+				Keys:    bson.M{"expiresAt": 1},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("mongo.IndexView.CreateMany: %v", err)
+		}
+	}
+	return nil
+}
+
+// Revoke is idempotent, revoking a token twice keeps a single record
+func (rc revokedColl) Revoke(ctx context.Context, tokenId string, expiresAt time.Time) error {
+	filter := bson.M{"jti": tokenId}
+	update := bson.M{"$set": bson.M{"jti": tokenId, "expiresAt": expiresAt}}
+	if _, err := rc.c.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("mongo.Collection.UpdateOne: %v", err)
+	}
+	return nil
+}
+
+func (rc revokedColl) IsRevoked(ctx context.Context, tokenId string) (bool, error) {
+	count, err := rc.c.CountDocuments(ctx, bson.M{"jti": tokenId})
+	if err != nil {
+		return false, fmt.Errorf("mongo.Collection.CountDocuments: %v", err)
+	}
+	return count > 0, nil
+}
+
+// RevokeUser only ever moves issuedBefore and expiresAt later, so an older revocation cannot undo a newer one
+func (rc revokedColl) RevokeUser(ctx context.Context, userID string, issuedBefore, expiresAt time.Time) error {
+	filter := bson.M{"userId": userID}
+	update := bson.M{"$max": bson.M{"issuedBefore": issuedBefore, "expiresAt": expiresAt}}
+	if _, err := rc.users.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("mongo.Collection.UpdateOne: %v", err)
+	}
+	return nil
+}
+
+func (rc revokedColl) IsUserRevoked(ctx context.Context, userID string, issuedAt time.Time) (bool, error) {
+	count, err := rc.users.CountDocuments(ctx, bson.M{"userId": userID, "issuedBefore": bson.M{"$gt": issuedAt}})
+	if err != nil {
+		return false, fmt.Errorf("mongo.Collection.CountDocuments: %v", err)
+	}
+	return count > 0, nil
+}
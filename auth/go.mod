@@ -3,8 +3,8 @@ module github.com/basilnsage/mwn-ticketapp/auth
 go 1.15
 
 require (
-	github.com/basilnsage/mwn-ticketapp v0.0.0-20210213022547-49939b26690d
-	github.com/basilnsage/mwn-ticketapp-common v0.0.0-20210213203911-36eaa69cc2d3
+	github.com/basilnsage/mwn-ticketapp-common v0.0.0-00010101000000-000000000000
+	github.com/basilnsage/mwn-ticketapp/middleware v0.0.0-00010101000000-000000000000
 	github.com/basilnsage/prometheus-gin-metrics v0.1.0-alpha
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gin-contrib/cors v1.3.1
@@ -12,8 +12,19 @@ require (
 	github.com/go-playground/validator v9.31.0+incompatible
 	github.com/golang/protobuf v1.4.3
 	github.com/google/go-cmp v0.5.2
+	github.com/nats-io/nats.go v1.10.0
+	github.com/nats-io/stan.go v0.8.1
+	github.com/prometheus/client_golang v1.8.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.14.0
 	github.com/stretchr/testify v1.6.1
 	go.mongodb.org/mongo-driver v1.3.5
 	golang.org/x/crypto v0.0.0-20201016220609-9e8e0b390897
 	golang.org/x/sys v0.0.0-20201024232916-9f70ab9862d5 // indirect
+	google.golang.org/protobuf v1.25.0
+)
+
+replace (
+	github.com/basilnsage/mwn-ticketapp-common => ../common
+	github.com/basilnsage/mwn-ticketapp/middleware => ../middleware
 )
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publishes the public keys other services use to verify session tokens
+// verifiers cache the keys, so a new key may take up to max-age to be picked up
+func JWKS(ctx *gin.Context, validator *middleware.JWTValidator) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, validator.JWKS())
+}
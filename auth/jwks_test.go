@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func TestJWKS(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKCS8PrivateKey: %v", err)
+	}
+	v, err := middleware.NewPrivateKeyValidator(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), "EdDSA")
+	if err != nil {
+		t.Fatalf("middleware.NewPrivateKeyValidator: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	eng := gin.New()
+	eng.GET("/test", func(ctx *gin.Context) {
+		JWKS(ctx, v)
+	})
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/test", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %v", err)
+	}
+	eng.ServeHTTP(w, req)
+
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("wrong response code: %v, want: %v", got, want)
+	}
+	var jwks middleware.JWKS
+	if err := json.Unmarshal(w.Body.Bytes(), &jwks); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if got, want := len(jwks.Keys), 1; got != want {
+		t.Fatalf("wrong number of keys: %v, want: %v", got, want)
+	}
+	if got, want := jwks.Keys[0], v.JWKS().Keys[0]; got != want {
+		t.Errorf("wrong key: %v, want: %v", got, want)
+	}
+}
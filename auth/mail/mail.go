@@ -0,0 +1,45 @@
+// Package mail sends email to users
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages to users
+type Mailer interface {
+	Send(context.Context, Message) error
+}
+
+// LogMailer is a Mailer for local development that never sends anything
+// messages are logged and, if Dir is set, also written to a file in Dir so links can be followed
+type LogMailer struct {
+	Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+func (m LogMailer) Send(_ context.Context, msg Message) error {
+	log.Printf("mail to %v: %v\n%v", msg.To, msg.Subject, msg.Body)
+	if m.Dir == "" {
+		return nil
+	}
+	name := fmt.Sprintf("%d-%s.txt", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	data := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+	if err := ioutil.WriteFile(filepath.Join(m.Dir, name), []byte(data), 0600); err != nil {
+		return fmt.Errorf("unable to write mail: %v", err)
+	}
+	return nil
+}
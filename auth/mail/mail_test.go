@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := LogMailer{Dir: dir}
+	msg := Message{To: "foo/../bar@example.com", Subject: "hello", Body: "follow this link"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("unexpected error sending mail: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("wrong mail files: %v, %v, want 1 file", files, err)
+	}
+	if name := filepath.Base(files[0]); strings.Contains(name, "/") || !strings.HasSuffix(name, "-foo_.._bar@example.com.txt") {
+		t.Errorf("unsafe mail file name: %v", name)
+	}
+	data, _ := ioutil.ReadFile(files[0])
+	if got, want := string(data), "To: foo/../bar@example.com\nSubject: hello\n\nfollow this link\n"; got != want {
+		t.Errorf("wrong mail: %q, want %q", got, want)
+	}
+
+	// without a dir messages are only logged
+	if err := (LogMailer{}).Send(context.Background(), msg); err != nil {
+		t.Errorf("unexpected error logging mail: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	prometrics "github.com/basilnsage/prometheus-gin-metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// metricsHandler serves the metrics of the prometrics registry together with those registered with reg
+// prometrics cannot register other collectors, so its metrics are gathered by reading its handler's text output
+func metricsHandler(metricReg *prometrics.Registry, reg prometheus.Gatherer) gin.HandlerFunc {
+	prometricsGatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		w := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(w)
+		// without an Accept header the metrics are written in the plain text format
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			return nil, err
+		}
+		ginCtx.Request = req
+		metricReg.DefaultHandler(ginCtx)
+		if w.Code != http.StatusOK {
+			return nil, fmt.Errorf("prometrics handler returned %v", w.Code)
+		}
+
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(w.Body)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse prometrics metrics: %v", err)
+		}
+		gathered := make([]*dto.MetricFamily, 0, len(families))
+		for _, mf := range families {
+			gathered = append(gathered, mf)
+		}
+		return gathered, nil
+	})
+	handler := promhttp.HandlerFor(prometheus.Gatherers{prometricsGatherer, reg}, promhttp.HandlerOpts{})
+	return gin.WrapH(handler)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// errUnsupportedMediaType is returned by bind for bodies that are not JSON, a form or protobuf
+var errUnsupportedMediaType = errors.New("unsupported content type")
+
+const unsupportedMediaTypeMsg = "please send JSON, a form or protobuf"
+
+// protoBinder is implemented by request bodies that internal clients send as a message of their own
+type protoBinder interface {
+	bindProto(data []byte) error
+}
+
+// bind decodes the request body into obj by its Content-Type, and validates it
+// bodies without a Content-Type are read as JSON, as they were before other encodings were accepted
+// protobuf bodies are decoded by obj's bindProto if it has one, otherwise they are a google.protobuf.Struct
+// with the same field names as the JSON body
+func bind(ginCtx *gin.Context, obj interface{}) error {
+	switch ginCtx.ContentType() {
+	case "", binding.MIMEJSON:
+		return ginCtx.ShouldBindWith(obj, binding.JSON)
+	case binding.MIMEPOSTForm:
+		return ginCtx.ShouldBindWith(obj, binding.Form)
+	case binding.MIMEMultipartPOSTForm:
+		return ginCtx.ShouldBindWith(obj, binding.FormMultipart)
+	case binding.MIMEPROTOBUF:
+		data, err := ginCtx.GetRawData()
+		if err != nil {
+			return err
+		}
+		if p, ok := obj.(protoBinder); ok {
+			err = p.bindProto(data)
+		} else {
+			err = bindStruct(data, obj)
+		}
+		if err != nil {
+			return err
+		}
+		return binding.Validator.ValidateStruct(obj)
+	default:
+		return errUnsupportedMediaType
+	}
+}
+
+func bindStruct(data []byte, obj interface{}) error {
+	s := new(structpb.Struct)
+	if err := proto.Unmarshal(data, s); err != nil {
+		return fmt.Errorf("proto.Unmarshal: %v", err)
+	}
+	fields, err := json.Marshal(s.AsMap())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(fields, obj)
+}
+
+// bindError responds to a body bind could not decode, msg tells the client what the body needs
+func bindError(ginCtx *gin.Context, err error, msg string) {
+	problem.Abort(ginCtx, bindProblem(err, msg))
+}
+
+// bindProblem is the problem with a body bind could not decode
+func bindProblem(err error, msg string) *problem.Error {
+	if err == errUnsupportedMediaType {
+		return problem.New(http.StatusUnsupportedMediaType, codeUnsupportedMediaType, unsupportedMediaTypeMsg).WithCause(err)
+	}
+	return problem.Validation(problem.CodeValidation, msg).WithCause(err)
+}
+
+// render responds with obj as JSON, or as protobuf to clients that ask for it before JSON in Accept
+// objects are sent as a google.protobuf.Struct and anything else as a google.protobuf.Value,
+// with the same field names as the JSON
+func render(ginCtx *gin.Context, code int, obj interface{}) {
+	if ginCtx.NegotiateFormat(binding.MIMEJSON, binding.MIMEPROTOBUF) != binding.MIMEPROTOBUF {
+		ginCtx.JSON(code, obj)
+		return
+	}
+	msg, err := toProto(obj)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to encode response", err))
+		return
+	}
+	ginCtx.ProtoBuf(code, msg)
+}
+
+func toProto(obj interface{}) (proto.Message, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var fields interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	v, err := structpb.NewValue(fields)
+	if err != nil {
+		return nil, err
+	}
+	if s := v.GetStructValue(); s != nil {
+		return s, nil
+	}
+	return v, nil
+}
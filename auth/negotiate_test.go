@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// negotiateEngine echoes the bodies it binds, rendered for the client
+func negotiateEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	eng := gin.New()
+	eng.Use(problem.Handler())
+	eng.POST("/credentials", func(ginCtx *gin.Context) {
+		data := new(userFormData)
+		if err := bind(ginCtx, data); err != nil {
+			bindError(ginCtx, err, "please provide a username and password")
+			return
+		}
+		render(ginCtx, http.StatusOK, data)
+	})
+	eng.POST("/forgot", func(ginCtx *gin.Context) {
+		data := new(forgotPasswordData)
+		if err := bind(ginCtx, data); err != nil {
+			bindError(ginCtx, err, "please provide an email")
+			return
+		}
+		render(ginCtx, http.StatusOK, data)
+	})
+	eng.GET("/whoami", func(ginCtx *gin.Context) {
+		render(ginCtx, http.StatusOK, gin.H{"email": email, "roles": []string{"buyer", "seller"}, "unverified": nil})
+	})
+	return eng
+}
+
+func mustMarshalProto(t *testing.T, msg proto.Message) []byte {
+	t.Helper()
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+	return data
+}
+
+func TestBind(t *testing.T) {
+	jsonBody, err := json.Marshal(gin.H{"username": email, "password": pass})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	formBody := url.Values{"username": {email}, "password": {pass}}.Encode()
+	emailStruct, err := structpb.NewStruct(map[string]interface{}{"email": email})
+	if err != nil {
+		t.Fatalf("structpb.NewStruct: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        []byte
+		// expectedCode is the response's status, on success the bound body is echoed back as JSON
+		expectedCode int
+		expectedBody string
+	}{
+		{"json", "/credentials", binding.MIMEJSON, jsonBody, http.StatusOK, `{"username":"foo@example.com","password":"password"}`},
+		{"json without content type", "/credentials", "", jsonBody, http.StatusOK, `{"username":"foo@example.com","password":"password"}`},
+		{"json with charset", "/credentials", "application/json; charset=utf-8", jsonBody, http.StatusOK, `{"username":"foo@example.com","password":"password"}`},
+		{"json missing password", "/credentials", binding.MIMEJSON, []byte(`{"username":"foo@example.com"}`), http.StatusBadRequest, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"please provide a username and password","instance":"/credentials","code":"validation_failed"}`},
+		{"form", "/credentials", binding.MIMEPOSTForm, []byte(formBody), http.StatusOK, `{"username":"foo@example.com","password":"password"}`},
+		{"form missing password", "/credentials", binding.MIMEPOSTForm, []byte("username=foo%40example.com"), http.StatusBadRequest, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"please provide a username and password","instance":"/credentials","code":"validation_failed"}`},
+		{"protobuf sign in", "/credentials", binding.MIMEPROTOBUF, mustMarshalProto(t, &events.SignIn{Username: email, Password: pass}), http.StatusOK, `{"username":"foo@example.com","password":"password"}`},
+		{"protobuf sign in missing password", "/credentials", binding.MIMEPROTOBUF, mustMarshalProto(t, &events.SignIn{Username: email}), http.StatusBadRequest, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"please provide a username and password","instance":"/credentials","code":"validation_failed"}`},
+		{"malformed protobuf", "/credentials", binding.MIMEPROTOBUF, []byte("not protobuf"), http.StatusBadRequest, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"please provide a username and password","instance":"/credentials","code":"validation_failed"}`},
+		{"protobuf struct", "/forgot", binding.MIMEPROTOBUF, mustMarshalProto(t, emailStruct), http.StatusOK, `{"email":"foo@example.com"}`},
+		{"protobuf struct missing email", "/forgot", binding.MIMEPROTOBUF, mustMarshalProto(t, new(structpb.Struct)), http.StatusBadRequest, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"please provide an email","instance":"/forgot","code":"validation_failed"}`},
+		{"unsupported content type", "/credentials", "text/plain", jsonBody, http.StatusUnsupportedMediaType, `{"type":"about:blank","title":"Unsupported Media Type","status":415,"detail":"please send JSON, a form or protobuf","instance":"/credentials","code":"unsupported_media_type"}`},
+	}
+	eng := negotiateEngine()
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			eng.ServeHTTP(w, req)
+			if got, want := w.Code, tt.expectedCode; got != want {
+				currTest.Errorf("wrong status code: %v, want %v", got, want)
+			}
+			if got, want := w.Body.String(), tt.expectedBody; got != want {
+				currTest.Errorf("wrong body: %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	want := map[string]interface{}{"email": email, "roles": []interface{}{"buyer", "seller"}, "unverified": nil}
+	tests := []struct {
+		name   string
+		accept string
+		// expectedType is the response's Content-Type, protobuf responses are a google.protobuf.Struct
+		expectedType string
+	}{
+		{"no accept", "", "application/json; charset=utf-8"},
+		{"anything", "*/*", "application/json; charset=utf-8"},
+		{"json", binding.MIMEJSON, "application/json; charset=utf-8"},
+		{"protobuf", binding.MIMEPROTOBUF, binding.MIMEPROTOBUF},
+		{"protobuf first", binding.MIMEPROTOBUF + ", " + binding.MIMEJSON, binding.MIMEPROTOBUF},
+		{"unsupported", "text/html", "application/json; charset=utf-8"},
+	}
+	eng := negotiateEngine()
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			eng.ServeHTTP(w, req)
+			if got, want := w.Code, http.StatusOK; got != want {
+				currTest.Fatalf("wrong status code: %v, want %v", got, want)
+			}
+			if got, want := w.Header().Get("Content-Type"), tt.expectedType; got != want {
+				currTest.Fatalf("wrong content type: %v, want %v", got, want)
+			}
+
+			var got map[string]interface{}
+			if tt.expectedType == binding.MIMEPROTOBUF {
+				s := new(structpb.Struct)
+				if err := proto.Unmarshal(w.Body.Bytes(), s); err != nil {
+					currTest.Fatalf("proto.Unmarshal: %v", err)
+				}
+				got = s.AsMap()
+			} else if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				currTest.Fatalf("json.Unmarshal: %v", err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				currTest.Errorf("wrong body (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
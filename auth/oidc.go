@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/oidc"
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// oidcStateTTL is how long users have to sign in with the provider
+	oidcStateTTL = 10 * time.Minute
+	// oidcStateCookie ties the callback to the browser that started the sign in
+	oidcStateCookie = "oidc-state"
+	oidcRoutePrefix = "/api/users/oidc/"
+)
+
+var (
+	// errInvalidOIDCState is returned for unknown, expired and already used sign in states
+	errInvalidOIDCState = errors.New("sign in state is invalid or expired")
+	errOIDCNoEmail      = errors.New("provider did not share an email")
+	errOIDCEmailTaken   = errors.New("email belongs to another user")
+)
+
+// oidcState is what is kept between sending a user to a provider and the provider sending them back
+// only the hash of the state is stored, the state itself is in the query and the state cookie
+type oidcState struct {
+	Hash      string
+	Provider  string
+	Verifier  string
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+type oidcStateStore interface {
+	Create(context.Context, oidcState) error
+	// Consume deletes an unexpired state and returns it, other states return errInvalidOIDCState
+	Consume(context.Context, string) (*oidcState, error)
+}
+
+func hashOIDCState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadOIDCProviders reads a JSON list of oidc.Config from path
+// providers without a redirect url are called back on their callback route under appURL
+func loadOIDCProviders(path, appURL string) (map[string]*oidc.Provider, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []oidc.Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("could not parse providers: %v", err)
+	}
+	providers := make(map[string]*oidc.Provider, len(configs))
+	for _, config := range configs {
+		if _, ok := providers[config.Name]; ok {
+			return nil, fmt.Errorf("provider %q is configured twice", config.Name)
+		}
+		if config.RedirectURL == "" {
+			config.RedirectURL = strings.TrimSuffix(appURL, "/") + oidcRoutePrefix + config.Name + "/callback"
+		}
+		provider, err := oidc.NewProvider(config)
+		if err != nil {
+			return nil, err
+		}
+		providers[config.Name] = provider
+	}
+	return providers, nil
+}
+
+// oidcLogin signs users in with OpenID Connect providers and issues them the same session as signing in with a password
+// provider accounts are linked to users by the provider's subject, and to existing users by email if the provider verified it
+type oidcLogin struct {
+	providers     map[string]*oidc.Provider
+	states        oidcStateStore
+	crud          users.CRUD
+	linked        users.LinkedAccountStore
+	signer        users.Signer
+	refreshTokens users.RefreshStore
+	verifier      *emailVerifier
+	twoFactor     *twoFactor
+	// appURL is where users are sent once they have signed in
+	appURL string
+}
+
+func (o *oidcLogin) provider(ginCtx *gin.Context) (*oidc.Provider, bool) {
+	provider, ok := o.providers[ginCtx.Param("provider")]
+	if !ok {
+		problem.Abort(ginCtx, problem.NotFound(codeUnknownProvider, "unknown provider").WithCause(errors.New("unknown provider")))
+	}
+	return provider, ok
+}
+
+// Start sends the user to the provider to sign in
+func (o *oidcLogin) Start(ctx context.Context, ginCtx *gin.Context) {
+	provider, ok := o.provider(ginCtx)
+	if !ok {
+		return
+	}
+
+	state, verifier, nonce, challenge, err := newOIDCParams()
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+		return
+	}
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		problem.Abort(ginCtx, problem.New(http.StatusBadGateway, codeProviderUnavailable, "unable to reach provider").WithCause(err))
+		return
+	}
+	record := oidcState{
+		Hash:      hashOIDCState(state),
+		Provider:  provider.Name(),
+		Verifier:  verifier,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(oidcStateTTL),
+	}
+	if err := o.states.Create(ctx, record); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+		return
+	}
+
+	ginCtx.SetCookie(oidcStateCookie, state, int(oidcStateTTL.Seconds()), oidcRoutePrefix+provider.Name(), "", false, true)
+	ginCtx.Redirect(http.StatusFound, authURL)
+}
+
+func newOIDCParams() (state, verifier, nonce, challenge string, err error) {
+	if state, err = oidc.RandomString(); err != nil {
+		return
+	}
+	if nonce, err = oidc.RandomString(); err != nil {
+		return
+	}
+	verifier, challenge, err = oidc.NewPKCE()
+	return
+}
+
+// Callback finishes signing in once the provider sends the user back
+func (o *oidcLogin) Callback(ctx context.Context, ginCtx *gin.Context) {
+	provider, ok := o.provider(ginCtx)
+	if !ok {
+		return
+	}
+	// the state is single use whatever happens next
+	cookieState, _ := ginCtx.Cookie(oidcStateCookie)
+	ginCtx.SetCookie(oidcStateCookie, "", -1, oidcRoutePrefix+provider.Name(), "", false, true)
+
+	if providerErr := ginCtx.Query("error"); providerErr != "" {
+		problem.Abort(ginCtx, problem.Unauthorized(codeProviderSignInFailed, "sign in with provider failed").WithCause(fmt.Errorf("provider returned %v", providerErr)))
+		return
+	}
+	// a state that did not come from this browser could sign the user in to someone else's account
+	queryState := ginCtx.Query("state")
+	if queryState == "" || queryState != cookieState {
+		problem.Abort(ginCtx, problem.Validation(codeInvalidSignInState, "sign in state is invalid or expired").WithCause(errors.New("state does not match the state cookie")))
+		return
+	}
+	state, err := o.states.Consume(ctx, hashOIDCState(queryState))
+	if err == nil && state.Provider != provider.Name() {
+		err = errInvalidOIDCState
+	}
+	if err == errInvalidOIDCState {
+		problem.Abort(ginCtx, problem.Validation(codeInvalidSignInState, "sign in state is invalid or expired").WithCause(err))
+		return
+	} else if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+		return
+	}
+
+	idToken, err := provider.Exchange(ctx, ginCtx.Query("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Unauthorized(codeProviderSignInFailed, "sign in with provider failed").WithCause(err))
+		return
+	}
+
+	user, err := o.user(ctx, users.LinkedAccount{Provider: provider.Name(), Subject: idToken.Subject}, idToken)
+	if err == errOIDCNoEmail {
+		problem.Abort(ginCtx, problem.Validation(codeProviderNoEmail, "provider did not share an email").WithCause(err))
+		return
+	} else if err == errOIDCEmailTaken {
+		problem.Abort(ginCtx, problem.Conflict(codeEmailInUse, "email is in use, sign in with your password").WithCause(err))
+		return
+	} else if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+		return
+	}
+
+	// users with an authenticator finish signing in on the two-factor page
+	if user.TOTPEnabled {
+		if err := user.CanSignIn(); err != nil {
+			sessionError(ginCtx, err)
+			return
+		}
+		if err := o.twoFactor.challenge(ctx, ginCtx, *user); err != nil {
+			problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+			return
+		}
+		ginCtx.Redirect(http.StatusFound, strings.TrimSuffix(o.appURL, "/")+"/auth/two-factor")
+		return
+	}
+
+	// the user is read again as the session is created, which rejects users that cannot sign in
+	userJWT, refreshToken, err := users.User{Email: user.Email}.CreateSession(ctx, o.crud, o.signer, o.refreshTokens)
+	if err != nil {
+		sessionError(ginCtx, err)
+		return
+	}
+	setSessionCookies(ginCtx, userJWT, refreshToken)
+	ginCtx.Redirect(http.StatusFound, o.appURL)
+}
+
+// user finds the user linked to the provider account, linking or creating one the first time the account is used
+// an existing user is only linked if both the provider and the user verified the email
+// otherwise anyone could claim the account, or sign up first and keep a password to the account the owner links later
+func (o *oidcLogin) user(ctx context.Context, account users.LinkedAccount, idToken *oidc.IDToken) (*users.User, error) {
+	user, err := o.linked.ReadLinked(ctx, account)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read linked user: %v", err)
+	} else if user != nil {
+		return user, nil
+	}
+
+	if idToken.Email == "" {
+		return nil, errOIDCNoEmail
+	}
+	found, err := o.crud.Read(ctx, users.User{Email: idToken.Email})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch users from DB: %v", err)
+	}
+	if len(found) > 0 {
+		if !idToken.EmailVerified || found[0].Unverified {
+			return nil, errOIDCEmailTaken
+		}
+		if _, err := o.linked.Link(ctx, fmt.Sprint(found[0].Uid), account); err != nil {
+			return nil, fmt.Errorf("unable to link user: %v", err)
+		}
+		return &found[0], nil
+	}
+
+	user, err = users.NewLinkedUser(idToken.Email, account, idToken.EmailVerified)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := user.Write(ctx, o.crud)
+	if err != nil {
+		return nil, err
+	}
+	// the user can still sign in without the link and ask for another one
+	if user.Unverified {
+		if err := o.verifier.Send(ctx, user.Email, fmt.Sprint(uid)); err != nil {
+			log.Printf("unable to send email verification: %v", err)
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,269 @@
+// Package oidc signs users in with OpenID Connect providers
+// it implements the relying party side of the authorization code flow with PKCE
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+)
+
+const (
+	// keyRefresh is how long the provider's signing keys are cached for
+	keyRefresh = time.Hour
+	// providers are called while the user waits on the callback, so give up quickly
+	requestTimeout = 10 * time.Second
+)
+
+// Config describes a provider and how this service is registered with it
+type Config struct {
+	// Name identifies the provider in routes, such as google
+	Name   string `json:"name"`
+	Issuer string `json:"issuer"`
+	// ClientSecret is empty for public clients, PKCE protects the code either way
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	// RedirectURL is the callback route registered with the provider
+	RedirectURL string `json:"redirectUrl"`
+}
+
+// IDToken holds the verified claims of an ID token
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// discovery is the part of the provider's metadata the flow needs
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider users can sign in with
+// its metadata is discovered on first use, so the service can start while the provider is unreachable
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	endpoints *discovery
+	keys      *middleware.JWTValidator
+}
+
+func NewProvider(config Config) (*Provider, error) {
+	if config.Name == "" || config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("providers need a name, issuer, client id and redirect url")
+	}
+	return &Provider{config: config, client: &http.Client{Timeout: requestTimeout}}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// discover fetches and caches the provider's metadata, failures are retried on the next call
+func (p *Provider) discover(ctx context.Context) (*discovery, *middleware.JWTValidator, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints != nil {
+		return p.endpoints, p.keys, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var d discovery
+	if err := p.do(req, &d); err != nil {
+		return nil, nil, fmt.Errorf("could not discover provider: %v", err)
+	}
+	// the metadata must be for the issuer that was configured, or ID tokens could come from anyone
+	if d.Issuer != p.config.Issuer {
+		return nil, nil, fmt.Errorf("provider issuer %q does not match %q", d.Issuer, p.config.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, nil, errors.New("provider metadata is missing endpoints")
+	}
+	p.endpoints = &d
+	p.keys = middleware.NewJWKSValidator(d.JWKSURI, keyRefresh)
+	return p.endpoints, p.keys, nil
+}
+
+// AuthCodeURL is where the user is sent to sign in with the provider
+// state and nonce must be random and kept until the callback, challenge comes from NewPKCE
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	endpoints, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	authURL, err := url.Parse(endpoints.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %v", err)
+	}
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", "openid email")
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	authURL.RawQuery = q.Encode()
+	return authURL.String(), nil
+}
+
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+}
+
+// Exchange trades the code from the callback for an ID token and verifies it
+// verifier is the PKCE verifier and nonce the nonce that were used for AuthCodeURL
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*IDToken, error) {
+	endpoints, keys, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	var token tokenResponse
+	if err := p.do(req, &token); err != nil {
+		return nil, fmt.Errorf("could not exchange code: %v", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("provider did not return an ID token")
+	}
+
+	claims := new(idTokenClaims)
+	if _, err := keys.ParseWithClaims(token.IDToken, claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+	switch {
+	case claims.Issuer != endpoints.Issuer:
+		return nil, fmt.Errorf("ID token was issued by %q", claims.Issuer)
+	case !claims.Audience.contains(p.config.ClientID):
+		return nil, errors.New("ID token was issued to another client")
+	case claims.Nonce != nonce:
+		return nil, errors.New("ID token nonce does not match")
+	case claims.Subject == "":
+		return nil, errors.New("ID token has no subject")
+	}
+	return &IDToken{claims.Issuer, claims.Subject, claims.Email, claims.EmailVerified}, nil
+}
+
+// do sends req and decodes the JSON response into v
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %v: %s", resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, v)
+}
+
+type idTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+}
+
+func (c idTokenClaims) Valid() error {
+	if c.ExpiresAt == 0 {
+		return errors.New("ID token does not expire")
+	}
+	if time.Now().Unix() >= c.ExpiresAt {
+		return errors.New("ID token is expired")
+	}
+	return nil
+}
+
+// audience is a single client id or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPKCE returns a random code verifier and its S256 challenge
+func NewPKCE() (string, string, error) {
+	verifier, err := RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, Challenge(verifier), nil
+}
+
+// Challenge is the S256 code challenge for verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomString returns 32 random bytes encoded for use in URLs, for states, nonces and verifiers
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("rand.Read: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
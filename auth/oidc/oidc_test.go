@@ -0,0 +1,155 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/oidc"
+	"github.com/basilnsage/mwn-ticketapp/auth/oidc/oidctest"
+)
+
+const redirectURL = "http://tickets.test/api/users/oidc/stub/callback"
+
+// signIn runs the flow up to the callback and returns the code and state the provider sent back
+func signIn(t *testing.T, stub *oidctest.Provider, provider *oidc.Provider, challenge string) (string, string) {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), "some-state", "some-nonce", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	callback, err := stub.SignIn(authURL)
+	if err != nil {
+		t.Fatalf("unable to sign in with the provider: %v", err)
+	}
+	if got, want := callback.Scheme+"://"+callback.Host+callback.Path, redirectURL; got != want {
+		t.Fatalf("redirected to %v, want %v", got, want)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+	user := oidctest.User{Subject: "1234", Email: "foo@example.com", EmailVerified: true}
+	stub, err := oidctest.NewProvider(user)
+	if err != nil {
+		t.Fatalf("oidctest.NewProvider: %v", err)
+	}
+	defer stub.Close()
+	provider, err := oidc.NewProvider(stub.Config("stub", redirectURL))
+	if err != nil {
+		t.Fatalf("oidc.NewProvider: %v", err)
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	code, state := signIn(t, stub, provider, challenge)
+	if got, want := state, "some-state"; got != want {
+		t.Errorf("wrong state: %v, want %v", got, want)
+	}
+	idToken, err := provider.Exchange(context.Background(), code, verifier, "some-nonce")
+	if err != nil {
+		t.Fatalf("unexpected error exchanging code: %v", err)
+	}
+	want := oidc.IDToken{Issuer: stub.URL, Subject: user.Subject, Email: user.Email, EmailVerified: true}
+	if *idToken != want {
+		t.Errorf("wrong ID token: %+v, want %+v", *idToken, want)
+	}
+
+	// codes can only be used once
+	if _, err := provider.Exchange(context.Background(), code, verifier, "some-nonce"); err == nil {
+		t.Error("a code was exchanged twice")
+	}
+}
+
+func TestExchangeRejected(t *testing.T) {
+	stub, err := oidctest.NewProvider(oidctest.User{Subject: "1234", Email: "foo@example.com"})
+	if err != nil {
+		t.Fatalf("oidctest.NewProvider: %v", err)
+	}
+	defer stub.Close()
+
+	tests := []struct {
+		name     string
+		config   func(oidc.Config) oidc.Config
+		verifier func(string) string
+		nonce    string
+	}{
+		{"wrong verifier", nil, func(string) string { return "not-the-verifier" }, "some-nonce"},
+		{"wrong nonce", nil, nil, "another-nonce"},
+		{"wrong client secret", func(c oidc.Config) oidc.Config { c.ClientSecret = "wrong"; return c }, nil, "some-nonce"},
+		{"wrong issuer", func(c oidc.Config) oidc.Config { c.Issuer += "/"; return c }, nil, "some-nonce"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			config := stub.Config("stub", redirectURL)
+			if tt.config != nil {
+				config = tt.config(config)
+			}
+			provider, err := oidc.NewProvider(config)
+			if err != nil {
+				currTest.Fatalf("oidc.NewProvider: %v", err)
+			}
+			verifier, challenge, err := oidc.NewPKCE()
+			if err != nil {
+				currTest.Fatalf("NewPKCE: %v", err)
+			}
+
+			authURL, err := provider.AuthCodeURL(context.Background(), "some-state", "some-nonce", challenge)
+			if err != nil {
+				// a provider that cannot be discovered cannot be signed in with
+				return
+			}
+			callback, err := stub.SignIn(authURL)
+			if err != nil {
+				currTest.Fatalf("unable to sign in with the provider: %v", err)
+			}
+			if tt.verifier != nil {
+				verifier = tt.verifier(verifier)
+			}
+			if _, err := provider.Exchange(context.Background(), callback.Query().Get("code"), verifier, tt.nonce); err == nil {
+				currTest.Error("expected the exchange to fail")
+			}
+		})
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	stub, err := oidctest.NewProvider(oidctest.User{Subject: "1234"})
+	if err != nil {
+		t.Fatalf("oidctest.NewProvider: %v", err)
+	}
+	defer stub.Close()
+	provider, err := oidc.NewProvider(stub.Config("stub", redirectURL))
+	if err != nil {
+		t.Fatalf("oidc.NewProvider: %v", err)
+	}
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "some-state", "some-nonce", oidc.Challenge("verifier"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             oidctest.ClientID,
+		"redirect_uri":          redirectURL,
+		"scope":                 "openid email",
+		"state":                 "some-state",
+		"nonce":                 "some-nonce",
+		"code_challenge":        oidc.Challenge("verifier"),
+		"code_challenge_method": "S256",
+	} {
+		if got := parsed.Query().Get(param); got != want {
+			t.Errorf("wrong %v: %v, want %v", param, got, want)
+		}
+	}
+
+	if _, err := oidc.NewProvider(oidc.Config{Name: "stub"}); err == nil {
+		t.Error("expected an incomplete config to be rejected")
+	}
+}
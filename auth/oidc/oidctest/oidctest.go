@@ -0,0 +1,202 @@
+// Package oidctest runs a stub OpenID Connect provider for tests
+// it signs every user in without asking, the way httptest serves requests without a network
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/oidc"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	ClientID     = "test-client"
+	ClientSecret = "test-secret"
+)
+
+// User is who the provider signs in
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// authorization is a code the provider handed out and what it was issued for
+type authorization struct {
+	user        User
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// Provider is a stub provider listening on a local port
+type Provider struct {
+	*httptest.Server
+
+	signer *middleware.JWTValidator
+
+	mu    sync.Mutex
+	user  User
+	codes map[string]authorization
+}
+
+// NewProvider starts a provider that signs user in, callers must Close it
+func NewProvider(user User) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("rsa.GenerateKey: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	signer, err := middleware.NewPrivateKeyValidator(keyPEM, "RS256")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{signer: signer, user: user, codes: make(map[string]authorization)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	p.Server = httptest.NewServer(mux)
+	return p, nil
+}
+
+// Config is how a relying party registered with the provider is configured
+func (p *Provider) Config(name, redirectURL string) oidc.Config {
+	return oidc.Config{
+		Name:         name,
+		Issuer:       p.URL,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// SetUser changes who the provider signs in next
+func (p *Provider) SetUser(user User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = user
+}
+
+// SignIn follows the URL the relying party sent the user to and returns where the provider sends them back
+func (p *Provider) SignIn(authCodeURL string) (*url.URL, error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authCodeURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("provider returned %v", resp.StatusCode)
+	}
+	return resp.Location()
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/jwks",
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.signer.JWKS())
+}
+
+// authorize signs the user in straight away and redirects back with a code
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != ClientID || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	code, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.mu.Lock()
+	p.codes[code] = authorization{p.user, redirect.String(), q.Get("code_challenge"), q.Get("nonce")}
+	p.mu.Unlock()
+
+	callback := redirect.Query()
+	callback.Set("code", code)
+	callback.Set("state", q.Get("state"))
+	redirect.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token once, if the client proves it started the flow
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if id, secret, ok := r.BasicAuth(); !ok || id != ClientID || secret != ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	auth, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	if !ok || auth.redirectURI != r.PostForm.Get("redirect_uri") || oidc.Challenge(r.PostForm.Get("code_verifier")) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken, err := p.signer.Sign(jwt.MapClaims{
+		"iss":            p.URL,
+		"sub":            auth.user.Subject,
+		"aud":            ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.user.Email,
+		"email_verified": auth.user.EmailVerified,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	accessToken := make([]byte, 16)
+	_, _ = rand.Read(accessToken)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": base64.RawURLEncoding.EncodeToString(accessToken),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/oidc"
+	"github.com/basilnsage/mwn-ticketapp/auth/oidc/oidctest"
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	oidcAppURL   = "http://tickets.test"
+	oidcCallback = oidcAppURL + "/api/users/oidc/stub/callback"
+)
+
+// oidcTest holds a stub provider and an engine routing the OIDC API the way UseUserRoutes does
+type oidcTest struct {
+	stub      *oidctest.Provider
+	eng       *gin.Engine
+	validator *middleware.JWTValidator
+	crud      *memoryUsers
+	states    *memoryOIDCStates
+	mailer    *mockMailer
+}
+
+func newOIDCTest(t *testing.T, user oidctest.User) *oidcTest {
+	t.Helper()
+	stub, err := oidctest.NewProvider(user)
+	if err != nil {
+		t.Fatalf("oidctest.NewProvider: %v", err)
+	}
+	t.Cleanup(stub.Close)
+	provider, err := oidc.NewProvider(stub.Config("stub", oidcCallback))
+	if err != nil {
+		t.Fatalf("oidc.NewProvider: %v", err)
+	}
+	v, err := middleware.NewJWTValidator(key, "HS256")
+	if err != nil {
+		t.Fatalf("middleware.NewJWTValidator: %v", err)
+	}
+	refreshTokens := new(mockRefreshStore)
+	refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+	mailer := new(mockMailer)
+	mailer.On("Send", mock.Anything, mock.Anything).Return(nil)
+	verifications := new(mockVerificationStore)
+	verifications.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+	ot := &oidcTest{stub: stub, validator: v, crud: new(memoryUsers), states: newMemoryOIDCStates(), mailer: mailer}
+	login := &oidcLogin{
+		providers:     map[string]*oidc.Provider{"stub": provider},
+		states:        ot.states,
+		crud:          ot.crud,
+		linked:        ot.crud,
+		signer:        v,
+		refreshTokens: refreshTokens,
+		verifier:      &emailVerifier{verifications: verifications, mailer: mailer, verifyURL: verifyURL},
+		twoFactor:     &twoFactor{challenges: newMemoryMFAChallenges()},
+		appURL:        oidcAppURL,
+	}
+
+	gin.SetMode(gin.TestMode)
+	ot.eng = gin.New()
+	ot.eng.Use(problem.Handler())
+	ot.eng.GET("/api/users/oidc/:provider/start", withTimeout(login.Start))
+	ot.eng.GET("/api/users/oidc/:provider/callback", withTimeout(login.Callback))
+	return ot
+}
+
+// start begins signing in and returns the provider's callback and the state cookie
+func (ot *oidcTest) start(t *testing.T) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	ot.eng.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/oidc/stub/start", nil))
+	if got, want := w.Code, http.StatusFound; got != want {
+		t.Fatalf("wrong status code starting sign in: %v, want %v", got, want)
+	}
+	var stateCookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			stateCookie = c
+		}
+	}
+	if stateCookie == nil || !stateCookie.HttpOnly || stateCookie.Path != "/api/users/oidc/stub" {
+		t.Fatalf("wrong state cookie: %+v", stateCookie)
+	}
+
+	callback, err := ot.stub.SignIn(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("unable to sign in with the provider: %v", err)
+	}
+	if got, want := callback.Scheme+"://"+callback.Host+callback.Path, oidcCallback; got != want {
+		t.Fatalf("provider redirected to %v, want %v", got, want)
+	}
+	return callback.RequestURI(), stateCookie
+}
+
+func (ot *oidcTest) callback(callback string, stateCookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	if stateCookie != nil {
+		req.AddCookie(stateCookie)
+	}
+	w := httptest.NewRecorder()
+	ot.eng.ServeHTTP(w, req)
+	return w
+}
+
+// sessionClaims returns the claims of the session cookie the callback set
+func (ot *oidcTest) sessionClaims(t *testing.T, w *httptest.ResponseRecorder) *middleware.Claims {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookie {
+			claims, err := ot.validator.ParseClaims(c.Value)
+			if err != nil {
+				t.Fatalf("invalid session token: %v", err)
+			}
+			return claims
+		}
+	}
+	t.Fatal("session cookie not set")
+	return nil
+}
+
+func TestOIDCSignin(t *testing.T) {
+	existing := users.User{Email: email, Hash: passHash, Roles: users.DefaultRoles}
+	unverified := users.User{Email: email, Hash: passHash, Roles: users.DefaultRoles, Unverified: true}
+	tests := []struct {
+		name string
+		// existing is written before signing in
+		existing *users.User
+		provider oidctest.User
+		// expectedCode is the callback's status, on success the user is redirected to the app
+		expectedCode       int
+		expectedID         string
+		expectedUnverified bool
+		expectedMails      int
+	}{
+		{"new verified user", nil, oidctest.User{Subject: "1234", Email: email, EmailVerified: true}, http.StatusFound, "000000000000000000000001", false, 0},
+		{"new unverified user", nil, oidctest.User{Subject: "1234", Email: email}, http.StatusFound, "000000000000000000000001", true, 1},
+		{"links existing user", &existing, oidctest.User{Subject: "1234", Email: email, EmailVerified: true}, http.StatusFound, "000000000000000000000001", false, 0},
+		{"unverified email of existing user", &existing, oidctest.User{Subject: "1234", Email: email}, http.StatusConflict, "", false, 0},
+		{"existing user never verified the email", &unverified, oidctest.User{Subject: "1234", Email: email, EmailVerified: true}, http.StatusConflict, "", false, 0},
+		{"no email", nil, oidctest.User{Subject: "1234"}, http.StatusBadRequest, "", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			ot := newOIDCTest(currTest, tt.provider)
+			if tt.existing != nil {
+				if _, err := ot.crud.Write(context.Background(), *tt.existing); err != nil {
+					currTest.Fatalf("unable to write existing user: %v", err)
+				}
+			}
+
+			w := ot.callback(ot.start(currTest))
+			if got, want := w.Code, tt.expectedCode; got != want {
+				currTest.Fatalf("wrong status code: %v, want %v: %s", got, want, w.Body.String())
+			}
+			ot.mailer.AssertNumberOfCalls(currTest, "Send", tt.expectedMails)
+			if tt.expectedCode != http.StatusFound {
+				if linked, _ := ot.crud.ReadLinked(context.Background(), users.LinkedAccount{Provider: "stub", Subject: "1234"}); linked != nil {
+					currTest.Errorf("account was linked to %v", linked.Uid)
+				}
+				return
+			}
+
+			if got, want := w.Header().Get("Location"), oidcAppURL; got != want {
+				currTest.Errorf("redirected to %v, want %v", got, want)
+			}
+			claims := ot.sessionClaims(currTest, w)
+			if claims.Email != email || claims.ID != tt.expectedID || claims.EmailVerified == tt.expectedUnverified {
+				currTest.Errorf("wrong session claims: %+v", claims)
+			}
+			checkRefreshCookie(currTest, w.Result())
+			linked, _ := ot.crud.ReadLinked(context.Background(), users.LinkedAccount{Provider: "stub", Subject: "1234"})
+			if linked == nil || linked.Uid != tt.expectedID {
+				currTest.Errorf("account is linked to %+v, want %v", linked, tt.expectedID)
+			}
+			if got := len(ot.crud.users); got != 1 {
+				currTest.Errorf("%v users after signing in, want 1", got)
+			}
+		})
+	}
+}
+
+func TestOIDCSigninLinkedUser(t *testing.T) {
+	ot := newOIDCTest(t, oidctest.User{Subject: "1234", Email: email, EmailVerified: true})
+	w := ot.callback(ot.start(t))
+	if got, want := w.Code, http.StatusFound; got != want {
+		t.Fatalf("wrong status code signing up: %v, want %v", got, want)
+	}
+
+	// the account is found by its subject even once the email changes
+	ot.stub.SetUser(oidctest.User{Subject: "1234", Email: "bar@example.com", EmailVerified: true})
+	w = ot.callback(ot.start(t))
+	if got, want := w.Code, http.StatusFound; got != want {
+		t.Fatalf("wrong status code signing in: %v, want %v", got, want)
+	}
+	if claims := ot.sessionClaims(t, w); claims.Email != email || claims.ID != "000000000000000000000001" {
+		t.Errorf("signed in as %v %v, want the linked user", claims.Email, claims.ID)
+	}
+
+	// users with an authenticator enter a code before they get a session
+	ot.crud.users[0].TOTPEnabled = true
+	w = ot.callback(ot.start(t))
+	if got, want := w.Header().Get("Location"), oidcAppURL+"/auth/two-factor"; w.Code != http.StatusFound || got != want {
+		t.Errorf("redirected with %v to %v, want %v", w.Code, got, want)
+	}
+	if hasSessionCookie(w) {
+		t.Error("session cookie set before the code was entered")
+	}
+	challengeSet := false
+	for _, c := range w.Result().Cookies() {
+		challengeSet = challengeSet || c.Name == mfaCookie && c.Value != ""
+	}
+	if !challengeSet {
+		t.Error("challenge cookie not set")
+	}
+
+	// disabled users cannot sign in with a provider either
+	ot.crud.users[0].Disabled = true
+	if got, want := ot.callback(ot.start(t)).Code, http.StatusForbidden; got != want {
+		t.Errorf("wrong status code for a disabled user: %v, want %v", got, want)
+	}
+}
+
+func TestOIDCCallbackRejected(t *testing.T) {
+	ot := newOIDCTest(t, oidctest.User{Subject: "1234", Email: email, EmailVerified: true})
+
+	t.Run("unknown provider", func(currTest *testing.T) {
+		w := httptest.NewRecorder()
+		ot.eng.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/oidc/other/start", nil))
+		if got, want := w.Code, http.StatusNotFound; got != want {
+			currTest.Errorf("wrong status code: %v, want %v", got, want)
+		}
+	})
+	t.Run("no state cookie", func(currTest *testing.T) {
+		callback, _ := ot.start(currTest)
+		if got, want := ot.callback(callback, nil).Code, http.StatusBadRequest; got != want {
+			currTest.Errorf("wrong status code: %v, want %v", got, want)
+		}
+	})
+	t.Run("another browser's state", func(currTest *testing.T) {
+		callback, _ := ot.start(currTest)
+		_, otherCookie := ot.start(currTest)
+		if got, want := ot.callback(callback, otherCookie).Code, http.StatusBadRequest; got != want {
+			currTest.Errorf("wrong status code: %v, want %v", got, want)
+		}
+	})
+	t.Run("state used twice", func(currTest *testing.T) {
+		callback, stateCookie := ot.start(currTest)
+		if got, want := ot.callback(callback, stateCookie).Code, http.StatusFound; got != want {
+			currTest.Fatalf("wrong status code: %v, want %v", got, want)
+		}
+		if got, want := ot.callback(callback, stateCookie).Code, http.StatusBadRequest; got != want {
+			currTest.Errorf("wrong status code reusing the state: %v, want %v", got, want)
+		}
+	})
+	t.Run("wrong code", func(currTest *testing.T) {
+		callback, stateCookie := ot.start(currTest)
+		callback = strings.Replace(callback, "code=", "code=wrong", 1)
+		if got, want := ot.callback(callback, stateCookie).Code, http.StatusUnauthorized; got != want {
+			currTest.Errorf("wrong status code: %v, want %v", got, want)
+		}
+	})
+	t.Run("provider error", func(currTest *testing.T) {
+		_, stateCookie := ot.start(currTest)
+		callback := "/api/users/oidc/stub/callback?error=access_denied&state=" + stateCookie.Value
+		if got, want := ot.callback(callback, stateCookie).Code, http.StatusUnauthorized; got != want {
+			currTest.Errorf("wrong status code: %v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/mail"
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+)
+
+type changePasswordData struct {
+	CurrentPassword string `json:"currentPassword" form:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" form:"newPassword" binding:"required"`
+}
+
+type forgotPasswordData struct {
+	Email string `json:"email" form:"email" binding:"required"`
+}
+
+type resetPasswordData struct {
+	Token       string `json:"token" form:"token" binding:"required"`
+	NewPassword string `json:"newPassword" form:"newPassword" binding:"required"`
+}
+
+// passwordManager serves the password routes
+// changing or resetting a password signs the user out everywhere, they sign in again with the new password
+type passwordManager struct {
+	crud          users.CRUD
+	store         users.PasswordStore
+	resets        users.PasswordResetStore
+	refreshTokens users.RefreshStore
+	revoker       sessionRevoker
+	mailer        mail.Mailer
+	// resetURL is the client page reset links point to, the token is passed as the token query parameter
+	resetURL string
+}
+
+// Change replaces the signed in user's password, the current password must be provided
+func (p *passwordManager) Change(ctx context.Context, ginCtx *gin.Context) {
+	data := new(changePasswordData)
+	if err := bind(ginCtx, data); err != nil {
+		bindError(ginCtx, err, "please provide your current password and a new password")
+		return
+	}
+	claims, ok := middleware.ClaimsFromContext(ginCtx)
+	if !ok {
+		problem.Abort(ginCtx, problem.Unauthorized(problem.CodeUnauthorized, "unauthorized").WithCause(errors.New("no session claims")))
+		return
+	}
+
+	u, err := p.store.ReadID(ctx, claims.ID)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to change password", err))
+		return
+	}
+	if u == nil {
+		problem.Abort(ginCtx, problem.Unauthorized(problem.CodeUnauthorized, "unauthorized").WithCause(errors.New("session user not found")))
+		return
+	}
+	if err := u.CheckPassword(data.CurrentPassword); err != nil {
+		problem.Abort(ginCtx, problem.Validation(codeWrongPassword, "current password is incorrect", problem.InvalidParam{Name: "currentPassword", Reason: "current password is incorrect"}).WithCause(err))
+		return
+	}
+	hash, err := users.HashPassword(data.NewPassword)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Validation(codeInvalidPassword, "invalid new password", problem.InvalidParam{Name: "newPassword", Reason: err.Error()}).WithCause(err))
+		return
+	}
+
+	if p.update(ctx, ginCtx, claims.ID, hash) {
+		ginCtx.Status(http.StatusOK)
+	}
+}
+
+// Forgot mails a password reset link to the user with the email
+// the response is the same whether or not the user exists, so it cannot be used to find accounts
+func (p *passwordManager) Forgot(ctx context.Context, ginCtx *gin.Context) {
+	data := new(forgotPasswordData)
+	if err := bind(ginCtx, data); err != nil {
+		bindError(ginCtx, err, "please provide an email")
+		return
+	}
+
+	found, err := p.crud.Read(ctx, users.User{Email: data.Email})
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to reset password", err))
+		return
+	}
+	// disabled users could not sign in with a new password anyway
+	if len(found) == 0 || found[0].Disabled {
+		ginCtx.Status(http.StatusAccepted)
+		return
+	}
+
+	token, record, err := users.NewPasswordReset(found[0].Email, fmt.Sprint(found[0].Uid))
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to reset password", err))
+		return
+	}
+	if err := p.resets.Create(ctx, record); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to reset password", err))
+		return
+	}
+
+	msg := mail.Message{
+		To:      record.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Follow this link within %v to choose a new password:\n%v?token=%v\n\n"+
+			"If you did not ask to reset your password you can ignore this email.",
+			users.PasswordResetTTL, p.resetURL, url.QueryEscape(token)),
+	}
+	// failing to send is not reported to the client, it would tell them the account exists
+	if err := p.mailer.Send(ctx, msg); err != nil {
+		log.Printf("unable to send password reset mail: %v", err)
+	}
+	ginCtx.Status(http.StatusAccepted)
+}
+
+// Reset sets a new password with a token from a reset link, each token can only be used once
+func (p *passwordManager) Reset(ctx context.Context, ginCtx *gin.Context) {
+	data := new(resetPasswordData)
+	if err := bind(ginCtx, data); err != nil {
+		bindError(ginCtx, err, "please provide a reset token and a new password")
+		return
+	}
+	// check the password before the token is used up
+	hash, err := users.HashPassword(data.NewPassword)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Validation(codeInvalidPassword, "invalid new password", problem.InvalidParam{Name: "newPassword", Reason: err.Error()}).WithCause(err))
+		return
+	}
+
+	reset, err := p.resets.Consume(ctx, users.HashResetToken(data.Token))
+	if err == users.ErrInvalidResetToken {
+		problem.Abort(ginCtx, problem.Validation(codeInvalidResetToken, "reset token is invalid or expired").WithCause(err))
+		return
+	} else if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to reset password", err))
+		return
+	}
+	// any other links that were mailed stop working too
+	if err := p.resets.RevokeUser(ctx, reset.UserID); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to reset password", err))
+		return
+	}
+
+	if p.update(ctx, ginCtx, reset.UserID, hash) {
+		ginCtx.Status(http.StatusOK)
+	}
+}
+
+// update stores the user's new password hash then revokes all of the user's sessions and clears the session cookies
+// it reports whether it succeeded, errors have already been added to ginCtx
+func (p *passwordManager) update(ctx context.Context, ginCtx *gin.Context, id string, hash []byte) bool {
+	found, err := p.store.SetPassword(ctx, id, hash)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to update password", err))
+		return false
+	}
+	if !found {
+		problem.Abort(ginCtx, problem.NotFound(codeUserNotFound, "user not found").WithCause(errors.New("user not found")))
+		return false
+	}
+
+	if err := p.refreshTokens.RevokeUser(ctx, id); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to revoke user sessions", err))
+		return false
+	}
+	if err := p.revoker.RevokeUser(ctx, id); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to revoke user sessions", err))
+		return false
+	}
+	clearSessionCookies(ginCtx)
+	return true
+}
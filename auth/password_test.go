@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/mail"
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	newPass    = "new-password"
+	resetURL   = "http://tickets.dev/auth/reset-password"
+	resetToken = "reset-token"
+)
+
+// passwordEngine routes the password API the way UseUserRoutes does
+func passwordEngine(t *testing.T, p *passwordManager) (*gin.Engine, *middleware.JWTValidator) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	v, err := middleware.NewJWTValidator(key, "HS256")
+	if err != nil {
+		t.Fatalf("middleware.NewJWTValidator: %v", err)
+	}
+	revoker := new(mockRevoker)
+	revoker.On("IsRevoked", mock.Anything, mock.Anything).Return(false, nil)
+
+	eng := gin.New()
+	eng.Use(problem.Handler())
+	eng.POST("/password", RequireSession(v, revoker), withTimeout(p.Change))
+	eng.POST("/password/forgot", withTimeout(p.Forgot))
+	eng.POST("/password/reset", withTimeout(p.Reset))
+	return eng, v
+}
+
+func passwordRequest(t *testing.T, eng *gin.Engine, path, token string, body interface{}) *http.Response {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("http.NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		addSessionCookies(req, token)
+	}
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func checkCookiesCleared(t *testing.T, resp *http.Response) {
+	t.Helper()
+	cleared := map[string]bool{}
+	for _, c := range resp.Cookies() {
+		if c.MaxAge < 0 {
+			cleared[c.Name] = true
+		}
+	}
+	if !cleared[sessionCookie] || !cleared[refreshCookie] {
+		t.Errorf("session cookies were not cleared: %v", resp.Cookies())
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name         string
+		signedIn     bool
+		body         gin.H
+		expectedCode int
+	}{
+		{"changed", true, gin.H{"currentPassword": pass, "newPassword": newPass}, http.StatusOK},
+		{"wrong current password", true, gin.H{"currentPassword": "wrong-password", "newPassword": newPass}, http.StatusBadRequest},
+		{"new password too short", true, gin.H{"currentPassword": pass, "newPassword": "short"}, http.StatusBadRequest},
+		{"missing new password", true, gin.H{"currentPassword": pass}, http.StatusBadRequest},
+		{"not signed in", false, gin.H{"currentPassword": pass, "newPassword": newPass}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			store := new(mockPasswordStore)
+			refreshTokens := new(mockRefreshStore)
+			revoker := new(mockRevoker)
+			eng, v := passwordEngine(currTest, &passwordManager{store: store, refreshTokens: refreshTokens, revoker: revoker})
+
+			store.On("ReadID", mock.Anything, uid).Return(&users.User{Email: email, Hash: passHash, Uid: uid}, nil)
+			store.On("SetPassword", mock.Anything, uid, mock.MatchedBy(checkPasswordHash(newPass))).Return(true, nil)
+			refreshTokens.On("RevokeUser", mock.Anything, uid).Return(nil)
+			revoker.On("RevokeUser", mock.Anything, uid).Return(nil)
+
+			var token string
+			if tt.signedIn {
+				var err error
+				if token, err = users.NewSessionToken(sampleIdentity, v); err != nil {
+					currTest.Fatalf("users.NewSessionToken: %v", err)
+				}
+			}
+			resp := passwordRequest(currTest, eng, "/password", token, tt.body)
+			if got, want := resp.StatusCode, tt.expectedCode; got != want {
+				currTest.Fatalf("wrong status code: %v, want %v", got, want)
+			}
+			if tt.expectedCode != http.StatusOK {
+				store.AssertNotCalled(currTest, "SetPassword", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			// the user signs in again with the new password
+			store.AssertExpectations(currTest)
+			refreshTokens.AssertExpectations(currTest)
+			revoker.AssertExpectations(currTest)
+			checkCookiesCleared(currTest, resp)
+		})
+	}
+}
+
+func TestChangePasswordCSRF(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+		header string
+	}{
+		{"no token", "", ""},
+		{"no header", "csrf-token", ""},
+		{"wrong header", "csrf-token", "other-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			store := new(mockPasswordStore)
+			eng, v := passwordEngine(currTest, &passwordManager{store: store})
+			token, err := users.NewSessionToken(sampleIdentity, v)
+			if err != nil {
+				currTest.Fatalf("users.NewSessionToken: %v", err)
+			}
+			data, _ := json.Marshal(gin.H{"currentPassword": pass, "newPassword": newPass})
+			req := httptest.NewRequest(http.MethodPost, "/password", bytes.NewReader(data))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: middleware.CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(middleware.CSRFHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			eng.ServeHTTP(w, req)
+			if got, want := w.Code, http.StatusForbidden; got != want {
+				currTest.Errorf("wrong status code: %v, want %v", got, want)
+			}
+			store.AssertNotCalled(currTest, "ReadID", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestForgotPassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		found   []users.User
+		mailErr error
+		mailed  bool
+	}{
+		{"mailed", []users.User{{Email: email, Hash: passHash, Uid: uid}}, nil, true},
+		{"reset required", []users.User{{Email: email, Hash: passHash, Uid: uid, PasswordResetRequired: true}}, nil, true},
+		{"mail fails", []users.User{{Email: email, Hash: passHash, Uid: uid}}, errors.New("mail down"), true},
+		{"no such user", []users.User{}, nil, false},
+		{"disabled", []users.User{{Email: email, Hash: passHash, Uid: uid, Disabled: true}}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			crud := new(mockCRUD)
+			resets := new(mockResetStore)
+			mailer := new(mockMailer)
+			eng, _ := passwordEngine(currTest, &passwordManager{crud: crud, resets: resets, mailer: mailer, resetURL: resetURL})
+
+			crud.On("Read", mock.Anything, mock.MatchedBy(checkTestUser)).Return(tt.found, nil)
+			var stored users.PasswordReset
+			resets.On("Create", mock.Anything, mock.MatchedBy(func(r users.PasswordReset) bool {
+				return r.Email == email && r.UserID == uid && r.Hash != ""
+			})).Run(func(args mock.Arguments) {
+				stored = args.Get(1).(users.PasswordReset)
+			}).Return(nil)
+			var sent mail.Message
+			mailer.On("Send", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				sent = args.Get(1).(mail.Message)
+			}).Return(tt.mailErr)
+
+			// the response does not say whether the user exists
+			resp := passwordRequest(currTest, eng, "/password/forgot", "", gin.H{"email": email})
+			if got, want := resp.StatusCode, http.StatusAccepted; got != want {
+				currTest.Fatalf("wrong status code: %v, want %v", got, want)
+			}
+			if !tt.mailed {
+				resets.AssertNotCalled(currTest, "Create", mock.Anything, mock.Anything)
+				mailer.AssertNotCalled(currTest, "Send", mock.Anything, mock.Anything)
+				return
+			}
+
+			if sent.To != email {
+				currTest.Errorf("mail sent to %v, want %v", sent.To, email)
+			}
+			// only the hash of the mailed token is stored
+			link := regexp.MustCompile(regexp.QuoteMeta(resetURL) + `\?token=\S+`).FindString(sent.Body)
+			u, err := url.Parse(link)
+			if err != nil || link == "" {
+				currTest.Fatalf("no reset link in mail: %q", sent.Body)
+			}
+			if got, want := users.HashResetToken(u.Query().Get("token")), stored.Hash; got != want {
+				currTest.Errorf("mailed token hashes to %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         gin.H
+		consumeErr   error
+		expectedCode int
+	}{
+		{"reset", gin.H{"token": resetToken, "newPassword": newPass}, nil, http.StatusOK},
+		{"invalid token", gin.H{"token": resetToken, "newPassword": newPass}, users.ErrInvalidResetToken, http.StatusBadRequest},
+		{"db down", gin.H{"token": resetToken, "newPassword": newPass}, errors.New("db down"), http.StatusInternalServerError},
+		{"new password too short", gin.H{"token": resetToken, "newPassword": "short"}, nil, http.StatusBadRequest},
+		{"missing token", gin.H{"newPassword": newPass}, nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			store := new(mockPasswordStore)
+			resets := new(mockResetStore)
+			refreshTokens := new(mockRefreshStore)
+			revoker := new(mockRevoker)
+			eng, _ := passwordEngine(currTest, &passwordManager{store: store, resets: resets, refreshTokens: refreshTokens, revoker: revoker})
+
+			var reset *users.PasswordReset
+			if tt.consumeErr == nil {
+				reset = &users.PasswordReset{Hash: users.HashResetToken(resetToken), UserID: uid, Email: email}
+			}
+			resets.On("Consume", mock.Anything, users.HashResetToken(resetToken)).Return(reset, tt.consumeErr)
+			resets.On("RevokeUser", mock.Anything, uid).Return(nil)
+			store.On("SetPassword", mock.Anything, uid, mock.MatchedBy(checkPasswordHash(newPass))).Return(true, nil)
+			refreshTokens.On("RevokeUser", mock.Anything, uid).Return(nil)
+			revoker.On("RevokeUser", mock.Anything, uid).Return(nil)
+
+			resp := passwordRequest(currTest, eng, "/password/reset", "", tt.body)
+			if got, want := resp.StatusCode, tt.expectedCode; got != want {
+				currTest.Fatalf("wrong status code: %v, want %v", got, want)
+			}
+			if tt.expectedCode != http.StatusOK {
+				store.AssertNotCalled(currTest, "SetPassword", mock.Anything, mock.Anything, mock.Anything)
+				if tt.consumeErr == nil {
+					// a bad request does not use up the token
+					resets.AssertNotCalled(currTest, "Consume", mock.Anything, mock.Anything)
+				}
+				return
+			}
+			resets.AssertExpectations(currTest)
+			store.AssertExpectations(currTest)
+			refreshTokens.AssertExpectations(currTest)
+			revoker.AssertExpectations(currTest)
+			checkCookiesCleared(currTest, resp)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionCookie = "auth-jwt"
+	refreshCookie = "auth-refresh"
+	// the refresh token is only sent to the user routes
+	refreshCookiePath = "/api/users"
+)
+
+// setSessionCookies also sets a new CSRF token, which scripts can read so they can send it back in middleware.CSRFHeader
+func setSessionCookies(ginCtx *gin.Context, sessionToken, refreshToken string) {
+	ginCtx.SetCookie(sessionCookie, sessionToken, int(middleware.DefaultTokenTTL.Seconds()), "", "", false, true)
+	ginCtx.SetCookie(refreshCookie, refreshToken, int(users.RefreshTokenTTL.Seconds()), refreshCookiePath, "", false, true)
+	csrfToken, err := users.NewCSRFToken()
+	if err != nil {
+		// requests changing state are rejected until the next refresh sets a token
+		log.Printf("unable to create CSRF token: %v", err)
+		return
+	}
+	ginCtx.SetCookie(middleware.CSRFCookie, csrfToken, int(users.RefreshTokenTTL.Seconds()), "/", "", false, false)
+}
+
+func clearSessionCookies(ginCtx *gin.Context) {
+	ginCtx.SetCookie(sessionCookie, "", -1, "", "", false, true)
+	ginCtx.SetCookie(refreshCookie, "", -1, refreshCookiePath, "", false, true)
+	ginCtx.SetCookie(middleware.CSRFCookie, "", -1, "/", "", false, false)
+}
+
+// Refresh exchanges the refresh token cookie for a new session token and refresh token
+func Refresh(ctx context.Context, ginCtx *gin.Context, store users.RefreshStore, crud users.CRUD, signer users.Signer) {
+	if err := refresh(ctx, ginCtx, store, crud, signer); err != nil {
+		clearSessionCookies(ginCtx)
+		problem.Abort(ginCtx, problem.Unauthorized(problem.CodeUnauthorized, "unauthorized").WithCause(err))
+	} else {
+		ginCtx.Status(http.StatusOK)
+	}
+}
+
+func refresh(ctx context.Context, ginCtx *gin.Context, store users.RefreshStore, crud users.CRUD, signer users.Signer) error {
+	oldToken, err := ginCtx.Cookie(refreshCookie)
+	if err != nil || oldToken == "" {
+		return errors.New("no refresh token provided")
+	}
+
+	sessionToken, refreshToken, err := users.RefreshSession(ctx, store, crud, signer, oldToken)
+	if err != nil {
+		return err
+	}
+	setSessionCookies(ginCtx, sessionToken, refreshToken)
+
+	return nil
+}
+
+// Signout revokes the session token and the refresh token and clears the session cookies
+// the cookies are cleared even if revocation fails
+func Signout(ctx context.Context, ginCtx *gin.Context, store users.RefreshStore, validator *middleware.JWTValidator, revoker sessionRevoker) {
+	// the tokens are read from the request, so the cookies can be cleared before the response is written
+	clearSessionCookies(ginCtx)
+
+	if refreshToken, err := ginCtx.Cookie(refreshCookie); err == nil && refreshToken != "" {
+		if err := store.Revoke(ctx, users.HashRefreshToken(refreshToken)); err != nil {
+			// the token expires on its own, still sign the user out
+			log.Printf("unable to revoke refresh token: %v", err)
+		}
+	}
+
+	// there is nothing to revoke if the session token is missing, invalid or expired
+	if sessionToken, err := ginCtx.Cookie(sessionCookie); err == nil && sessionToken != "" {
+		if claims, err := validator.ParseClaims(sessionToken); err == nil {
+			if err := revoker.Revoke(ctx, *claims); err != nil {
+				problem.Abort(ginCtx, problem.Internal("unable to sign out", err))
+				return
+			}
+		}
+	}
+
+	ginCtx.Status(http.StatusOK)
+}
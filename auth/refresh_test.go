@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+const oldRefreshToken = "old-refresh-token"
+
+func checkRefreshCookie(t *testing.T, resp *http.Response) {
+	t.Helper()
+	for _, c := range resp.Cookies() {
+		if c.Name != refreshCookie {
+			continue
+		}
+		if c.Value == "" {
+			t.Error("auth-refresh cookie is empty")
+		}
+		if got, want := c.Path, refreshCookiePath; got != want {
+			t.Errorf("wrong auth-refresh cookie path: %v, want: %v", got, want)
+		}
+		if !c.HttpOnly {
+			t.Error("auth-refresh cookie is not HttpOnly")
+		}
+		return
+	}
+	t.Error("auth-refresh cookie not set")
+}
+
+// checkCSRFCookie checks the CSRF cookie is set where scripts can read it
+func checkCSRFCookie(t *testing.T, resp *http.Response) {
+	t.Helper()
+	for _, c := range resp.Cookies() {
+		if c.Name != middleware.CSRFCookie {
+			continue
+		}
+		if c.Value == "" || c.Path != "/" || c.HttpOnly {
+			t.Errorf("wrong CSRF cookie: %+v", c)
+		}
+		return
+	}
+	t.Error("CSRF cookie not set")
+}
+
+func refreshEngine(handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	eng := gin.New()
+	eng.Use(problem.Handler())
+	eng.POST("/test", handler)
+	return eng
+}
+
+func refreshRequest(t *testing.T, eng *gin.Engine, refreshToken string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "/test", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %v", err)
+	}
+	if refreshToken != "" {
+		req.AddCookie(&http.Cookie{Name: refreshCookie, Value: refreshToken})
+	}
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	signer := new(mockSigner)
+	store := new(mockRefreshStore)
+	crud := new(mockCRUD)
+	eng := refreshEngine(func(ginCtx *gin.Context) {
+		Refresh(ctx, ginCtx, store, crud, signer)
+	})
+	// the new session token carries the user's current roles and verification
+	roles := []string{middleware.RoleAdmin}
+
+	store.On("Rotate", ctx, users.HashRefreshToken(oldRefreshToken)).Return(&users.RefreshToken{
+		Email:  email,
+		UserID: uid,
+		Used:   true,
+	}, nil)
+	crud.On("Read", ctx, mock.MatchedBy(checkTestUser)).Return([]users.User{{Email: email, Uid: uid, Roles: roles, Unverified: true}}, nil)
+	store.On("Create", ctx, mock.MatchedBy(checkRefreshToken(uid))).Return(nil)
+	signer.On("Sign", mock.MatchedBy(func(c jwt.Claims) bool {
+		return checkSessionClaims(uid, roles)(c) && !c.(*middleware.Claims).EmailVerified
+	})).Return(jwtString, nil)
+
+	resp := refreshRequest(t, eng, oldRefreshToken)
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Errorf("wrong response code: %v, want: %v", got, want)
+	}
+	checkRefreshCookie(t, resp)
+	checkCSRFCookie(t, resp)
+	for _, c := range resp.Cookies() {
+		if c.Name == refreshCookie && c.Value == oldRefreshToken {
+			t.Error("refresh token was not rotated")
+		}
+		if c.Name == sessionCookie && c.Value != jwtString {
+			t.Errorf("wrong auth-jwt cookie: %v, want: %v", c.Value, jwtString)
+		}
+	}
+	store.AssertExpectations(t)
+	signer.AssertExpectations(t)
+}
+
+func TestRefreshRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		rotateErr error
+		// the users found for the refresh token's email once it is rotated
+		found []users.User
+	}{
+		{"no refresh token", "", nil, nil},
+		{"unknown refresh token", oldRefreshToken, users.ErrInvalidRefreshToken, nil},
+		{"reused refresh token", oldRefreshToken, users.ErrRefreshTokenReused, nil},
+		{"user no longer exists", oldRefreshToken, nil, []users.User{}},
+		{"email belongs to another user", oldRefreshToken, nil, []users.User{{Email: email, Uid: "1"}}},
+		{"user is disabled", oldRefreshToken, nil, []users.User{{Email: email, Uid: uid, Disabled: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			ctx := context.Background()
+			signer := new(mockSigner)
+			store := new(mockRefreshStore)
+			crud := new(mockCRUD)
+			eng := refreshEngine(func(ginCtx *gin.Context) {
+				Refresh(ctx, ginCtx, store, crud, signer)
+			})
+			if tt.rotateErr != nil {
+				store.On("Rotate", ctx, users.HashRefreshToken(tt.token)).Return((*users.RefreshToken)(nil), tt.rotateErr)
+			} else if tt.found != nil {
+				store.On("Rotate", ctx, users.HashRefreshToken(tt.token)).Return(&users.RefreshToken{Email: email, UserID: uid, Used: true}, nil)
+				crud.On("Read", ctx, mock.MatchedBy(checkTestUser)).Return(tt.found, nil)
+			}
+
+			resp := refreshRequest(currTest, eng, tt.token)
+			if got, want := resp.StatusCode, http.StatusUnauthorized; got != want {
+				currTest.Errorf("wrong response code: %v, want: %v", got, want)
+			}
+			for _, c := range resp.Cookies() {
+				if c.Value != "" {
+					currTest.Errorf("cookie %v not cleared", c.Name)
+				}
+			}
+			store.AssertExpectations(currTest)
+			crud.AssertExpectations(currTest)
+			signer.AssertNotCalled(currTest, "Sign", mock.Anything)
+		})
+	}
+}
+
+func TestSignout(t *testing.T) {
+	v, err := middleware.NewJWTValidator(key, "HS256")
+	if err != nil {
+		t.Fatalf("middleware.NewJWTValidator: %v", err)
+	}
+	sessionToken, err := users.NewSessionToken(sampleIdentity, v)
+	if err != nil {
+		t.Fatalf("users.NewSessionToken: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		revokeErr    error
+		expectedCode int
+	}{
+		{"revokes the session", nil, http.StatusOK},
+		{"revocation fails", errors.New("db down"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			ctx := context.Background()
+			store := new(mockRefreshStore)
+			revoker := new(mockRevoker)
+			eng := refreshEngine(func(ginCtx *gin.Context) {
+				Signout(ctx, ginCtx, store, v, revoker)
+			})
+			store.On("Revoke", ctx, users.HashRefreshToken(oldRefreshToken)).Return(nil)
+			revoker.On("Revoke", ctx, mock.MatchedBy(func(claims middleware.Claims) bool {
+				return claims.Email == email && claims.TokenID != ""
+			})).Return(tt.revokeErr)
+
+			req, err := http.NewRequest(http.MethodPost, "/test", nil)
+			if err != nil {
+				currTest.Fatalf("http.NewRequest: %v", err)
+			}
+			req.AddCookie(&http.Cookie{Name: refreshCookie, Value: oldRefreshToken})
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sessionToken})
+			w := httptest.NewRecorder()
+			eng.ServeHTTP(w, req)
+			resp := w.Result()
+
+			if got, want := resp.StatusCode, tt.expectedCode; got != want {
+				currTest.Errorf("wrong response code: %v, want: %v", got, want)
+			}
+			// cookies are cleared even if revocation fails
+			cleared := map[string]bool{}
+			for _, c := range resp.Cookies() {
+				cleared[c.Name] = c.Value == "" && c.MaxAge < 0
+			}
+			for _, name := range []string{sessionCookie, refreshCookie} {
+				if !cleared[name] {
+					currTest.Errorf("cookie %v not cleared", name)
+				}
+			}
+			store.AssertExpectations(currTest)
+			revoker.AssertExpectations(currTest)
+		})
+	}
+}
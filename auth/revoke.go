@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/nats-io/stan.go"
+	"google.golang.org/protobuf/proto"
+)
+
+// sessionRevoker revokes session tokens so they stop being accepted before they expire
+type sessionRevoker interface {
+	Revoke(context.Context, middleware.Claims) error
+	// RevokeUser revokes every session token the user has been issued so far
+	RevokeUser(context.Context, string) error
+	// IsRevoked reports whether the token was revoked, either by its id or with its user
+	IsRevoked(context.Context, middleware.Claims) (bool, error)
+}
+
+// revocationStore saves the IDs of revoked tokens and the revoked users until their tokens expire
+type revocationStore interface {
+	Revoke(context.Context, string, time.Time) error
+	IsRevoked(context.Context, string) (bool, error)
+	RevokeUser(ctx context.Context, userID string, issuedBefore, expiresAt time.Time) error
+	IsUserRevoked(ctx context.Context, userID string, issuedAt time.Time) (bool, error)
+}
+
+// tokenRevoker saves revoked token IDs and publishes them so the other services reject them too
+type tokenRevoker struct {
+	store revocationStore
+	eBus  stan.Conn
+	subj  string
+}
+
+func newTokenRevoker(store revocationStore, eBus stan.Conn) (*tokenRevoker, error) {
+	subj, err := subjects.StringifySubject(subjects.Subject_TOKEN_REVOKED)
+	if err != nil {
+		return nil, fmt.Errorf("unable to set NATS subject: %v", err)
+	}
+	return &tokenRevoker{store, eBus, subj}, nil
+}
+
+func (r *tokenRevoker) Revoke(ctx context.Context, claims middleware.Claims) error {
+	if claims.TokenID == "" {
+		return errors.New("token does not have an id")
+	}
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if err := r.store.Revoke(ctx, claims.TokenID, expiresAt); err != nil {
+		return err
+	}
+
+	data, err := marshalTokenRevoked(claims.TokenID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("unable to marshal token revocation: %v", err)
+	}
+	if err := r.eBus.Publish(r.subj, data); err != nil {
+		return fmt.Errorf("unable to publish token revocation: %v", err)
+	}
+	return nil
+}
+
+// RevokeUser revokes every token issued to the user up to and including the current second
+// iat only has whole seconds, so a token issued earlier in the same second cannot be told apart from a later one
+// the revocation is kept until all of those tokens have expired
+func (r *tokenRevoker) RevokeUser(ctx context.Context, userID string) error {
+	issuedBefore := time.Now().Truncate(time.Second).Add(time.Second)
+	expiresAt := issuedBefore.Add(middleware.DefaultTokenTTL)
+	if err := r.store.RevokeUser(ctx, userID, issuedBefore, expiresAt); err != nil {
+		return err
+	}
+
+	data, err := marshalUserRevoked(userID, issuedBefore, expiresAt)
+	if err != nil {
+		return fmt.Errorf("unable to marshal user revocation: %v", err)
+	}
+	if err := r.eBus.Publish(r.subj, data); err != nil {
+		return fmt.Errorf("unable to publish user revocation: %v", err)
+	}
+	return nil
+}
+
+func (r *tokenRevoker) IsRevoked(ctx context.Context, claims middleware.Claims) (bool, error) {
+	if revoked, err := r.store.IsRevoked(ctx, claims.TokenID); err != nil || revoked {
+		return revoked, err
+	}
+	return r.store.IsUserRevoked(ctx, claims.ID, time.Unix(claims.IssuedAt, 0))
+}
+
+func marshalTokenRevoked(tokenId string, expiresAt time.Time) ([]byte, error) {
+	pbExpiresAt, err := ptypes.TimestampProto(expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&events.TokenRevoked{
+		Subject:   subjects.Subject_TOKEN_REVOKED,
+		TokenId:   tokenId,
+		ExpiresAt: pbExpiresAt,
+	})
+}
+
+// marshalUserRevoked is a token revocation for every token of the user issued up to issuedBefore
+func marshalUserRevoked(userID string, issuedBefore, expiresAt time.Time) ([]byte, error) {
+	pbIssuedBefore, err := ptypes.TimestampProto(issuedBefore)
+	if err != nil {
+		return nil, err
+	}
+	pbExpiresAt, err := ptypes.TimestampProto(expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&events.TokenRevoked{
+		Subject:      subjects.Subject_TOKEN_REVOKED,
+		ExpiresAt:    pbExpiresAt,
+		UserId:       userID,
+		IssuedBefore: pbIssuedBefore,
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/stan.go"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakeNatsConn struct {
+	messages map[string][][]byte
+}
+
+func newFakeNatsConn() *fakeNatsConn {
+	return &fakeNatsConn{
+		make(map[string][][]byte),
+	}
+}
+
+func (f *fakeNatsConn) Publish(subj string, data []byte) error {
+	f.messages[subj] = append(f.messages[subj], data)
+	return nil
+}
+
+func (f *fakeNatsConn) PublishAsync(subj string, data []byte, ah stan.AckHandler) (string, error) {
+	_, _, _ = subj, data, ah
+	return "", errors.New("not implemented")
+}
+
+func (f *fakeNatsConn) Subscribe(subj string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	_, _, _ = subj, cb, opts
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeNatsConn) QueueSubscribe(subj, qgroup string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	_, _, _, _ = subj, qgroup, cb, opts
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeNatsConn) Close() error {
+	return nil
+}
+
+func (f *fakeNatsConn) NatsConn() *nats.Conn {
+	return nil
+}
+
+func TestTokenRevoker(t *testing.T) {
+	ctx := context.Background()
+	store := new(mockRevocationStore)
+	fakeStan := newFakeNatsConn()
+	revoker, err := newTokenRevoker(store, fakeStan)
+	if err != nil {
+		t.Fatalf("unable to create token revoker: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	store.On("Revoke", ctx, "1", expiresAt).Return(nil)
+	claims := middleware.Claims{Email: email, ID: uid, TokenID: "1", ExpiresAt: expiresAt.Unix()}
+	if err := revoker.Revoke(ctx, claims); err != nil {
+		t.Fatalf("unexpected error revoking token: %v", err)
+	}
+	store.AssertExpectations(t)
+
+	published := fakeStan.messages[revoker.subj]
+	if got, want := len(published), 1; got != want {
+		t.Fatalf("wrong number of revocations published: %v, want %v", got, want)
+	}
+	event := &events.TokenRevoked{}
+	if err := proto.Unmarshal(published[0], event); err != nil {
+		t.Fatalf("unable to unmarshal revocation: %v", err)
+	}
+	if got, want := event.TokenId, "1"; got != want {
+		t.Errorf("wrong revoked token id: %v, want %v", got, want)
+	}
+	if got, _ := ptypes.Timestamp(event.ExpiresAt); !got.Equal(expiresAt) {
+		t.Errorf("wrong revoked token expiry: %v, want %v", got, expiresAt)
+	}
+
+	if err := revoker.Revoke(ctx, middleware.Claims{Email: email}); err == nil {
+		t.Error("expected error revoking a token without an id")
+	}
+}
+
+func TestTokenRevokerUser(t *testing.T) {
+	ctx := context.Background()
+	store := new(mockRevocationStore)
+	fakeStan := newFakeNatsConn()
+	revoker, err := newTokenRevoker(store, fakeStan)
+	if err != nil {
+		t.Fatalf("unable to create token revoker: %v", err)
+	}
+
+	// tokens issued up to and including the current second stay revoked until the last of them expires
+	before := time.Now().Truncate(time.Second).Add(time.Second)
+	var issuedBefore time.Time
+	store.On("RevokeUser", ctx, uid, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		issuedBefore = args.Get(2).(time.Time)
+	}).Return(nil)
+	if err := revoker.RevokeUser(ctx, uid); err != nil {
+		t.Fatalf("unexpected error revoking user: %v", err)
+	}
+	store.AssertExpectations(t)
+	if issuedBefore.Before(before) || issuedBefore.After(time.Now().Add(time.Second)) {
+		t.Errorf("wrong issued before time: %v, want about %v", issuedBefore, before)
+	}
+	if !issuedBefore.Equal(issuedBefore.Truncate(time.Second)) {
+		t.Errorf("issued before time has sub-second precision: %v", issuedBefore)
+	}
+	// a token issued in the same second as the revocation carries the same iat
+	if issuedAt := time.Unix(time.Now().Unix(), 0); !issuedAt.Before(issuedBefore) {
+		t.Errorf("token issued at %v is not revoked by %v", issuedAt, issuedBefore)
+	}
+
+	published := fakeStan.messages[revoker.subj]
+	if got, want := len(published), 1; got != want {
+		t.Fatalf("wrong number of revocations published: %v, want %v", got, want)
+	}
+	event := &events.TokenRevoked{}
+	if err := proto.Unmarshal(published[0], event); err != nil {
+		t.Fatalf("unable to unmarshal revocation: %v", err)
+	}
+	if got, want := event.UserId, uid; got != want {
+		t.Errorf("wrong revoked user id: %v, want %v", got, want)
+	}
+	if got, _ := ptypes.Timestamp(event.IssuedBefore); !got.Equal(issuedBefore) {
+		t.Errorf("wrong issued before time: %v, want %v", got, issuedBefore)
+	}
+	if got, _ := ptypes.Timestamp(event.ExpiresAt); !got.Equal(issuedBefore.Add(middleware.DefaultTokenTTL)) {
+		t.Errorf("wrong revocation expiry: %v, want %v", got, issuedBefore.Add(middleware.DefaultTokenTTL))
+	}
+}
+
+func TestTokenRevokerIsRevoked(t *testing.T) {
+	ctx := context.Background()
+	issuedAt := time.Now().Truncate(time.Second)
+	claims := middleware.Claims{Email: email, ID: uid, TokenID: "1", IssuedAt: issuedAt.Unix()}
+
+	tests := []struct {
+		name        string
+		tokenRevoke bool
+		userRevoke  bool
+	}{
+		{"not revoked", false, false},
+		{"token revoked", true, false},
+		{"user revoked", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			store := new(mockRevocationStore)
+			revoker, err := newTokenRevoker(store, newFakeNatsConn())
+			if err != nil {
+				currTest.Fatalf("unable to create token revoker: %v", err)
+			}
+			store.On("IsRevoked", ctx, "1").Return(tt.tokenRevoke, nil)
+			store.On("IsUserRevoked", ctx, uid, issuedAt).Return(tt.userRevoke, nil)
+
+			revoked, err := revoker.IsRevoked(ctx, claims)
+			if err != nil {
+				currTest.Fatalf("unexpected error: %v", err)
+			}
+			if want := tt.tokenRevoke || tt.userRevoke; revoked != want {
+				currTest.Errorf("wrong revoked: %v, want %v", revoked, want)
+			}
+		})
+	}
+}
@@ -3,58 +3,55 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"time"
 
 	"github.com/basilnsage/mwn-ticketapp-common/events"
-	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/protobuf/proto"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// codes of the problems the user routes respond with
+const (
+	codeInvalidCredentials       = "invalid_credentials"
+	codeTooManyAttempts          = "too_many_attempts"
+	codeSignInExpired            = "sign_in_expired"
+	codeAccountDisabled          = "account_disabled"
+	codePasswordResetRequired    = "password_reset_required"
+	codeInvalidPassword          = "invalid_password"
+	codeWrongPassword            = "wrong_current_password"
+	codeInvalidResetToken        = "invalid_reset_token"
+	codeInvalidVerificationToken = "invalid_verification_token"
+	codeEmailVerified            = "email_already_verified"
+	codeEmailInUse               = "email_in_use"
+	codeUserNotFound             = "user_not_found"
+	codeCannotDisableSelf        = "cannot_disable_self"
+	codeTwoFactorEnabled         = "two_factor_enabled"
+	codeTwoFactorDisabled        = "two_factor_disabled"
+	codeNotEnrolling             = "two_factor_not_enrolling"
+	codeInvalidCode              = "invalid_code"
+	codeUnknownProvider          = "unknown_provider"
+	codeProviderUnavailable      = "provider_unavailable"
+	codeProviderSignInFailed     = "provider_sign_in_failed"
+	codeProviderNoEmail          = "provider_no_email"
+	codeInvalidSignInState       = "invalid_sign_in_state"
+	codeUnsupportedMediaType     = "unsupported_media_type"
+)
+
+// userFormData is the credentials users sign up and sign in with
+// internal clients can send them as an events.SignIn message
 type userFormData struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username string `json:"username" form:"username" binding:"required"`
+	Password string `json:"password" form:"password" binding:"required"`
 }
 
-func userFromForm(ctx *gin.Context) (*users.User, int, string, error) {
-	data := new(userFormData)
-	err := ctx.Bind(data)
-	if err != nil {
-		return nil, http.StatusBadRequest,
-			"please provide a username and password", fmt.Errorf("ctx.Bind: %v", err)
-	}
-	userHash, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, http.StatusInternalServerError, "unable to hash password", err
+func (d *userFormData) bindProto(data []byte) error {
+	msg := new(events.SignIn)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("proto.Unmarshal: %v", err)
 	}
-	userObj, err := users.NewUser(data.Username, data.Password, userHash)
-	if err != nil {
-		return nil, http.StatusBadRequest, "malformed request", err
-	}
-	return userObj, http.StatusOK, "credentials parsed", nil
-}
-
-func userFromPayload(ctx *gin.Context) (*users.User, int, string, error) {
-	data, err := ctx.GetRawData()
-	if err != nil {
-		return nil, http.StatusBadRequest, "please provide a username and password", err
-	}
-	userProto := &events.SignIn{}
-	if err = proto.Unmarshal(data, userProto); err != nil {
-		return nil, http.StatusBadRequest, "unable to parse provided credentials", err
-	}
-	userEmail, userPass := userProto.Username, userProto.Password
-	userHash, err := bcrypt.GenerateFromPassword([]byte(userPass), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, http.StatusInternalServerError, "unable to hash password", err
-	}
-	userObj, err := users.NewUser(userEmail, userPass, userHash)
-	if err != nil {
-		return nil, http.StatusInternalServerError, "unable to create the user object", err
-	}
-	return userObj, http.StatusOK, "credentials parsed", nil
+	d.Username, d.Password = msg.Username, msg.Password
+	return nil
 }
 
 func UseUserRoutes(r *gin.Engine, conf config) {
@@ -63,22 +60,80 @@ func UseUserRoutes(r *gin.Engine, conf config) {
 	// keep following along with class first and see what they do about /signout and /signup
 	// how they implement these routes will affect how to organize/apply the middlewear
 	{
+		userRoutePrefix.GET("/.well-known/jwks.json", func(ctx *gin.Context) {
+			JWKS(ctx, conf.authValidator)
+		})
 		userRoutePrefix.GET("/whoami", func(ctx *gin.Context) {
-			Whoami(ctx, conf.authValidator)
+			Whoami(ctx, conf.authValidator, conf.revoker)
 		})
 		userRoutePrefix.POST("/signup", func(ginCtx *gin.Context) {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
-			SignupUser(ctx, ginCtx, conf.collection, conf.authValidator)
+			SignupUser(ctx, ginCtx, conf.collection, conf.authValidator, conf.refreshTokens, conf.verifier)
 		})
 		userRoutePrefix.POST("/signin", func(ginCtx *gin.Context) {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
-			Signin(ctx, ginCtx, conf.collection, conf.authValidator)
+			Signin(ctx, ginCtx, conf.collection, conf.authValidator, conf.refreshTokens, conf.throttle, conf.twoFactor)
+		})
+		userRoutePrefix.POST("/refresh", func(ginCtx *gin.Context) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			Refresh(ctx, ginCtx, conf.refreshTokens, conf.collection, conf.authValidator)
 		})
-		userRoutePrefix.GET("/signout", func(ctx *gin.Context) {
-			ctx.SetCookie("auth-jwt", "", -1, "", "", false, true)
-			ctx.Status(http.StatusOK)
+		// signing out changes state, so it is a POST that other sites cannot trigger with a link or an image
+		userRoutePrefix.POST("/signout", func(ginCtx *gin.Context) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			Signout(ctx, ginCtx, conf.refreshTokens, conf.authValidator, conf.revoker)
 		})
 	}
+
+	verifyRoutes := userRoutePrefix.Group("/verify")
+	{
+		verifyRoutes.POST("", withTimeout(conf.verifier.Verify))
+		verifyRoutes.POST("/resend", RequireSession(conf.authValidator, conf.revoker), withTimeout(conf.verifier.Resend))
+	}
+
+	// providers send users back to the callback with a GET, so both routes are GETs
+	oidcRoutes := userRoutePrefix.Group("/oidc/:provider")
+	{
+		oidcRoutes.GET("/start", withTimeout(conf.oidc.Start))
+		oidcRoutes.GET("/callback", withTimeout(conf.oidc.Callback))
+	}
+
+	twoFactorRoutes := userRoutePrefix.Group("/2fa")
+	{
+		twoFactorRoutes.POST("/enroll", RequireSession(conf.authValidator, conf.revoker), withTimeout(conf.twoFactor.Enroll))
+		twoFactorRoutes.POST("/verify", RequireSession(conf.authValidator, conf.revoker), withTimeout(conf.twoFactor.Verify))
+		twoFactorRoutes.POST("/disable", RequireSession(conf.authValidator, conf.revoker), withTimeout(conf.twoFactor.Disable))
+		// users are not signed in yet, the challenge cookie says who they are
+		twoFactorRoutes.POST("/signin", withTimeout(conf.twoFactor.Signin))
+	}
+
+	passwordRoutes := userRoutePrefix.Group("/password")
+	{
+		passwordRoutes.POST("", RequireSession(conf.authValidator, conf.revoker), withTimeout(conf.passwords.Change))
+		passwordRoutes.POST("/forgot", withTimeout(conf.passwords.Forgot))
+		passwordRoutes.POST("/reset", withTimeout(conf.passwords.Reset))
+	}
+
+	// user management is only for admins
+	adminRoutes := userRoutePrefix.Group("/admin", RequireSession(conf.authValidator, conf.revoker), middleware.RequireRole(middleware.RoleAdmin))
+	{
+		adminRoutes.GET("", withTimeout(conf.admin.List))
+		adminRoutes.GET("/:id", withTimeout(conf.admin.Get))
+		adminRoutes.POST("/:id/disable", withTimeout(conf.admin.Disable))
+		adminRoutes.POST("/:id/enable", withTimeout(conf.admin.Enable))
+		adminRoutes.POST("/:id/reset-password", withTimeout(conf.admin.RequirePasswordReset))
+	}
+}
+
+// withTimeout gives handler a context that times out after 10 seconds
+func withTimeout(handler func(context.Context, *gin.Context)) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		handler(ctx, ginCtx)
+	}
 }
@@ -4,46 +4,89 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 
-	e "github.com/basilnsage/mwn-ticketapp/auth/errors"
 	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
 	"github.com/gin-gonic/gin"
 )
 
-func Signin(ctx context.Context, ginCtx *gin.Context, crud users.CRUD, signer users.Signer) {
-	if err := signin(ctx, ginCtx, crud, signer); err != nil {
-		cError := e.NewBaseError(http.StatusBadRequest, "invalid credentials")
-		_ = ginCtx.Error(err).SetType(1 << 1).SetMeta(*cError)
+// errInvalidCredentials is returned for unknown emails and wrong passwords, the failures the throttle counts
+var errInvalidCredentials = errors.New("invalid credentials")
+
+func Signin(ctx context.Context, ginCtx *gin.Context, crud users.CRUD, signer users.Signer, store users.RefreshStore, throttle *signinThrottle, mfa *twoFactor) {
+	data := new(userFormData)
+	if err := bind(ginCtx, data); err != nil {
+		bindError(ginCtx, err, "please provide a username and password")
+		return
+	}
+
+	// locked out clients are turned away before their password is checked, so guessing costs no bcrypt time
+	ip := clientIP(ginCtx)
+	if wait, err := throttle.RetryAfter(ctx, data.Username, ip); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+		return
+	} else if wait > 0 {
+		throttle.Rejected("locked_out")
+		ginCtx.Header("Retry-After", retryAfterSeconds(wait))
+		problem.Abort(ginCtx, problem.New(http.StatusTooManyRequests, codeTooManyAttempts, "too many failed sign in attempts, try again later").WithCause(errors.New("sign in locked out")))
+		return
+	}
+
+	// the account status is only checked once the password matches, so it is not revealed to anyone else
+	mfaRequired, err := signin(ctx, ginCtx, data, crud, signer, store, mfa)
+	if err == errInvalidCredentials {
+		if err := throttle.Failed(ctx, data.Username, ip); err != nil {
+			problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+			return
+		}
+		problem.Abort(ginCtx, problem.Unauthorized(codeInvalidCredentials, "invalid credentials").WithCause(err))
+	} else if err == users.ErrUserDisabled {
+		throttle.Rejected("account_disabled")
+		problem.Abort(ginCtx, problem.Forbidden(codeAccountDisabled, "account is disabled").WithCause(err))
+	} else if err == users.ErrPasswordResetRequired {
+		throttle.Rejected("password_reset_required")
+		problem.Abort(ginCtx, problem.Forbidden(codePasswordResetRequired, "password reset required").WithCause(err))
+	} else if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+	} else if mfaRequired {
+		// failures are only forgotten once the code is entered too, or codes could be guessed between passwords
+		render(ginCtx, http.StatusOK, gin.H{"mfaRequired": true})
 	} else {
+		// the user is signed in even if this fails, their failures are forgotten once they expire
+		if err := throttle.Succeeded(ctx, data.Username); err != nil {
+			log.Printf("unable to reset sign in failures: %v", err)
+		}
 		ginCtx.Status(http.StatusOK)
 	}
 }
 
-func signin(ctx context.Context, ginCtx *gin.Context, crud users.CRUD, signer users.Signer) error {
-	newUser, _, _, err := userFromForm(ginCtx)
+// signin sets the session cookies, or starts a challenge for users with two-factor authentication and reports that it did
+func signin(ctx context.Context, ginCtx *gin.Context, data *userFormData, crud users.CRUD, signer users.Signer, store users.RefreshStore, mfa *twoFactor) (bool, error) {
+	found, err := crud.Read(ctx, users.User{Email: data.Username})
 	if err != nil {
-		return fmt.Errorf("unable to parse user from payload: %v", err)
+		return false, fmt.Errorf("unable to fetch users from DB: %v", err)
 	}
-
-	exists, err := newUser.Exists(ctx, crud)
-	if err != nil {
-		return err
+	if len(found) != 1 {
+		return false, errInvalidCredentials
 	}
-	if !exists {
-		return errors.New("user does not exist")
+	if err := found[0].CheckPassword(data.Password); err != nil {
+		return false, errInvalidCredentials
 	}
-	if passwordOk, err := newUser.DoesPassMatch(ctx, crud); err != nil {
-		return err
-	} else if !passwordOk {
-		return errors.New("user password does not match")
+	if found[0].TOTPEnabled {
+		if err := found[0].CanSignIn(); err != nil {
+			return false, err
+		}
+		return true, mfa.challenge(ctx, ginCtx, found[0])
 	}
 
-	userJWT, err := newUser.CreateSessionToken(ctx, crud, signer)
+	// the user is read again as the session is created, which rejects users that cannot sign in
+	userJWT, refreshToken, err := users.User{Email: found[0].Email}.CreateSession(ctx, crud, signer, store)
 	if err != nil {
-		return err
+		return false, err
 	}
-	ginCtx.SetCookie("auth-jwt", userJWT, 3600, "", "", false, true)
+	setSessionCookies(ginCtx, userJWT, refreshToken)
 
-	return nil
+	return false, nil
 }
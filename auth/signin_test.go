@@ -5,6 +5,8 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/mock"
 	"net/http"
@@ -15,7 +17,11 @@ import (
 func TestSignin(t *testing.T) {
 	signer := new(mockSigner)
 	crud := new(mockCRUD)
+	store := new(mockRefreshStore)
+	throttle, attempts, _ := newTestThrottle()
 	ctx := context.Background()
+	// signing in forgets the account's earlier failures
+	attempts.attempts["account:"+email] = loginAttempts{Failures: 3}
 	//user, err := users.NewUser(email, pass, passHash)
 	//if err != nil {
 	//	t.Fatalf("unable to create new user: %v", err)
@@ -24,6 +30,7 @@ func TestSignin(t *testing.T) {
 		Email: email,
 		Hash:  passHash,
 		Uid:   "0",
+		Roles: []string{middleware.RoleAdmin},
 	}
 
 	payload, err := json.Marshal(&userFormData{Username: email, Password: pass})
@@ -34,10 +41,8 @@ func TestSignin(t *testing.T) {
 	crud.On("Read", ctx, mock.MatchedBy(checkTestUser)).Return([]users.User{*user}, nil)
 	crud.On("Write", ctx, mock.MatchedBy(checkTestUser)).Return(uid, nil)
 	//crud.On("Read", ctx, mock.MatchedBy(checkTestUser)).Return([]users.User{*user}, nil)
-	signer.On("Sign", map[string]interface{}{
-		"email": email,
-		"id":    "0",
-	}).Return(jwtString, nil)
+	signer.On("Sign", mock.MatchedBy(checkSessionClaims("0", user.Roles))).Return(jwtString, nil)
+	store.On("Create", ctx, mock.MatchedBy(checkRefreshToken("0"))).Return(nil)
 
 	gin.SetMode(gin.TestMode)
 	eng := gin.Default()
@@ -48,7 +53,7 @@ func TestSignin(t *testing.T) {
 		}
 	})
 	eng.POST("/test", func(ginCtx *gin.Context) {
-		Signin(ctx, ginCtx, crud, signer)
+		Signin(ctx, ginCtx, crud, signer, store, throttle, nil)
 	})
 
 	w := httptest.NewRecorder()
@@ -77,5 +82,58 @@ func TestSignin(t *testing.T) {
 			t.Error("auth-jwt cookie not set")
 		}
 	}
+	checkRefreshCookie(t, resp)
+	checkCSRFCookie(t, resp)
+	store.AssertExpectations(t)
+	if got := attempts.attempts["account:"+email].Failures; got != 0 {
+		t.Errorf("account has %v failures after signing in, want 0", got)
+	}
+}
+
+func TestSigninRejected(t *testing.T) {
+	payload, err := json.Marshal(&userFormData{Username: email, Password: pass})
+	if err != nil {
+		t.Fatalf("json.marshal: %v", err)
+	}
 
+	tests := []struct {
+		name         string
+		user         users.User
+		expectedCode int
+	}{
+		{"disabled user", users.User{Email: email, Hash: passHash, Uid: "0", Disabled: true}, http.StatusForbidden},
+		{"password reset required", users.User{Email: email, Hash: passHash, Uid: "0", PasswordResetRequired: true}, http.StatusForbidden},
+		{"wrong password", users.User{Email: email, Hash: []byte("$2a$10$notthehash"), Uid: "0", Disabled: true}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			ctx := context.Background()
+			signer := new(mockSigner)
+			crud := new(mockCRUD)
+			store := new(mockRefreshStore)
+			throttle, _, _ := newTestThrottle()
+			crud.On("Read", ctx, mock.MatchedBy(checkTestUser)).Return([]users.User{tt.user}, nil)
+
+			gin.SetMode(gin.TestMode)
+			eng := gin.New()
+			eng.Use(problem.Handler())
+			eng.POST("/test", func(ginCtx *gin.Context) {
+				Signin(ctx, ginCtx, crud, signer, store, throttle, nil)
+			})
+
+			w := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/test", bytes.NewReader(payload))
+			if err != nil {
+				currTest.Fatalf("http.NewRequest: %v", err)
+			}
+			req.Header.Add("Content-Type", "application/json")
+			eng.ServeHTTP(w, req)
+
+			if got, want := w.Code, tt.expectedCode; got != want {
+				currTest.Errorf("wrong response code: %v, want: %v", got, want)
+			}
+			signer.AssertNotCalled(currTest, "Sign", mock.Anything)
+			store.AssertNotCalled(currTest, "Create", mock.Anything, mock.Anything)
+		})
+	}
 }
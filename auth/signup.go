@@ -2,54 +2,65 @@ package main
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"log"
 	"net/http"
 
-	e "github.com/basilnsage/mwn-ticketapp/auth/errors"
 	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
 )
 
-func SignupUser(ctx context.Context, ginCtx *gin.Context, crud users.CRUD, signer users.Signer) {
-	if err, cError := signupUserFlow(ctx, ginCtx, crud, signer); err != nil {
-		_ = ginCtx.Error(err).SetType(1 << 1).SetMeta(cError)
+func SignupUser(ctx context.Context, ginCtx *gin.Context, crud users.CRUD, signer users.Signer, store users.RefreshStore, verifier *emailVerifier) {
+	if err := signupUserFlow(ctx, ginCtx, crud, signer, store, verifier); err != nil {
+		problem.Abort(ginCtx, err)
 	} else {
-		ginCtx.String(http.StatusCreated, "signup complete")
+		render(ginCtx, http.StatusCreated, gin.H{"status": "signup complete"})
 	}
 }
 
-func signupUserFlow(ctx context.Context, ginCtx *gin.Context, crud users.CRUD, signer users.Signer) (error, *e.BaseError) {
-	// parse raw binary data from request
-	// this should be a protobuf message
-	//newUser, statusCode, status, err := userFromPayload(ginCtx)
-	newUser, statusCode, status, err := userFromForm(ginCtx)
+func signupUserFlow(ctx context.Context, ginCtx *gin.Context, crud users.CRUD, signer users.Signer, store users.RefreshStore, verifier *emailVerifier) *problem.Error {
+	data := new(userFormData)
+	if err := bind(ginCtx, data); err != nil {
+		return bindProblem(err, "please provide a username and password")
+	}
+	userHash, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return problem.Internal("unable to hash password", err)
+	}
+	newUser, err := users.NewUser(data.Username, data.Password, userHash)
 	if err != nil {
-		return err, e.NewBaseError(statusCode, status)
+		return problem.Validation(problem.CodeValidation, "malformed request").WithCause(err)
 	}
 
 	// check for existng user
 	userExists, err := newUser.Exists(ctx, crud)
 	if err != nil {
-		return err, e.NewBaseError(http.StatusInternalServerError, "signup failed")
+		return problem.Internal("signup failed", err)
 	}
 	if userExists {
-		return errors.New("user already exists"), e.NewBaseError(http.StatusBadRequest, "signup failed")
+		return problem.Conflict(codeEmailInUse, "email is in use, sign in with your password")
 	}
 
 	// no errors fetching user and user does not exist --> lets make that user
-	if uid, err := newUser.Write(ctx, crud); err != nil {
-		return err, e.NewBaseError(http.StatusBadRequest, "signup failed")
-	} else {
-		log.Printf("user created with id: %v", uid)
+	uid, err := newUser.Write(ctx, crud)
+	if err != nil {
+		return problem.Internal("signup failed", err)
+	}
+	log.Printf("user created with id: %v", uid)
+
+	// the user starts out unverified, if the link cannot be sent they can ask for another one once signed in
+	if err := verifier.Send(ctx, newUser.Email, fmt.Sprint(uid)); err != nil {
+		log.Printf("unable to send verification email: %v", err)
 	}
 
 	// now create a JWT for the user and return this to the client
-	userJwt, err := newUser.CreateSessionToken(ctx, crud, signer)
+	userJwt, refreshToken, err := newUser.CreateSession(ctx, crud, signer, store)
 	if err != nil {
-		return err, e.NewBaseError(http.StatusBadRequest, "signup failed")
+		return problem.Internal("signup failed", err)
 	}
-	ginCtx.SetCookie("auth-jwt", userJwt, 3600, "", "", false, true)
+	setSessionCookies(ginCtx, userJwt, refreshToken)
 
-	return nil, nil
+	return nil
 }
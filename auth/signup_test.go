@@ -4,27 +4,55 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"github.com/basilnsage/mwn-ticketapp/auth/mail"
 	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/mock"
-	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 )
 
 func TestSignupFlow(t *testing.T) {
+	t.Run("mailed", func(currTest *testing.T) {
+		testSignupFlow(currTest, nil)
+	})
+	// the user can ask for another link once signed in
+	t.Run("mail fails", func(currTest *testing.T) {
+		testSignupFlow(currTest, errors.New("mail down"))
+	})
+}
+
+func testSignupFlow(t *testing.T, mailErr error) {
 	signer := new(mockSigner)
 	crud := new(mockCRUD)
+	store := new(mockRefreshStore)
+	verifications := new(mockVerificationStore)
+	mailer := new(mockMailer)
+	verifier := &emailVerifier{verifications: verifications, mailer: mailer, verifyURL: verifyURL}
 	ctx := context.Background()
 
+	// new users start out unverified
 	crud.On("Read", ctx, mock.MatchedBy(checkTestUser)).Return(make([]users.User, 0), nil)
-	crud.On("Write", ctx, mock.MatchedBy(checkTestUser)).Return(uid, nil)
-	signer.On("Sign", map[string]interface{}{
-		"email": email,
-		"id":    uid,
-	}).Return(jwtString, nil)
+	crud.On("Write", ctx, mock.MatchedBy(func(u users.User) bool {
+		return checkTestUser(u) && cmp.Equal(u.Roles, users.DefaultRoles) && u.Unverified
+	})).Return(uid, nil)
+	signer.On("Sign", mock.MatchedBy(func(c jwt.Claims) bool {
+		return checkSessionClaims(uid, users.DefaultRoles)(c) && !c.(*middleware.Claims).EmailVerified
+	})).Return(jwtString, nil)
+	store.On("Create", ctx, mock.MatchedBy(checkRefreshToken(uid))).Return(nil)
+	verifications.On("Create", ctx, mock.MatchedBy(func(v users.EmailVerification) bool {
+		return v.Email == email && v.UserID == uid && v.Hash != ""
+	})).Return(nil)
+	mailer.On("Send", ctx, mock.MatchedBy(func(msg mail.Message) bool {
+		return msg.To == email && strings.Contains(msg.Body, verifyURL+"?token=")
+	})).Return(mailErr)
 
 	gin.SetMode(gin.TestMode)
 	eng := gin.Default()
@@ -35,7 +63,7 @@ func TestSignupFlow(t *testing.T) {
 		}
 	})
 	eng.POST("/test", func(ginCtx *gin.Context) {
-		SignupUser(ctx, ginCtx, crud, signer)
+		SignupUser(ctx, ginCtx, crud, signer, store, verifier)
 	})
 
 	w := httptest.NewRecorder()
@@ -55,8 +83,16 @@ func TestSignupFlow(t *testing.T) {
 	if got, want := resp.StatusCode, http.StatusCreated; got != want {
 		t.Errorf("wrong response code: %v, want: %v", got, want)
 	}
-	respString, _ := ioutil.ReadAll(resp.Body)
-	if got, want := string(respString), "signup complete"; got != want {
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	if got, want := body["status"], "signup complete"; got != want {
 		t.Errorf("wrong response status: %v, want: %v", got, want)
 	}
+	checkRefreshCookie(t, resp)
+	store.AssertExpectations(t)
+	signer.AssertExpectations(t)
+	verifications.AssertExpectations(t)
+	mailer.AssertExpectations(t)
 }
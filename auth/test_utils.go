@@ -3,10 +3,18 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/basilnsage/mwn-ticketapp/auth/mail"
 	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
 )
 
 var (
@@ -25,15 +33,17 @@ var (
 		"email": email,
 		"id":    uid,
 	}
-	sampleClaims = users.Claims{
+	sampleClaims = middleware.Claims{
 		Email: email,
 		ID:    uid,
+		Roles: users.DefaultRoles,
 	}
-	jwtString = fmt.Sprintf("%s.%s.%s", header, payload, sig)
-	cookie    = http.Cookie{
-		Name:  "auth-jwt",
-		Value: jwtString,
+	sampleIdentity = users.Identity{
+		Email: email,
+		ID:    uid,
+		Roles: users.DefaultRoles,
 	}
+	jwtString = fmt.Sprintf("%s.%s.%s", header, payload, sig)
 )
 
 type mockSigner struct {
@@ -44,7 +54,43 @@ type mockCRUD struct {
 	mock.Mock
 }
 
-func (m *mockSigner) Sign(claims map[string]interface{}) (string, error) {
+type mockAdminStore struct {
+	mock.Mock
+}
+
+type mockRefreshStore struct {
+	mock.Mock
+}
+
+type mockPasswordStore struct {
+	mock.Mock
+}
+
+type mockResetStore struct {
+	mock.Mock
+}
+
+type mockMailer struct {
+	mock.Mock
+}
+
+type mockVerifyStore struct {
+	mock.Mock
+}
+
+type mockVerificationStore struct {
+	mock.Mock
+}
+
+type mockRevoker struct {
+	mock.Mock
+}
+
+type mockRevocationStore struct {
+	mock.Mock
+}
+
+func (m *mockSigner) Sign(claims jwt.Claims) (string, error) {
 	args := m.Called(claims)
 	return args.String(0), args.Error(1)
 }
@@ -59,6 +105,412 @@ func (m *mockCRUD) Write(ctx context.Context, user users.User) (interface{}, err
 	return args.Get(0).(interface{}), args.Error(1)
 }
 
+func (m *mockAdminStore) List(ctx context.Context, q users.UserQuery) ([]users.User, error) {
+	args := m.Called(ctx, q)
+	return args.Get(0).([]users.User), args.Error(1)
+}
+
+func (m *mockAdminStore) ReadID(ctx context.Context, id string) (*users.User, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*users.User), args.Error(1)
+}
+
+func (m *mockAdminStore) SetDisabled(ctx context.Context, id string, disabled bool) (bool, error) {
+	args := m.Called(ctx, id, disabled)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockAdminStore) RequirePasswordReset(ctx context.Context, id string) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockRefreshStore) Create(ctx context.Context, token users.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *mockRefreshStore) Rotate(ctx context.Context, hash string) (*users.RefreshToken, error) {
+	args := m.Called(ctx, hash)
+	return args.Get(0).(*users.RefreshToken), args.Error(1)
+}
+
+func (m *mockRefreshStore) Revoke(ctx context.Context, hash string) error {
+	args := m.Called(ctx, hash)
+	return args.Error(0)
+}
+
+func (m *mockRefreshStore) RevokeUser(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *mockPasswordStore) ReadID(ctx context.Context, id string) (*users.User, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*users.User), args.Error(1)
+}
+
+func (m *mockPasswordStore) SetPassword(ctx context.Context, id string, hash []byte) (bool, error) {
+	args := m.Called(ctx, id, hash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockResetStore) Create(ctx context.Context, reset users.PasswordReset) error {
+	args := m.Called(ctx, reset)
+	return args.Error(0)
+}
+
+func (m *mockResetStore) Consume(ctx context.Context, hash string) (*users.PasswordReset, error) {
+	args := m.Called(ctx, hash)
+	return args.Get(0).(*users.PasswordReset), args.Error(1)
+}
+
+func (m *mockResetStore) RevokeUser(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg mail.Message) error {
+	args := m.Called(ctx, msg)
+	return args.Error(0)
+}
+
+func (m *mockVerifyStore) SetVerified(ctx context.Context, id string) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockVerificationStore) Create(ctx context.Context, verification users.EmailVerification) error {
+	args := m.Called(ctx, verification)
+	return args.Error(0)
+}
+
+func (m *mockVerificationStore) Consume(ctx context.Context, hash string) (*users.EmailVerification, error) {
+	args := m.Called(ctx, hash)
+	return args.Get(0).(*users.EmailVerification), args.Error(1)
+}
+
+func (m *mockVerificationStore) RevokeUser(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *mockRevoker) Revoke(ctx context.Context, claims middleware.Claims) error {
+	args := m.Called(ctx, claims)
+	return args.Error(0)
+}
+
+func (m *mockRevoker) RevokeUser(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *mockRevoker) IsRevoked(ctx context.Context, claims middleware.Claims) (bool, error) {
+	args := m.Called(ctx, claims)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockRevocationStore) Revoke(ctx context.Context, tokenId string, expiresAt time.Time) error {
+	args := m.Called(ctx, tokenId, expiresAt)
+	return args.Error(0)
+}
+
+func (m *mockRevocationStore) IsRevoked(ctx context.Context, tokenId string) (bool, error) {
+	args := m.Called(ctx, tokenId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockRevocationStore) RevokeUser(ctx context.Context, userID string, issuedBefore, expiresAt time.Time) error {
+	args := m.Called(ctx, userID, issuedBefore, expiresAt)
+	return args.Error(0)
+}
+
+func (m *mockRevocationStore) IsUserRevoked(ctx context.Context, userID string, issuedAt time.Time) (bool, error) {
+	args := m.Called(ctx, userID, issuedAt)
+	return args.Bool(0), args.Error(1)
+}
+
+// memoryAttempts is an attemptStore for tests
+type memoryAttempts struct {
+	mu       sync.Mutex
+	attempts map[string]loginAttempts
+}
+
+func newMemoryAttempts() *memoryAttempts {
+	return &memoryAttempts{attempts: map[string]loginAttempts{}}
+}
+
+func (m *memoryAttempts) Get(_ context.Context, key string) (loginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attempts[key], nil
+}
+
+func (m *memoryAttempts) Fail(_ context.Context, key string, _ time.Time) (loginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.attempts[key]
+	a.Failures++
+	m.attempts[key] = a
+	return a, nil
+}
+
+func (m *memoryAttempts) Lock(_ context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.attempts[key]
+	if until.After(a.LockedUntil) {
+		a.LockedUntil = until
+	}
+	m.attempts[key] = a
+	return nil
+}
+
+func (m *memoryAttempts) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+// memoryUsers is a users.CRUD, users.LinkedAccountStore and users.TwoFactorStore for tests
+type memoryUsers struct {
+	mu    sync.Mutex
+	users []users.User
+}
+
+func (m *memoryUsers) Read(_ context.Context, user users.User) ([]users.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found []users.User
+	for _, u := range m.users {
+		if u.Email == user.Email {
+			found = append(found, u)
+		}
+	}
+	return found, nil
+}
+
+func (m *memoryUsers) Write(_ context.Context, user users.User) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user.Uid = fmt.Sprintf("%024x", len(m.users)+1)
+	m.users = append(m.users, user)
+	return user.Uid, nil
+}
+
+func (m *memoryUsers) ReadLinked(_ context.Context, account users.LinkedAccount) (*users.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		for _, l := range u.LinkedAccounts {
+			if l == account {
+				return &u, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryUsers) Link(_ context.Context, id string, account users.LinkedAccount) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, u := range m.users {
+		if u.Uid == id {
+			m.users[i].LinkedAccounts = append(u.LinkedAccounts, account)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryUsers) index(id string) int {
+	for i, u := range m.users {
+		if u.Uid == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memoryUsers) ReadID(_ context.Context, id string) (*users.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.index(id); i >= 0 {
+		u := m.users[i]
+		return &u, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryUsers) SetTOTPSecret(_ context.Context, id, secret string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.index(id)
+	if i < 0 || m.users[i].TOTPEnabled {
+		return false, nil
+	}
+	m.users[i].TOTPSecret = secret
+	return true, nil
+}
+
+func (m *memoryUsers) EnableTOTP(_ context.Context, id string, recoveryCodes []string, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.index(id)
+	if i < 0 {
+		return false, nil
+	}
+	m.users[i].TOTPEnabled = true
+	m.users[i].TOTPLastStep = step
+	m.users[i].RecoveryCodes = recoveryCodes
+	return true, nil
+}
+
+func (m *memoryUsers) UseTOTPStep(_ context.Context, id string, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.index(id)
+	if i < 0 || m.users[i].TOTPLastStep >= step {
+		return false, nil
+	}
+	m.users[i].TOTPLastStep = step
+	return true, nil
+}
+
+func (m *memoryUsers) UseRecoveryCode(_ context.Context, id, hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.index(id)
+	if i < 0 {
+		return false, nil
+	}
+	for j, code := range m.users[i].RecoveryCodes {
+		if code == hash {
+			m.users[i].RecoveryCodes = append(m.users[i].RecoveryCodes[:j:j], m.users[i].RecoveryCodes[j+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryUsers) DisableTOTP(_ context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.index(id)
+	if i < 0 {
+		return false, nil
+	}
+	m.users[i].TOTPEnabled = false
+	m.users[i].TOTPSecret = ""
+	m.users[i].RecoveryCodes = nil
+	return true, nil
+}
+
+// memoryMFAChallenges is a users.MFAChallengeStore for tests
+type memoryMFAChallenges struct {
+	mu         sync.Mutex
+	challenges map[string]users.MFAChallenge
+}
+
+func newMemoryMFAChallenges() *memoryMFAChallenges {
+	return &memoryMFAChallenges{challenges: map[string]users.MFAChallenge{}}
+}
+
+func (m *memoryMFAChallenges) Create(_ context.Context, challenge users.MFAChallenge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.challenges[challenge.Hash] = challenge
+	return nil
+}
+
+func (m *memoryMFAChallenges) Read(_ context.Context, hash string) (*users.MFAChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	challenge, ok := m.challenges[hash]
+	if !ok || !challenge.ExpiresAt.After(time.Now()) {
+		return nil, users.ErrInvalidMFAChallenge
+	}
+	return &challenge, nil
+}
+
+func (m *memoryMFAChallenges) Consume(ctx context.Context, hash string) (*users.MFAChallenge, error) {
+	challenge, err := m.Read(ctx, hash)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.challenges, hash)
+	return challenge, err
+}
+
+// memoryOIDCStates is an oidcStateStore for tests
+type memoryOIDCStates struct {
+	mu     sync.Mutex
+	states map[string]oidcState
+}
+
+func newMemoryOIDCStates() *memoryOIDCStates {
+	return &memoryOIDCStates{states: map[string]oidcState{}}
+}
+
+func (m *memoryOIDCStates) Create(_ context.Context, state oidcState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[state.Hash] = state
+	return nil
+}
+
+func (m *memoryOIDCStates) Consume(_ context.Context, hash string) (*oidcState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.states[hash]
+	delete(m.states, hash)
+	if !ok || !state.ExpiresAt.After(time.Now()) {
+		return nil, errInvalidOIDCState
+	}
+	return &state, nil
+}
+
+// newTestThrottle returns a throttle whose counters are registered with a registry of their own
+func newTestThrottle() (*signinThrottle, *memoryAttempts, *prometheus.Registry) {
+	attempts := newMemoryAttempts()
+	reg := prometheus.NewRegistry()
+	throttle, err := newSigninThrottle(attempts, reg)
+	if err != nil {
+		panic(err)
+	}
+	return throttle, attempts, reg
+}
+
 func checkTestUser(u users.User) bool {
 	return u.Email == email
 }
+
+// checkSessionClaims matches the claims of a session token for the test user
+func checkSessionClaims(id string, roles []string) func(jwt.Claims) bool {
+	return func(c jwt.Claims) bool {
+		claims, ok := c.(*middleware.Claims)
+		return ok && claims.Email == email && claims.ID == id && claims.TokenID != "" && claims.ExpiresAt > time.Now().Unix() &&
+			cmp.Equal(claims.Roles, roles)
+	}
+}
+
+func checkRefreshToken(id string) func(users.RefreshToken) bool {
+	return func(token users.RefreshToken) bool {
+		return token.Email == email && token.UserID == id && token.Hash != "" && token.ExpiresAt.After(time.Now())
+	}
+}
+
+// checkPasswordHash matches the bcrypt hash of password
+func checkPasswordHash(password string) func([]byte) bool {
+	return func(hash []byte) bool {
+		return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+	}
+}
+
+// addSessionCookies signs the request in with the session token the way browsers do,
+// sending the CSRF cookie and copying it into the CSRF header
+func addSessionCookies(req *http.Request, token string) {
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	req.AddCookie(&http.Cookie{Name: middleware.CSRFCookie, Value: "csrf-token"})
+	req.Header.Set(middleware.CSRFHeader, "csrf-token")
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// failures are forgotten once a key has had none for attemptWindow
+	attemptWindow = 24 * time.Hour
+	// the first lockout lasts baseLockout and doubles with each failure after it, up to maxLockout
+	baseLockout = time.Minute
+	maxLockout  = time.Hour
+	// an IP is shared by everyone behind the same NAT, so it is allowed more failures than an account
+	maxAccountFailures = 5
+	maxIPFailures      = 20
+)
+
+// loginAttempts are the failed sign ins recorded for a key
+type loginAttempts struct {
+	Failures    int
+	LockedUntil time.Time
+}
+
+// attemptStore counts failed sign ins by key, keys are an account's email or a client's IP
+type attemptStore interface {
+	// Get returns a zero loginAttempts if the key has no failures
+	Get(ctx context.Context, key string) (loginAttempts, error)
+	// Fail adds a failure and keeps the key's record until at least expiresAt, returning the updated record
+	Fail(ctx context.Context, key string, expiresAt time.Time) (loginAttempts, error)
+	// Lock refuses sign ins for the key until until
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets the key's failures
+	Reset(ctx context.Context, key string) error
+}
+
+// loginLimiter locks a key out after maxFailures failed sign ins
+type loginLimiter struct {
+	scope       string
+	maxFailures int
+}
+
+// lockout is how long a key with failures is locked out for
+// no lockout is returned until the key has maxFailures failures
+func (l loginLimiter) lockout(failures int) time.Duration {
+	if failures < l.maxFailures {
+		return 0
+	}
+	// avoid overflowing the shift, the lockout is capped long before then
+	shift := failures - l.maxFailures
+	if shift > 30 {
+		return maxLockout
+	}
+	lockout := baseLockout << uint(shift)
+	if lockout > maxLockout {
+		return maxLockout
+	}
+	return lockout
+}
+
+// key namespaces the value so accounts and IPs cannot collide
+func (l loginLimiter) key(value string) string {
+	return l.scope + ":" + value
+}
+
+// signinThrottle stops clients from guessing passwords
+// every failed sign in counts against both the account and the client's IP,
+// once either has too many failures sign ins are refused, before any password is checked, until its lockout ends
+type signinThrottle struct {
+	store    attemptStore
+	account  loginLimiter
+	ip       loginLimiter
+	failures *prometheus.CounterVec
+	lockouts *prometheus.CounterVec
+}
+
+// newSigninThrottle registers the throttle's counters with reg
+func newSigninThrottle(store attemptStore, reg prometheus.Registerer) (*signinThrottle, error) {
+	t := &signinThrottle{
+		store:   store,
+		account: loginLimiter{"account", maxAccountFailures},
+		ip:      loginLimiter{"ip", maxIPFailures},
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "signin_failures_total",
+			Help: "Number of failed sign ins by reason",
+		}, []string{"reason"}),
+		lockouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "signin_lockouts_total",
+			Help: "Number of times an account or IP was locked out after failed sign ins",
+		}, []string{"scope"}),
+	}
+	for _, c := range []prometheus.Collector{t.failures, t.lockouts} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("unable to register sign in metrics: %v", err)
+		}
+	}
+	return t, nil
+}
+
+// emails are case insensitive, so differently cased guesses count against the same account
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// clientIP returns the IP sign in failures are counted against
+// the ingress appends the address it received the request from to X-Forwarded-For, so only the last entry can be trusted
+// the entries before it are whatever the client sent, gin's ClientIP uses the first one
+func clientIP(ginCtx *gin.Context) string {
+	if forwarded := ginCtx.GetHeader("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+			return ip
+		}
+	}
+	if ip, _, err := net.SplitHostPort(strings.TrimSpace(ginCtx.Request.RemoteAddr)); err == nil {
+		return ip
+	}
+	return ginCtx.Request.RemoteAddr
+}
+
+// RetryAfter returns how long until the account and IP may try to sign in again, 0 if they can try now
+func (t *signinThrottle) RetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []string{t.account.key(accountKey(email)), t.ip.key(ip)} {
+		attempts, err := t.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if remaining := time.Until(attempts.LockedUntil); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// Failed records a failed sign in, locking out the account or IP if it has failed too often
+func (t *signinThrottle) Failed(ctx context.Context, email, ip string) error {
+	t.failures.WithLabelValues("invalid_credentials").Inc()
+	for _, l := range []struct {
+		limiter loginLimiter
+		value   string
+	}{{t.account, accountKey(email)}, {t.ip, ip}} {
+		now := time.Now()
+		attempts, err := t.store.Fail(ctx, l.limiter.key(l.value), now.Add(attemptWindow))
+		if err != nil {
+			return err
+		}
+		if lockout := l.limiter.lockout(attempts.Failures); lockout > 0 {
+			if err := t.store.Lock(ctx, l.limiter.key(l.value), now.Add(lockout)); err != nil {
+				return err
+			}
+			t.lockouts.WithLabelValues(l.limiter.scope).Inc()
+		}
+	}
+	return nil
+}
+
+// Rejected counts a sign in that failed for a reason other than the credentials
+// such as a locked account, which does not count towards a lockout
+func (t *signinThrottle) Rejected(reason string) {
+	t.failures.WithLabelValues(reason).Inc()
+}
+
+// Succeeded forgets the account's failures
+// the IP's failures are kept, or an attacker could reset them by signing in to their own account
+func (t *signinThrottle) Succeeded(ctx context.Context, email string) error {
+	return t.store.Reset(ctx, t.account.key(accountKey(email)))
+}
+
+// retryAfterSeconds rounds up so clients never retry before the lockout ends
+func retryAfterSeconds(d time.Duration) string {
+	return fmt.Sprint(int64(math.Ceil(d.Seconds())))
+}
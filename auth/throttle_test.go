@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	prometrics "github.com/basilnsage/prometheus-gin-metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLoginLimiterLockout(t *testing.T) {
+	limiter := loginLimiter{"account", maxAccountFailures}
+	tests := []struct {
+		failures int
+		lockout  time.Duration
+	}{
+		{0, 0},
+		{maxAccountFailures - 1, 0},
+		{maxAccountFailures, baseLockout},
+		{maxAccountFailures + 1, 2 * baseLockout},
+		{maxAccountFailures + 3, 8 * baseLockout},
+		{maxAccountFailures + 6, maxLockout},
+		{maxAccountFailures + 1000, maxLockout},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.failures), func(currTest *testing.T) {
+			if got, want := limiter.lockout(tt.failures), tt.lockout; got != want {
+				currTest.Errorf("wrong lockout: %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// signinEngine serves Signin for a user whose password is pass
+func signinEngine(crud *mockCRUD, throttle *signinThrottle) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	eng := gin.New()
+	eng.Use(problem.Handler())
+	eng.POST("/test", func(ginCtx *gin.Context) {
+		Signin(context.Background(), ginCtx, crud, new(mockSigner), new(mockRefreshStore), throttle, nil)
+	})
+	return eng
+}
+
+func signinRequest(t *testing.T, eng *gin.Engine, username, password, ip string) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(&userFormData{Username: username, Password: password})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/test", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("http.NewRequest: %v", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, req)
+	return w
+}
+
+func TestSigninAccountLockout(t *testing.T) {
+	crud := new(mockCRUD)
+	crud.On("Read", mock.Anything, mock.Anything).Return([]users.User{{Email: email, Hash: passHash, Uid: uid}}, nil)
+	throttle, _, _ := newTestThrottle()
+	eng := signinEngine(crud, throttle)
+
+	// each failure comes from another IP, only the account is locked out
+	for i := 0; i < maxAccountFailures; i++ {
+		if got, want := signinRequest(t, eng, email, "wrong-password", fmt.Sprintf("10.0.0.%d", i)).Code, http.StatusUnauthorized; got != want {
+			t.Fatalf("wrong status code for failure %v: %v, want %v", i+1, got, want)
+		}
+	}
+
+	// even the right password is refused, differently cased emails are the same account
+	reads := len(crud.Calls)
+	w := signinRequest(t, eng, strings.ToUpper(email), pass, "10.0.1.1")
+	if got, want := w.Code, http.StatusTooManyRequests; got != want {
+		t.Fatalf("wrong status code once locked out: %v, want %v", got, want)
+	}
+	if got, want := w.Header().Get("Retry-After"), fmt.Sprint(int(baseLockout.Seconds())); got != want {
+		t.Errorf("wrong Retry-After: %v, want %v", got, want)
+	}
+	if got := len(crud.Calls); got != reads {
+		t.Errorf("the user was read %v times while locked out, want 0", got-reads)
+	}
+
+	// other accounts from the same IPs can still sign in
+	if got, want := signinRequest(t, eng, "bar@example.com", "wrong-password", "10.0.0.1").Code, http.StatusUnauthorized; got != want {
+		t.Errorf("wrong status code for another account: %v, want %v", got, want)
+	}
+
+	if got, want := testutil.ToFloat64(throttle.failures.WithLabelValues("invalid_credentials")), float64(maxAccountFailures+1); got != want {
+		t.Errorf("wrong invalid_credentials failures: %v, want %v", got, want)
+	}
+	if got, want := testutil.ToFloat64(throttle.failures.WithLabelValues("locked_out")), 1.0; got != want {
+		t.Errorf("wrong locked_out failures: %v, want %v", got, want)
+	}
+	if got, want := testutil.ToFloat64(throttle.lockouts.WithLabelValues("account")), 1.0; got != want {
+		t.Errorf("wrong account lockouts: %v, want %v", got, want)
+	}
+}
+
+func TestSigninIPLockout(t *testing.T) {
+	crud := new(mockCRUD)
+	crud.On("Read", mock.Anything, mock.Anything).Return([]users.User{}, nil)
+	throttle, attempts, _ := newTestThrottle()
+	eng := signinEngine(crud, throttle)
+
+	// guessing a different account each time still counts against the IP
+	for i := 0; i < maxIPFailures; i++ {
+		if got, want := signinRequest(t, eng, fmt.Sprintf("user%d@example.com", i), pass, "10.0.0.1").Code, http.StatusUnauthorized; got != want {
+			t.Fatalf("wrong status code for failure %v: %v, want %v", i+1, got, want)
+		}
+	}
+	if got, want := signinRequest(t, eng, "new@example.com", pass, "10.0.0.1").Code, http.StatusTooManyRequests; got != want {
+		t.Errorf("wrong status code once the IP is locked out: %v, want %v", got, want)
+	}
+	if got, want := signinRequest(t, eng, "new@example.com", pass, "10.0.0.2").Code, http.StatusUnauthorized; got != want {
+		t.Errorf("wrong status code from another IP: %v, want %v", got, want)
+	}
+
+	// the lockout ends
+	a := attempts.attempts["ip:10.0.0.1"]
+	a.LockedUntil = time.Now().Add(-time.Second)
+	attempts.attempts["ip:10.0.0.1"] = a
+	if got, want := signinRequest(t, eng, "new@example.com", pass, "10.0.0.1").Code, http.StatusUnauthorized; got != want {
+		t.Errorf("wrong status code after the lockout: %v, want %v", got, want)
+	}
+	// and the next failure locks the IP out for twice as long
+	if got, want := attempts.attempts["ip:10.0.0.1"].LockedUntil, time.Now().Add(2*baseLockout); got.Before(want.Add(-time.Minute)) || got.After(want) {
+		t.Errorf("IP locked until %v, want about %v", got, want)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name      string
+		forwarded string
+		want      string
+	}{
+		{"no proxy", "", "10.0.0.1"},
+		{"through the ingress", "203.0.113.7", "203.0.113.7"},
+		{"spoofed hops are ignored", "198.51.100.1, 198.51.100.2, 203.0.113.7", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			ginCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ginCtx.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+			ginCtx.Request.RemoteAddr = "10.0.0.1:1234"
+			if tt.forwarded != "" {
+				ginCtx.Request.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(ginCtx); got != tt.want {
+				currTest.Errorf("wrong client IP: %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metricReg := prometrics.NewRegistry()
+	throttle, _, signinReg := newTestThrottle()
+	throttle.Rejected("account_disabled")
+
+	eng := gin.New()
+	eng.Use(metricReg.ReportDuration(nil))
+	eng.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	eng.GET("/metrics", metricsHandler(metricReg, signinReg))
+	eng.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	w := httptest.NewRecorder()
+	eng.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code: %v, want %v", got, want)
+	}
+	body, _ := ioutil.ReadAll(w.Body)
+	for _, want := range []string{
+		`signin_failures_total{reason="account_disabled"} 1`,
+		`request_duration_seconds_count{code="200",method="GET",route="/test"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+}
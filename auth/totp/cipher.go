@@ -0,0 +1,70 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the length of the key secrets are encrypted with, for AES-256
+const KeySize = 32
+
+// sealedPrefix marks secrets encrypted by a SecretCipher
+const sealedPrefix = "v1:"
+
+// SecretCipher encrypts secrets with a server key before they are stored
+// a copy of the database alone does not reveal users' authenticators
+type SecretCipher struct {
+	aead cipher.AEAD
+}
+
+func NewSecretCipher(key []byte) (*SecretCipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %v bytes, got %v", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes.NewCipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("cipher.NewGCM: %v", err)
+	}
+	return &SecretCipher{aead}, nil
+}
+
+// Seal encrypts the secret of the user with id
+// the id is authenticated along with the secret, so a sealed secret cannot be copied to another user
+func (c *SecretCipher) Seal(id, secret string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("rand.Read: %v", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(secret), []byte(id))
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a secret sealed for the user with id
+// a secret that was not sealed is an error, it may have been written to the database directly
+func (c *SecretCipher) Open(id, stored string) (string, error) {
+	if !strings.HasPrefix(stored, sealedPrefix) {
+		return "", errors.New("secret is not sealed")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed secret: %v", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("invalid sealed secret: too short")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	secret, err := c.aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt secret: %v", err)
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,43 @@
+package totp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSecretCipher(t *testing.T) {
+	c, err := NewSecretCipher(bytes.Repeat([]byte{1}, KeySize))
+	if err != nil {
+		t.Fatalf("NewSecretCipher: %v", err)
+	}
+	secret, _ := GenerateSecret()
+
+	sealed, err := c.Seal("1", secret)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if strings.Contains(sealed, secret) {
+		t.Errorf("sealed secret contains the secret: %v", sealed)
+	}
+	if got, err := c.Open("1", sealed); err != nil || got != secret {
+		t.Errorf("Open: %v, %v, want %v", got, err, secret)
+	}
+
+	// a secret sealed for one user does not open for another
+	if _, err := c.Open("2", sealed); err == nil {
+		t.Error("opened a secret sealed for another user")
+	}
+	// nor with another key
+	other, _ := NewSecretCipher(bytes.Repeat([]byte{2}, KeySize))
+	if _, err := other.Open("1", sealed); err == nil {
+		t.Error("opened a secret with the wrong key")
+	}
+	if _, err := c.Open("1", secret); err == nil {
+		t.Error("opened a secret that was not sealed")
+	}
+
+	if _, err := NewSecretCipher([]byte("short")); err == nil {
+		t.Error("created a cipher with a short key")
+	}
+}
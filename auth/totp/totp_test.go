@@ -0,0 +1,95 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the RFC lists 8 digit codes, these are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(currTest *testing.T) {
+			got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+			if err != nil {
+				currTest.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.code {
+				currTest.Errorf("wrong code: %v, want %v", got, tt.code)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	now := time.Unix(1600000000, 0)
+	tests := []struct {
+		name  string
+		at    time.Time
+		valid bool
+	}{
+		{"current period", now, true},
+		{"previous period", now.Add(-Period), true},
+		{"next period", now.Add(Period), true},
+		{"too old", now.Add(-2 * Period), false},
+		{"too new", now.Add(2 * Period), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			code, err := Code(secret, tt.at)
+			if err != nil {
+				currTest.Fatalf("Code: %v", err)
+			}
+			step, ok := Validate(secret, code, now)
+			if ok != tt.valid {
+				currTest.Fatalf("code valid: %v, want %v", ok, tt.valid)
+			}
+			if ok && step != Step(tt.at) {
+				currTest.Errorf("matched period %v, want %v", step, Step(tt.at))
+			}
+		})
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(secret, code, now); ok {
+			t.Errorf("malformed code %q is valid", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "123456", now); ok {
+		t.Error("code is valid for a malformed secret")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(ProvisioningURI("Tickets", "foo@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	if got, want := uri.Scheme+"://"+uri.Host+uri.Path, "otpauth://totp/Tickets:foo@example.com"; got != want {
+		t.Errorf("wrong label: %v, want %v", got, want)
+	}
+	for param, want := range map[string]string{"secret": "JBSWY3DPEHPK3PXP", "issuer": "Tickets", "digits": "6", "period": "30"} {
+		if got := uri.Query().Get(param); got != want {
+			t.Errorf("wrong %v: %v, want %v", param, got, want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/totp"
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// mfaCookie holds the challenge token between the password and the code, it is only sent to the 2fa routes
+	mfaCookie     = "auth-mfa"
+	mfaCookiePath = "/api/users/2fa"
+	// totpIssuer is the account name authenticator apps show
+	totpIssuer = "Tickets"
+)
+
+type twoFactorCodeData struct {
+	Code string `json:"code" form:"code" binding:"required"`
+}
+
+type twoFactorEnrollData struct {
+	Password string `json:"password" form:"password" binding:"required"`
+}
+
+type twoFactorConfirmData struct {
+	Password string `json:"password" form:"password" binding:"required"`
+	Code     string `json:"code" form:"code" binding:"required"`
+}
+
+// twoFactor enrolls authenticators and finishes sign ins for users who have one
+// once enabled, signing in with a password or a provider only starts a challenge, and the session
+// is issued when the challenge is exchanged with a code from the authenticator or a recovery code
+// enrolling and disabling need the user's current password, so a stolen session cannot change the second factor
+type twoFactor struct {
+	store         users.TwoFactorStore
+	challenges    users.MFAChallengeStore
+	crud          users.CRUD
+	signer        users.Signer
+	refreshTokens users.RefreshStore
+	// secrets encrypts authenticator secrets before they are stored
+	secrets *totp.SecretCipher
+	// wrong codes count as failed sign ins, so codes cannot be guessed any faster than passwords
+	throttle *signinThrottle
+}
+
+// loadSecretCipher reads the base64 encoded key authenticator secrets are encrypted with
+func loadSecretCipher(path string) (*totp.SecretCipher, error) {
+	encoded, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %v", err)
+	}
+	return totp.NewSecretCipher(key)
+}
+
+// signedInUser reads the signed in user and checks their current password
+func (t *twoFactor) signedInUser(ctx context.Context, ginCtx *gin.Context, password string) (*users.User, string, bool) {
+	claims, ok := middleware.ClaimsFromContext(ginCtx)
+	if !ok {
+		problem.Abort(ginCtx, problem.Unauthorized(problem.CodeUnauthorized, "unauthorized").WithCause(errors.New("no session claims")))
+		return nil, "", false
+	}
+	u, err := t.store.ReadID(ctx, claims.ID)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to read user", err))
+		return nil, "", false
+	}
+	if u == nil {
+		problem.Abort(ginCtx, problem.Unauthorized(problem.CodeUnauthorized, "unauthorized").WithCause(errors.New("session user not found")))
+		return nil, "", false
+	}
+	if err := u.CheckPassword(password); err != nil {
+		problem.Abort(ginCtx, problem.Validation(codeWrongPassword, "current password is incorrect", problem.InvalidParam{Name: "password", Reason: "current password is incorrect"}).WithCause(err))
+		return nil, "", false
+	}
+	return u, claims.ID, true
+}
+
+// enrollingUser reads the signed in user, who cannot enroll once they have an authenticator
+func (t *twoFactor) enrollingUser(ctx context.Context, ginCtx *gin.Context, password string) (*users.User, string, bool) {
+	u, id, ok := t.signedInUser(ctx, ginCtx, password)
+	if !ok {
+		return nil, "", false
+	}
+	if u.TOTPEnabled {
+		problem.Abort(ginCtx, problem.Conflict(codeTwoFactorEnabled, "two-factor authentication is already enabled").WithCause(errors.New("two-factor authentication is already enabled")))
+		return nil, "", false
+	}
+	return u, id, true
+}
+
+// Enroll starts enrolling an authenticator for the signed in user
+// the authenticator is not used until the user confirms it with Verify, so enrolling again replaces the secret
+func (t *twoFactor) Enroll(ctx context.Context, ginCtx *gin.Context) {
+	data := new(twoFactorEnrollData)
+	if err := bind(ginCtx, data); err != nil {
+		bindError(ginCtx, err, "please provide your current password")
+		return
+	}
+	u, id, ok := t.enrollingUser(ctx, ginCtx, data.Password)
+	if !ok {
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to enroll authenticator", err))
+		return
+	}
+	sealed, err := t.secrets.Seal(id, secret)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to enroll authenticator", err))
+		return
+	}
+	// the user may have finished enrolling in another request since they were read
+	if set, err := t.store.SetTOTPSecret(ctx, id, sealed); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to enroll authenticator", err))
+		return
+	} else if !set {
+		problem.Abort(ginCtx, problem.Conflict(codeTwoFactorEnabled, "two-factor authentication is already enabled").WithCause(errors.New("two-factor authentication is already enabled")))
+		return
+	}
+	render(ginCtx, http.StatusOK, gin.H{
+		"secret": secret,
+		"uri":    totp.ProvisioningURI(totpIssuer, u.Email, secret),
+	})
+}
+
+// Verify confirms the authenticator with a code from it and turns two-factor authentication on
+// the recovery codes are returned once, only their hashes are kept
+func (t *twoFactor) Verify(ctx context.Context, ginCtx *gin.Context) {
+	data := new(twoFactorConfirmData)
+	if err := bind(ginCtx, data); err != nil {
+		bindError(ginCtx, err, "please provide your current password and a code from your authenticator")
+		return
+	}
+	u, id, ok := t.enrollingUser(ctx, ginCtx, data.Password)
+	if !ok {
+		return
+	}
+	if u.TOTPSecret == "" {
+		problem.Abort(ginCtx, problem.Conflict(codeNotEnrolling, "no authenticator is being enrolled").WithCause(errors.New("no totp secret")))
+		return
+	}
+	secret, err := t.secrets.Open(id, u.TOTPSecret)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to enable two-factor authentication", err))
+		return
+	}
+	step, valid := totp.Validate(secret, data.Code, time.Now())
+	if !valid {
+		problem.Abort(ginCtx, problem.Validation(codeInvalidCode, "invalid code").WithCause(errors.New("invalid totp code")))
+		return
+	}
+
+	codes, hashes, err := users.NewRecoveryCodes()
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to enable two-factor authentication", err))
+		return
+	}
+	if found, err := t.store.EnableTOTP(ctx, id, hashes, step); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to enable two-factor authentication", err))
+		return
+	} else if !found {
+		problem.Abort(ginCtx, problem.Unauthorized(problem.CodeUnauthorized, "unauthorized").WithCause(errors.New("session user not found")))
+		return
+	}
+	render(ginCtx, http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// Disable removes the signed in user's authenticator and recovery codes, so they can enroll a new one
+// it takes a code from the authenticator or a recovery code, and wrong codes count as failed sign ins
+func (t *twoFactor) Disable(ctx context.Context, ginCtx *gin.Context) {
+	data := new(twoFactorConfirmData)
+	if err := bind(ginCtx, data); err != nil {
+		bindError(ginCtx, err, "please provide your current password and a code from your authenticator or a recovery code")
+		return
+	}
+	u, id, ok := t.signedInUser(ctx, ginCtx, data.Password)
+	if !ok {
+		return
+	}
+	if !u.TOTPEnabled {
+		problem.Abort(ginCtx, problem.Conflict(codeTwoFactorDisabled, "two-factor authentication is not enabled").WithCause(errors.New("two-factor authentication is not enabled")))
+		return
+	}
+
+	ip := clientIP(ginCtx)
+	if wait, err := t.throttle.RetryAfter(ctx, u.Email, ip); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to disable two-factor authentication", err))
+		return
+	} else if wait > 0 {
+		t.throttle.Rejected("locked_out")
+		ginCtx.Header("Retry-After", retryAfterSeconds(wait))
+		problem.Abort(ginCtx, problem.New(http.StatusTooManyRequests, codeTooManyAttempts, "too many failed attempts, try again later").WithCause(errors.New("two-factor locked out")))
+		return
+	}
+	if valid, err := t.checkCode(ctx, *u, id, data.Code); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to disable two-factor authentication", err))
+		return
+	} else if !valid {
+		if err := t.throttle.Failed(ctx, u.Email, ip); err != nil {
+			problem.Abort(ginCtx, problem.Internal("unable to disable two-factor authentication", err))
+			return
+		}
+		problem.Abort(ginCtx, problem.Validation(codeInvalidCode, "invalid code").WithCause(errors.New("invalid two-factor code")))
+		return
+	}
+
+	if found, err := t.store.DisableTOTP(ctx, id); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to disable two-factor authentication", err))
+		return
+	} else if !found {
+		problem.Abort(ginCtx, problem.Unauthorized(problem.CodeUnauthorized, "unauthorized").WithCause(errors.New("session user not found")))
+		return
+	}
+	ginCtx.Status(http.StatusOK)
+}
+
+// challenge starts the second step of signing the user in
+func (t *twoFactor) challenge(ctx context.Context, ginCtx *gin.Context, u users.User) error {
+	token, record, err := users.NewMFAChallenge(u.Email, fmt.Sprint(u.Uid))
+	if err != nil {
+		return err
+	}
+	if err := t.challenges.Create(ctx, record); err != nil {
+		return fmt.Errorf("unable to save two-factor challenge: %v", err)
+	}
+	ginCtx.SetCookie(mfaCookie, token, int(users.MFAChallengeTTL.Seconds()), mfaCookiePath, "", false, true)
+	return nil
+}
+
+// Signin exchanges the challenge cookie and a code for a session
+func (t *twoFactor) Signin(ctx context.Context, ginCtx *gin.Context) {
+	data := new(twoFactorCodeData)
+	if err := bind(ginCtx, data); err != nil {
+		bindError(ginCtx, err, "please provide a code from your authenticator or a recovery code")
+		return
+	}
+	token, _ := ginCtx.Cookie(mfaCookie)
+	hash := users.HashMFAChallenge(token)
+	challenge, err := t.challenges.Read(ctx, hash)
+	if err == users.ErrInvalidMFAChallenge {
+		ginCtx.SetCookie(mfaCookie, "", -1, mfaCookiePath, "", false, true)
+		problem.Abort(ginCtx, problem.Unauthorized(codeSignInExpired, "sign in has expired, please sign in again").WithCause(err))
+		return
+	} else if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+		return
+	}
+
+	ip := clientIP(ginCtx)
+	if wait, err := t.throttle.RetryAfter(ctx, challenge.Email, ip); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+		return
+	} else if wait > 0 {
+		t.throttle.Rejected("locked_out")
+		ginCtx.Header("Retry-After", retryAfterSeconds(wait))
+		problem.Abort(ginCtx, problem.New(http.StatusTooManyRequests, codeTooManyAttempts, "too many failed sign in attempts, try again later").WithCause(errors.New("sign in locked out")))
+		return
+	}
+
+	u, err := t.store.ReadID(ctx, challenge.UserID)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+		return
+	}
+	if u == nil {
+		problem.Abort(ginCtx, problem.Unauthorized(codeSignInExpired, "sign in has expired, please sign in again").WithCause(errors.New("challenge user not found")))
+		return
+	}
+	if valid, err := t.checkCode(ctx, *u, challenge.UserID, data.Code); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+		return
+	} else if !valid {
+		if err := t.throttle.Failed(ctx, challenge.Email, ip); err != nil {
+			problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+			return
+		}
+		problem.Abort(ginCtx, problem.Validation(codeInvalidCode, "invalid code").WithCause(errors.New("invalid two-factor code")))
+		return
+	}
+
+	// consuming the challenge makes sure it only starts one session
+	if _, err := t.challenges.Consume(ctx, hash); err == users.ErrInvalidMFAChallenge {
+		problem.Abort(ginCtx, problem.Unauthorized(codeSignInExpired, "sign in has expired, please sign in again").WithCause(err))
+		return
+	} else if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+		return
+	}
+	ginCtx.SetCookie(mfaCookie, "", -1, mfaCookiePath, "", false, true)
+
+	userJWT, refreshToken, err := users.User{Email: challenge.Email}.CreateSession(ctx, t.crud, t.signer, t.refreshTokens)
+	if err != nil {
+		sessionError(ginCtx, err)
+		return
+	}
+	setSessionCookies(ginCtx, userJWT, refreshToken)
+	if err := t.throttle.Succeeded(ctx, challenge.Email); err != nil {
+		log.Printf("unable to reset sign in failures: %v", err)
+	}
+	ginCtx.Status(http.StatusOK)
+}
+
+// checkCode accepts a code from the user's authenticator, or one of their recovery codes
+// each code is only accepted once
+func (t *twoFactor) checkCode(ctx context.Context, u users.User, id, code string) (bool, error) {
+	if !u.TOTPEnabled {
+		return false, nil
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits && strings.Trim(code, "0123456789") == "" {
+		secret, err := t.secrets.Open(id, u.TOTPSecret)
+		if err != nil {
+			return false, err
+		}
+		step, valid := totp.Validate(secret, code, time.Now())
+		if !valid {
+			return false, nil
+		}
+		return t.store.UseTOTPStep(ctx, id, step)
+	}
+	return t.store.UseRecoveryCode(ctx, id, users.HashRecoveryCode(code))
+}
+
+// sessionError responds to an error creating a session for a user who has proven who they are
+func sessionError(ginCtx *gin.Context, err error) {
+	switch err {
+	case users.ErrUserDisabled:
+		problem.Abort(ginCtx, problem.Forbidden(codeAccountDisabled, "account is disabled").WithCause(err))
+	case users.ErrPasswordResetRequired:
+		problem.Abort(ginCtx, problem.Forbidden(codePasswordResetRequired, "password reset required").WithCause(err))
+	default:
+		problem.Abort(ginCtx, problem.Internal("unable to sign in", err))
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/totp"
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+// twoFactorTest routes sign in and the two-factor API the way UseUserRoutes does, for a user with a password
+type twoFactorTest struct {
+	eng        *gin.Engine
+	validator  *middleware.JWTValidator
+	crud       *memoryUsers
+	challenges *memoryMFAChallenges
+	attempts   *memoryAttempts
+	// session is the signed in user's session token
+	session string
+}
+
+func newTwoFactorTest(t *testing.T) *twoFactorTest {
+	t.Helper()
+	v, err := middleware.NewJWTValidator(key, "HS256")
+	if err != nil {
+		t.Fatalf("middleware.NewJWTValidator: %v", err)
+	}
+	revoker := new(mockRevoker)
+	revoker.On("IsRevoked", mock.Anything, mock.Anything).Return(false, nil)
+	refreshTokens := new(mockRefreshStore)
+	refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+	throttle, attempts, _ := newTestThrottle()
+
+	tt := &twoFactorTest{validator: v, crud: new(memoryUsers), challenges: newMemoryMFAChallenges(), attempts: attempts}
+	if _, err := tt.crud.Write(context.Background(), users.User{Email: email, Hash: passHash, Roles: users.DefaultRoles}); err != nil {
+		t.Fatalf("unable to write user: %v", err)
+	}
+	claims, err := middleware.NewClaims(email, "000000000000000000000001", time.Minute, users.DefaultRoles...)
+	if err != nil {
+		t.Fatalf("middleware.NewClaims: %v", err)
+	}
+	if tt.session, err = claims.Tokenize(v); err != nil {
+		t.Fatalf("unable to sign session token: %v", err)
+	}
+
+	secrets, err := totp.NewSecretCipher(bytes.Repeat([]byte{1}, totp.KeySize))
+	if err != nil {
+		t.Fatalf("totp.NewSecretCipher: %v", err)
+	}
+
+	mfa := &twoFactor{
+		store:         tt.crud,
+		challenges:    tt.challenges,
+		crud:          tt.crud,
+		signer:        v,
+		refreshTokens: refreshTokens,
+		secrets:       secrets,
+		throttle:      throttle,
+	}
+	gin.SetMode(gin.TestMode)
+	tt.eng = gin.New()
+	tt.eng.Use(problem.Handler())
+	tt.eng.POST("/api/users/signin", withTimeout(func(ctx context.Context, ginCtx *gin.Context) {
+		Signin(ctx, ginCtx, tt.crud, v, refreshTokens, throttle, mfa)
+	}))
+	tt.eng.POST("/api/users/2fa/enroll", RequireSession(v, revoker), withTimeout(mfa.Enroll))
+	tt.eng.POST("/api/users/2fa/verify", RequireSession(v, revoker), withTimeout(mfa.Verify))
+	tt.eng.POST("/api/users/2fa/disable", RequireSession(v, revoker), withTimeout(mfa.Disable))
+	tt.eng.POST("/api/users/2fa/signin", withTimeout(mfa.Signin))
+	return tt
+}
+
+func (tt *twoFactorTest) request(t *testing.T, path string, body interface{}, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		if c.Name == sessionCookie {
+			addSessionCookies(req, c.Value)
+		} else {
+			req.AddCookie(c)
+		}
+	}
+	w := httptest.NewRecorder()
+	tt.eng.ServeHTTP(w, req)
+	return w
+}
+
+// enroll turns two-factor authentication on and returns the secret and recovery codes
+func (tt *twoFactorTest) enroll(t *testing.T) (string, []string) {
+	t.Helper()
+	sessionCookie := &http.Cookie{Name: sessionCookie, Value: tt.session}
+	w := tt.request(t, "/api/users/2fa/enroll", gin.H{"password": pass}, sessionCookie)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code enrolling: %v, want %v: %s", got, want, w.Body.String())
+	}
+	var enrollment struct{ Secret, URI string }
+	if err := json.Unmarshal(w.Body.Bytes(), &enrollment); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.Contains(enrollment.URI, "secret="+enrollment.Secret) {
+		t.Errorf("wrong provisioning uri: %v", enrollment.URI)
+	}
+	if stored := tt.crud.users[0].TOTPSecret; stored == "" || strings.Contains(stored, enrollment.Secret) {
+		t.Errorf("secret was not encrypted: %v", stored)
+	}
+
+	code, _ := totp.Code(enrollment.Secret, time.Now().Add(-totp.Period))
+	w = tt.request(t, "/api/users/2fa/verify", gin.H{"password": pass, "code": code}, sessionCookie)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code verifying: %v, want %v: %s", got, want, w.Body.String())
+	}
+	var verified struct{ RecoveryCodes []string }
+	if err := json.Unmarshal(w.Body.Bytes(), &verified); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if got, want := len(verified.RecoveryCodes), users.RecoveryCodeCount; got != want {
+		t.Fatalf("got %v recovery codes, want %v", got, want)
+	}
+	return enrollment.Secret, verified.RecoveryCodes
+}
+
+// signin signs in with the password and returns the challenge cookie
+func (tt *twoFactorTest) signin(t *testing.T) *http.Cookie {
+	t.Helper()
+	w := tt.request(t, "/api/users/signin", userFormData{Username: email, Password: pass})
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code signing in: %v, want %v", got, want)
+	}
+	if got, want := strings.TrimSpace(w.Body.String()), `{"mfaRequired":true}`; got != want {
+		t.Errorf("wrong sign in response: %v, want %v", got, want)
+	}
+	var challenge *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		switch c.Name {
+		case sessionCookie, refreshCookie:
+			t.Errorf("%v cookie set before the code was entered", c.Name)
+		case mfaCookie:
+			challenge = c
+		}
+	}
+	if challenge == nil || challenge.Path != mfaCookiePath || !challenge.HttpOnly {
+		t.Fatalf("wrong challenge cookie: %+v", challenge)
+	}
+	return challenge
+}
+
+func hasSessionCookie(w *httptest.ResponseRecorder) bool {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookie && c.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTwoFactorSignin(t *testing.T) {
+	tt := newTwoFactorTest(t)
+	secret, recoveryCodes := tt.enroll(t)
+
+	// the code used to enroll cannot be used again
+	challenge := tt.signin(t)
+	usedCode, _ := totp.Code(secret, time.Now().Add(-totp.Period))
+	if got, want := tt.request(t, "/api/users/2fa/signin", gin.H{"code": usedCode}, challenge).Code, http.StatusBadRequest; got != want {
+		t.Errorf("wrong status code replaying a code: %v, want %v", got, want)
+	}
+	if got, want := tt.attempts.attempts["account:"+email].Failures, 1; got != want {
+		t.Errorf("account has %v failures, want %v", got, want)
+	}
+
+	code, _ := totp.Code(secret, time.Now())
+	w := tt.request(t, "/api/users/2fa/signin", gin.H{"code": code}, challenge)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code: %v, want %v: %s", got, want, w.Body.String())
+	}
+	if !hasSessionCookie(w) {
+		t.Error("session cookie not set")
+	}
+	checkRefreshCookie(t, w.Result())
+	if got := tt.attempts.attempts["account:"+email].Failures; got != 0 {
+		t.Errorf("account has %v failures after signing in, want 0", got)
+	}
+	// each challenge only starts one session
+	next, _ := totp.Code(secret, time.Now().Add(totp.Period))
+	if got, want := tt.request(t, "/api/users/2fa/signin", gin.H{"code": next}, challenge).Code, http.StatusUnauthorized; got != want {
+		t.Errorf("wrong status code reusing the challenge: %v, want %v", got, want)
+	}
+
+	// recovery codes work however they are typed, but only once
+	recoveryCode := strings.ToUpper(strings.Replace(recoveryCodes[3], "-", "", 1))
+	challenge = tt.signin(t)
+	w = tt.request(t, "/api/users/2fa/signin", gin.H{"code": recoveryCode}, challenge)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code for a recovery code: %v, want %v", got, want)
+	}
+	if !hasSessionCookie(w) {
+		t.Error("session cookie not set")
+	}
+	challenge = tt.signin(t)
+	if got, want := tt.request(t, "/api/users/2fa/signin", gin.H{"code": recoveryCodes[3]}, challenge).Code, http.StatusBadRequest; got != want {
+		t.Errorf("wrong status code reusing a recovery code: %v, want %v", got, want)
+	}
+	if got, want := len(tt.crud.users[0].RecoveryCodes), users.RecoveryCodeCount-1; got != want {
+		t.Errorf("user has %v recovery codes, want %v", got, want)
+	}
+}
+
+func TestTwoFactorSigninRejected(t *testing.T) {
+	tt := newTwoFactorTest(t)
+	secret, _ := tt.enroll(t)
+	code, _ := totp.Code(secret, time.Now().Add(totp.Period))
+
+	if got, want := tt.request(t, "/api/users/2fa/signin", gin.H{"code": code}).Code, http.StatusUnauthorized; got != want {
+		t.Errorf("wrong status code without a challenge: %v, want %v", got, want)
+	}
+
+	// the account is checked before the challenge is started
+	tt.crud.users[0].Disabled = true
+	if got, want := tt.request(t, "/api/users/signin", userFormData{Username: email, Password: pass}).Code, http.StatusForbidden; got != want {
+		t.Errorf("wrong status code for a disabled user: %v, want %v", got, want)
+	}
+	tt.crud.users[0].Disabled = false
+
+	// and again once the code is entered
+	challenge := tt.signin(t)
+	tt.crud.users[0].Disabled = true
+	w := tt.request(t, "/api/users/2fa/signin", gin.H{"code": code}, challenge)
+	if got, want := w.Code, http.StatusForbidden; got != want {
+		t.Errorf("wrong status code for a user disabled after the password: %v, want %v", got, want)
+	}
+	if hasSessionCookie(w) {
+		t.Error("session cookie set for a disabled user")
+	}
+	tt.crud.users[0].Disabled = false
+
+	// wrong codes lock the account out like wrong passwords
+	challenge = tt.signin(t)
+	for i := 0; i < maxAccountFailures; i++ {
+		if got, want := tt.request(t, "/api/users/2fa/signin", gin.H{"code": "000000"}, challenge).Code, http.StatusBadRequest; got != want {
+			t.Fatalf("wrong status code for wrong code %v: %v, want %v", i+1, got, want)
+		}
+	}
+	if got, want := tt.request(t, "/api/users/2fa/signin", gin.H{"code": code}, challenge).Code, http.StatusTooManyRequests; got != want {
+		t.Errorf("wrong status code once locked out: %v, want %v", got, want)
+	}
+}
+
+func TestTwoFactorEnrollRejected(t *testing.T) {
+	tt := newTwoFactorTest(t)
+	sessionCookie := &http.Cookie{Name: sessionCookie, Value: tt.session}
+
+	if got, want := tt.request(t, "/api/users/2fa/enroll", gin.H{"password": pass}).Code, http.StatusUnauthorized; got != want {
+		t.Errorf("wrong status code signed out: %v, want %v", got, want)
+	}
+	// a session alone is not enough to enroll
+	if got, want := tt.request(t, "/api/users/2fa/enroll", gin.H{}, sessionCookie).Code, http.StatusBadRequest; got != want {
+		t.Errorf("wrong status code without a password: %v, want %v", got, want)
+	}
+	if got, want := tt.request(t, "/api/users/2fa/enroll", gin.H{"password": "wrong password"}, sessionCookie).Code, http.StatusBadRequest; got != want {
+		t.Errorf("wrong status code for a wrong password: %v, want %v", got, want)
+	}
+	if tt.crud.users[0].TOTPSecret != "" {
+		t.Fatal("enrolled with a wrong password")
+	}
+	if got, want := tt.request(t, "/api/users/2fa/verify", gin.H{"password": pass, "code": "123456"}, sessionCookie).Code, http.StatusConflict; got != want {
+		t.Errorf("wrong status code verifying before enrolling: %v, want %v", got, want)
+	}
+	if got, want := tt.request(t, "/api/users/2fa/enroll", gin.H{"password": pass}, sessionCookie).Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code enrolling: %v, want %v", got, want)
+	}
+	if got, want := tt.request(t, "/api/users/2fa/verify", gin.H{"password": pass, "code": "abcdef"}, sessionCookie).Code, http.StatusBadRequest; got != want {
+		t.Errorf("wrong status code for a wrong code: %v, want %v", got, want)
+	}
+	if got, want := tt.request(t, "/api/users/2fa/verify", gin.H{"code": "123456"}, sessionCookie).Code, http.StatusBadRequest; got != want {
+		t.Errorf("wrong status code verifying without a password: %v, want %v", got, want)
+	}
+	if tt.crud.users[0].TOTPEnabled {
+		t.Fatal("two-factor authentication enabled with a wrong code")
+	}
+
+	// an enabled authenticator cannot be replaced
+	tt.enroll(t)
+	secret := tt.crud.users[0].TOTPSecret
+	if got, want := tt.request(t, "/api/users/2fa/enroll", gin.H{"password": pass}, sessionCookie).Code, http.StatusConflict; got != want {
+		t.Errorf("wrong status code enrolling again: %v, want %v", got, want)
+	}
+	if tt.crud.users[0].TOTPSecret != secret {
+		t.Error("the secret was replaced")
+	}
+}
+
+func TestTwoFactorDisable(t *testing.T) {
+	tt := newTwoFactorTest(t)
+	sessionCookie := &http.Cookie{Name: sessionCookie, Value: tt.session}
+
+	if got, want := tt.request(t, "/api/users/2fa/disable", gin.H{"password": pass, "code": "123456"}, sessionCookie).Code, http.StatusConflict; got != want {
+		t.Errorf("wrong status code disabling before enrolling: %v, want %v", got, want)
+	}
+
+	secret, recoveryCodes := tt.enroll(t)
+	code, _ := totp.Code(secret, time.Now())
+	if got, want := tt.request(t, "/api/users/2fa/disable", gin.H{"password": "wrong password", "code": code}, sessionCookie).Code, http.StatusBadRequest; got != want {
+		t.Errorf("wrong status code for a wrong password: %v, want %v", got, want)
+	}
+	if got, want := tt.request(t, "/api/users/2fa/disable", gin.H{"password": pass, "code": "000000"}, sessionCookie).Code, http.StatusBadRequest; got != want {
+		t.Errorf("wrong status code for a wrong code: %v, want %v", got, want)
+	}
+	if got, want := tt.attempts.attempts["account:"+email].Failures, 1; got != want {
+		t.Errorf("account has %v failures, want %v", got, want)
+	}
+	if !tt.crud.users[0].TOTPEnabled {
+		t.Fatal("two-factor authentication disabled without the password and a code")
+	}
+
+	// users who lost their authenticator disable it with a recovery code
+	w := tt.request(t, "/api/users/2fa/disable", gin.H{"password": pass, "code": recoveryCodes[0]}, sessionCookie)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code: %v, want %v: %s", got, want, w.Body.String())
+	}
+	if u := tt.crud.users[0]; u.TOTPEnabled || u.TOTPSecret != "" || len(u.RecoveryCodes) != 0 {
+		t.Errorf("authenticator was not removed: %+v", u)
+	}
+
+	// signing in no longer needs a code, and a new authenticator can be enrolled
+	w = tt.request(t, "/api/users/signin", userFormData{Username: email, Password: pass})
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("wrong status code signing in: %v, want %v", got, want)
+	}
+	if !hasSessionCookie(w) {
+		t.Error("session cookie not set")
+	}
+	tt.enroll(t)
+}
@@ -0,0 +1,19 @@
+package users
+
+import "errors"
+
+var (
+	// ErrUserDisabled is returned when a disabled user tries to start a session
+	ErrUserDisabled = errors.New("user is disabled")
+	// ErrPasswordResetRequired is returned when a user an admin has made reset their password tries to start a session
+	ErrPasswordResetRequired = errors.New("user must reset their password")
+	// ErrInvalidUserID is returned for user IDs the store could never have issued
+	ErrInvalidUserID = errors.New("invalid user id")
+)
+
+// UserQuery describes a page of users
+// the page holds up to Limit users whose IDs come after After
+type UserQuery struct {
+	After string
+	Limit int64
+}
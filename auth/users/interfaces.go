@@ -1,12 +1,107 @@
 package users
 
-import "context"
+import (
+	"context"
+
+	"github.com/dgrijalva/jwt-go"
+)
 
 type CRUD interface {
 	Read(context.Context, User) ([]User, error)
 	Write(context.Context, User) (interface{}, error)
 }
 
+// AdminStore finds and manages users by ID for admins
+type AdminStore interface {
+	// List returns a page of users ordered by ID
+	List(context.Context, UserQuery) ([]User, error)
+	// ReadID returns nil if there is no user with the ID
+	ReadID(context.Context, string) (*User, error)
+	// SetDisabled and RequirePasswordReset return false if there is no user with the ID
+	SetDisabled(context.Context, string, bool) (bool, error)
+	RequirePasswordReset(context.Context, string) (bool, error)
+}
+
+// PasswordStore changes users' passwords
+type PasswordStore interface {
+	// ReadID returns nil if there is no user with the ID
+	ReadID(context.Context, string) (*User, error)
+	// SetPassword replaces the user's hash and clears PasswordResetRequired
+	// it returns false if there is no user with the ID
+	SetPassword(context.Context, string, []byte) (bool, error)
+}
+
+// VerifyStore marks users' emails as verified
+type VerifyStore interface {
+	// SetVerified returns false if there is no user with the ID
+	SetVerified(context.Context, string) (bool, error)
+}
+
+// LinkedAccountStore finds and links users by their OpenID Connect identities
+type LinkedAccountStore interface {
+	// ReadLinked returns nil if no user is linked to the account
+	ReadLinked(context.Context, LinkedAccount) (*User, error)
+	// Link returns false if there is no user with the ID
+	Link(context.Context, string, LinkedAccount) (bool, error)
+}
+
+// TwoFactorStore manages users' authenticators and recovery codes
+// the methods that change a user return false if there is no user with the ID
+type TwoFactorStore interface {
+	// ReadID returns nil if there is no user with the ID
+	ReadID(context.Context, string) (*User, error)
+	// SetTOTPSecret starts enrolling an authenticator, it returns false if the user already has one
+	SetTOTPSecret(context.Context, string, string) (bool, error)
+	// EnableTOTP finishes enrolling, replacing the recovery codes with the given hashes
+	// step is the period of the code the user confirmed with
+	EnableTOTP(context.Context, string, []string, int64) (bool, error)
+	// UseTOTPStep records that a code for the period was used
+	// it returns false if a code for the same or a later period was already used
+	UseTOTPStep(context.Context, string, int64) (bool, error)
+	// UseRecoveryCode removes the recovery code with the hash, returning false if the user did not have it
+	UseRecoveryCode(context.Context, string, string) (bool, error)
+	// DisableTOTP removes the authenticator and the recovery codes
+	DisableTOTP(context.Context, string) (bool, error)
+}
+
 type Signer interface {
-	Sign(map[string]interface{}) (string, error)
-}
\ No newline at end of file
+	Sign(jwt.Claims) (string, error)
+}
+
+// RefreshStore saves refresh tokens by their hash
+type RefreshStore interface {
+	Create(context.Context, RefreshToken) error
+	// Rotate marks an unused, unexpired token as used and returns it
+	// reusing a token revokes all of the user's tokens and returns ErrRefreshTokenReused
+	Rotate(context.Context, string) (*RefreshToken, error)
+	Revoke(context.Context, string) error
+	// RevokeUser revokes all of the user's tokens
+	RevokeUser(context.Context, string) error
+}
+
+// PasswordResetStore saves password reset tokens by their hash
+type PasswordResetStore interface {
+	Create(context.Context, PasswordReset) error
+	// Consume deletes an unexpired token and returns it, other tokens return ErrInvalidResetToken
+	Consume(context.Context, string) (*PasswordReset, error)
+	// RevokeUser deletes all of the user's tokens
+	RevokeUser(context.Context, string) error
+}
+
+// EmailVerificationStore saves email verification tokens by their hash
+type EmailVerificationStore interface {
+	Create(context.Context, EmailVerification) error
+	// Consume deletes an unexpired token and returns it, other tokens return ErrInvalidVerificationToken
+	Consume(context.Context, string) (*EmailVerification, error)
+	// RevokeUser deletes all of the user's tokens
+	RevokeUser(context.Context, string) error
+}
+
+// MFAChallengeStore saves sign ins waiting on their second factor by the hash of their token
+type MFAChallengeStore interface {
+	Create(context.Context, MFAChallenge) error
+	// Read returns an unexpired challenge without using it up, other challenges return ErrInvalidMFAChallenge
+	Read(context.Context, string) (*MFAChallenge, error)
+	// Consume deletes an unexpired challenge and returns it, other challenges return ErrInvalidMFAChallenge
+	Consume(context.Context, string) (*MFAChallenge, error)
+}
@@ -0,0 +1,27 @@
+package users
+
+import "fmt"
+
+// LinkedAccount is a user's identity with an OpenID Connect provider
+// the subject is the provider's ID for the user, which unlike the email never changes
+type LinkedAccount struct {
+	Provider string
+	Subject  string
+}
+
+// NewLinkedUser creates a user who signed in with a provider and has no password
+// the user is only verified if the provider has verified their email
+func NewLinkedUser(email string, account LinkedAccount, verified bool) (*User, error) {
+	type Email struct {
+		Value string `validate:"required,email,strnonblank"`
+	}
+	if err := v.Struct(Email{email}); err != nil {
+		return nil, fmt.Errorf("invalid email: %v", err)
+	}
+	return &User{
+		Email:          email,
+		Roles:          append([]string(nil), DefaultRoles...),
+		Unverified:     !verified,
+		LinkedAccounts: []LinkedAccount{account},
+	}, nil
+}
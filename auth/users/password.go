@@ -0,0 +1,64 @@
+package users
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordResetTTL is how long a password reset token can be used for
+const PasswordResetTTL = time.Hour
+
+// ErrInvalidResetToken is returned for unknown, expired and already used password reset tokens
+var ErrInvalidResetToken = errors.New("password reset token is invalid or expired")
+
+// PasswordReset is the stored record of a password reset token
+// like refresh tokens, the token itself is only ever mailed to the user
+type PasswordReset struct {
+	Hash      string
+	UserID    string
+	Email     string
+	ExpiresAt time.Time
+}
+
+// NewPasswordReset creates a random password reset token and the record to store for it
+func NewPasswordReset(email, userID string) (string, PasswordReset, error) {
+	b, err := randomToken(32)
+	if err != nil {
+		return "", PasswordReset{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, PasswordReset{
+		Hash:      HashResetToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(PasswordResetTTL),
+	}, nil
+}
+
+func HashResetToken(token string) string {
+	return hashToken(token)
+}
+
+// HashPassword validates a new password and returns its bcrypt hash
+func HashPassword(password string) ([]byte, error) {
+	if err := validatePassword(password); err != nil {
+		return nil, fmt.Errorf("invalid password: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("bcrypt.GenerateFromPassword: %v", err)
+	}
+	return hash, nil
+}
+
+// CheckPassword returns an error unless password matches the user's hash
+func (u User) CheckPassword(password string) error {
+	if err := bcrypt.CompareHashAndPassword(u.Hash, []byte(password)); err != nil {
+		return fmt.Errorf("bcrypt.CompareHashAndPassword: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package users
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// RefreshTokenTTL is how long a refresh token can be exchanged for a new session
+const RefreshTokenTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown and expired refresh tokens
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+	// ErrRefreshTokenReused is returned when a refresh token is used a second time
+	// the token may have been stolen so all of the user's refresh tokens are revoked
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+)
+
+// RefreshToken is the stored record of a refresh token
+// the token itself is only ever handed to the client
+type RefreshToken struct {
+	Hash      string
+	UserID    string
+	Email     string
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// NewRefreshToken creates a random refresh token and the record to store for it
+func NewRefreshToken(email, userID string) (string, RefreshToken, error) {
+	b, err := randomToken(32)
+	if err != nil {
+		return "", RefreshToken{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, RefreshToken{
+		Hash:      HashRefreshToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}, nil
+}
+
+func HashRefreshToken(token string) string {
+	return hashToken(token)
+}
+
+// hashToken hashes random tokens before they are stored
+// the tokens are long and random so a fast hash is enough
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
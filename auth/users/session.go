@@ -0,0 +1,91 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+)
+
+// DefaultRoles are the roles users sign up with, every user can both sell and buy tickets
+// admins are made by adding the admin role to the user's document
+var DefaultRoles = []string{middleware.RoleBuyer, middleware.RoleSeller}
+
+// Identity is who a session is issued to
+type Identity struct {
+	Email string
+	ID    string
+	Roles []string
+	// Unverified is set until the user verifies their email
+	Unverified bool
+}
+
+// NewSessionToken signs a short lived session token for the user
+func NewSessionToken(user Identity, signer Signer) (string, error) {
+	claims, err := middleware.NewClaims(user.Email, user.ID, middleware.DefaultTokenTTL, user.Roles...)
+	if err != nil {
+		return "", fmt.Errorf("unable to create session claims: %v", err)
+	}
+	claims.EmailVerified = !user.Unverified
+	token, err := signer.Sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("unable to create session token: %v", err)
+	}
+	return token, nil
+}
+
+// IssueSession creates a session token and a refresh token for the user
+// only the hash of the refresh token is stored
+func IssueSession(ctx context.Context, store RefreshStore, signer Signer, user Identity) (string, string, error) {
+	sessionToken, err := NewSessionToken(user, signer)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, record, err := NewRefreshToken(user.Email, user.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if err := store.Create(ctx, record); err != nil {
+		return "", "", fmt.Errorf("unable to save refresh token: %v", err)
+	}
+	return sessionToken, refreshToken, nil
+}
+
+// RefreshSession exchanges a refresh token for a new session token and refresh token
+// each refresh token can only be used once
+// the user is read again so the new session token carries the user's current roles and verification
+func RefreshSession(ctx context.Context, store RefreshStore, c CRUD, signer Signer, refreshToken string) (string, string, error) {
+	old, err := store.Rotate(ctx, HashRefreshToken(refreshToken))
+	if err != nil {
+		return "", "", err
+	}
+	user, err := User{Email: old.Email}.identity(ctx, c)
+	if err != nil {
+		return "", "", err
+	}
+	if user.ID != old.UserID {
+		return "", "", errors.New("refresh token belongs to another user")
+	}
+	return IssueSession(ctx, store, signer, user)
+}
+
+// NewCSRFToken creates a random token for the double submit CSRF check, see middleware.CheckCSRF
+// it is not stored: the check only compares the cookie with the header
+func NewCSRFToken() (string, error) {
+	b, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func randomToken(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("rand.Read: %v", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,74 @@
+package users
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// MFAChallengeTTL is how long users have to enter their code once their password is accepted
+	MFAChallengeTTL = 5 * time.Minute
+	// RecoveryCodeCount is how many recovery codes users get when they enable two-factor authentication
+	RecoveryCodeCount = 10
+)
+
+// ErrInvalidMFAChallenge is returned for unknown, expired and already used MFA challenges
+var ErrInvalidMFAChallenge = errors.New("two-factor challenge is invalid or expired")
+
+// MFAChallenge is the stored record of a sign in waiting on its second factor
+// the token is handed to the client in place of a session until it is exchanged with a code
+type MFAChallenge struct {
+	Hash      string
+	UserID    string
+	Email     string
+	ExpiresAt time.Time
+}
+
+// NewMFAChallenge creates a random MFA challenge token and the record to store for it
+func NewMFAChallenge(email, userID string) (string, MFAChallenge, error) {
+	b, err := randomToken(32)
+	if err != nil {
+		return "", MFAChallenge{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, MFAChallenge{
+		Hash:      HashMFAChallenge(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(MFAChallengeTTL),
+	}, nil
+}
+
+func HashMFAChallenge(token string) string {
+	return hashToken(token)
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewRecoveryCodes creates single use codes users can sign in with when they lose their authenticator
+// the codes are only shown to the user once, only their hashes are stored
+func NewRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, RecoveryCodeCount)
+	hashes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		// 50 random bits, written as two groups of five characters
+		b, err := randomToken(7)
+		if err != nil {
+			return nil, nil, err
+		}
+		encoded := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		code := encoded[:5] + "-" + encoded[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode hashes a recovery code however the user typed it
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(normalized)
+}
@@ -24,21 +24,6 @@ func init() {
 	}
 }
 
-type Claims struct {
-	Email string      `json:"email"`
-	// do we really need the ID in the claims? why would the user need to see this?
-	// if we do want to include the ID we should think about methods to create a new user
-	// by fetching a matching user from the DB; match done via email address
-	ID   string `json:"id"`
-}
-
-func (pc Claims) Valid() error {
-	if pc.Email == "" {
-		return errors.New("claims do not represent a user")
-	}
-	return nil
-}
-
 type User struct {
 	Email    string `validate:"required,email,strnonblank"`
 	Hash []byte
@@ -52,6 +37,22 @@ type User struct {
 	// issues with reintroducing Hash
 	// how to mock? new hash generated every time the password is run through bcrypt
 	Uid      interface{}
+	// Roles are issued in the user's session tokens, see DefaultRoles
+	Roles []string
+	// disabled users and users an admin has made reset their password cannot start sessions
+	Disabled              bool
+	PasswordResetRequired bool
+	// new users are unverified until they follow the link mailed to them
+	Unverified bool
+	// LinkedAccounts are the OpenID Connect identities the user can sign in with
+	// users who only ever signed in with a provider have no Hash
+	LinkedAccounts []LinkedAccount
+	// TOTPSecret is set when the user starts enrolling an authenticator and is only checked once TOTPEnabled
+	// TOTPLastStep is the last period a code was accepted for, so a code cannot be used twice
+	TOTPSecret    string
+	TOTPEnabled   bool
+	TOTPLastStep  int64
+	RecoveryCodes []string
 }
 
 func validatePassword(password string) error {
@@ -86,6 +87,8 @@ func NewUser(email string, password string, hash []byte) (*User, error) {
 		Hash: hash,
 		password: password,
 		Uid: nil,
+		Roles: append([]string(nil), DefaultRoles...),
+		Unverified: true,
 	}, nil
 }
 
@@ -129,23 +132,59 @@ func (u User) DoesPassMatch(ctx context.Context, crud CRUD) (bool, error) {
 	return true, nil
 }
 
-func (u User) CreateSessionToken(ctx context.Context, c CRUD, signer Signer) (string, error) {
+// CanSignIn returns ErrUserDisabled or ErrPasswordResetRequired for users that cannot start sessions
+func (u User) CanSignIn() error {
+	if u.Disabled {
+		return ErrUserDisabled
+	}
+	if u.PasswordResetRequired {
+		return ErrPasswordResetRequired
+	}
+	return nil
+}
+
+// identity looks up the user's ID, roles and verification if the ID has not been set yet
+// users that cannot start sessions are rejected with ErrUserDisabled or ErrPasswordResetRequired
+func (u User) identity(ctx context.Context, c CRUD) (Identity, error) {
 	if u.Uid == nil {
 		res, err := c.Read(ctx, u)
 		if err != nil {
-			return "", fmt.Errorf("could not fetch user from DB: %v", err)
+			return Identity{}, fmt.Errorf("could not fetch user from DB: %v", err)
+		}
+		if len(res) == 0 {
+			return Identity{}, errors.New("could not find user in DB")
+		}
+		if err := res[0].CanSignIn(); err != nil {
+			return Identity{}, err
 		}
 		// WARNING: because this is a value receiver this will NOT update the UID of the underlying user
 		u.Uid = res[0].Uid
+		u.Roles = res[0].Roles
+		u.Unverified = res[0].Unverified
 	}
+	id := Identity{Email: u.Email, Roles: u.Roles, Unverified: u.Unverified}
+	switch t := u.Uid.(type) {
+	case string:
+		id.ID = t
+	default:
+		id.ID = fmt.Sprint(t)
+	}
+	return id, nil
+}
 
-	claims := map[string]interface{}{
-		"email": u.Email,
-		"id": u.Uid,
+func (u User) CreateSessionToken(ctx context.Context, c CRUD, signer Signer) (string, error) {
+	id, err := u.identity(ctx, c)
+	if err != nil {
+		return "", err
 	}
-	token, err := signer.Sign(claims)
+	return NewSessionToken(id, signer)
+}
+
+// CreateSession creates a session token and a refresh token for the user
+func (u User) CreateSession(ctx context.Context, c CRUD, signer Signer, store RefreshStore) (string, string, error) {
+	id, err := u.identity(ctx, c)
 	if err != nil {
-		return "", fmt.Errorf("unable to create session token: %v", err)
+		return "", "", err
 	}
-	return token, nil
-}
\ No newline at end of file
+	return IssueSession(ctx, store, signer, id)
+}
@@ -0,0 +1,41 @@
+package users
+
+import (
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// EmailVerificationTTL is how long an email verification link can be followed for
+// users can ask for a new link once it expires
+const EmailVerificationTTL = 24 * time.Hour
+
+// ErrInvalidVerificationToken is returned for unknown, expired and already used email verification tokens
+var ErrInvalidVerificationToken = errors.New("email verification token is invalid or expired")
+
+// EmailVerification is the stored record of an email verification token
+type EmailVerification struct {
+	Hash      string
+	UserID    string
+	Email     string
+	ExpiresAt time.Time
+}
+
+// NewEmailVerification creates a random email verification token and the record to store for it
+func NewEmailVerification(email, userID string) (string, EmailVerification, error) {
+	b, err := randomToken(32)
+	if err != nil {
+		return "", EmailVerification{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, EmailVerification{
+		Hash:      HashVerificationToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(EmailVerificationTTL),
+	}, nil
+}
+
+func HashVerificationToken(token string) string {
+	return hashToken(token)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/mail"
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+)
+
+type verifyEmailData struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+// emailVerifier mails verification links to new users and verifies their email when they follow one
+// session tokens carry the unverified claim until they are refreshed after verifying
+type emailVerifier struct {
+	store         users.VerifyStore
+	verifications users.EmailVerificationStore
+	mailer        mail.Mailer
+	// verifyURL is the client page verification links point to, the token is passed as the token query parameter
+	verifyURL string
+}
+
+// Send mails a verification link to the user
+func (v *emailVerifier) Send(ctx context.Context, email, id string) error {
+	token, record, err := users.NewEmailVerification(email, id)
+	if err != nil {
+		return err
+	}
+	if err := v.verifications.Create(ctx, record); err != nil {
+		return fmt.Errorf("unable to save email verification: %v", err)
+	}
+	msg := mail.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Follow this link within %v to verify your email:\n%v?token=%v\n\n"+
+			"You can sign in before then, but cannot sell or order tickets until your email is verified.",
+			users.EmailVerificationTTL, v.verifyURL, url.QueryEscape(token)),
+	}
+	if err := v.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("unable to send email verification: %v", err)
+	}
+	return nil
+}
+
+// Verify marks the user's email as verified with a token from a verification link
+func (v *emailVerifier) Verify(ctx context.Context, ginCtx *gin.Context) {
+	data := new(verifyEmailData)
+	if err := bind(ginCtx, data); err != nil {
+		bindError(ginCtx, err, "please provide a verification token")
+		return
+	}
+
+	verification, err := v.verifications.Consume(ctx, users.HashVerificationToken(data.Token))
+	if err == users.ErrInvalidVerificationToken {
+		problem.Abort(ginCtx, problem.Validation(codeInvalidVerificationToken, "verification token is invalid or expired").WithCause(err))
+		return
+	} else if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to verify email", err))
+		return
+	}
+
+	found, err := v.store.SetVerified(ctx, verification.UserID)
+	if err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to verify email", err))
+		return
+	}
+	if !found {
+		problem.Abort(ginCtx, problem.NotFound(codeUserNotFound, "user not found").WithCause(errors.New("user not found")))
+		return
+	}
+	// the other links that were mailed are no longer needed
+	if err := v.verifications.RevokeUser(ctx, verification.UserID); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to verify email", err))
+		return
+	}
+	ginCtx.Status(http.StatusOK)
+}
+
+// Resend mails a new verification link to the signed in user
+func (v *emailVerifier) Resend(ctx context.Context, ginCtx *gin.Context) {
+	claims, ok := middleware.ClaimsFromContext(ginCtx)
+	if !ok {
+		problem.Abort(ginCtx, problem.Unauthorized(problem.CodeUnauthorized, "unauthorized").WithCause(errors.New("no session claims")))
+		return
+	}
+	if claims.EmailVerified {
+		problem.Abort(ginCtx, problem.Conflict(codeEmailVerified, "email is already verified").WithCause(errors.New("email is already verified")))
+		return
+	}
+	if err := v.Send(ctx, claims.Email, claims.ID); err != nil {
+		problem.Abort(ginCtx, problem.Internal("unable to send verification email", err))
+		return
+	}
+	ginCtx.Status(http.StatusAccepted)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp/auth/mail"
+	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	verifyURL   = "http://tickets.dev/auth/verify-email"
+	verifyToken = "verify-token"
+)
+
+// verifyEngine routes the verification API the way UseUserRoutes does
+func verifyEngine(t *testing.T, verifier *emailVerifier) (*gin.Engine, *middleware.JWTValidator) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	v, err := middleware.NewJWTValidator(key, "HS256")
+	if err != nil {
+		t.Fatalf("middleware.NewJWTValidator: %v", err)
+	}
+	revoker := new(mockRevoker)
+	revoker.On("IsRevoked", mock.Anything, mock.Anything).Return(false, nil)
+
+	eng := gin.New()
+	eng.Use(problem.Handler())
+	eng.POST("/verify", withTimeout(verifier.Verify))
+	eng.POST("/verify/resend", RequireSession(v, revoker), withTimeout(verifier.Resend))
+	return eng, v
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         gin.H
+		consumeErr   error
+		found        bool
+		expectedCode int
+	}{
+		{"verified", gin.H{"token": verifyToken}, nil, true, http.StatusOK},
+		{"invalid token", gin.H{"token": verifyToken}, users.ErrInvalidVerificationToken, true, http.StatusBadRequest},
+		{"db down", gin.H{"token": verifyToken}, errors.New("db down"), true, http.StatusInternalServerError},
+		{"user deleted", gin.H{"token": verifyToken}, nil, false, http.StatusNotFound},
+		{"missing token", gin.H{}, nil, true, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			store := new(mockVerifyStore)
+			verifications := new(mockVerificationStore)
+			eng, _ := verifyEngine(currTest, &emailVerifier{store: store, verifications: verifications})
+
+			var verification *users.EmailVerification
+			if tt.consumeErr == nil {
+				verification = &users.EmailVerification{Hash: users.HashVerificationToken(verifyToken), UserID: uid, Email: email}
+			}
+			verifications.On("Consume", mock.Anything, users.HashVerificationToken(verifyToken)).Return(verification, tt.consumeErr)
+			verifications.On("RevokeUser", mock.Anything, uid).Return(nil)
+			store.On("SetVerified", mock.Anything, uid).Return(tt.found, nil)
+
+			resp := passwordRequest(currTest, eng, "/verify", "", tt.body)
+			if got, want := resp.StatusCode, tt.expectedCode; got != want {
+				currTest.Fatalf("wrong status code: %v, want %v", got, want)
+			}
+			if tt.expectedCode == http.StatusOK {
+				store.AssertExpectations(currTest)
+				verifications.AssertExpectations(currTest)
+			} else if tt.consumeErr != nil {
+				store.AssertNotCalled(currTest, "SetVerified", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	tests := []struct {
+		name         string
+		signedIn     bool
+		unverified   bool
+		expectedCode int
+	}{
+		{"unverified", true, true, http.StatusAccepted},
+		{"already verified", true, false, http.StatusConflict},
+		{"not signed in", false, true, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			verifications := new(mockVerificationStore)
+			mailer := new(mockMailer)
+			eng, v := verifyEngine(currTest, &emailVerifier{verifications: verifications, mailer: mailer, verifyURL: verifyURL})
+
+			verifications.On("Create", mock.Anything, mock.MatchedBy(func(v users.EmailVerification) bool {
+				return v.Email == email && v.UserID == uid && v.Hash != ""
+			})).Return(nil)
+			mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg mail.Message) bool {
+				return msg.To == email && strings.Contains(msg.Body, verifyURL+"?token=")
+			})).Return(nil)
+
+			var token string
+			if tt.signedIn {
+				user := sampleIdentity
+				user.Unverified = tt.unverified
+				var err error
+				if token, err = users.NewSessionToken(user, v); err != nil {
+					currTest.Fatalf("users.NewSessionToken: %v", err)
+				}
+			}
+			resp := passwordRequest(currTest, eng, "/verify/resend", token, nil)
+			if got, want := resp.StatusCode, tt.expectedCode; got != want {
+				currTest.Fatalf("wrong status code: %v, want %v", got, want)
+			}
+			if tt.expectedCode == http.StatusAccepted {
+				verifications.AssertExpectations(currTest)
+				mailer.AssertExpectations(currTest)
+			} else {
+				mailer.AssertNotCalled(currTest, "Send", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
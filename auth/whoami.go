@@ -1,44 +1,78 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
 
-	e "github.com/basilnsage/mwn-ticketapp/auth/errors"
-	"github.com/basilnsage/mwn-ticketapp/auth/token"
-	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
 	"github.com/gin-gonic/gin"
 )
 
-type Claims struct {
-	users.Claims
-}
-
 // Whoami identifies a user by the provided JWT cookie and returns a representation of said user
-func Whoami(ctx *gin.Context, validator *token.JWTValidator) {
-	resp, err := userFromRequest(ctx, validator)
+// revoked tokens are rejected
+func Whoami(ctx *gin.Context, validator *middleware.JWTValidator, revoker sessionRevoker) {
+	resp, err := userFromRequest(ctx, validator, revoker)
 	if err != nil {
-		cError := e.NewBaseError(http.StatusUnauthorized, "unauthorized")
-		_ = ctx.Error(err).SetType(1 << 1).SetMeta(*cError)
+		problem.Abort(ctx, problem.Unauthorized(problem.CodeUnauthorized, "unauthorized").WithCause(err))
 	} else {
-		ctx.JSON(http.StatusOK, resp)
+		render(ctx, http.StatusOK, resp)
 	}
 }
 
-func userFromRequest(ctx *gin.Context, validator *token.JWTValidator) (*gin.H, error) {
-	defaultResp := &gin.H{"email": nil, "id": nil}
-	// check for the "auth-jwt" cookie from the request
-	cookie, err := ctx.Cookie("auth-jwt")
+func userFromRequest(ctx *gin.Context, validator *middleware.JWTValidator, revoker sessionRevoker) (*gin.H, error) {
+	defaultResp := &gin.H{"email": nil, "id": nil, "roles": nil, "email_verified": nil}
+	claims, err := sessionClaims(ctx, validator, revoker)
 	if err == http.ErrNoCookie {
 		return defaultResp, nil
 	} else if err != nil {
 		return defaultResp, err
 	}
+	return &gin.H{"email": claims.Email, "id": claims.ID, "roles": claims.Roles, "email_verified": claims.EmailVerified}, nil
+}
+
+// RequireSession rejects requests without a valid, unrevoked session cookie
+// the claims are stored in the gin.Context so middleware.RequireRole can check them
+// as the session comes from a cookie, state changing requests must also pass the CSRF check
+func RequireSession(validator *middleware.JWTValidator, revoker sessionRevoker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, err := sessionClaims(ctx, validator, revoker)
+		if err != nil {
+			problem.Abort(ctx, problem.Unauthorized(problem.CodeUnauthorized, "unauthorized").WithCause(err))
+			ctx.Abort()
+			return
+		}
+		if !middleware.CheckCSRF(ctx.Request) {
+			problem.Abort(ctx, problem.Forbidden(middleware.CodeInvalidCSRF, "invalid CSRF token").WithCause(errors.New("invalid CSRF token")))
+			ctx.Abort()
+			return
+		}
+		middleware.SetClaims(ctx, claims)
+	}
+}
+
+// sessionClaims parses the session cookie, returning http.ErrNoCookie if there is none
+func sessionClaims(ctx *gin.Context, validator *middleware.JWTValidator, revoker sessionRevoker) (*middleware.Claims, error) {
+	// check for the "auth-jwt" cookie from the request
+	cookie, err := ctx.Cookie(sessionCookie)
+	if err != nil {
+		return nil, err
+	}
 
-	parsedClaims := new(Claims)
 	// attempt to parse the cookie as a JWT
-	_, err = validator.ParseWithClaims(cookie, parsedClaims)
+	parsedClaims, err := validator.ParseClaims(cookie)
 	if err != nil {
-		return defaultResp, err
+		return nil, err
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx.Request.Context(), 10*time.Second)
+	defer cancel()
+	if revoked, err := revoker.IsRevoked(dbCtx, *parsedClaims); err != nil {
+		return nil, err
+	} else if revoked {
+		return nil, errors.New("token has been revoked")
 	}
-	return &gin.H{"email": parsedClaims.Email, "id": parsedClaims.ID}, nil
+	return parsedClaims, nil
 }
@@ -7,18 +7,21 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
-	"github.com/basilnsage/mwn-ticketapp/auth/token"
 	"github.com/basilnsage/mwn-ticketapp/auth/users"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
 	"github.com/gin-gonic/gin"
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/mock"
 )
 
-func setup(t *testing.T) (*token.JWTValidator, *gin.Engine) {
+func setup(t *testing.T) (*middleware.JWTValidator, *gin.Engine) {
 	// create the JWT validator
-	jwtValidator, err := token.NewJWTValidator(key, "HS256")
+	jwtValidator, err := middleware.NewJWTValidator(key, "HS256")
 	if err != nil {
-		t.Fatalf("token.NewJWTValidator: %v", err)
+		t.Fatalf("middleware.NewJWTValidator: %v", err)
 	}
 
 	eng := gin.Default()
@@ -31,7 +34,7 @@ func setup(t *testing.T) (*token.JWTValidator, *gin.Engine) {
 	return jwtValidator, eng
 }
 
-func parseBody(receiver *users.Claims, resp *http.Response) error {
+func parseBody(receiver *middleware.Claims, resp *http.Response) error {
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("ioutil.ReadAll: %v", err)
@@ -46,10 +49,13 @@ func TestWhoami(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	v, eng := setup(t)
 
+	revoker := new(mockRevoker)
+	revoker.On("IsRevoked", mock.Anything, mock.Anything).Return(false, nil)
+
 	// stand up a test router and create a test route to invoke Whoami
 	w := httptest.NewRecorder()
 	eng.GET("/test", func(ctx *gin.Context) {
-		Whoami(ctx, v)
+		Whoami(ctx, v, revoker)
 	})
 
 	// create an HTTP request and send it to the test route
@@ -57,7 +63,14 @@ func TestWhoami(t *testing.T) {
 	if err != nil {
 		t.Fatalf("http.NewRequest: %v", err)
 	}
-	req.AddCookie(&cookie)
+	// new users see they still have to verify their email
+	unverified := sampleIdentity
+	unverified.Unverified = true
+	sessionToken, err := users.NewSessionToken(unverified, v)
+	if err != nil {
+		t.Fatalf("users.NewSessionToken: %v", err)
+	}
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sessionToken})
 	eng.ServeHTTP(w, req)
 
 	// check status
@@ -67,11 +80,67 @@ func TestWhoami(t *testing.T) {
 	}
 
 	// check response body
-	bodyJson := users.Claims{}
+	bodyJson := middleware.Claims{}
 	if err := parseBody(&bodyJson, resp); err != nil {
 		t.Errorf("Whoami could not parse resp body: %v", err)
 	}
-	if diff := cmp.Diff(sampleClaims, bodyJson); diff != "" {
+	want := sampleClaims
+	if diff := cmp.Diff(want, bodyJson); diff != "" {
 		t.Errorf("Whoami: (-want, +got):\n%s", diff)
 	}
 }
+
+func TestWhoamiRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	v, err := middleware.NewJWTValidator(key, "HS256")
+	if err != nil {
+		t.Fatalf("middleware.NewJWTValidator: %v", err)
+	}
+
+	expired, err := v.Sign(&middleware.Claims{
+		Email:     email,
+		ID:        uid,
+		TokenID:   "1",
+		ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("JWTValidator.Sign: %v", err)
+	}
+	valid, err := users.NewSessionToken(sampleIdentity, v)
+	if err != nil {
+		t.Fatalf("users.NewSessionToken: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		revoked bool
+	}{
+		{"expired token", expired, false},
+		{"revoked token", valid, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			revoker := new(mockRevoker)
+			revoker.On("IsRevoked", mock.Anything, mock.Anything).Return(tt.revoked, nil)
+
+			eng := gin.New()
+			eng.Use(problem.Handler())
+			eng.GET("/test", func(ctx *gin.Context) {
+				Whoami(ctx, v, revoker)
+			})
+
+			w := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/test", nil)
+			if err != nil {
+				currTest.Fatalf("http.NewRequest: %v", err)
+			}
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.token})
+			eng.ServeHTTP(w, req)
+
+			if got, want := w.Code, http.StatusUnauthorized; got != want {
+				currTest.Errorf("Whoami wrong status code: %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -14,11 +14,15 @@ const named = ({url, method, body, onSuccess}) => {
             return resp.data;
         } catch(err) {
             console.log(err);
+            // services respond with an application/problem+json body, invalid-params lists what is wrong with each field
+            const problem = (err.response && err.response.data) || {};
+            const params = problem['invalid-params'] || [];
             setErrors(
                 <div className="alert alert-danger">
                 <h4>Ooops....</h4>
                 <ul className="my-0">
-                    <li>{err.response.data.error}</li>
+                    <li>{problem.detail || 'Something went wrong'}</li>
+                    {params.map(param => <li key={param.name}>{param.reason}</li>)}
                 </ul>
                 </div>
             );
@@ -0,0 +1,43 @@
+import { useState } from 'react';
+import Router, { useRouter } from 'next/router';
+import useRequest from '../../hooks/use-request';
+
+const resetPasswordDefault = () => {
+  const { query } = useRouter();
+  const [password, setPassword] = useState('');
+  const { doRequest, errors } = useRequest({
+    url: '/api/users/password/reset',
+    method: 'post',
+    body: {
+        token: query.token,
+        newPassword: password
+    },
+    onSuccess: () => {
+        Router.push('/auth/signin');
+    },
+  });
+
+  const onSubmit = async event => {
+    event.preventDefault();
+    doRequest();
+  };
+
+  return (
+    <form onSubmit={onSubmit}>
+      <h1>Reset Password</h1>
+      <div className="form-group">
+        <label>New Password</label>
+        <input
+          value={password}
+          onChange={e => setPassword(e.target.value)}
+          type="password"
+          className="form-control"
+        />
+      </div>
+      {errors}
+      <button className="btn btn-primary">Reset Password</button>
+    </form>
+  );
+};
+
+export default resetPasswordDefault;
@@ -12,8 +12,9 @@ const signinDefault = () => {
         username: email,
         password: password
     },
-    onSuccess: () => {
-        Router.push('/');
+    onSuccess: (data) => {
+        // users with an authenticator enter a code before they are signed in
+        Router.push(data && data.mfaRequired ? '/auth/two-factor' : '/');
     },
   });
 
@@ -5,7 +5,7 @@ import useRequest from '../../hooks/use-request';
 const signoutDefault = () => {
     const { doRequest } = useRequest({
         url: '/api/users/signout',
-        method: 'get',
+        method: 'post',
         onSuccess: () => {
             Router.push('/')
         },
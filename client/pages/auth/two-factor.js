@@ -0,0 +1,41 @@
+import { useState } from 'react';
+import Router from 'next/router';
+import useRequest from '../../hooks/use-request';
+
+const twoFactorDefault = () => {
+  const [code, setCode] = useState('');
+  const { doRequest, errors } = useRequest({
+    url: '/api/users/2fa/signin',
+    method: 'post',
+    body: {
+        code: code
+    },
+    onSuccess: () => {
+        Router.push('/');
+    },
+  });
+
+  const onSubmit = async event => {
+    event.preventDefault();
+    doRequest();
+  };
+
+  return (
+    <form onSubmit={onSubmit}>
+      <h1>Two-Factor Authentication</h1>
+      <div className="form-group">
+        <label>Code from your authenticator, or a recovery code</label>
+        <input
+          value={code}
+          onChange={e => setCode(e.target.value)}
+          autoComplete="one-time-code"
+          className="form-control"
+        />
+      </div>
+      {errors}
+      <button className="btn btn-primary">Sign In</button>
+    </form>
+  );
+};
+
+export default twoFactorDefault;
@@ -0,0 +1,29 @@
+import axios from 'axios';
+import Router, { useRouter } from 'next/router';
+import { useEffect } from 'react';
+import useRequest from '../../hooks/use-request';
+
+const verifyEmailDefault = () => {
+    const { query } = useRouter();
+    const { doRequest, errors } = useRequest({
+        url: '/api/users/verify',
+        method: 'post',
+        body: {
+            token: query.token
+        },
+        onSuccess: async () => {
+            // refresh the session so it carries the email_verified claim, signed out users have nothing to refresh
+            await axios.post('/api/users/refresh').catch(() => {});
+            Router.push('/');
+        },
+    });
+
+    useEffect(() => {
+        if (query.token) {
+            doRequest();
+        }
+    }, [query.token]);
+    return <div>Verifying your email{errors}</div>
+};
+
+export default verifyEmailDefault;
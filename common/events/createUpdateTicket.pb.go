@@ -0,0 +1,192 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.30.0
+// 	protoc        (unknown)
+// source: createUpdateTicket.proto
+
+package events
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CreateUpdateTicket struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Title   string  `protobuf:"bytes,1,opt,name=title,proto3" json:"title,omitempty"`
+	Price   float64 `protobuf:"fixed64,2,opt,name=price,proto3" json:"price,omitempty"`
+	Id      string  `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	Owner   string  `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	Version uint32  `protobuf:"varint,5,opt,name=version,proto3" json:"version,omitempty"`
+	OrderId string  `protobuf:"bytes,6,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+}
+
+func (x *CreateUpdateTicket) Reset() {
+	*x = CreateUpdateTicket{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_createUpdateTicket_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateUpdateTicket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateUpdateTicket) ProtoMessage() {}
+
+func (x *CreateUpdateTicket) ProtoReflect() protoreflect.Message {
+	mi := &file_createUpdateTicket_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateUpdateTicket.ProtoReflect.Descriptor instead.
+func (*CreateUpdateTicket) Descriptor() ([]byte, []int) {
+	return file_createUpdateTicket_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CreateUpdateTicket) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *CreateUpdateTicket) GetPrice() float64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+func (x *CreateUpdateTicket) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CreateUpdateTicket) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *CreateUpdateTicket) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *CreateUpdateTicket) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+var File_createUpdateTicket_proto protoreflect.FileDescriptor
+
+var file_createUpdateTicket_proto_rawDesc = []byte{
+	0x0a, 0x18, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x54, 0x69,
+	0x63, 0x6b, 0x65, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x9b, 0x01, 0x0a, 0x12, 0x43,
+	0x72, 0x65, 0x61, 0x74, 0x65, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x54, 0x69, 0x63, 0x6b, 0x65,
+	0x74, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x72, 0x69, 0x63, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x70, 0x72, 0x69, 0x63, 0x65, 0x12, 0x0e, 0x0a,
+	0x02, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x14, 0x0a,
+	0x05, 0x6f, 0x77, 0x6e, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6f, 0x77,
+	0x6e, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x19, 0x0a,
+	0x08, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x07, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x49, 0x64, 0x42, 0x33, 0x5a, 0x31, 0x67, 0x69, 0x74, 0x68,
+	0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x62, 0x61, 0x73, 0x69, 0x6c, 0x6e, 0x73, 0x61, 0x67,
+	0x65, 0x2f, 0x6d, 0x77, 0x6e, 0x2d, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x61, 0x70, 0x70, 0x2d,
+	0x63, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x2f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_createUpdateTicket_proto_rawDescOnce sync.Once
+	file_createUpdateTicket_proto_rawDescData = file_createUpdateTicket_proto_rawDesc
+)
+
+func file_createUpdateTicket_proto_rawDescGZIP() []byte {
+	file_createUpdateTicket_proto_rawDescOnce.Do(func() {
+		file_createUpdateTicket_proto_rawDescData = protoimpl.X.CompressGZIP(file_createUpdateTicket_proto_rawDescData)
+	})
+	return file_createUpdateTicket_proto_rawDescData
+}
+
+var file_createUpdateTicket_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_createUpdateTicket_proto_goTypes = []interface{}{
+	(*CreateUpdateTicket)(nil), // 0: CreateUpdateTicket
+}
+var file_createUpdateTicket_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_createUpdateTicket_proto_init() }
+func file_createUpdateTicket_proto_init() {
+	if File_createUpdateTicket_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_createUpdateTicket_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateUpdateTicket); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_createUpdateTicket_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_createUpdateTicket_proto_goTypes,
+		DependencyIndexes: file_createUpdateTicket_proto_depIdxs,
+		MessageInfos:      file_createUpdateTicket_proto_msgTypes,
+	}.Build()
+	File_createUpdateTicket_proto = out.File
+	file_createUpdateTicket_proto_rawDesc = nil
+	file_createUpdateTicket_proto_goTypes = nil
+	file_createUpdateTicket_proto_depIdxs = nil
+}
@@ -0,0 +1,159 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.30.0
+// 	protoc        (unknown)
+// source: expirationComplete.proto
+
+package events
+
+import (
+	subjects "github.com/basilnsage/mwn-ticketapp-common/subjects"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ExpirationComplete struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Subject subjects.Subject `protobuf:"varint,1,opt,name=subject,proto3,enum=Subject" json:"subject,omitempty"`
+	OrderId string           `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+}
+
+func (x *ExpirationComplete) Reset() {
+	*x = ExpirationComplete{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_expirationComplete_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExpirationComplete) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpirationComplete) ProtoMessage() {}
+
+func (x *ExpirationComplete) ProtoReflect() protoreflect.Message {
+	mi := &file_expirationComplete_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpirationComplete.ProtoReflect.Descriptor instead.
+func (*ExpirationComplete) Descriptor() ([]byte, []int) {
+	return file_expirationComplete_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ExpirationComplete) GetSubject() subjects.Subject {
+	if x != nil {
+		return x.Subject
+	}
+	return subjects.Subject(0)
+}
+
+func (x *ExpirationComplete) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+var File_expirationComplete_proto protoreflect.FileDescriptor
+
+var file_expirationComplete_proto_rawDesc = []byte{
+	0x0a, 0x18, 0x65, 0x78, 0x70, 0x69, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x6d, 0x70,
+	0x6c, 0x65, 0x74, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x12, 0x6e, 0x61, 0x74, 0x73,
+	0x53, 0x75, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x53,
+	0x0a, 0x12, 0x45, 0x78, 0x70, 0x69, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x6d, 0x70,
+	0x6c, 0x65, 0x74, 0x65, 0x12, 0x22, 0x0a, 0x07, 0x73, 0x75, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x08, 0x2e, 0x53, 0x75, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x52,
+	0x07, 0x73, 0x75, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x12, 0x19, 0x0a, 0x08, 0x6f, 0x72, 0x64, 0x65,
+	0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6f, 0x72, 0x64, 0x65,
+	0x72, 0x49, 0x64, 0x42, 0x33, 0x5a, 0x31, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f,
+	0x6d, 0x2f, 0x62, 0x61, 0x73, 0x69, 0x6c, 0x6e, 0x73, 0x61, 0x67, 0x65, 0x2f, 0x6d, 0x77, 0x6e,
+	0x2d, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x61, 0x70, 0x70, 0x2d, 0x63, 0x6f, 0x6d, 0x6d, 0x6f,
+	0x6e, 0x2f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_expirationComplete_proto_rawDescOnce sync.Once
+	file_expirationComplete_proto_rawDescData = file_expirationComplete_proto_rawDesc
+)
+
+func file_expirationComplete_proto_rawDescGZIP() []byte {
+	file_expirationComplete_proto_rawDescOnce.Do(func() {
+		file_expirationComplete_proto_rawDescData = protoimpl.X.CompressGZIP(file_expirationComplete_proto_rawDescData)
+	})
+	return file_expirationComplete_proto_rawDescData
+}
+
+var file_expirationComplete_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_expirationComplete_proto_goTypes = []interface{}{
+	(*ExpirationComplete)(nil), // 0: ExpirationComplete
+	(subjects.Subject)(0),      // 1: Subject
+}
+var file_expirationComplete_proto_depIdxs = []int32{
+	1, // 0: ExpirationComplete.subject:type_name -> Subject
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_expirationComplete_proto_init() }
+func file_expirationComplete_proto_init() {
+	if File_expirationComplete_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_expirationComplete_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ExpirationComplete); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_expirationComplete_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_expirationComplete_proto_goTypes,
+		DependencyIndexes: file_expirationComplete_proto_depIdxs,
+		MessageInfos:      file_expirationComplete_proto_msgTypes,
+	}.Build()
+	File_expirationComplete_proto = out.File
+	file_expirationComplete_proto_rawDesc = nil
+	file_expirationComplete_proto_goTypes = nil
+	file_expirationComplete_proto_depIdxs = nil
+}
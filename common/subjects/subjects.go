@@ -0,0 +1,55 @@
+package subjects
+
+import (
+	"fmt"
+)
+
+var protoSubjToString = map[string]string{
+	"TICKET_CREATED":               "ticket:created",
+	"TICKET_UPDATED":               "ticket:updated",
+	"ORDER_CREATED":                "order:created",
+	"ORDER_CANCELLED":              "order:cancelled",
+	"EXPIRATION_COMPLETE":          "expiration:complete",
+	"PAYMENT_CREATED":              "payment:created",
+	"TOKEN_REVOKED":                "token:revoked",
+	"USER_DISABLED":                "user:disabled",
+	"USER_ENABLED":                 "user:enabled",
+	"USER_PASSWORD_RESET_REQUIRED": "user:password-reset-required",
+}
+
+var stringToProtoSubj = map[string]string{
+	"ticket:created":               "TICKET_CREATED",
+	"ticket:updated":               "TICKET_UPDATED",
+	"order:created":                "ORDER_CREATED",
+	"order:cancelled":              "ORDER_CANCELLED",
+	"expiration:complete":          "EXPIRATION_COMPLETE",
+	"payment:created":              "PAYMENT_CREATED",
+	"token:revoked":                "TOKEN_REVOKED",
+	"user:disabled":                "USER_DISABLED",
+	"user:enabled":                 "USER_ENABLED",
+	"user:password-reset-required": "USER_PASSWORD_RESET_REQUIRED",
+}
+
+func StringifySubject(enum Subject) (string, error) {
+	protoSubj, ok := Subject_name[int32(enum.Number())]
+	if !ok {
+		return "", fmt.Errorf("invalid subject %v", enum)
+	}
+	subject, ok := protoSubjToString[protoSubj]
+	if !ok {
+		return "", fmt.Errorf("could not map subject %v", protoSubj)
+	}
+	return subject, nil
+}
+
+func SubjectifyString(subject string) (Subject, error) {
+	protoSubj, ok := stringToProtoSubj[subject]
+	if !ok {
+		return -1, fmt.Errorf("invalid subject %v", subject)
+	}
+	enum, ok := Subject_value[protoSubj]
+	if !ok {
+		return -1, fmt.Errorf("could not map subject %v", protoSubj)
+	}
+	return Subject(enum), nil
+}
@@ -0,0 +1,11 @@
+#!/bin/bash
+
+set -e
+
+go mod tidy
+go fmt
+go vet
+go test
+
+version=0.0.1
+docker build -t  basilnsage/mwn-ticketapp.expiration:"$version" -t basilnsage/mwn-ticketapp.expiration:latest -f Dockerfile ..
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/protobuf/proto"
+)
+
+func jobFromOrderCreated(data []byte) (*Job, error) {
+	var createdEvent events.OrderCreated
+	if err := proto.Unmarshal(data, &createdEvent); err != nil {
+		return nil, err
+	}
+	if createdEvent.Data == nil {
+		return nil, errors.New("order created event has no data")
+	}
+
+	expiresAt, err := ptypes.Timestamp(createdEvent.Data.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		OrderId:   createdEvent.Data.Id,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func marshalExpirationComplete(orderId string) ([]byte, error) {
+	completeEvent := &events.ExpirationComplete{
+		Subject: subjects.Subject_EXPIRATION_COMPLETE,
+		OrderId: orderId,
+	}
+
+	completeEventBytes, err := proto.Marshal(completeEvent)
+	if err != nil {
+		return nil, err
+	}
+	return completeEventBytes, nil
+}
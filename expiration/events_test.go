@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func marshalOrderCreated(t *testing.T, orderId string, expiresAt time.Time) []byte {
+	pbExpiresAt, err := ptypes.TimestampProto(expiresAt)
+	if err != nil {
+		t.Fatalf("ptypes.TimestampProto: %v", err)
+	}
+	b, err := proto.Marshal(&events.OrderCreated{
+		Subject: subjects.Subject_ORDER_CREATED,
+		Data: &events.CreatedData{
+			Id:        orderId,
+			Status:    events.Status_Created,
+			UserId:    "1",
+			ExpiresAt: pbExpiresAt,
+			Ticket: &events.CreatedData_Ticket{
+				Id:    "1",
+				Price: 1.0,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+	return b
+}
+
+func TestJobFromOrderCreated(t *testing.T) {
+	expiresAt := time.Unix(1000, 0).UTC()
+	job, err := jobFromOrderCreated(marshalOrderCreated(t, "1", expiresAt))
+	if err != nil {
+		t.Fatalf("jobFromOrderCreated: %v", err)
+	}
+	if diff := cmp.Diff(Job{OrderId: "1", ExpiresAt: expiresAt}, *job); diff != "" {
+		t.Fatalf("diff: (-want +got)\n%v", diff)
+	}
+
+	if _, err := jobFromOrderCreated([]byte("not a proto")); err == nil {
+		t.Fatal("jobFromOrderCreated should fail on a malformed event")
+	}
+}
+
+func TestMarshalExpirationComplete(t *testing.T) {
+	want := &events.ExpirationComplete{
+		Subject: subjects.Subject_EXPIRATION_COMPLETE,
+		OrderId: "1",
+	}
+
+	b, err := marshalExpirationComplete("1")
+	if err != nil {
+		t.Fatalf("marshalExpirationComplete: %v", err)
+	}
+
+	var got events.ExpirationComplete
+	if err := proto.Unmarshal(b, &got); err != nil {
+		t.Fatalf("proto.Unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(want, &got, protocmp.Transform()); diff != "" {
+		t.Fatalf("diff: (-want +got)\n%v", diff)
+	}
+}
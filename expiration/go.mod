@@ -0,0 +1,19 @@
+module github.com/basilnsage/mwn-ticketapp/expiration
+
+go 1.15
+
+require (
+	github.com/basilnsage/mwn-ticketapp-common v0.0.0-00010101000000-000000000000
+	github.com/basilnsage/mwn-ticketapp/middleware v0.0.0-00010101000000-000000000000
+	github.com/golang/protobuf v1.4.3
+	github.com/google/go-cmp v0.5.4
+	github.com/nats-io/nats.go v1.10.0
+	github.com/nats-io/stan.go v0.8.1
+	go.mongodb.org/mongo-driver v1.4.4
+	google.golang.org/protobuf v1.25.0
+)
+
+replace (
+	github.com/basilnsage/mwn-ticketapp-common => ../common
+	github.com/basilnsage/mwn-ticketapp/middleware => ../middleware
+)
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Job is a pending order expiration
+// jobs are persisted so they survive restarts of the expiration service
+type Job struct {
+	OrderId   string    `bson:"_id"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	// Owner is the scheduler that claimed the job when it expired, no other scheduler completes it until LeaseUntil
+	Owner      string    `bson:"owner,omitempty"`
+	LeaseUntil time.Time `bson:"leaseUntil,omitempty"`
+}
+
+type jobsCRUD interface {
+	create(Job) error
+	read(string) (*Job, error)
+	readAll() ([]Job, error)
+	claim(orderId, owner string, lease time.Duration) (bool, error)
+	delete(string) error
+}
+
+type jobsCollection struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func newJobsCollection(collection *mongo.Collection, timeout time.Duration) jobsCRUD {
+	return jobsCollection{
+		collection,
+		timeout,
+	}
+}
+
+// create upserts so a redelivered order:created event does not fail on a duplicate key
+// nor release a job another scheduler has claimed
+func (j jobsCollection) create(job Job) error {
+	ctx, cancel := context.WithTimeout(context.Background(), j.timeout)
+	defer cancel()
+
+	filter := bson.M{"_id": job.OrderId}
+	update := bson.M{"$set": bson.M{"expiresAt": job.ExpiresAt}}
+	if _, err := j.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (j jobsCollection) read(orderId string) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), j.timeout)
+	defer cancel()
+
+	res := j.collection.FindOne(ctx, bson.M{"_id": orderId})
+	if res.Err() == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if res.Err() != nil {
+		return nil, res.Err()
+	}
+
+	var job Job
+	if err := res.Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (j jobsCollection) readAll() ([]Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), j.timeout)
+	defer cancel()
+
+	cursor, err := j.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []Job
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// claim leases the job to owner for lease, unless another owner holds an unexpired lease on it
+// it reports false if the job is leased by someone else or no longer exists
+func (j jobsCollection) claim(orderId, owner string, lease time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), j.timeout)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id": orderId,
+		"$or": []bson.M{
+			{"owner": owner},
+			{"leaseUntil": bson.M{"$exists": false}},
+			{"leaseUntil": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "leaseUntil": now.Add(lease)}}
+	res, err := j.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (j jobsCollection) delete(orderId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), j.timeout)
+	defer cancel()
+
+	if _, err := j.collection.DeleteOne(ctx, bson.M{"_id": orderId}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type fakeJobsCollection struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+func newFakeJobsCollection() *fakeJobsCollection {
+	return &fakeJobsCollection{
+		jobs: make(map[string]Job),
+	}
+}
+
+func (f *fakeJobsCollection) create(job Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if existing, ok := f.jobs[job.OrderId]; ok {
+		existing.ExpiresAt = job.ExpiresAt
+		job = existing
+	}
+	f.jobs[job.OrderId] = job
+	return nil
+}
+
+func (f *fakeJobsCollection) read(orderId string) (*Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	job, ok := f.jobs[orderId]
+	if !ok {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+func (f *fakeJobsCollection) readAll() ([]Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var jobs []Job
+	for _, job := range f.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (f *fakeJobsCollection) claim(orderId, owner string, lease time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	job, ok := f.jobs[orderId]
+	if !ok {
+		return false, nil
+	}
+	now := time.Now()
+	if job.Owner != owner && job.LeaseUntil.After(now) {
+		return false, nil
+	}
+	job.Owner = owner
+	job.LeaseUntil = now.Add(lease)
+	f.jobs[orderId] = job
+	return true, nil
+}
+
+func (f *fakeJobsCollection) delete(orderId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.jobs, orderId)
+	return nil
+}
+
+func (f *fakeJobsCollection) has(orderId string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.jobs[orderId]
+	return ok
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp/middleware/listen"
+	"github.com/nats-io/stan.go"
+)
+
+const (
+	queueGroup   = "expiration-service"
+	eventAckWait = 30 * time.Second
+)
+
+type listener struct {
+	s    *scheduler
+	eBus stan.Conn
+}
+
+func newListener(s *scheduler, eBus stan.Conn) *listener {
+	return &listener{
+		s,
+		eBus,
+	}
+}
+
+// listen subscribes to every subject the expiration service consumes
+func (l *listener) listen() error {
+	handlers := map[string]listen.Handler{
+		orderCreatedSubject: l.onOrderCreated,
+	}
+
+	subscriber := listen.Subscriber{Group: queueGroup, AckWait: eventAckWait, Info: InfoLogger, Error: ErrorLogger}
+	return subscriber.Listen(l.eBus, handlers)
+}
+
+func (l *listener) onOrderCreated(data []byte) error {
+	job, err := jobFromOrderCreated(data)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal order created event: %v", err)
+	}
+
+	if err := l.s.add(*job); err != nil {
+		return err
+	}
+	InfoLogger.Printf("scheduled expiration for order: %v, at: %v", job.OrderId, job.ExpiresAt)
+
+	return nil
+}
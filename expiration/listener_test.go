@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOnOrderCreated(t *testing.T) {
+	s, fakeJC, fakeStan := newTestScheduler(t)
+	l := newListener(s, fakeStan)
+
+	if err := l.onOrderCreated(marshalOrderCreated(t, "1", time.Now().Add(time.Hour))); err != nil {
+		t.Fatalf("onOrderCreated: %v", err)
+	}
+	if !fakeJC.has("1") {
+		t.Fatal("job was not persisted")
+	}
+
+	if err := l.onOrderCreated([]byte("not a proto")); err == nil {
+		t.Fatal("onOrderCreated should fail on a malformed event")
+	}
+}
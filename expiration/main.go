@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/stan.go"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	dbName             = "app"
+	jobsCollectionName = "jobs"
+	dbTimeout          = 3 * time.Second
+	publishRetry       = 5 * time.Second
+	jobLease           = 30 * time.Second
+)
+
+var (
+	InfoLogger  *log.Logger
+	ErrorLogger *log.Logger
+)
+
+func init() {
+	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
+	ErrorLogger = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
+}
+
+type groupCloser struct {
+	scheduler   *scheduler
+	stan        stan.Conn
+	mongoClient *mongo.Client
+}
+
+func (gc groupCloser) shutdown(code int) {
+	// shutdown order: scheduler -> nats -> mongo
+	// allow 90 seconds for everything to shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	InfoLogger.Print("stopping the job scheduler")
+	if gc.scheduler != nil {
+		gc.scheduler.stop()
+	}
+
+	InfoLogger.Print("shutting down the NATS connection")
+	if gc.stan != nil {
+		if err := gc.stan.Close(); err != nil {
+			panic(err)
+		}
+	}
+
+	InfoLogger.Print("shutting down the MongoDB connection")
+	if gc.mongoClient != nil {
+		if err := gc.mongoClient.Disconnect(ctx); err != nil {
+			panic(err)
+		}
+	}
+
+	InfoLogger.Print("all service connections shut down")
+	os.Exit(code)
+}
+
+type mainConfig map[string]string
+
+func genMainConfig() (mainConfig, []string) {
+	var missingEnvs []string
+	conf := mainConfig{}
+	envToErrString := map[string]string{
+		"MONGO_CONN_STR":  "missing mongo connection: MONGO_CONN_STR",
+		"NATS_CLUSTER_ID": "missing NATS cluster ID: NATS_CLUSTER_ID",
+		"NATS_CLIENT_ID":  "missing NATS client ID: NATS_CLIENT_ID",
+		"NATS_CONN_STR":   "missing NATS connection string: NATS_CONN_STR",
+	}
+	for key, errStr := range envToErrString {
+		if val, ok := os.LookupEnv(key); !ok {
+			missingEnvs = append(missingEnvs, errStr)
+		} else {
+			conf[key] = val
+		}
+	}
+	return conf, missingEnvs
+}
+
+func main() {
+	// for handling graceful shutdown of all required services
+	gc := groupCloser{}
+
+	// parse environment variables for startup info
+	conf, missingEnvs := genMainConfig()
+	if len(missingEnvs) > 0 {
+		for _, errStr := range missingEnvs {
+			ErrorLogger.Print(errStr)
+		}
+		os.Exit(1)
+	}
+
+	// init MongoDB collections
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	client, err := mongo.NewClient(options.Client().ApplyURI(conf["MONGO_CONN_STR"]))
+	if err != nil {
+		ErrorLogger.Printf("mongo.NewClient: %v", err)
+		gc.shutdown(1)
+	}
+	if err := client.Connect(ctx); err != nil {
+		ErrorLogger.Printf("mongo client.Connect: %v", err)
+		gc.shutdown(1)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		ErrorLogger.Printf("mongo client.Ping: %v", err)
+		gc.shutdown(1)
+	}
+	InfoLogger.Print("connected to MongoDB")
+	gc.mongoClient = client
+	db := client.Database(dbName)
+
+	jc := newJobsCollection(db.Collection(jobsCollectionName), dbTimeout)
+
+	// init NATS Streaming Server connection
+	natsClient, err := stan.Connect(conf["NATS_CLUSTER_ID"], conf["NATS_CLIENT_ID"], stan.NatsURL(conf["NATS_CONN_STR"]))
+	if err != nil {
+		ErrorLogger.Printf("stan.Connect: %v", err)
+		gc.shutdown(1)
+	}
+	InfoLogger.Print("connected to NATS Streaming Server")
+	gc.stan = natsClient
+
+	// reschedule any jobs left over from a previous run
+	s, err := newScheduler(jc, natsClient, conf["NATS_CLIENT_ID"], publishRetry, jobLease)
+	if err != nil {
+		ErrorLogger.Printf("could not create job scheduler: %v", err)
+		gc.shutdown(1)
+		return // this will never be called but it makes the IDE happy
+	}
+	gc.scheduler = s
+	restored, err := s.restore()
+	if err != nil {
+		ErrorLogger.Printf("could not restore pending jobs: %v", err)
+		gc.shutdown(1)
+	}
+	InfoLogger.Printf("restored %v pending jobs", restored)
+
+	// schedule a job for every new order
+	if err := newListener(s, natsClient).listen(); err != nil {
+		ErrorLogger.Printf("could not subscribe to events: %v", err)
+		gc.shutdown(1)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	// SIGINT signal received, begin graceful shutdown
+	case <-c:
+		InfoLogger.Print("beginning graceful shutdown")
+		gc.shutdown(0)
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+// scheduler keeps a timer for every pending job
+// when a timer fires the job is claimed, and an expiration:complete event is published for the job's order
+// every replica keeps timers for the jobs it restored, the claim makes sure only one of them publishes the event
+type scheduler struct {
+	jc      jobsCRUD
+	eBus    stan.Conn
+	owner   string
+	retry   time.Duration
+	lease   time.Duration
+	mu      sync.Mutex
+	timers  map[string]*time.Timer
+	stopped bool
+}
+
+// owner identifies the scheduler's claims on jobs and must be unique among replicas
+// a claimed job is left to its owner for lease, after which another replica may take it over
+func newScheduler(jc jobsCRUD, eBus stan.Conn, owner string, retry, lease time.Duration) (*scheduler, error) {
+	if err := setSubjects(); err != nil {
+		return nil, fmt.Errorf("unable to set NATS subjects: %v", err)
+	}
+
+	return &scheduler{
+		jc:     jc,
+		eBus:   eBus,
+		owner:  owner,
+		retry:  retry,
+		lease:  lease,
+		timers: make(map[string]*time.Timer),
+	}, nil
+}
+
+// add persists the job before scheduling it so it is not lost if the service restarts
+func (s *scheduler) add(job Job) error {
+	if err := s.jc.create(job); err != nil {
+		return fmt.Errorf("unable to save job: %v", err)
+	}
+	s.schedule(job.OrderId, time.Until(job.ExpiresAt))
+	return nil
+}
+
+// restore schedules every job that was persisted but not completed before the last shutdown
+// jobs that expired while the service was down fire immediately
+func (s *scheduler) restore() (int, error) {
+	jobs, err := s.jc.readAll()
+	if err != nil {
+		return 0, fmt.Errorf("unable to read pending jobs: %v", err)
+	}
+	for _, job := range jobs {
+		s.schedule(job.OrderId, time.Until(job.ExpiresAt))
+	}
+	return len(jobs), nil
+}
+
+// schedule does nothing once the scheduler is stopped
+func (s *scheduler) schedule(orderId string, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+	if timer, ok := s.timers[orderId]; ok {
+		timer.Stop()
+	}
+	s.timers[orderId] = time.AfterFunc(delay, func() {
+		s.expire(orderId)
+	})
+}
+
+func (s *scheduler) expire(orderId string) {
+	claimed, err := s.jc.claim(orderId, s.owner, s.lease)
+	if err != nil {
+		ErrorLogger.Printf("unable to claim job for order: %v, retrying in %v, err: %v", orderId, s.retry, err)
+		s.schedule(orderId, s.retry)
+		return
+	}
+	if !claimed {
+		s.awaitOwner(orderId)
+		return
+	}
+
+	if err := s.complete(orderId); err != nil {
+		ErrorLogger.Printf("unable to complete job for order: %v, retrying in %v, err: %v", orderId, s.retry, err)
+		s.schedule(orderId, s.retry)
+		return
+	}
+	s.forget(orderId)
+}
+
+// awaitOwner checks on a job another replica claimed once its lease runs out
+// and takes the job over if the replica did not complete it
+func (s *scheduler) awaitOwner(orderId string) {
+	job, err := s.jc.read(orderId)
+	if err != nil {
+		ErrorLogger.Printf("unable to read job for order: %v, retrying in %v, err: %v", orderId, s.retry, err)
+		s.schedule(orderId, s.retry)
+		return
+	}
+	if job == nil {
+		s.forget(orderId)
+		return
+	}
+	s.schedule(orderId, time.Until(job.LeaseUntil))
+}
+
+func (s *scheduler) forget(orderId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.timers, orderId)
+}
+
+func (s *scheduler) complete(orderId string) error {
+	eventBytes, err := marshalExpirationComplete(orderId)
+	if err != nil {
+		return fmt.Errorf("unable to marshal expiration complete event: %v", err)
+	}
+	if err := s.eBus.Publish(expirationCompleteSubject, eventBytes); err != nil {
+		return fmt.Errorf("unable to publish expiration complete event: %v", err)
+	}
+	InfoLogger.Printf("published expiration complete for order: %v", orderId)
+
+	// the event is already out, a leftover job only results in a duplicate event after a restart
+	// which the orders service ignores, so do not retry the whole job if the delete fails
+	if err := s.jc.delete(orderId); err != nil {
+		ErrorLogger.Printf("unable to delete completed job for order: %v, err: %v", orderId, err)
+	}
+	return nil
+}
+
+func (s *scheduler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+	for orderId, timer := range s.timers {
+		timer.Stop()
+		delete(s.timers, orderId)
+	}
+}
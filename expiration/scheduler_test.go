@@ -0,0 +1,157 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestScheduler(t *testing.T) (*scheduler, *fakeJobsCollection, *fakeNatsConn) {
+	fakeJC := newFakeJobsCollection()
+	fakeStan := newFakeNatsConn()
+	s, err := newScheduler(fakeJC, fakeStan, "test", 10*time.Millisecond, time.Minute)
+	if err != nil {
+		t.Fatalf("newScheduler: %v", err)
+	}
+	t.Cleanup(s.stop)
+	return s, fakeJC, fakeStan
+}
+
+// waitForCompleted polls until the expected number of expiration:complete events are published
+func waitForCompleted(t *testing.T, fakeStan *fakeNatsConn, want int) []string {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if msgs := fakeStan.published(expirationCompleteSubject); len(msgs) >= want {
+			var orderIds []string
+			for _, msg := range msgs {
+				var event events.ExpirationComplete
+				if err := proto.Unmarshal(msg, &event); err != nil {
+					t.Fatalf("proto.Unmarshal: %v", err)
+				}
+				orderIds = append(orderIds, event.OrderId)
+			}
+			return orderIds
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %v expiration complete events", want)
+	return nil
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	s, fakeJC, fakeStan := newTestScheduler(t)
+
+	if err := s.add(Job{OrderId: "expired", ExpiresAt: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := s.add(Job{OrderId: "pending", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	orderIds := waitForCompleted(t, fakeStan, 1)
+	if got, want := orderIds[0], "expired"; got != want {
+		t.Fatalf("wrong order expired: %v, want %v", got, want)
+	}
+	if fakeJC.has("expired") {
+		t.Fatal("completed job was not deleted")
+	}
+	if !fakeJC.has("pending") {
+		t.Fatal("pending job was not persisted")
+	}
+}
+
+func TestSchedulerRestore(t *testing.T) {
+	s, fakeJC, fakeStan := newTestScheduler(t)
+	_ = fakeJC.create(Job{OrderId: "expired while down", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	restored, err := s.restore()
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if got, want := restored, 1; got != want {
+		t.Fatalf("restored %v jobs, want %v", got, want)
+	}
+
+	orderIds := waitForCompleted(t, fakeStan, 1)
+	if got, want := orderIds[0], "expired while down"; got != want {
+		t.Fatalf("wrong order expired: %v, want %v", got, want)
+	}
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	s, fakeJC, fakeStan := newTestScheduler(t)
+	fakeStan.failures = 2
+
+	if err := s.add(Job{OrderId: "retry me", ExpiresAt: time.Now()}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	orderIds := waitForCompleted(t, fakeStan, 1)
+	if got, want := orderIds[0], "retry me"; got != want {
+		t.Fatalf("wrong order expired: %v, want %v", got, want)
+	}
+	if fakeJC.has("retry me") {
+		t.Fatal("completed job was not deleted")
+	}
+}
+
+func TestSchedulerReplicas(t *testing.T) {
+	fakeJC := newFakeJobsCollection()
+	fakeStan := newFakeNatsConn()
+	_ = fakeJC.create(Job{OrderId: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	for _, owner := range []string{"replica-1", "replica-2"} {
+		s, err := newScheduler(fakeJC, fakeStan, owner, 10*time.Millisecond, time.Minute)
+		if err != nil {
+			t.Fatalf("newScheduler: %v", err)
+		}
+		t.Cleanup(s.stop)
+		if _, err := s.restore(); err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+	}
+
+	waitForCompleted(t, fakeStan, 1)
+	time.Sleep(50 * time.Millisecond)
+	if got, want := len(fakeStan.published(expirationCompleteSubject)), 1; got != want {
+		t.Fatalf("published %v expiration complete events, want %v", got, want)
+	}
+}
+
+func TestSchedulerTakeOver(t *testing.T) {
+	s, fakeJC, fakeStan := newTestScheduler(t)
+	_ = fakeJC.create(Job{OrderId: "abandoned", ExpiresAt: time.Now().Add(-time.Minute)})
+	if _, err := fakeJC.claim("abandoned", "dead replica", 20*time.Millisecond); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+
+	if _, err := s.restore(); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	orderIds := waitForCompleted(t, fakeStan, 1)
+	if got, want := orderIds[0], "abandoned"; got != want {
+		t.Fatalf("wrong order expired: %v, want %v", got, want)
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	s, fakeJC, fakeStan := newTestScheduler(t)
+	fakeStan.failures = 1
+
+	if err := s.add(Job{OrderId: "stopped", ExpiresAt: time.Now()}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	s.stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if got := len(fakeStan.published(expirationCompleteSubject)); got != 0 {
+		t.Fatalf("published %v expiration complete events after stop", got)
+	}
+	if !fakeJC.has("stopped") {
+		t.Fatal("job was deleted after stop")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/stan.go"
+)
+
+// jobs publish from timer goroutines so the fake must be safe for concurrent use
+type fakeNatsConn struct {
+	mu       sync.Mutex
+	messages map[string][][]byte
+	// number of publishes that should fail before publishing succeeds
+	failures int
+}
+
+func newFakeNatsConn() *fakeNatsConn {
+	return &fakeNatsConn{
+		messages: make(map[string][][]byte),
+	}
+}
+
+func (f *fakeNatsConn) Publish(subj string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("unable to publish")
+	}
+	f.messages[subj] = append(f.messages[subj], data)
+	return nil
+}
+
+func (f *fakeNatsConn) published(subj string) [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.messages[subj]
+}
+
+func (f *fakeNatsConn) PublishAsync(subj string, data []byte, ah stan.AckHandler) (string, error) {
+	_, _, _ = subj, data, ah
+	return "", errors.New("not implemented")
+}
+
+func (f *fakeNatsConn) Subscribe(subj string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	_, _, _ = subj, cb, opts
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeNatsConn) QueueSubscribe(subj, qgroup string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	_, _, _, _ = subj, qgroup, cb, opts
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeNatsConn) Close() error {
+	return nil
+}
+
+func (f *fakeNatsConn) NatsConn() *nats.Conn {
+	return nil
+}
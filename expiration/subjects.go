@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+)
+
+var (
+	orderCreatedSubject       string
+	expirationCompleteSubject string
+)
+
+func setOrderCreated(subj *string) error {
+	ocs, err := subjects.StringifySubject(subjects.Subject_ORDER_CREATED)
+	if err != nil {
+		return err
+	}
+	*subj = ocs
+	return nil
+}
+
+func setExpirationComplete(subj *string) error {
+	ecs, err := subjects.StringifySubject(subjects.Subject_EXPIRATION_COMPLETE)
+	if err != nil {
+		return err
+	}
+	*subj = ecs
+	return nil
+}
+
+func setSubjects() error {
+	if err := setOrderCreated(&orderCreatedSubject); err != nil {
+		return err
+	}
+	if err := setExpirationComplete(&expirationCompleteSubject); err != nil {
+		return err
+	}
+	return nil
+}
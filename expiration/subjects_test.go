@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestSetOrderCreated(t *testing.T) {
+	var createdSubj string
+	if err := setOrderCreated(&createdSubj); err != nil {
+		t.Fatalf("setOrderCreated: %v", err)
+	}
+	if got, want := createdSubj, "order:created"; got != want {
+		t.Fatalf("wrong subject: %v, want %v", got, want)
+	}
+}
+
+func TestSetExpirationComplete(t *testing.T) {
+	var completeSubj string
+	if err := setExpirationComplete(&completeSubj); err != nil {
+		t.Fatalf("setExpirationComplete: %v", err)
+	}
+	if got, want := completeSubj, "expiration:complete"; got != want {
+		t.Fatalf("wrong subject: %v, want %v", got, want)
+	}
+}
@@ -4,38 +4,156 @@ package middleware
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+// JWTValidator verifies tokens, and signs them if it holds a private key or shared secret
+// signing validators hold a keyset indexed by kid: tokens are signed with the current key and
+// verified with whichever key signed them, until that key retires
+// verifying validators only hold public keys so they can verify but never sign
 type JWTValidator struct {
-	key    []byte
-	signer jwt.SigningMethod
+	keys keySource
+	// nil for validators that can only verify
+	signing *signingKeys
 }
 
+// NewJWTValidator signs and verifies tokens with a shared HS256 key
 func NewJWTValidator(key []byte, method string) (*JWTValidator, error) {
 	switch method {
 	case "HS256":
-		return &JWTValidator{key, jwt.SigningMethodHS256}, nil
+		set, err := newSigningKeySet(signingKey{method: jwt.SigningMethodHS256, key: key}, key)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningValidator(&signingKeys{set: set, now: time.Now}), nil
 	default:
 		return nil, fmt.Errorf("unsupported signing method: %v", method)
 	}
 }
 
-func (v *JWTValidator) Parse(tokenString string) (*jwt.Token, error) {
-	// keyFunc: check JWT headers to make it specifies the correct signature alg
-	checkHeaders := func(token *jwt.Token) (interface{}, error) {
-		untrustedAlg, ok := token.Header["alg"]
-		if !ok {
-			return nil, errors.New("no alg specified")
-		}
-		if untrustedAlg != v.signer.Alg() {
-			return nil, fmt.Errorf("unexpected alg detected: %s", untrustedAlg)
-		}
-		return v.key, nil
+// NewPrivateKeyValidator signs tokens with a PEM encoded private key
+// method is one of RS256, ES256 or EdDSA, the kid is the thumbprint of the public key
+func NewPrivateKeyValidator(privateKeyPEM []byte, method string) (*JWTValidator, error) {
+	signingMethod, err := asymmetricMethod(method)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, publicKey, err := parsePrivateKeyPEM(privateKeyPEM, signingMethod)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %v", err)
+	}
+	jwk, err := NewJWK("", method, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := jwk.thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	set, err := newSigningKeySet(signingKey{kid, signingMethod, privateKey}, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return newSigningValidator(&signingKeys{set: set, now: time.Now}), nil
+}
+
+// NewKeySetValidator signs and verifies tokens with the keys in a keyset, see KeySetFile
+func NewKeySetValidator(data []byte) (*JWTValidator, error) {
+	set, err := parseKeySet(data, time.Now())
+	if err != nil {
+		return nil, err
 	}
+	return newSigningValidator(&signingKeys{set: set, now: time.Now}), nil
+}
 
-	token, err := jwt.Parse(tokenString, checkHeaders)
+// NewKeySetFileValidator loads the keyset in path and reloads it when the file changes
+// the file is checked at most once per reload, when a token is signed or verified
+func NewKeySetFileValidator(path string, reload time.Duration) (*JWTValidator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read keyset: %v", err)
+	}
+	set, err := parseKeySet(data, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	keys := &signingKeys{path: path, reload: reload, now: time.Now, set: set, data: data}
+	keys.checked = keys.now()
+	return newSigningValidator(keys), nil
+}
+
+func newSigningValidator(keys *signingKeys) *JWTValidator {
+	return &JWTValidator{keys: keys, signing: keys}
+}
+
+// NewPublicKeyValidator verifies tokens with a PEM encoded public key
+// method is one of RS256, ES256 or EdDSA
+func NewPublicKeyValidator(publicKeyPEM []byte, method string) (*JWTValidator, error) {
+	signingMethod, err := asymmetricMethod(method)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePublicKeyPEM(publicKeyPEM, signingMethod)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse public key: %v", err)
+	}
+	return &JWTValidator{keys: staticKey{verificationKey{method: signingMethod, key: key}}}, nil
+}
+
+// NewPublicKeyFileValidator verifies tokens with the PEM encoded public key in path
+func NewPublicKeyFileValidator(path, method string) (*JWTValidator, error) {
+	publicKeyPEM, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read public key: %v", err)
+	}
+	return NewPublicKeyValidator(publicKeyPEM, method)
+}
+
+// NewJWKSFileValidator verifies tokens with the keys in a JWKS file
+// HS256 secrets may be listed as oct keys, keys stop verifying tokens once their retireAt passes
+// the file is checked for changes at most once per reload, so keys can be rotated without a restart
+func NewJWKSFileValidator(path string, reload time.Duration) (*JWTValidator, error) {
+	keys, err := newFileKeys(path, reload)
+	if err != nil {
+		return nil, err
+	}
+	return &JWTValidator{keys: keys}, nil
+}
+
+// NewJWKSValidator verifies tokens with the public keys published at url
+// keys are fetched on first use and cached for refresh
+func NewJWKSValidator(url string, refresh time.Duration) *JWTValidator {
+	return &JWTValidator{keys: newJWKSKeys(url, refresh)}
+}
+
+// keyFunc picks the key named by the kid header and makes sure the JWT headers specify that key's alg
+func (v *JWTValidator) keyFunc(token *jwt.Token) (interface{}, error) {
+	untrustedAlg, ok := token.Header["alg"]
+	if !ok {
+		return nil, errors.New("no alg specified")
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	vk, err := v.keys.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if vk.retired(time.Now()) {
+		return nil, fmt.Errorf("key %q is retired", kid)
+	}
+	if untrustedAlg != vk.method.Alg() {
+		return nil, fmt.Errorf("unexpected alg detected: %s", untrustedAlg)
+	}
+	return vk.key, nil
+}
+
+// ParseWithClaims verifies the token and decodes its claims into claims
+// claims.Valid decides whether the token has expired
+func (v *JWTValidator) ParseWithClaims(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	token, err := jwt.ParseWithClaims(tokenString, claims, v.keyFunc)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse token: %v", err)
 	}
@@ -45,45 +163,44 @@ func (v *JWTValidator) Parse(tokenString string) (*jwt.Token, error) {
 	return token, nil
 }
 
-type UserClaims struct {
-	Email string
-	Id    string
-}
-
-func NewUserClaims(email, id string) *UserClaims {
-	return &UserClaims{email, id}
+// ParseClaims verifies a session token and returns its claims
+func (v *JWTValidator) ParseClaims(tokenString string) (*Claims, error) {
+	claims := new(Claims)
+	if _, err := v.ParseWithClaims(tokenString, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
 
-func (u *UserClaims) Tokenize(v *JWTValidator) (string, error) {
-	claims := jwt.MapClaims{"email": u.Email, "id": u.Id}
-	token := jwt.NewWithClaims(v.signer, claims)
-	signedTokenString, err := token.SignedString(v.key)
+// Sign signs the claims with the current key, the kid header tells verifiers which key that is
+func (v *JWTValidator) Sign(claims jwt.Claims) (string, error) {
+	if v.signing == nil {
+		return "", errors.New("validator can only verify tokens")
+	}
+	current := v.signing.keySet().current
+	token := jwt.NewWithClaims(current.method, claims)
+	if current.kid != "" {
+		token.Header["kid"] = current.kid
+	}
+	signedTokenString, err := token.SignedString(current.key)
 	if err != nil {
 		return "", fmt.Errorf("could not sign token: %v", err)
 	}
 	return signedTokenString, nil
 }
 
-// WARNING: this may overwrite any already set fields in the UserClaims struct
-func (u *UserClaims) NewFromToken(v *JWTValidator, token string) error {
-	jwtToken, err := v.Parse(token)
-	if err != nil {
-		return err
+// JWKS returns the public keys that verify tokens signed by v
+// retired keys are left out, HS256 keys are secret so they are never published
+func (v *JWTValidator) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	if v.signing == nil {
+		return set
 	}
-
-	claims := jwtToken.Claims
-	if email, ok := claims.(jwt.MapClaims)["email"]; ok {
-		switch t := email.(type) {
-		case string:
-			u.Email = t
+	now := time.Now()
+	for _, jwk := range v.signing.keySet().published {
+		if jwk.RetireAt == nil || now.Before(*jwk.RetireAt) {
+			set.Keys = append(set.Keys, jwk)
 		}
 	}
-	if id, ok := claims.(jwt.MapClaims)["id"]; ok {
-		switch t := id.(type) {
-		case string:
-			u.Id = t
-		}
-	}
-
-	return nil
+	return set
 }
@@ -2,8 +2,12 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -14,10 +18,11 @@ func TestNewJWTValidator(t *testing.T) {
 		t.Errorf("unexpected error creating new JWT validator: %v", err)
 	}
 
-	if got, want := v.key, []byte("password"); !bytes.Equal(got, want) {
-		t.Errorf("new JWT validator does not have expected key: %v, want %v", string(got), string(want))
+	current := v.signing.keySet().current
+	if got, want := current.key, []byte("password"); !bytes.Equal(got.([]byte), want) {
+		t.Errorf("new JWT validator does not have expected key: %v, want %v", got, string(want))
 	}
-	if got, want := v.signer.Alg(), "HS256"; got != want {
+	if got, want := current.method.Alg(), "HS256"; got != want {
 		t.Errorf("new JWT validator does not have expected signing alg: %v, want %v", got, want)
 	}
 
@@ -33,10 +38,13 @@ func TestNewJWTValidator(t *testing.T) {
 
 func TestSign(t *testing.T) {
 	v, _ := NewJWTValidator([]byte("password"), "HS256")
-	claims := UserClaims{"foo@bar.com", "0"}
+	claims, err := NewClaims("foo@bar.com", "0", DefaultTokenTTL)
+	if err != nil {
+		t.Fatalf("unexpected error creating claims: %v", err)
+	}
 	token, err := claims.Tokenize(v)
 	if err != nil {
-		t.Errorf("unexpected error while creating UserClaims JWT: %v", err)
+		t.Errorf("unexpected error while creating Claims JWT: %v", err)
 	}
 
 	parts := strings.Split(token, ".")
@@ -44,51 +52,77 @@ func TestSign(t *testing.T) {
 	if got, want := parts[0], "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9"; got != want {
 		t.Errorf("unexpected JWT header: %v, want %v", got, want)
 	}
-	// email: foo@bar.com, id: 0
-	if got, want := parts[1], "eyJlbWFpbCI6ImZvb0BiYXIuY29tIiwiaWQiOiIwIn0"; got != want {
-		t.Errorf("unexpected JWT payload: %v, want %v", got, want)
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("unable to decode JWT payload: %v", err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		t.Fatalf("unable to unmarshal JWT payload: %v", err)
+	}
+	if got, want := body["email"], "foo@bar.com"; got != want {
+		t.Errorf("unexpected JWT email: %v, want %v", got, want)
+	}
+	if got, want := body["id"], "0"; got != want {
+		t.Errorf("unexpected JWT id: %v, want %v", got, want)
+	}
+	if jti, _ := body["jti"].(string); len(jti) != 32 {
+		t.Errorf("unexpected JWT token id: %q, want 32 hex characters", jti)
+	}
+	iat, _ := body["iat"].(float64)
+	exp, _ := body["exp"].(float64)
+	if got, want := exp-iat, DefaultTokenTTL.Seconds(); got != want {
+		t.Errorf("unexpected JWT lifetime: %vs, want %vs", got, want)
 	}
 }
 
-func TestParse(t *testing.T) {
+func TestParseClaims(t *testing.T) {
 	v, _ := NewJWTValidator([]byte("password"), "HS256")
-	claims := UserClaims{"foo@bar.com", "0"}
+	claims, _ := NewClaims("foo@bar.com", "0", DefaultTokenTTL, RoleBuyer, RoleSeller)
 	tokenStr, _ := claims.Tokenize(v)
 
-	// alg: HS256, typ: JWT, no body
-	token, err := v.Parse(tokenStr)
+	parsed, err := v.ParseClaims(tokenStr)
 	if err != nil {
-		t.Errorf("unexpected error while parsing token string: %v", err)
-	}
-
-	if err = token.Claims.Valid(); err != nil {
-		t.Errorf("parsed token claims invalid: %v", err)
+		t.Fatalf("unexpected error while parsing token string: %v", err)
 	}
-	if got, want := token.Claims.(jwt.MapClaims)["email"], "foo@bar.com"; got != want {
-		t.Errorf("JWT does not contain correct email: %v, want %v", got, want)
+	if !reflect.DeepEqual(parsed, claims) {
+		t.Errorf("parsed claims mismatch: %+v, want %+v", *parsed, *claims)
 	}
-	if got, want := token.Claims.(jwt.MapClaims)["id"], "0"; got != want {
-		t.Errorf("JWT does not contain correct id: %v, want %v", got, want)
+
+	// gen with jwt.io, alg: none
+	noneToken := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJlbWFpbCI6ImZvb0BiYXIuY29tIiwiaWQiOiIwIn0."
+	if _, err := v.ParseClaims(noneToken); err == nil {
+		t.Error("expected error while parsing an unsigned token")
 	}
 }
 
-func TestNewFromToken(t *testing.T) {
+func TestParseExpiry(t *testing.T) {
 	v, _ := NewJWTValidator([]byte("password"), "HS256")
-	// gen with jwt.io
-	tokenParts := []string{
-		"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9",
-		"eyJlbWFpbCI6ImZvb0BiYXIuY29tIiwiaWQiOiIwIn0",
-		"itigCGh9yImD1NEW-hv5MS__uMdhLcz4qcdrvA4c3A4",
-	}
+	now := time.Now()
 
-	var claims UserClaims
-	if err := claims.NewFromToken(v, strings.Join(tokenParts, ".")); err != nil {
-		t.Errorf("unexpected error while parsing token: %v", err)
-	}
-	if got, want := claims.Email, "foo@bar.com"; got != want {
-		t.Errorf("incorrect parsed Email: %v, want %v", got, want)
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"no expiry", jwt.MapClaims{"email": "foo@bar.com"}},
+		{"expired", jwt.MapClaims{"email": "foo@bar.com", "exp": now.Add(-time.Minute).Unix()}},
+		{"not yet valid", jwt.MapClaims{
+			"email": "foo@bar.com",
+			"nbf":   now.Add(time.Minute).Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}},
+		{"no user", jwt.MapClaims{"exp": now.Add(time.Hour).Unix()}},
 	}
-	if got, want := claims.Id, "0"; got != want {
-		t.Errorf("incorrect parsed Id: %v, want %v", got, want)
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			tokenStr, err := v.Sign(tt.claims)
+			if err != nil {
+				currTest.Fatalf("unable to sign token: %v", err)
+			}
+			if _, err := v.ParseClaims(tokenStr); err == nil {
+				currTest.Error("expected error parsing token")
+			}
+		})
 	}
 }
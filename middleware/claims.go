@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultTokenTTL is how long session tokens are valid for
+// clients use their refresh token to get a new session token once it expires
+const DefaultTokenTTL = 15 * time.Minute
+
+// claimsKey is where UserValidator stores the parsed claims in the gin.Context
+const claimsKey = "middleware.claims"
+
+// Claims are the claims of a session token
+// times are unix seconds, as in the JWT registered claims
+type Claims struct {
+	Email     string `json:"email"`
+	ID        string `json:"id"`
+	TokenID   string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	// Roles are the roles the user held when the token was issued, see RoleAdmin
+	Roles []string `json:"roles,omitempty"`
+	// EmailVerified is set once the user verifies their email, see RequireVerified
+	// tokens without the claim are treated as unverified
+	EmailVerified bool `json:"email_verified,omitempty"`
+}
+
+// NewClaims creates the claims of a session token issued now that expires after ttl
+// each token gets a random ID so it can be revoked
+func NewClaims(email, id string, ttl time.Duration, roles ...string) (*Claims, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, fmt.Errorf("could not create token id: %v", err)
+	}
+	now := time.Now()
+	return &Claims{
+		Email:     email,
+		ID:        id,
+		TokenID:   hex.EncodeToString(jti),
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+		Roles:     roles,
+	}, nil
+}
+
+// Valid is called by the jwt parser once the signature is verified
+// session tokens must name a user and must expire
+func (c Claims) Valid() error {
+	if c.Email == "" {
+		return errors.New("claims do not represent a user")
+	}
+	now := time.Now().Unix()
+	if c.ExpiresAt == 0 {
+		return errors.New("claims do not expire")
+	}
+	if now >= c.ExpiresAt {
+		return errors.New("claims are expired")
+	}
+	if now < c.NotBefore {
+		return errors.New("claims are not valid yet")
+	}
+	return nil
+}
+
+// HasRole reports whether the user holds role
+func (c Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Tokenize signs the claims into a JWT
+func (c *Claims) Tokenize(v *JWTValidator) (string, error) {
+	return v.Sign(c)
+}
+
+// ClaimsFromContext returns the claims UserValidator parsed for this request
+func ClaimsFromContext(c *gin.Context) (*Claims, bool) {
+	value, ok := c.Get(claimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*Claims)
+	return claims, ok
+}
+
+// SetClaims stores claims for ClaimsFromContext and RequireRole
+// it lets services that read the session token some other way, such as from a cookie, reuse them
+func SetClaims(c *gin.Context, claims *Claims) {
+	c.Set(claimsKey, claims)
+}
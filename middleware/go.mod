@@ -3,6 +3,13 @@ module github.com/basilnsage/mwn-ticketapp/middleware
 go 1.15
 
 require (
+	github.com/basilnsage/mwn-ticketapp-common v0.0.0-00010101000000-000000000000
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gin-gonic/gin v1.6.3
+	github.com/golang/protobuf v1.4.3
+	github.com/nats-io/nats.go v1.10.0
+	github.com/nats-io/stan.go v0.8.1
+	google.golang.org/protobuf v1.25.0
 )
+
+replace github.com/basilnsage/mwn-ticketapp-common => ../common
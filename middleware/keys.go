@@ -0,0 +1,444 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// DefaultJWKSRefresh is how long a fetched JWKS is used before it is fetched again
+	DefaultJWKSRefresh = 5 * time.Minute
+	// DefaultKeySetReload is how often a keyset file is checked for changes
+	DefaultKeySetReload = 30 * time.Second
+	// unknown key ids trigger a refetch, but no more often than this
+	jwksMinRefetch = 30 * time.Second
+	jwksTimeout    = 5 * time.Second
+)
+
+// asymmetricMethod returns the signing method for one of the supported public key algs
+func asymmetricMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case "RS256":
+		return jwt.SigningMethodRS256, nil
+	case "ES256":
+		return jwt.SigningMethodES256, nil
+	case "EdDSA":
+		return SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing method: %v", alg)
+	}
+}
+
+// verificationKey is a public key and the only alg it may be used with
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+	// zero if the key never retires
+	retireAt time.Time
+}
+
+// retired keys no longer verify tokens, even ones that have not expired yet
+func (vk verificationKey) retired(now time.Time) bool {
+	return !vk.retireAt.IsZero() && !now.Before(vk.retireAt)
+}
+
+type keySource interface {
+	key(kid string) (verificationKey, error)
+}
+
+// keyMap indexes a keyset by kid
+type keyMap map[string]verificationKey
+
+// lookup returns the key for kid
+// a token without a kid is only accepted when the keyset has a single key
+func (m keyMap) lookup(kid string) (verificationKey, bool) {
+	if kid == "" && len(m) == 1 {
+		for _, vk := range m {
+			return vk, true
+		}
+	}
+	vk, ok := m[kid]
+	return vk, ok
+}
+
+// staticKey is a single public key, used for every token regardless of kid
+type staticKey struct {
+	vk verificationKey
+}
+
+func (s staticKey) key(string) (verificationKey, error) {
+	return s.vk, nil
+}
+
+// parsePublicKeyPEM parses a PEM encoded PKIX public key for alg
+func parsePublicKeyPEM(data []byte, method jwt.SigningMethod) (interface{}, error) {
+	switch method {
+	case jwt.SigningMethodRS256:
+		return jwt.ParseRSAPublicKeyFromPEM(data)
+	case jwt.SigningMethodES256:
+		return jwt.ParseECPublicKeyFromPEM(data)
+	case SigningMethodEdDSA:
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("key must be PEM encoded")
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("key is not an Ed25519 public key")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing method: %v", method.Alg())
+	}
+}
+
+// JWK is a JSON Web Key (RFC 7517)
+// only the members needed for RSA, P-256 and Ed25519 signing keys are supported,
+// plus HS256 secrets (kty oct) in keyset files
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	K   string `json:"k,omitempty"`
+	// RetireAt is when verifiers must stop accepting the key, it is not part of RFC 7517
+	RetireAt *time.Time `json:"retireAt,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK describes a public key as a JWK
+func NewJWK(kid, alg string, publicKey interface{}) (JWK, error) {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", Kid: kid, Use: "sig", Alg: alg, N: enc(k.N.Bytes()), E: enc(big.NewInt(int64(k.E)).Bytes())}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return JWK{}, errors.New("only P-256 EC keys are supported")
+		}
+		x, y := make([]byte, 32), make([]byte, 32)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		return JWK{Kty: "EC", Kid: kid, Use: "sig", Alg: alg, Crv: "P-256", X: enc(x), Y: enc(y)}, nil
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Kid: kid, Use: "sig", Alg: alg, Crv: "Ed25519", X: enc(k)}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type: %T", publicKey)
+	}
+}
+
+// verificationKey converts the JWK into a public key
+// the alg always comes from the JWK so tokens cannot pick a different one
+// alg is optional in RFC 7517, without it the alg is inferred from the key type
+func (k JWK) verificationKey() (verificationKey, error) {
+	alg := k.Alg
+	if alg == "" {
+		alg = k.inferAlg()
+	}
+	method, err := asymmetricMethod(alg)
+	if err != nil {
+		return verificationKey{}, err
+	}
+	dec := base64.RawURLEncoding.DecodeString
+
+	var key interface{}
+	switch {
+	case k.Kty == "RSA" && method == jwt.SigningMethodRS256:
+		n, err := dec(k.N)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("invalid RSA modulus: %v", err)
+		}
+		e, err := dec(k.E)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("invalid RSA exponent: %v", err)
+		}
+		key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case k.Kty == "EC" && k.Crv == "P-256" && method == jwt.SigningMethodES256:
+		x, err := dec(k.X)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("invalid EC x coordinate: %v", err)
+		}
+		y, err := dec(k.Y)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("invalid EC y coordinate: %v", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return verificationKey{}, errors.New("EC point is not on the curve")
+		}
+		key = pub
+	case k.Kty == "OKP" && k.Crv == "Ed25519" && method == SigningMethodEdDSA:
+		x, err := dec(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return verificationKey{}, errors.New("invalid Ed25519 public key")
+		}
+		key = ed25519.PublicKey(x)
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key: kty %v, crv %v, alg %v", k.Kty, k.Crv, alg)
+	}
+	return verificationKey{method, key, k.retireTime()}, nil
+}
+
+// inferAlg is the only alg each supported key type can be used with
+func (k JWK) inferAlg() string {
+	switch {
+	case k.Kty == "RSA":
+		return "RS256"
+	case k.Kty == "EC" && k.Crv == "P-256":
+		return "ES256"
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		return "EdDSA"
+	default:
+		return ""
+	}
+}
+
+// secretKey converts an HS256 JWK into a verification key
+// secrets are only trusted from keyset files, never from a JWKS endpoint
+func (k JWK) secretKey() (verificationKey, error) {
+	if k.Kty != "oct" || k.Alg != "HS256" {
+		return verificationKey{}, fmt.Errorf("unsupported key: kty %v, alg %v", k.Kty, k.Alg)
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(k.K)
+	if err != nil || len(secret) == 0 {
+		return verificationKey{}, errors.New("invalid HS256 secret")
+	}
+	return verificationKey{jwt.SigningMethodHS256, secret, k.retireTime()}, nil
+}
+
+func (k JWK) retireTime() time.Time {
+	if k.RetireAt == nil {
+		return time.Time{}
+	}
+	return *k.RetireAt
+}
+
+// jwksKeys fetches public keys from a JWKS endpoint and caches them for refresh
+type jwksKeys struct {
+	url     string
+	client  *http.Client
+	refresh time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	keys      keyMap
+	fetched   time.Time
+	attempted time.Time
+	// fetching is closed when the running fetch is done, nil if there is none
+	fetching chan struct{}
+	fetchErr error
+}
+
+func newJWKSKeys(url string, refresh time.Duration) *jwksKeys {
+	return &jwksKeys{
+		url:     url,
+		client:  &http.Client{Timeout: jwksTimeout},
+		refresh: refresh,
+		now:     time.Now,
+	}
+}
+
+// key returns the key for kid, fetching the keyset if it is stale or does not contain kid
+func (j *jwksKeys) key(kid string) (verificationKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// refetch when the keys are stale or kid is new, the auth service may have started using another key
+	// attempts are rate limited so a bad kid or an unreachable auth service cannot trigger a fetch per request
+	now := j.now()
+	_, known := j.keys.lookup(kid)
+	if now.Sub(j.fetched) >= j.refresh || !known {
+		switch {
+		case j.fetching != nil && !known:
+			// another request is already fetching, wait for it rather than fetch again
+			j.wait()
+		case j.fetching == nil && now.Sub(j.attempted) >= jwksMinRefetch:
+			j.attempted = now
+			j.refetch(now)
+		}
+	}
+
+	vk, ok := j.keys.lookup(kid)
+	if !ok {
+		// if there are no keys at all the endpoint has never been reached
+		if j.keys == nil && j.fetchErr != nil {
+			return verificationKey{}, j.fetchErr
+		}
+		return verificationKey{}, fmt.Errorf("unknown key id: %q", kid)
+	}
+	return vk, nil
+}
+
+// refetch fetches the keyset without holding j.mu so requests with cached keys are not held up by the endpoint
+// j.mu must be held, it is held again when refetch returns
+func (j *jwksKeys) refetch(now time.Time) {
+	done := make(chan struct{})
+	j.fetching = done
+	j.mu.Unlock()
+
+	keys, err := j.fetch()
+
+	j.mu.Lock()
+	// if the fetch fails keep using the keys we already have
+	if err == nil {
+		j.keys = keys
+		j.fetched = now
+	}
+	j.fetchErr = err
+	j.fetching = nil
+	close(done)
+}
+
+// wait blocks until the running fetch is done
+// j.mu must be held, it is held again when wait returns
+func (j *jwksKeys) wait() {
+	done := j.fetching
+	j.mu.Unlock()
+	<-done
+	j.mu.Lock()
+}
+
+// fetch returns the keys currently published
+// keys that cannot be used are skipped
+func (j *jwksKeys) fetch() (keyMap, error) {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch JWKS: status %v", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read JWKS: %v", err)
+	}
+
+	var set JWKS
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, fmt.Errorf("could not parse JWKS: %v", err)
+	}
+	keys := make(keyMap)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		vk, err := k.verificationKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = vk
+	}
+	return keys, nil
+}
+
+// fileKeys loads a keyset from a JWKS file and reloads it when the file changes
+// mounted secrets are updated by swapping symlinks, so the file is polled rather than watched
+type fileKeys struct {
+	path   string
+	reload time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	keys    keyMap
+	data    []byte
+	checked time.Time
+}
+
+func newFileKeys(path string, reload time.Duration) (*fileKeys, error) {
+	f := &fileKeys{path: path, reload: reload, now: time.Now}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read keyset: %v", err)
+	}
+	if err := f.load(data); err != nil {
+		return nil, err
+	}
+	f.checked = f.now()
+	return f, nil
+}
+
+// key returns the key for kid, rereading the file at most once per reload
+// if the file cannot be read or parsed the keys that were loaded last are kept
+func (f *fileKeys) key(kid string) (verificationKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now := f.now(); now.Sub(f.checked) >= f.reload {
+		f.checked = now
+		data, err := ioutil.ReadFile(f.path)
+		if err == nil && !bytes.Equal(data, f.data) {
+			err = f.load(data)
+		}
+		if err != nil {
+			log.Printf("could not reload JWT keyset: %v", err)
+		}
+	}
+
+	vk, ok := f.keys.lookup(kid)
+	if !ok {
+		return verificationKey{}, fmt.Errorf("unknown key id: %q", kid)
+	}
+	return vk, nil
+}
+
+// load replaces the keys with the keyset in data
+// unlike a fetched JWKS every key must be usable, a typo in a mounted keyset should not go unnoticed
+func (f *fileKeys) load(data []byte) error {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("could not parse keyset: %v", err)
+	}
+	if len(set.Keys) == 0 {
+		return errors.New("keyset has no keys")
+	}
+	keys := make(keyMap)
+	for i, k := range set.Keys {
+		var vk verificationKey
+		var err error
+		if k.Kty == "oct" {
+			vk, err = k.secretKey()
+		} else {
+			vk, err = k.verificationKey()
+		}
+		if err != nil {
+			return fmt.Errorf("keyset key %d: %v", i, err)
+		}
+		if _, ok := keys[k.Kid]; ok {
+			return fmt.Errorf("keyset key %d: duplicate kid %q", i, k.Kid)
+		}
+		keys[k.Kid] = vk
+	}
+	f.keys, f.data = keys, data
+	return nil
+}
@@ -0,0 +1,385 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type testKey struct {
+	alg        string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+}
+
+func newTestKeys(t *testing.T) []testKey {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate EC key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate Ed25519 key: %v", err)
+	}
+	return []testKey{
+		{"RS256", jwt.SigningMethodRS256, rsaKey},
+		{"ES256", jwt.SigningMethodES256, ecKey},
+		{"EdDSA", SigningMethodEdDSA, edKey},
+	}
+}
+
+func signTestToken(t *testing.T, k testKey, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(k.method, jwt.MapClaims{
+		"email": "foo@bar.com",
+		"id":    "0",
+		"jti":   "1",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	tokenStr, err := token.SignedString(k.privateKey)
+	if err != nil {
+		t.Fatalf("unable to sign %v token: %v", k.alg, err)
+	}
+	return tokenStr
+}
+
+// jwksServer serves a JWKS for keys and counts the requests it receives
+func jwksServer(t *testing.T, keys []testKey) (*httptest.Server, *int) {
+	t.Helper()
+	var set JWKS
+	for _, k := range keys {
+		jwk, err := NewJWK(k.alg, k.alg, k.privateKey.Public())
+		if err != nil {
+			t.Fatalf("unable to create JWK: %v", err)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	for _, k := range newTestKeys(t) {
+		t.Run(k.alg, func(currTest *testing.T) {
+			jwk, err := NewJWK("kid", k.alg, k.privateKey.Public())
+			if err != nil {
+				currTest.Fatalf("unable to create JWK: %v", err)
+			}
+			vk, err := jwk.verificationKey()
+			if err != nil {
+				currTest.Fatalf("unable to convert JWK: %v", err)
+			}
+			if got, want := vk.method.Alg(), k.alg; got != want {
+				currTest.Errorf("wrong method: %v, want %v", got, want)
+			}
+			if !vk.key.(interface{ Equal(crypto.PublicKey) bool }).Equal(k.privateKey.Public()) {
+				currTest.Errorf("wrong public key: %v, want %v", vk.key, k.privateKey.Public())
+			}
+		})
+	}
+
+	// a JWK cannot be used with an alg other than its own
+	rsaKey := newTestKeys(t)[0]
+	jwk, _ := NewJWK("kid", "ES256", rsaKey.privateKey.Public())
+	if _, err := jwk.verificationKey(); err == nil {
+		t.Error("expected error converting an RSA JWK with alg ES256")
+	}
+}
+
+func TestJWKInferAlg(t *testing.T) {
+	// a JWK without an alg is used with the alg of its key type
+	for _, k := range newTestKeys(t) {
+		t.Run(k.alg, func(currTest *testing.T) {
+			jwk, err := NewJWK("kid", "", k.privateKey.Public())
+			if err != nil {
+				currTest.Fatalf("unable to create JWK: %v", err)
+			}
+			vk, err := jwk.verificationKey()
+			if err != nil {
+				currTest.Fatalf("unable to convert JWK: %v", err)
+			}
+			if got, want := vk.method.Alg(), k.alg; got != want {
+				currTest.Errorf("wrong method: %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := (JWK{Kty: "EC", Crv: "P-384"}).verificationKey(); err == nil {
+		t.Error("expected error converting a JWK without an alg of an unsupported key type")
+	}
+}
+
+func TestJWKSValidator(t *testing.T) {
+	keys := newTestKeys(t)
+	server, requests := jwksServer(t, keys)
+	v := NewJWKSValidator(server.URL, DefaultJWKSRefresh)
+
+	for _, k := range keys {
+		t.Run(k.alg, func(currTest *testing.T) {
+			claims, err := v.ParseClaims(signTestToken(currTest, k, k.alg))
+			if err != nil {
+				currTest.Fatalf("unexpected error parsing token: %v", err)
+			}
+			if got, want := claims.Email, "foo@bar.com"; got != want {
+				currTest.Errorf("wrong email: %v, want %v", got, want)
+			}
+		})
+	}
+	// the keyset is fetched once and cached
+	if got, want := *requests, 1; got != want {
+		t.Errorf("JWKS fetched %v times, want %v", got, want)
+	}
+
+	// tokens must name a known key and use that key's alg
+	if _, err := v.ParseClaims(signTestToken(t, keys[0], "unknown")); err == nil {
+		t.Error("expected error parsing a token with an unknown kid")
+	}
+	if _, err := v.ParseClaims(signTestToken(t, keys[0], keys[1].alg)); err == nil {
+		t.Error("expected error parsing a token signed with the wrong alg for its kid")
+	}
+	hsToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"email": "foo@bar.com", "exp": time.Now().Add(time.Minute).Unix()})
+	hsToken.Header["kid"] = keys[0].alg
+	hsTokenStr, _ := hsToken.SignedString([]byte("password"))
+	if _, err := v.ParseClaims(hsTokenStr); err == nil {
+		t.Error("expected error parsing an HS256 token")
+	}
+
+	// verifying validators cannot mint tokens
+	if _, err := v.Sign(Claims{Email: "foo@bar.com", ID: "0"}); err == nil {
+		t.Error("expected error tokenizing with a JWKS validator")
+	}
+}
+
+func TestJWKSRefetch(t *testing.T) {
+	keys := newTestKeys(t)
+	server, requests := jwksServer(t, keys[:1])
+	v := NewJWKSValidator(server.URL, DefaultJWKSRefresh)
+	source := v.keys.(*jwksKeys)
+	now := time.Now()
+	source.now = func() time.Time { return now }
+
+	if _, err := v.ParseClaims(signTestToken(t, keys[0], "")); err != nil {
+		t.Fatalf("unexpected error parsing a token without a kid from a single key set: %v", err)
+	}
+
+	// unknown kids only trigger a refetch once jwksMinRefetch has passed
+	for i := 0; i < 3; i++ {
+		_, _ = v.ParseClaims(signTestToken(t, keys[0], "new"))
+	}
+	if got, want := *requests, 1; got != want {
+		t.Errorf("JWKS fetched %v times, want %v", got, want)
+	}
+	now = now.Add(jwksMinRefetch)
+	_, _ = v.ParseClaims(signTestToken(t, keys[0], "new"))
+	if got, want := *requests, 2; got != want {
+		t.Errorf("JWKS fetched %v times, want %v", got, want)
+	}
+
+	// cached keys are used if the JWKS endpoint goes down
+	server.Close()
+	now = now.Add(DefaultJWKSRefresh)
+	if _, err := v.ParseClaims(signTestToken(t, keys[0], keys[0].alg)); err != nil {
+		t.Errorf("unexpected error parsing with cached keys: %v", err)
+	}
+}
+
+func TestJWKSFetchDoesNotBlock(t *testing.T) {
+	keys := newTestKeys(t)
+	var set JWKS
+	jwk, err := NewJWK(keys[0].alg, keys[0].alg, keys[0].privateKey.Public())
+	if err != nil {
+		t.Fatalf("unable to create JWK: %v", err)
+	}
+	set.Keys = append(set.Keys, jwk)
+
+	// every fetch after the first hangs until release is closed
+	started, release := make(chan struct{}), make(chan struct{})
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			started <- struct{}{}
+			<-release
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+
+	v := NewJWKSValidator(server.URL, DefaultJWKSRefresh)
+	source := v.keys.(*jwksKeys)
+	now := time.Now()
+	source.now = func() time.Time { return now }
+	if _, err := v.ParseClaims(signTestToken(t, keys[0], keys[0].alg)); err != nil {
+		t.Fatalf("unexpected error parsing token: %v", err)
+	}
+
+	// an unknown kid triggers a fetch, and a second request for it waits on that fetch
+	newKidToken, cachedToken := signTestToken(t, keys[0], "new"), signTestToken(t, keys[0], keys[0].alg)
+	now = now.Add(jwksMinRefetch)
+	fetched := make(chan error, 2)
+	go func() {
+		_, err := v.ParseClaims(newKidToken)
+		fetched <- err
+	}()
+	<-started
+	go func() {
+		_, err := v.ParseClaims(newKidToken)
+		fetched <- err
+	}()
+
+	// tokens signed with cached keys are verified while the fetch hangs
+	verified := make(chan error, 1)
+	go func() {
+		_, err := v.ParseClaims(cachedToken)
+		verified <- err
+	}()
+	select {
+	case err := <-verified:
+		if err != nil {
+			t.Errorf("unexpected error parsing with cached keys: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("verifying with cached keys waited on the JWKS fetch")
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-fetched; err == nil {
+			t.Error("expected error parsing a token with an unknown kid")
+		}
+	}
+	if got, want := atomic.LoadInt32(&requests), int32(2); got != want {
+		t.Errorf("JWKS fetched %v times, want %v", got, want)
+	}
+}
+
+func TestPublicKeyValidator(t *testing.T) {
+	for _, k := range newTestKeys(t) {
+		t.Run(k.alg, func(currTest *testing.T) {
+			der, err := x509.MarshalPKIXPublicKey(k.privateKey.Public())
+			if err != nil {
+				currTest.Fatalf("unable to marshal public key: %v", err)
+			}
+			publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+			v, err := NewPublicKeyValidator(publicKeyPEM, k.alg)
+			if err != nil {
+				currTest.Fatalf("unable to create validator: %v", err)
+			}
+			if _, err := v.ParseClaims(signTestToken(currTest, k, "")); err != nil {
+				currTest.Errorf("unexpected error parsing token: %v", err)
+			}
+		})
+	}
+
+	if _, err := NewPublicKeyValidator([]byte("not a key"), "RS256"); err == nil {
+		t.Error("expected error parsing an invalid public key")
+	}
+	if _, err := NewPublicKeyValidator(nil, "HS256"); err == nil {
+		t.Error("expected error creating a public key validator for HS256")
+	}
+}
+
+func TestJWKSFileValidator(t *testing.T) {
+	edKey := newTestKeys(t)[2]
+	hsToken := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"email": "foo@bar.com", "exp": time.Now().Add(time.Minute).Unix()})
+		token.Header["kid"] = kid
+		tokenStr, err := token.SignedString([]byte("password"))
+		if err != nil {
+			t.Fatalf("unable to sign HS256 token: %v", err)
+		}
+		return tokenStr
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeKeySet := func(retireAt time.Time) {
+		edJWK, err := NewJWK("new", edKey.alg, edKey.privateKey.Public())
+		if err != nil {
+			t.Fatalf("unable to create JWK: %v", err)
+		}
+		hsJWK := JWK{Kty: "oct", Kid: "old", Alg: "HS256", K: base64.RawURLEncoding.EncodeToString([]byte("password")), RetireAt: &retireAt}
+		data, err := json.Marshal(JWKS{Keys: []JWK{edJWK, hsJWK}})
+		if err != nil {
+			t.Fatalf("unable to marshal keyset: %v", err)
+		}
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("unable to write keyset: %v", err)
+		}
+	}
+	writeKeySet(time.Now().Add(time.Hour))
+
+	v, err := NewJWKSFileValidator(path, DefaultKeySetReload)
+	if err != nil {
+		t.Fatalf("unable to create validator: %v", err)
+	}
+	source := v.keys.(*fileKeys)
+	now := time.Now()
+	source.now = func() time.Time { return now }
+
+	// both the new key and the retiring old key verify tokens
+	if _, err := v.ParseClaims(signTestToken(t, edKey, "new")); err != nil {
+		t.Errorf("unexpected error parsing a token signed with the new key: %v", err)
+	}
+	if _, err := v.ParseClaims(hsToken("old")); err != nil {
+		t.Errorf("unexpected error parsing a token signed with the old key: %v", err)
+	}
+	if _, err := v.ParseClaims(signTestToken(t, edKey, "")); err == nil {
+		t.Error("expected error parsing a token without a kid from a multi key set")
+	}
+
+	// the file is reloaded once DefaultKeySetReload has passed, after which the old key is retired
+	writeKeySet(time.Now().Add(-time.Minute))
+	if _, err := v.ParseClaims(hsToken("old")); err != nil {
+		t.Errorf("unexpected error parsing before the keyset is reloaded: %v", err)
+	}
+	now = now.Add(DefaultKeySetReload)
+	if _, err := v.ParseClaims(hsToken("old")); err == nil {
+		t.Error("expected error parsing a token signed with a retired key")
+	}
+
+	// a broken file keeps the keys that were loaded last
+	if err := ioutil.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatalf("unable to write keyset: %v", err)
+	}
+	now = now.Add(DefaultKeySetReload)
+	if _, err := v.ParseClaims(signTestToken(t, edKey, "new")); err != nil {
+		t.Errorf("unexpected error parsing after a bad reload: %v", err)
+	}
+
+	// every key in a keyset file must be usable
+	if err := ioutil.WriteFile(path, []byte(`{"keys": [{"kty": "oct", "kid": "a", "alg": "RS256", "k": "cGFzc3dvcmQ"}]}`), 0600); err != nil {
+		t.Fatalf("unable to write keyset: %v", err)
+	}
+	if _, err := NewJWKSFileValidator(path, DefaultKeySetReload); err == nil {
+		t.Error("expected error loading a keyset with an unusable key")
+	}
+}
@@ -0,0 +1,59 @@
+// Package listen subscribes services to the events they consume
+package listen
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+// Handler handles the data of an event, the event is redelivered if it returns an error
+type Handler func([]byte) error
+
+// Subscriber subscribes the handlers of a service to their subjects
+type Subscriber struct {
+	// Group names both the queue group and the durable subscription, usually after the service
+	Group string
+	// AckWait is how long NATS waits for a handler to succeed before redelivering the event
+	AckWait time.Duration
+	Info    *log.Logger
+	Error   *log.Logger
+}
+
+// Listen subscribes each handler to its subject
+// subscriptions are durable and queue grouped so events are not lost across restarts
+// and each event is only handled by a single replica of the service
+func (s Subscriber) Listen(eBus stan.Conn, handlers map[string]Handler) error {
+	for subj, handler := range handlers {
+		_, err := eBus.QueueSubscribe(
+			subj,
+			s.Group,
+			s.ackOnSuccess(subj, handler),
+			stan.DurableName(s.Group),
+			stan.DeliverAllAvailable(),
+			stan.SetManualAckMode(),
+			stan.AckWait(s.AckWait),
+		)
+		if err != nil {
+			return fmt.Errorf("could not subscribe to %v: %v", subj, err)
+		}
+		s.Info.Printf("listening for events on: %v", subj)
+	}
+	return nil
+}
+
+// ackOnSuccess wraps an event handler so the message is only acked once the handler succeeds
+// if the handler fails the message is left un-acked and NATS will redeliver it after AckWait
+func (s Subscriber) ackOnSuccess(subj string, handler Handler) stan.MsgHandler {
+	return func(msg *stan.Msg) {
+		if err := handler(msg.Data); err != nil {
+			s.Error.Printf("could not handle %v event, seq: %v, err: %v", subj, msg.Sequence, err)
+			return
+		}
+		if err := msg.Ack(); err != nil {
+			s.Error.Printf("could not ack %v event, seq: %v, err: %v", subj, msg.Sequence, err)
+		}
+	}
+}
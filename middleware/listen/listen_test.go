@@ -0,0 +1,93 @@
+package listen
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/stan.go"
+	"github.com/nats-io/stan.go/pb"
+)
+
+// fakeConn records the queue subscriptions made on it
+type fakeConn struct {
+	stan.Conn
+	groups   map[string]string
+	handlers map[string]stan.MsgHandler
+	opts     map[string]stan.SubscriptionOptions
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		groups:   make(map[string]string),
+		handlers: make(map[string]stan.MsgHandler),
+		opts:     make(map[string]stan.SubscriptionOptions),
+	}
+}
+
+func (f *fakeConn) QueueSubscribe(subj, qgroup string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	if subj == "unavailable" {
+		return nil, errors.New("nats unavailable")
+	}
+	subOpts := stan.DefaultSubscriptionOptions
+	for _, opt := range opts {
+		if err := opt(&subOpts); err != nil {
+			return nil, err
+		}
+	}
+	f.groups[subj] = qgroup
+	f.handlers[subj] = cb
+	f.opts[subj] = subOpts
+	return nil, nil
+}
+
+func (f *fakeConn) NatsConn() *nats.Conn {
+	return nil
+}
+
+func TestListen(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.New(&logs, "", 0)
+	s := Subscriber{Group: "test-service", AckWait: time.Minute, Info: logger, Error: logger}
+	conn := newFakeConn()
+
+	var handled [][]byte
+	err := s.Listen(conn, map[string]Handler{
+		"test:event": func(data []byte) error {
+			handled = append(handled, data)
+			return errors.New("handler failed")
+		},
+	})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	// subscriptions survive restarts and are shared by the replicas of the service
+	if got, want := conn.groups["test:event"], "test-service"; got != want {
+		t.Errorf("wrong queue group: %v, want %v", got, want)
+	}
+	opts := conn.opts["test:event"]
+	if got, want := opts.DurableName, "test-service"; got != want {
+		t.Errorf("wrong durable name: %v, want %v", got, want)
+	}
+	if !opts.ManualAcks || opts.AckWait != time.Minute || opts.StartAt != pb.StartPosition_First {
+		t.Errorf("wrong subscription options: %+v", opts)
+	}
+
+	// failed events are not acked, so NATS redelivers them
+	conn.handlers["test:event"](&stan.Msg{MsgProto: pb.MsgProto{Sequence: 7, Data: []byte("event")}})
+	if got, want := len(handled), 1; got != want {
+		t.Fatalf("handler called %v times, want %v", got, want)
+	}
+	if !strings.Contains(logs.String(), "could not handle test:event event, seq: 7") {
+		t.Errorf("handler failure not logged: %v", logs.String())
+	}
+
+	if err := s.Listen(conn, map[string]Handler{"unavailable": nil}); err == nil {
+		t.Error("expected an error when subscribing fails")
+	}
+}
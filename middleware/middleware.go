@@ -1,27 +1,91 @@
 package middleware
 
 import (
-	"net/http"
+	"errors"
+	"time"
 
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
 	"github.com/gin-gonic/gin"
 )
 
-func UserValidator(v *JWTValidator, header string) func(c *gin.Context) {
+// codes of the problems the validators respond with
+const (
+	CodeNotSignedIn  = "not_signed_in"
+	CodeInvalidToken = "invalid_token"
+	CodeInvalidCSRF  = "invalid_csrf_token"
+	CodeMissingRole  = "missing_role"
+	CodeUnverified   = "email_unverified"
+)
+
+// UserValidator rejects requests without a valid JWT in header
+// it is UserValidatorFrom with the header as the only source
+func UserValidator(v *JWTValidator, header string, revoked *RevocationCache) func(c *gin.Context) {
+	return UserValidatorFrom(v, revoked, HeaderToken(header))
+}
+
+// UserValidatorFrom rejects requests without a valid JWT in the first of sources that has one
+// tokens must have an id (jti) so they can be revoked, and must not be in revoked, neither by id nor by user
+// tokens from a cookie must pass the CSRF check, see CheckCSRF
+// the parsed claims are stored in the gin.Context for handlers to read with ClaimsFromContext
+func UserValidatorFrom(v *JWTValidator, revoked *RevocationCache, sources ...TokenSource) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		jwtHeader := c.GetHeader(header)
-		if jwtHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"errors": []string{"User is not signed in"},
-			})
+		token, fromCookie := findToken(c.Request, sources)
+		if token == "" {
+			problem.Abort(c, problem.Unauthorized(CodeNotSignedIn, "User is not signed in"))
+			return
+		}
+		if fromCookie && !CheckCSRF(c.Request) {
+			problem.Abort(c, problem.Forbidden(CodeInvalidCSRF, "Invalid CSRF token").WithCause(errors.New("CSRF token is missing or does not match")))
 			return
 		}
-		_, err := v.Parse(jwtHeader)
+		claims, err := v.ParseClaims(token)
+		if err == nil && claims.TokenID == "" {
+			err = errors.New("JWT does not have an id")
+		}
+		if err == nil && revoked.IsRevoked(claims.TokenID) {
+			err = errors.New("JWT has been revoked")
+		}
+		if err == nil && revoked.IsUserRevoked(claims.ID, time.Unix(claims.IssuedAt, 0)) {
+			err = errors.New("JWT user has been revoked")
+		}
 		if err != nil {
-			_ = c.Error(err)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"errors": []string{"Unauthorized"},
-			})
+			problem.Abort(c, problem.Unauthorized(CodeInvalidToken, "Session token is not valid").WithCause(err))
 			return
 		}
+		SetClaims(c, claims)
+	}
+}
+
+// RequireRole rejects requests from users that hold none of roles
+// it must run after UserValidator, which parses the claims it checks
+func RequireRole(roles ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		claims, ok := ClaimsFromContext(c)
+		if !ok {
+			problem.Abort(c, problem.Unauthorized(CodeNotSignedIn, "User is not signed in"))
+			return
+		}
+		for _, role := range roles {
+			if claims.HasRole(role) {
+				return
+			}
+		}
+		problem.Abort(c, problem.Forbidden(CodeMissingRole, "Forbidden"))
+	}
+}
+
+// RequireVerified rejects requests from users who have not verified their email
+// only tokens carrying the email_verified claim are let through
+// like RequireRole, it must run after UserValidator
+func RequireVerified() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		claims, ok := ClaimsFromContext(c)
+		if !ok {
+			problem.Abort(c, problem.Unauthorized(CodeNotSignedIn, "User is not signed in"))
+			return
+		}
+		if !claims.EmailVerified {
+			problem.Abort(c, problem.Forbidden(CodeUnverified, "Email is not verified"))
+		}
 	}
 }
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+func TestUserValidator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	v, _ := NewJWTValidator([]byte("password"), "HS256")
+	revoked := NewRevocationCache()
+
+	validClaims, _ := NewClaims("foo@bar.com", "0", DefaultTokenTTL)
+	validJWT, _ := validClaims.Tokenize(v)
+	revokedClaims, _ := NewClaims("foo@bar.com", "0", DefaultTokenTTL)
+	revokedJWT, _ := revokedClaims.Tokenize(v)
+	revoked.Revoke(revokedClaims.TokenID, time.Now().Add(DefaultTokenTTL))
+	// revoking a user rejects the tokens they were issued before it
+	disabledClaims, _ := NewClaims("bar@foo.com", "1", DefaultTokenTTL)
+	disabledJWT, _ := disabledClaims.Tokenize(v)
+	// iat has whole seconds, so the revocation has to come at least a second later
+	revoked.RevokeUser("1", time.Now().Add(time.Second), time.Now().Add(DefaultTokenTTL))
+	noIdJWT, _ := v.Sign(jwt.MapClaims{
+		"email": "foo@bar.com",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	})
+
+	r := gin.New()
+	r.GET("/test", UserValidator(v, "auth-jwt", revoked), func(c *gin.Context) {
+		// handlers read the claims parsed by UserValidator
+		claims, ok := ClaimsFromContext(c)
+		if !ok || claims.TokenID != validClaims.TokenID {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{"valid token", validJWT, http.StatusOK},
+		{"no token", "", http.StatusUnauthorized},
+		{"revoked token", revokedJWT, http.StatusUnauthorized},
+		{"revoked user", disabledJWT, http.StatusUnauthorized},
+		{"token without id", noIdJWT, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/test", nil)
+			if tt.token != "" {
+				req.Header.Set("auth-jwt", tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if got, want := w.Code, tt.expectedCode; got != want {
+				currTest.Errorf("wrong status code: %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestUserValidatorFrom(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	v, _ := NewJWTValidator([]byte("password"), "HS256")
+	revoked := NewRevocationCache()
+	claims, _ := NewClaims("foo@bar.com", "0", DefaultTokenTTL)
+	token, _ := claims.Tokenize(v)
+
+	r := gin.New()
+	validator := UserValidatorFrom(v, revoked, DefaultTokenSources()...)
+	handler := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	r.GET("/test", validator, handler)
+	r.POST("/test", validator, handler)
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		cookies map[string]string
+		// expectedCode is the status of the request
+		expectedCode int
+	}{
+		{"header", http.MethodPost, map[string]string{"auth-jwt": token}, nil, http.StatusOK},
+		{"bearer", http.MethodPost, map[string]string{"Authorization": "Bearer " + token}, nil, http.StatusOK},
+		{"lowercase bearer", http.MethodPost, map[string]string{"Authorization": "bearer " + token}, nil, http.StatusOK},
+		{"other scheme", http.MethodPost, map[string]string{"Authorization": "Basic " + token}, nil, http.StatusUnauthorized},
+		{"cookie without CSRF token on a safe method", http.MethodGet, nil, map[string]string{SessionCookie: token}, http.StatusOK},
+		{"cookie without CSRF token", http.MethodPost, nil, map[string]string{SessionCookie: token}, http.StatusForbidden},
+		{"cookie without CSRF header", http.MethodPost, nil, map[string]string{SessionCookie: token, CSRFCookie: "csrf"}, http.StatusForbidden},
+		{"cookie with wrong CSRF header", http.MethodPost, map[string]string{CSRFHeader: "other"}, map[string]string{SessionCookie: token, CSRFCookie: "csrf"}, http.StatusForbidden},
+		{"cookie with empty CSRF token", http.MethodPost, map[string]string{CSRFHeader: ""}, map[string]string{SessionCookie: token, CSRFCookie: ""}, http.StatusForbidden},
+		{"cookie with CSRF token", http.MethodPost, map[string]string{CSRFHeader: "csrf"}, map[string]string{SessionCookie: token, CSRFCookie: "csrf"}, http.StatusOK},
+		// headers cannot be set by other sites, so they need no CSRF token even if there is also a cookie
+		{"header before cookie", http.MethodPost, map[string]string{"auth-jwt": token}, map[string]string{SessionCookie: "not-a-token"}, http.StatusOK},
+		// the first token found is the one checked
+		{"invalid header before cookie", http.MethodGet, map[string]string{"auth-jwt": "not-a-token"}, map[string]string{SessionCookie: token}, http.StatusUnauthorized},
+		{"no token", http.MethodGet, nil, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			req, _ := http.NewRequest(tt.method, "/test", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			for name, value := range tt.cookies {
+				req.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if got, want := w.Code, tt.expectedCode; got != want {
+				currTest.Errorf("wrong status code: %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	v, _ := NewJWTValidator([]byte("password"), "HS256")
+	revoked := NewRevocationCache()
+
+	r := gin.New()
+	r.GET("/test", UserValidator(v, "auth-jwt", revoked), RequireRole(RoleAdmin, RoleSeller), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	// without UserValidator there are no claims to check
+	r.GET("/unvalidated", RequireRole(RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name         string
+		path         string
+		roles        []string
+		expectedCode int
+	}{
+		{"admin", "/test", []string{RoleAdmin}, http.StatusOK},
+		{"one of the roles", "/test", []string{RoleBuyer, RoleSeller}, http.StatusOK},
+		{"other role", "/test", []string{RoleBuyer}, http.StatusForbidden},
+		{"no roles", "/test", nil, http.StatusForbidden},
+		{"no claims", "/unvalidated", []string{RoleAdmin}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			claims, _ := NewClaims("foo@bar.com", "0", DefaultTokenTTL, tt.roles...)
+			token, _ := claims.Tokenize(v)
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("auth-jwt", token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if got, want := w.Code, tt.expectedCode; got != want {
+				currTest.Errorf("wrong status code: %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRequireVerified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	v, _ := NewJWTValidator([]byte("password"), "HS256")
+	revoked := NewRevocationCache()
+
+	r := gin.New()
+	r.GET("/test", UserValidator(v, "auth-jwt", revoked), RequireVerified(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/unvalidated", RequireVerified(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name         string
+		path         string
+		unverified   bool
+		expectedCode int
+	}{
+		{"verified", "/test", false, http.StatusOK},
+		{"unverified", "/test", true, http.StatusForbidden},
+		{"no claims", "/unvalidated", false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			claims, _ := NewClaims("foo@bar.com", "0", DefaultTokenTTL, RoleBuyer)
+			claims.EmailVerified = !tt.unverified
+			token, _ := claims.Tokenize(v)
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("auth-jwt", token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if got, want := w.Code, tt.expectedCode; got != want {
+				currTest.Errorf("wrong status code: %v, want %v", got, want)
+			}
+		})
+	}
+}
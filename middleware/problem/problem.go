@@ -0,0 +1,150 @@
+// Package problem is the error model the services share
+// handlers abort with an *Error, which is rendered as an RFC 7807 application/problem+json response
+// with a stable code clients can match on, whatever the wording of its detail
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// codes of the problems every service has, services add codes for the problems of their domain
+const (
+	CodeInternal     = "internal"
+	CodeValidation   = "validation_failed"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+)
+
+// Error is a problem the client made or ran into
+// the cause is logged but never sent, so it can hold anything that helps debugging
+type Error struct {
+	// Type is about:blank, so Title is the status text, clients tell problems apart by Code
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// InvalidParams says what is wrong with each field of a request that failed validation
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+
+	cause error
+}
+
+// InvalidParam is a field of the request that failed validation, and why
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// New creates a problem with status, for the statuses that have no constructor of their own
+func New(status int, code, detail string) *Error {
+	return &Error{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Validation is a request the service could not accept, params say which fields were wrong
+func Validation(code, detail string, params ...InvalidParam) *Error {
+	err := New(http.StatusBadRequest, code, detail)
+	err.InvalidParams = params
+	return err
+}
+
+// Unauthorized is a request from a client that is not signed in, or whose credentials are not valid
+func Unauthorized(code, detail string) *Error {
+	return New(http.StatusUnauthorized, code, detail)
+}
+
+// Forbidden is a request from a signed in user who is not allowed to make it
+func Forbidden(code, detail string) *Error {
+	return New(http.StatusForbidden, code, detail)
+}
+
+// NotFound is a request for something that does not exist
+func NotFound(code, detail string) *Error {
+	return New(http.StatusNotFound, code, detail)
+}
+
+// Conflict is a request that cannot be made in the current state of what it changes
+func Conflict(code, detail string) *Error {
+	return New(http.StatusConflict, code, detail)
+}
+
+// Internal is a request the service failed to serve, the client is told no more than detail
+func Internal(detail string, cause error) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, detail).WithCause(cause)
+}
+
+// WithCause records the error that caused the problem, for the logs
+func (e *Error) WithCause(cause error) *Error {
+	e.cause = cause
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%v: %v: %v", e.Code, e.Detail, e.cause)
+	}
+	return fmt.Sprintf("%v: %v", e.Code, e.Detail)
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Abort stops the request and responds with err
+// errors that are not problems are responded to as internal errors
+func Abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+	render(c, err)
+}
+
+// Handler logs the errors handlers add to the gin.Context, and responds with the first problem among them if no one has yet
+// handlers can abort with Abort, or add the problem with c.Error and return
+func Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 {
+			return
+		}
+		resp := c.Errors[0].Err
+		found := false
+		for _, err := range c.Errors {
+			log.Printf("[ERROR] - %v %v, err: %v", c.Request.Method, c.Request.URL.Path, err.Err)
+			var p *Error
+			if !found && errors.As(err.Err, &p) {
+				resp, found = err.Err, true
+			}
+		}
+		if !c.Writer.Written() {
+			render(c, resp)
+		}
+	}
+}
+
+func render(c *gin.Context, err error) {
+	var p *Error
+	if !errors.As(err, &p) {
+		p = Internal("internal server error", err)
+	}
+	resp := *p
+	resp.Instance = c.Request.URL.Path
+	c.Header("Content-Type", ContentType)
+	c.JSON(resp.Status, resp)
+}
@@ -0,0 +1,116 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		// expected is the problem the client receives, nil if the handler's response is left alone
+		expected *Error
+	}{
+		{
+			"abort",
+			func(c *gin.Context) {
+				Abort(c, NotFound("ticket_not_found", "could not find ticket"))
+				c.Status(http.StatusOK)
+			},
+			&Error{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Detail: "could not find ticket", Instance: "/test", Code: "ticket_not_found"},
+		},
+		{
+			"error added to context",
+			func(c *gin.Context) {
+				_ = c.Error(Conflict("ticket_reserved", "ticket already reserved"))
+			},
+			&Error{Type: "about:blank", Title: "Conflict", Status: http.StatusConflict, Detail: "ticket already reserved", Instance: "/test", Code: "ticket_reserved"},
+		},
+		{
+			"validation",
+			func(c *gin.Context) {
+				Abort(c, Validation(CodeValidation, "ticket is not valid", InvalidParam{"price", "price cannot be less than 0"}))
+			},
+			&Error{Type: "about:blank", Title: "Bad Request", Status: http.StatusBadRequest, Detail: "ticket is not valid", Instance: "/test", Code: CodeValidation, InvalidParams: []InvalidParam{{"price", "price cannot be less than 0"}}},
+		},
+		{
+			"cause is not sent",
+			func(c *gin.Context) {
+				Abort(c, Internal("unable to save ticket", errors.New("connection refused")))
+			},
+			&Error{Type: "about:blank", Title: "Internal Server Error", Status: http.StatusInternalServerError, Detail: "unable to save ticket", Instance: "/test", Code: CodeInternal},
+		},
+		{
+			"first problem is sent",
+			func(c *gin.Context) {
+				_ = c.Error(errors.New("cache miss"))
+				_ = c.Error(Unauthorized(CodeUnauthorized, "please sign in"))
+				_ = c.Error(Forbidden(CodeForbidden, "forbidden"))
+			},
+			&Error{Type: "about:blank", Title: "Unauthorized", Status: http.StatusUnauthorized, Detail: "please sign in", Instance: "/test", Code: CodeUnauthorized},
+		},
+		{
+			"other errors are internal",
+			func(c *gin.Context) {
+				_ = c.Error(errors.New("connection refused"))
+			},
+			&Error{Type: "about:blank", Title: "Internal Server Error", Status: http.StatusInternalServerError, Detail: "internal server error", Instance: "/test", Code: CodeInternal},
+		},
+		{
+			"response already written",
+			func(c *gin.Context) {
+				c.String(http.StatusAccepted, "accepted")
+				_ = c.Error(errors.New("unable to send mail"))
+			},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			eng := gin.New()
+			eng.Use(Handler())
+			eng.GET("/test", tt.handler)
+			w := httptest.NewRecorder()
+			eng.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+			if tt.expected == nil {
+				if got, want := w.Body.String(), "accepted"; w.Code != http.StatusAccepted || got != want {
+					currTest.Errorf("response was replaced: %v %v", w.Code, got)
+				}
+				return
+			}
+			if got, want := w.Code, tt.expected.Status; got != want {
+				currTest.Errorf("wrong status code: %v, want %v", got, want)
+			}
+			if got, want := w.Header().Get("Content-Type"), ContentType; got != want {
+				currTest.Errorf("wrong content type: %v, want %v", got, want)
+			}
+			var got Error
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				currTest.Fatalf("json.Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(got, *tt.expected) {
+				currTest.Errorf("wrong problem: %+v, want %+v", got, *tt.expected)
+			}
+		})
+	}
+}
+
+func TestErrorCause(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := Internal("unable to save ticket", cause)
+	if !errors.Is(err, cause) {
+		t.Error("error does not wrap its cause")
+	}
+	if got, want := err.Error(), "internal: unable to save ticket: connection refused"; got != want {
+		t.Errorf("wrong error: %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/nats-io/stan.go"
+	"google.golang.org/protobuf/proto"
+)
+
+// RevocationCache holds the IDs (jti) of revoked tokens that have not expired yet
+// a revoked token is only remembered until its expiry, after which Parse rejects it anyway
+// whole users can be revoked too, which rejects every token they were issued up to a point in time
+type RevocationCache struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	users   map[string]userRevocation
+	now     func() time.Time
+}
+
+// userRevocation rejects a user's tokens issued before issuedBefore
+// it is remembered until expiresAt, when every one of those tokens has expired
+type userRevocation struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+func NewRevocationCache() *RevocationCache {
+	return &RevocationCache{
+		revoked: make(map[string]time.Time),
+		users:   make(map[string]userRevocation),
+		now:     time.Now,
+	}
+}
+
+// Revoke remembers tokenId until expiresAt
+// tokens that have already expired are ignored and expired entries are dropped
+func (c *RevocationCache) Revoke(tokenId string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for id, exp := range c.revoked {
+		if !exp.After(now) {
+			delete(c.revoked, id)
+		}
+	}
+	if expiresAt.After(now) {
+		c.revoked[tokenId] = expiresAt
+	}
+}
+
+// IsRevoked reports whether tokenId has been revoked
+// a nil cache has no revoked tokens
+func (c *RevocationCache) IsRevoked(tokenId string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	exp, ok := c.revoked[tokenId]
+	return ok && exp.After(c.now())
+}
+
+// RevokeUser rejects every token of userID issued before issuedBefore until expiresAt
+// issuedBefore is rounded up to the second since that is all iat records, tokens from the same second are revoked too
+// revoking a user again only ever moves issuedBefore later
+func (c *RevocationCache) RevokeUser(userID string, issuedBefore, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for id, r := range c.users {
+		if !r.expiresAt.After(now) {
+			delete(c.users, id)
+		}
+	}
+	if !expiresAt.After(now) {
+		return
+	}
+	r := userRevocation{ceilSecond(issuedBefore), expiresAt}
+	if old, ok := c.users[userID]; ok {
+		if old.issuedBefore.After(r.issuedBefore) {
+			r.issuedBefore = old.issuedBefore
+		}
+		if old.expiresAt.After(r.expiresAt) {
+			r.expiresAt = old.expiresAt
+		}
+	}
+	c.users[userID] = r
+}
+
+// ceilSecond rounds t up to the next whole second
+func ceilSecond(t time.Time) time.Time {
+	if whole := t.Truncate(time.Second); whole.Before(t) {
+		return whole.Add(time.Second)
+	}
+	return t
+}
+
+// IsUserRevoked reports whether the token of userID issued at issuedAt has been revoked with the user
+// a nil cache has no revoked users
+func (c *RevocationCache) IsUserRevoked(userID string, issuedAt time.Time) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok := c.users[userID]
+	return ok && r.expiresAt.After(c.now()) && issuedAt.Before(r.issuedBefore)
+}
+
+// ListenRevocations keeps the cache up to date with the tokens revoked by the auth service
+// every replica needs every revocation so the subscription is neither queue grouped nor durable
+// instead it replays the last token lifetime of events, which covers every token that could still be valid
+// events that cannot be handled are logged to errLog
+func (c *RevocationCache) ListenRevocations(eBus stan.Conn, errLog *log.Logger) error {
+	subj, err := subjects.StringifySubject(subjects.Subject_TOKEN_REVOKED)
+	if err != nil {
+		return fmt.Errorf("unable to set NATS subjects: %v", err)
+	}
+
+	_, err = eBus.Subscribe(
+		subj,
+		func(msg *stan.Msg) {
+			if err := c.onTokenRevoked(msg.Data); err != nil {
+				errLog.Printf("could not handle %v event, seq: %v, err: %v", subj, msg.Sequence, err)
+			}
+		},
+		stan.StartAtTimeDelta(DefaultTokenTTL),
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to %v: %v", subj, err)
+	}
+	return nil
+}
+
+func (c *RevocationCache) onTokenRevoked(data []byte) error {
+	event := &events.TokenRevoked{}
+	if err := proto.Unmarshal(data, event); err != nil {
+		return fmt.Errorf("unable to unmarshal token revocation: %v", err)
+	}
+	if event.TokenId == "" && event.UserId == "" {
+		return errors.New("token revocation is missing a token id")
+	}
+	expiresAt, err := ptypes.Timestamp(event.ExpiresAt)
+	if err != nil {
+		// without an expiry keep the token revoked for as long as any token can live
+		expiresAt = time.Now().Add(DefaultTokenTTL)
+	}
+
+	// a user revocation rejects every token the user was issued before it, e.g. when the user is disabled
+	if event.UserId != "" {
+		issuedBefore, err := ptypes.Timestamp(event.IssuedBefore)
+		if err != nil {
+			return fmt.Errorf("user revocation has an invalid issued before time: %v", err)
+		}
+		c.RevokeUser(event.UserId, issuedBefore, expiresAt)
+		return nil
+	}
+	c.Revoke(event.TokenId, expiresAt)
+	return nil
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRevocationCache(t *testing.T) {
+	now := time.Now()
+	c := NewRevocationCache()
+	c.now = func() time.Time { return now }
+
+	c.Revoke("live", now.Add(time.Minute))
+	c.Revoke("expired", now.Add(-time.Minute))
+	if !c.IsRevoked("live") {
+		t.Error("live token should be revoked")
+	}
+	if c.IsRevoked("expired") {
+		t.Error("expired token should not be cached")
+	}
+	if c.IsRevoked("unknown") {
+		t.Error("unknown token should not be revoked")
+	}
+
+	// once the token expires it is no longer tracked
+	now = now.Add(2 * time.Minute)
+	if c.IsRevoked("live") {
+		t.Error("token should be dropped after it expires")
+	}
+	c.Revoke("other", now.Add(time.Minute))
+	if got, want := len(c.revoked), 1; got != want {
+		t.Errorf("expired tokens were not pruned: %v cached, want %v", got, want)
+	}
+
+	var nilCache *RevocationCache
+	if nilCache.IsRevoked("live") {
+		t.Error("nil cache should not revoke tokens")
+	}
+}
+
+func TestRevokeUser(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	c := NewRevocationCache()
+	c.now = func() time.Time { return now }
+
+	c.RevokeUser("1", now.Add(500*time.Millisecond), now.Add(DefaultTokenTTL))
+	if !c.IsUserRevoked("1", now.Add(-time.Minute)) {
+		t.Error("token issued before the revocation should be revoked")
+	}
+	if !c.IsUserRevoked("1", now.Add(-time.Second)) {
+		t.Error("token issued the second before the revocation should be revoked")
+	}
+	if !c.IsUserRevoked("1", now) {
+		t.Error("token issued in the second of the revocation should be revoked")
+	}
+	if c.IsUserRevoked("1", now.Add(time.Second)) {
+		t.Error("token issued after the revocation should not be revoked")
+	}
+	if c.IsUserRevoked("2", now.Add(-time.Minute)) {
+		t.Error("other users should not be revoked")
+	}
+
+	// an older revocation does not undo a newer one
+	c.RevokeUser("1", now.Add(-time.Hour), now.Add(time.Minute))
+	if !c.IsUserRevoked("1", now.Add(-time.Second)) {
+		t.Error("older revocation replaced a newer one")
+	}
+
+	// once every revoked token has expired the user is no longer tracked
+	now = now.Add(DefaultTokenTTL)
+	if c.IsUserRevoked("1", now.Add(-DefaultTokenTTL)) {
+		t.Error("user should be dropped once their tokens expire")
+	}
+	c.RevokeUser("2", now, now.Add(time.Minute))
+	if got, want := len(c.users), 1; got != want {
+		t.Errorf("expired users were not pruned: %v cached, want %v", got, want)
+	}
+
+	var nilCache *RevocationCache
+	if nilCache.IsUserRevoked("2", now) {
+		t.Error("nil cache should not revoke users")
+	}
+}
+
+func TestOnTokenRevoked(t *testing.T) {
+	revoked := NewRevocationCache()
+	handler := revoked.onTokenRevoked
+
+	expiresAt, _ := ptypes.TimestampProto(time.Now().Add(time.Minute))
+	data, err := proto.Marshal(&events.TokenRevoked{
+		Subject:   subjects.Subject_TOKEN_REVOKED,
+		TokenId:   "1",
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("unable to marshal revocation: %v", err)
+	}
+	if err := handler(data); err != nil {
+		t.Fatalf("unexpected error handling revocation: %v", err)
+	}
+	if !revoked.IsRevoked("1") {
+		t.Error("token was not revoked")
+	}
+
+	// user revocations reject every token issued to the user before them
+	issuedBefore, _ := ptypes.TimestampProto(time.Now())
+	data, err = proto.Marshal(&events.TokenRevoked{
+		Subject:      subjects.Subject_TOKEN_REVOKED,
+		ExpiresAt:    expiresAt,
+		UserId:       "2",
+		IssuedBefore: issuedBefore,
+	})
+	if err != nil {
+		t.Fatalf("unable to marshal revocation: %v", err)
+	}
+	if err := handler(data); err != nil {
+		t.Fatalf("unexpected error handling user revocation: %v", err)
+	}
+	if !revoked.IsUserRevoked("2", time.Now().Add(-time.Minute)) {
+		t.Error("user was not revoked")
+	}
+	data, _ = proto.Marshal(&events.TokenRevoked{Subject: subjects.Subject_TOKEN_REVOKED, UserId: "2"})
+	if err := handler(data); err == nil {
+		t.Error("expected error handling a user revocation without an issued before time")
+	}
+
+	data, _ = proto.Marshal(&events.TokenRevoked{Subject: subjects.Subject_TOKEN_REVOKED})
+	if err := handler(data); err == nil {
+		t.Error("expected error handling a revocation without a token id")
+	}
+	if err := handler([]byte("not a proto")); err == nil {
+		t.Error("expected error handling a malformed revocation")
+	}
+}
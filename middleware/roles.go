@@ -0,0 +1,12 @@
+package middleware
+
+// roles a user can hold
+// auth stores them on the user and issues them in the roles claim of session tokens
+const (
+	// RoleAdmin can moderate any ticket, cancel any order and view all users
+	RoleAdmin = "admin"
+	// RoleSeller can list tickets for sale
+	RoleSeller = "seller"
+	// RoleBuyer can order tickets
+	RoleBuyer = "buyer"
+)
@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// privateKeyPEM encodes a test key the way NewPrivateKeyValidator expects
+func privateKeyPEM(t *testing.T, k testKey) string {
+	t.Helper()
+	var block *pem.Block
+	switch key := k.privateKey.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("unable to marshal EC key: %v", err)
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	case ed25519.PrivateKey:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("unable to marshal Ed25519 key: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	return string(pem.EncodeToMemory(block))
+}
+
+func keySetJSON(t *testing.T, current string, items ...KeySetItem) []byte {
+	t.Helper()
+	data, err := json.Marshal(KeySetFile{Current: current, Keys: items})
+	if err != nil {
+		t.Fatalf("unable to marshal keyset: %v", err)
+	}
+	return data
+}
+
+// signedKid signs a session token with v and returns it with the kid it was signed with
+func signedKid(t *testing.T, v *JWTValidator) (string, string) {
+	t.Helper()
+	claims, err := NewClaims("foo@bar.com", "0", DefaultTokenTTL)
+	if err != nil {
+		t.Fatalf("unable to create claims: %v", err)
+	}
+	tokenStr, err := claims.Tokenize(v)
+	if err != nil {
+		t.Fatalf("unable to sign token: %v", err)
+	}
+	token, err := v.ParseWithClaims(tokenStr, new(Claims))
+	if err != nil {
+		t.Fatalf("unexpected error parsing token: %v", err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return tokenStr, kid
+}
+
+func TestThumbprint(t *testing.T) {
+	// example key from RFC 7638 section 3.1
+	jwk := JWK{
+		Kty: "RSA",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn" +
+			"64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91Cb" +
+			"OpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E: "AQAB",
+	}
+	got, err := jwk.thumbprint()
+	if err != nil {
+		t.Fatalf("unexpected error computing thumbprint: %v", err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("wrong thumbprint: %v, want %v", got, want)
+	}
+}
+
+func TestPrivateKeyValidator(t *testing.T) {
+	keys, others := newTestKeys(t), newTestKeys(t)
+	for i, k := range keys {
+		other := others[i]
+		t.Run(k.alg, func(currTest *testing.T) {
+			v, err := NewPrivateKeyValidator([]byte(privateKeyPEM(currTest, k)), k.alg)
+			if err != nil {
+				currTest.Fatalf("unable to create validator: %v", err)
+			}
+
+			jwks := v.JWKS()
+			if got, want := len(jwks.Keys), 1; got != want {
+				currTest.Fatalf("JWKS has %v keys, want %v", got, want)
+			}
+			if got, want := jwks.Keys[0].Alg, k.alg; got != want {
+				currTest.Errorf("wrong JWKS alg: %v, want %v", got, want)
+			}
+			if _, kid := signedKid(currTest, v); kid != jwks.Keys[0].Kid {
+				currTest.Errorf("wrong kid: %v, want %v", kid, jwks.Keys[0].Kid)
+			}
+
+			// tokens signed by another key are rejected, even if they name the right kid
+			if _, err := v.ParseClaims(signTestToken(currTest, other, jwks.Keys[0].Kid)); err == nil {
+				currTest.Error("expected error parsing a token signed by another key")
+			}
+		})
+	}
+
+	if _, err := NewPrivateKeyValidator([]byte("not a key"), "RS256"); err == nil {
+		t.Error("expected error parsing an invalid private key")
+	}
+	if _, err := NewPrivateKeyValidator([]byte(privateKeyPEM(t, keys[1])), "RS256"); err == nil {
+		t.Error("expected error parsing a key that does not match the alg")
+	}
+	hs, _ := NewJWTValidator([]byte("password"), "HS256")
+	if got := len(hs.JWKS().Keys); got != 0 {
+		t.Errorf("HS256 JWKS has %v keys, want 0", got)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	keys := newTestKeys(t)
+	oldKey, newKey := privateKeyPEM(t, keys[2]), privateKeyPEM(t, keys[1])
+
+	before, err := NewKeySetValidator(keySetJSON(t, "old", KeySetItem{Kid: "old", Alg: "EdDSA", Key: oldKey}))
+	if err != nil {
+		t.Fatalf("unable to create validator: %v", err)
+	}
+	oldToken, kid := signedKid(t, before)
+	if kid != "old" {
+		t.Errorf("wrong kid: %q, want old", kid)
+	}
+
+	// the new key signs, the old key still verifies until it retires
+	retireAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	after, err := NewKeySetValidator(keySetJSON(t, "new",
+		KeySetItem{Kid: "new", Alg: "ES256", Key: newKey},
+		KeySetItem{Kid: "old", Alg: "EdDSA", Key: oldKey, RetireAt: &retireAt},
+	))
+	if err != nil {
+		t.Fatalf("unable to create validator: %v", err)
+	}
+	if _, kid := signedKid(t, after); kid != "new" {
+		t.Errorf("wrong kid: %q, want new", kid)
+	}
+	if _, err := after.ParseClaims(oldToken); err != nil {
+		t.Errorf("unexpected error parsing a token signed with the old key: %v", err)
+	}
+	jwks := after.JWKS()
+	if got, want := len(jwks.Keys), 2; got != want {
+		t.Fatalf("JWKS has %v keys, want %v", got, want)
+	}
+	if got := jwks.Keys[1]; got.Kid != "old" || got.RetireAt == nil || !got.RetireAt.Equal(retireAt) {
+		t.Errorf("wrong JWKS key: %+v, want kid old retiring at %v", got, retireAt)
+	}
+
+	// once retired the old key is no longer accepted or published
+	retired := time.Now().Add(-time.Minute)
+	after, err = NewKeySetValidator(keySetJSON(t, "new",
+		KeySetItem{Kid: "new", Alg: "ES256", Key: newKey},
+		KeySetItem{Kid: "old", Alg: "EdDSA", Key: oldKey, RetireAt: &retired},
+	))
+	if err != nil {
+		t.Fatalf("unable to create validator: %v", err)
+	}
+	if _, err := after.ParseClaims(oldToken); err == nil || !strings.Contains(err.Error(), `key "old" is retired`) {
+		t.Errorf("wrong error parsing a token signed with a retired key: %v", err)
+	}
+	if jwks := after.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "new" {
+		t.Errorf("wrong JWKS: %+v, want only the new key", jwks)
+	}
+
+	// a key without a kid is named by its thumbprint
+	rsaValidator, _ := NewPrivateKeyValidator([]byte(privateKeyPEM(t, keys[0])), "RS256")
+	rsaKid := rsaValidator.JWKS().Keys[0].Kid
+	thumbprinted, err := NewKeySetValidator(keySetJSON(t, rsaKid, KeySetItem{Alg: "RS256", Key: privateKeyPEM(t, keys[0])}))
+	if err != nil {
+		t.Fatalf("unable to create validator: %v", err)
+	}
+	if _, kid := signedKid(t, thumbprinted); kid != rsaKid {
+		t.Errorf("wrong kid: %q, want thumbprint %q", kid, rsaKid)
+	}
+}
+
+func TestParseKeySetRejected(t *testing.T) {
+	keyPEM := privateKeyPEM(t, newTestKeys(t)[2])
+	retired := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"not json", []byte("keys"), "could not parse keyset"},
+		{"no keys", keySetJSON(t, "a"), "keyset has no keys"},
+		{"unknown current", keySetJSON(t, "b", KeySetItem{Kid: "a", Alg: "EdDSA", Key: keyPEM}), `current key "b" is not in the keyset`},
+		{
+			"duplicate kid",
+			keySetJSON(t, "a", KeySetItem{Kid: "a", Alg: "EdDSA", Key: keyPEM}, KeySetItem{Kid: "a", Alg: "HS256", Key: "password"}),
+			`keyset key 1: duplicate kid "a"`,
+		},
+		{"retired current", keySetJSON(t, "a", KeySetItem{Kid: "a", Alg: "EdDSA", Key: keyPEM, RetireAt: &retired}), `current key "a" is retired`},
+		{"HS256 without kid", keySetJSON(t, "", KeySetItem{Alg: "HS256", Key: "password"}), "HS256 keys must have a kid"},
+		{"unsupported alg", keySetJSON(t, "a", KeySetItem{Kid: "a", Alg: "none", Key: keyPEM}), "unsupported signing method: none"},
+		{"wrong key type", keySetJSON(t, "a", KeySetItem{Kid: "a", Alg: "RS256", Key: keyPEM}), "could not parse private key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			_, err := NewKeySetValidator(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				currTest.Errorf("wrong error: %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestKeySetFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyset.json")
+	write := func(data []byte) {
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("unable to write keyset: %v", err)
+		}
+	}
+	first := KeySetItem{Kid: "first", Alg: "HS256", Key: "password"}
+	write(keySetJSON(t, "first", first))
+
+	v, err := NewKeySetFileValidator(path, DefaultKeySetReload)
+	if err != nil {
+		t.Fatalf("unable to create validator: %v", err)
+	}
+	now := time.Now()
+	v.signing.now = func() time.Time { return now }
+	firstToken, _ := signedKid(t, v)
+
+	// changes are only picked up once the reload interval has passed
+	write(keySetJSON(t, "second", KeySetItem{Kid: "second", Alg: "HS256", Key: "hunter2"}, first))
+	if _, kid := signedKid(t, v); kid != "first" {
+		t.Errorf("wrong kid before reload: %q, want first", kid)
+	}
+	now = now.Add(DefaultKeySetReload)
+	if _, kid := signedKid(t, v); kid != "second" {
+		t.Errorf("wrong kid after reload: %q, want second", kid)
+	}
+	if _, err := v.ParseClaims(firstToken); err != nil {
+		t.Errorf("unexpected error parsing a token signed before the reload: %v", err)
+	}
+
+	// a broken file keeps the keyset that was loaded last
+	write([]byte("{"))
+	now = now.Add(DefaultKeySetReload)
+	if _, kid := signedKid(t, v); kid != "second" {
+		t.Errorf("wrong kid after a bad reload: %q, want second", kid)
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const (
+	// SessionCookie is the cookie the auth service keeps the session token in
+	SessionCookie = "auth-jwt"
+	// CSRFCookie and CSRFHeader carry the double submit token for requests authenticated by cookie
+	// the auth service sets the cookie where scripts can read it, and clients copy it into the header
+	// these are the names axios uses, so it sends the header without being told to
+	CSRFCookie = "XSRF-TOKEN"
+	CSRFHeader = "X-XSRF-TOKEN"
+)
+
+// TokenSource finds the session token in a request
+type TokenSource struct {
+	token func(*http.Request) string
+	// browsers send cookies on requests other sites make, so cookie tokens need CSRF protection
+	cookie bool
+}
+
+// HeaderToken reads the token from a header, as services calling each other send it
+func HeaderToken(header string) TokenSource {
+	return TokenSource{token: func(r *http.Request) string {
+		return r.Header.Get(header)
+	}}
+}
+
+// BearerToken reads the token from an Authorization: Bearer header
+func BearerToken() TokenSource {
+	return TokenSource{token: func(r *http.Request) string {
+		auth := r.Header.Get("Authorization")
+		// the scheme is case insensitive
+		if len(auth) > len("bearer ") && strings.EqualFold(auth[:len("bearer ")], "bearer ") {
+			return strings.TrimSpace(auth[len("bearer "):])
+		}
+		return ""
+	}}
+}
+
+// CookieToken reads the token from a cookie, as browsers send it
+// state changing requests must also pass the CSRF check, see CSRFCookie
+func CookieToken(name string) TokenSource {
+	return TokenSource{cookie: true, token: func(r *http.Request) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}}
+}
+
+// DefaultTokenSources accept tokens from the auth-jwt header, then a bearer token, then the session cookie
+func DefaultTokenSources() []TokenSource {
+	return []TokenSource{HeaderToken(SessionCookie), BearerToken(), CookieToken(SessionCookie)}
+}
+
+// findToken returns the token from the first source that has one, and whether it came from a cookie
+func findToken(r *http.Request, sources []TokenSource) (string, bool) {
+	for _, source := range sources {
+		if token := source.token(r); token != "" {
+			return token, source.cookie
+		}
+	}
+	return "", false
+}
+
+// CheckCSRF checks the double submit token of state changing requests authenticated by cookie
+// the CSRF header must match the CSRF cookie: other sites can make browsers send the cookie but cannot read it to set the header
+// GET, HEAD, OPTIONS and TRACE requests must not change state, so they pass without a token
+func CheckCSRF(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	c, err := r.Cookie(CSRFCookie)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	header := r.Header.Get(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(header)) == 1
+}
@@ -1,37 +1,48 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
 	prometrics "github.com/basilnsage/prometheus-gin-metrics"
 	"github.com/gin-gonic/gin"
-	"github.com/nats-io/stan.go"
+)
+
+// codes of the problems the order routes respond with
+const (
+	codeTicketNotFound = "ticket_not_found"
+	codeTicketReserved = "ticket_reserved"
+	codeOrderNotFound  = "order_not_found"
+	codeNotOrderOwner  = "not_order_owner"
+	codeOrderPaid      = "order_paid"
+	codeOrderModified  = "order_modified"
 )
 
 type apiServer struct {
 	orderDuration time.Duration
 	tc            ticketsCRUD
 	oc            ordersCRUD
-	eBus          stan.Conn
 	router        *gin.Engine
 	v             *middleware.JWTValidator
+	revoked       *middleware.RevocationCache
+	// sources are where session tokens are read from
+	sources []middleware.TokenSource
 }
 
-func newApiServer(pass string, orderDuration time.Duration, r *gin.Engine, tc ticketsCRUD, oc ordersCRUD, stan stan.Conn) (*apiServer, error) {
+func newApiServer(v *middleware.JWTValidator, orderDuration time.Duration, r *gin.Engine, tc ticketsCRUD, oc ordersCRUD, revoked *middleware.RevocationCache, sources []middleware.TokenSource) (*apiServer, error) {
 	a := &apiServer{}
 
 	if err := setOrderSubjects(); err != nil {
 		return nil, fmt.Errorf("unable to set NATS subjects: %v", err)
 	}
 
-	jwtValidator, err := middleware.NewJWTValidator([]byte(pass), "HS256")
-	if err != nil {
-		return nil, fmt.Errorf("NewJWTValidator: %v", err)
-	}
-	a.v = jwtValidator
+	a.v = v
+	a.revoked = revoked
+	a.sources = sources
 
 	a.orderDuration = orderDuration
 
@@ -40,7 +51,6 @@ func newApiServer(pass string, orderDuration time.Duration, r *gin.Engine, tc ti
 
 	a.tc = tc
 	a.oc = oc
-	a.eBus = stan
 
 	return a, nil
 }
@@ -51,10 +61,11 @@ func (a *apiServer) bindRoutes() {
 		[]float64{0.005, 0.01, 0.05, 0.1, 0.5, 1.0, 2.0, 5.0},
 	))
 	a.router.GET("/orders/metrics", promRegistry.DefaultHandler)
+	a.router.Use(problem.Handler())
 
-	userValidationMiddleware := middleware.UserValidator(a.v, "auth-jwt")
+	userValidationMiddleware := middleware.UserValidatorFrom(a.v, a.revoked, a.sources...)
 	ticketRoutes := a.router.Group("/api/orders")
-	ticketRoutes.POST("/create", userValidationMiddleware, a.postOrder)
+	ticketRoutes.POST("/create", userValidationMiddleware, middleware.RequireRole(middleware.RoleBuyer), middleware.RequireVerified(), a.postOrder)
 	ticketRoutes.GET("", userValidationMiddleware, a.getAllOrders)
 	ticketRoutes.GET("/:id", userValidationMiddleware, a.getOrder)
 	ticketRoutes.PATCH("/:id", userValidationMiddleware, a.cancelOrder)
@@ -62,18 +73,17 @@ func (a *apiServer) bindRoutes() {
 
 func (a *apiServer) postOrder(c *gin.Context) {
 	// extract user ID from JWT
-	var userClaims middleware.UserClaims
-	if err := userClaims.NewFromToken(a.v, c.GetHeader("auth-jwt")); err != nil {
-		ErrorLogger.Printf("could not parse auth-jwt header: %v", err)
-		c.Status(http.StatusForbidden)
+	userClaims, ok := middleware.ClaimsFromContext(c)
+	if !ok {
+		problem.Abort(c, problem.Internal("Internal Server Error", errors.New("no user claims found, this should never happen")))
 		return
 	}
-	uid := userClaims.Id
+	uid := userClaims.ID
 
 	// get the ticket ID from the request
 	req := OrderReq{}
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResp{[]string{"Could not parse request"}})
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "Could not parse request").WithCause(err))
 		return
 	}
 	ticketId := req.TicketId
@@ -81,25 +91,10 @@ func (a *apiServer) postOrder(c *gin.Context) {
 	// do we know about the ticket?
 	ticket, err := a.tc.read(ticketId)
 	if err != nil {
-		ErrorLogger.Printf("failed to read ticket from DB: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("failed to read ticket from DB: %v", err)))
 		return
 	} else if ticket == nil {
-		c.JSON(http.StatusNotFound, ErrorResp{[]string{"could not find ticket: " + ticketId}})
-		return
-	}
-
-	// has the ticket been reserved?
-	// find an order, whose status != reserved, that references the ticket
-	orders, err := a.oc.search(1, []string{ticket.Id}, []string{}, []orderStatus{Created, AwaitingPayment, Completed})
-	if err != nil {
-		ErrorLogger.Printf("reserved order search failed: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
-		return
-	}
-	// if there exists a matching order then the ticket is already ordered --> we cannot order twice
-	if len(orders) > 0 {
-		c.JSON(http.StatusBadRequest, ErrorResp{[]string{"ticket already reserved"}})
+		problem.Abort(c, problem.NotFound(codeTicketNotFound, "could not find ticket: "+ticketId))
 		return
 	}
 
@@ -120,78 +115,78 @@ func (a *apiServer) postOrder(c *gin.Context) {
 		"", // we can't know this until we save the order to the DB
 	}
 
-	// save the order
-	orderId, err := a.oc.create(order)
-	if err != nil {
-		ErrorLogger.Printf("failed to save order: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
+	// save the order, this fails if another active order has already reserved the ticket
+	// the order created event is saved with the order and published by the outbox relay
+	orderId, err := a.oc.reserve(order, func(id string) (outboxEvent, error) {
+		created := order
+		created.Id = id
+		eventBytes, err := marshalOrderCreated(*ticket, created)
+		if err != nil {
+			return outboxEvent{}, err
+		}
+		return newOutboxEvent(orderCreatedSubject, eventBytes), nil
+	})
+	if errors.As(err, &alreadyReservedError{}) {
+		problem.Abort(c, problem.Conflict(codeTicketReserved, "ticket already reserved"))
+		return
+	} else if err != nil {
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("failed to save order: %v", err)))
 		return
 	}
 	order.Id = orderId
 	InfoLogger.Printf("saved order with id: %v", orderId)
 
-	// marshal the order created event
-	createdEventBytes, err := marshalOrderCreated(*ticket, order)
-	if err != nil {
-		ErrorLogger.Printf("could not create order created event: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
-		return
-	}
-
-	// publish event
-	if err := a.eBus.Publish(orderCreatedSubject, createdEventBytes); err != nil {
-		ErrorLogger.Printf("could not publish created order event: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
-		return
-	}
-
 	c.JSON(http.StatusCreated, OrderResp{
 		order.Status,
 		order.ExpiresAt,
 		*ticket,
 		order.Id,
+		false,
 	})
 }
 
 func (a *apiServer) getOrder(c *gin.Context) {
-	// get user id from auth-jwt header
-	var userClaims middleware.UserClaims
-	if err := userClaims.NewFromToken(a.v, c.GetHeader("auth-jwt")); err != nil {
-		ErrorLogger.Printf("could not parse auth-jwt header: %v", err)
-		c.Status(http.StatusForbidden)
+	// get user id from the session token
+	userClaims, ok := middleware.ClaimsFromContext(c)
+	if !ok {
+		problem.Abort(c, problem.Internal("Internal Server Error", errors.New("no user claims found, this should never happen")))
 		return
 	}
-	uid := userClaims.Id
+	uid := userClaims.ID
 
 	// fetch order with ID from URI param
 	oid := c.Param("id")
 	// if no oid (not sure how this would happen...)
 	if oid == "" {
-		c.JSON(http.StatusBadRequest, ErrorResp{[]string{"no order id found"}})
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "no order id found", problem.InvalidParam{Name: "id", Reason: "please specify an order id"}))
 		return
 	}
 	order, err := a.oc.read(oid)
 	if err != nil {
-		ErrorLogger.Printf("unable to fetch single order: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("unable to fetch single order: %v", err)))
 		return
 	}
 	if order == nil {
-		c.JSON(http.StatusNotFound, ErrorResp{[]string{"no order found"}})
+		problem.Abort(c, problem.NotFound(codeOrderNotFound, "no order found"))
 		return
 	}
 	if order.UserId != uid {
-		c.JSON(http.StatusUnauthorized, ErrorResp{[]string{"unauthorized"}})
+		problem.Abort(c, problem.Forbidden(codeNotOrderOwner, "only the buyer can view an order"))
 		return
 	}
 
 	// fetch corresponding ticket
 	ticket, err := a.tc.read(order.TicketId)
 	if err != nil {
-		ErrorLogger.Printf("failed to read ticket from DB: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("failed to read ticket from DB: %v", err)))
 		return
 	}
+	ticketMissing := ticket == nil
+	if ticketMissing {
+		// return the order anyway, as getAllOrders does
+		ErrorLogger.Printf("ticket missing for order, order id: %v, ticket id: %v", order.Id, order.TicketId)
+		ticket = &Ticket{Id: order.TicketId}
+	}
 
 	// return OrderResp if order exists
 	c.JSON(http.StatusOK, OrderResp{
@@ -199,117 +194,128 @@ func (a *apiServer) getOrder(c *gin.Context) {
 		order.ExpiresAt,
 		*ticket,
 		order.Id,
+		ticketMissing,
 	})
 }
 
+// getAllOrders returns a page of the user's orders
+// pass the returned next token as the after query parameter to fetch the following page
 func (a *apiServer) getAllOrders(c *gin.Context) {
-	// get user id from auth-jwt header
-	var userClaims middleware.UserClaims
-	if err := userClaims.NewFromToken(a.v, c.GetHeader("auth-jwt")); err != nil {
-		ErrorLogger.Printf("could not parse auth-jwt header: %v", err)
-		c.Status(http.StatusForbidden)
+	// get user id from the session token
+	userClaims, ok := middleware.ClaimsFromContext(c)
+	if !ok {
+		problem.Abort(c, problem.Internal("Internal Server Error", errors.New("no user claims found, this should never happen")))
 		return
 	}
-	uid := userClaims.Id
+	uid := userClaims.ID
 
-	// search for all orders belonging to this user
-	orders, err := a.oc.search(50, nil, []string{uid}, nil)
+	// search for a page of orders belonging to this user
+	query, params := orderSearchFromParams(c.Request.URL.Query())
+	if len(params) > 0 {
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "query is not valid", params...))
+		return
+	}
+	query.userIds = []string{uid}
+	orders, next, err := a.oc.search(query)
 	if err != nil {
-		ErrorLogger.Printf("error search for users orders: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("error search for users orders: %v", err)))
 		return
 	}
 
-	// for each order, fetch the ticket and combine the two into the response
-	resp := make([]OrderResp, 0)
+	// fetch every ticket for the page at once and join them to the orders
+	ticketIds := make([]string, 0, len(orders))
 	for _, order := range orders {
-		tid := order.TicketId
-		ticket, err := a.tc.read(tid)
-		if err != nil {
-			ErrorLogger.Printf("error reading ticket, id: %v, error: %v", tid, err)
-			continue
+		ticketIds = append(ticketIds, order.TicketId)
+	}
+	tickets, err := a.tc.readMany(ticketIds)
+	if err != nil {
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("error reading tickets for users orders: %v", err)))
+		return
+	}
+
+	resp := make([]OrderResp, 0, len(orders))
+	for _, order := range orders {
+		ticket, ok := tickets[order.TicketId]
+		if !ok {
+			// keep the order in the response so it does not silently disappear
+			ErrorLogger.Printf("ticket missing for order, order id: %v, ticket id: %v", order.Id, order.TicketId)
+			ticket = Ticket{Id: order.TicketId}
 		}
 		resp = append(resp, OrderResp{
 			order.Status,
 			order.ExpiresAt,
-			*ticket,
+			ticket,
 			order.Id,
+			!ok,
 		})
 	}
 
 	// send the response
-	c.JSON(http.StatusOK, resp)
+	c.JSON(http.StatusOK, OrdersPage{resp, next})
 }
 
 func (a *apiServer) cancelOrder(c *gin.Context) {
 	// get user id from jwt header
-	var userClaims middleware.UserClaims
-	if err := userClaims.NewFromToken(a.v, c.GetHeader("auth-jwt")); err != nil {
-		ErrorLogger.Printf("could not parse auth-jwt header: %v", err)
-		c.Status(http.StatusForbidden)
+	userClaims, ok := middleware.ClaimsFromContext(c)
+	if !ok {
+		problem.Abort(c, problem.Internal("Internal Server Error", errors.New("no user claims found, this should never happen")))
 		return
 	}
-	uid := userClaims.Id
+	uid := userClaims.ID
 
 	// check if the order exists
 	oid := c.Param("id")
 	if oid == "" {
-		ErrorLogger.Printf("no order id found, this should not happen, id: %v", oid)
-		c.JSON(http.StatusBadRequest, ErrorResp{[]string{"please specify an order id"}})
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "please specify an order id", problem.InvalidParam{Name: "id", Reason: "please specify an order id"}))
 		return
 	}
 	order, err := a.oc.read(oid)
 	if err != nil {
-		ErrorLogger.Printf("unable to fetch single order: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("unable to fetch single order: %v", err)))
 		return
 	}
 	if order == nil {
-		c.JSON(http.StatusNotFound, ErrorResp{[]string{"order not found"}})
+		problem.Abort(c, problem.NotFound(codeOrderNotFound, "order not found"))
 		return
 	}
 
-	// check if the user owns the order
-	if order.UserId != uid {
-		c.JSON(http.StatusUnauthorized, ErrorResp{[]string{"unauthorized"}})
+	// check if the user owns the order, admins can cancel any order
+	if order.UserId != uid && !userClaims.HasRole(middleware.RoleAdmin) {
+		problem.Abort(c, problem.Forbidden(codeNotOrderOwner, "only the buyer can cancel an order"))
 		return
 	}
 
-	// update status
-	order.Status = Cancelled
-	ok, err := a.oc.update(oid, *order)
-	if err != nil {
-		ErrorLogger.Printf("could not update order: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
+	// a paid order keeps its ticket, and an order is only cancelled once
+	switch order.Status {
+	case Completed:
+		problem.Abort(c, problem.Conflict(codeOrderPaid, "cannot cancel an order that has been paid for"))
 		return
-	}
-	if !ok {
-		ErrorLogger.Printf("order not found during update, this should not happen, id: %v", oid)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
+	case Cancelled:
+		c.Status(http.StatusNoContent)
 		return
 	}
 
-	// publish event
+	// update status and save the order cancelled event with it
 	// could be dangerous if marshalOrderCancelled changes underneath without updating this function
 	// it would then marshal zero-values that are probably do not match actual ticket values
 	// ideally, this situation would be caught by unit tests
+	order.Status = Cancelled
 	eventBytes, err := marshalOrderCancelled(Ticket{Id: order.TicketId}, *order)
 	if err != nil {
-		ErrorLogger.Printf("unable to marshal orderCancelled event: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("unable to marshal orderCancelled event: %v", err)))
 		return
 	}
-
-	if err := a.eBus.Publish(orderCancelledSubject, eventBytes); err != nil {
-		ErrorLogger.Printf("unable to publish orderCancelled event: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal Server Error"}})
+	ok, err = a.oc.update(oid, *order, activeStatuses, newOutboxEvent(orderCancelledSubject, eventBytes))
+	if err != nil {
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("could not update order: %v", err)))
+		return
+	}
+	// the order was read above so a miss here means it was paid for or cancelled in the meantime
+	if !ok {
+		problem.Abort(c, problem.Conflict(codeOrderModified, "order was modified, please try again"))
 		return
 	}
 
 	// send response
 	c.Status(http.StatusNoContent)
 }
-
-type ErrorResp struct {
-	Errors []string `json:"errors"`
-}
@@ -12,9 +12,11 @@ import (
 	"github.com/basilnsage/mwn-ticketapp-common/events"
 	"github.com/basilnsage/mwn-ticketapp-common/subjects"
 	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
 )
@@ -25,7 +27,11 @@ func newTestInfra() (*apiServer, *fakeTicketsCollection, *fakeOrdersCollection,
 	fakeStan := newFakeNatsConn()
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	server, err := newApiServer("password", 0, r, fakeTC, fakeOC, fakeStan)
+	v, err := middleware.NewJWTValidator([]byte("password"), "HS256")
+	if err != nil {
+		return nil, fakeTC, fakeOC, fakeStan, err
+	}
+	server, err := newApiServer(v, 0, r, fakeTC, fakeOC, middleware.NewRevocationCache(), middleware.DefaultTokenSources())
 	if err != nil {
 		return nil, fakeTC, fakeOC, fakeStan, nil
 	}
@@ -33,15 +39,33 @@ func newTestInfra() (*apiServer, *fakeTicketsCollection, *fakeOrdersCollection,
 	return server, fakeTC, fakeOC, fakeStan, nil
 }
 
+// newTestJWT signs a session token for an ordinary test user, who can both buy and sell tickets
+func newTestJWT(v *middleware.JWTValidator, email, id string) (string, error) {
+	return newRoleJWT(v, email, id, middleware.RoleBuyer, middleware.RoleSeller)
+}
+
+// newRoleJWT signs a session token for a verified test user holding roles
+func newRoleJWT(v *middleware.JWTValidator, email, id string, roles ...string) (string, error) {
+	claims, err := middleware.NewClaims(email, id, middleware.DefaultTokenTTL, roles...)
+	if err != nil {
+		return "", err
+	}
+	claims.EmailVerified = true
+	return claims.Tokenize(v)
+}
+
 func TestNewApiServer(t *testing.T) {
 	t.Run("test newApiServer", func(tester *testing.T) {
 		fakeTC := newFakeTicketsCollection()
 		fakeOC := newFakeOrdersCollection()
-		fakeStan := newFakeNatsConn()
 		gin.SetMode(gin.TestMode)
 		r := gin.New()
+		v, err := middleware.NewJWTValidator([]byte("password"), "HS256")
+		if err != nil {
+			tester.Fatalf("NewJWTValidator: %v", err)
+		}
 
-		server, err := newApiServer("password", 3*time.Second, r, fakeTC, fakeOC, fakeStan)
+		server, err := newApiServer(v, 3*time.Second, r, fakeTC, fakeOC, middleware.NewRevocationCache(), middleware.DefaultTokenSources())
 		if err != nil {
 			tester.Fatalf("newApiServer: %v", err)
 		}
@@ -66,7 +90,7 @@ type test struct {
 	headers      map[string]string
 	expectedCode int
 	expectedResp interface{}
-	expectedErr  *ErrorResp
+	expectedErr  *problem.Error
 }
 
 func runTest(tests []test, router *gin.Engine, t *testing.T) (err error) {
@@ -109,8 +133,8 @@ func runTest(tests []test, router *gin.Engine, t *testing.T) (err error) {
 						currTest.Fatalf("json.Unmarshal: %v", err)
 					}
 					diff = cmp.Diff(test.expectedResp, respBody)
-				case []OrderResp:
-					var respBody []OrderResp
+				case OrdersPage:
+					var respBody OrdersPage
 					if err := json.Unmarshal(respBytes, &respBody); err != nil {
 						currTest.Fatalf("json.Unmarshal: %v", err)
 					}
@@ -123,7 +147,10 @@ func runTest(tests []test, router *gin.Engine, t *testing.T) (err error) {
 
 			// check resp body if an err is expected
 			if test.expectedErr != nil {
-				var respBody ErrorResp
+				if got, want := resp.Header().Get("Content-Type"), problem.ContentType; got != want {
+					currTest.Errorf("wrong content type: %v, want %v", got, want)
+				}
+				var respBody problem.Error
 				respBytes, err := ioutil.ReadAll(resp.Body)
 				if err != nil {
 					currTest.Fatalf("ioutil.Readall: %v", err)
@@ -131,7 +158,7 @@ func runTest(tests []test, router *gin.Engine, t *testing.T) (err error) {
 				if err := json.Unmarshal(respBytes, &respBody); err != nil {
 					currTest.Fatalf("json.Unmarshal: %v", err)
 				}
-				if diff := cmp.Diff(*test.expectedErr, respBody); diff != "" {
+				if diff := cmp.Diff(*test.expectedErr, respBody, cmpopts.IgnoreUnexported(problem.Error{}), cmpopts.IgnoreFields(problem.Error{}, "Instance")); diff != "" {
 					currTest.Fatalf("unexpected error: (-want, +got)\n%v", diff)
 				}
 			}
@@ -146,7 +173,19 @@ func TestPostOrder(t *testing.T) {
 		t.Fatalf("unable to complete pre-test tasks: %v", err)
 	}
 
-	testUserJWT, err := middleware.NewUserClaims("foo@bar.com", "1").Tokenize(server.v)
+	testUserJWT, err := newTestJWT(server.v, "foo@bar.com", "1")
+	if err != nil {
+		t.Fatalf("unble to create test JWT: %v", err)
+	}
+	sellerJWT, err := newRoleJWT(server.v, "foo@bar.com", "1", middleware.RoleSeller)
+	if err != nil {
+		t.Fatalf("unble to create test JWT: %v", err)
+	}
+	unverifiedClaims, err := middleware.NewClaims("foo@bar.com", "1", middleware.DefaultTokenTTL, middleware.RoleBuyer)
+	if err != nil {
+		t.Fatalf("unble to create test JWT: %v", err)
+	}
+	unverifiedJWT, err := unverifiedClaims.Tokenize(server.v)
 	if err != nil {
 		t.Fatalf("unble to create test JWT: %v", err)
 	}
@@ -164,7 +203,27 @@ func TestPostOrder(t *testing.T) {
 			map[string]string{"auth-jwt": testUserJWT},
 			http.StatusBadRequest,
 			nil,
-			&ErrorResp{[]string{"Could not parse request"}},
+			problem.Validation(problem.CodeValidation, "Could not parse request"),
+		},
+		{
+			"order without buyer role",
+			http.MethodPost,
+			"/api/orders/create",
+			OrderReq{"1"},
+			map[string]string{"auth-jwt": sellerJWT},
+			http.StatusForbidden,
+			nil,
+			problem.Forbidden(middleware.CodeMissingRole, "Forbidden"),
+		},
+		{
+			"order with unverified email",
+			http.MethodPost,
+			"/api/orders/create",
+			OrderReq{"1"},
+			map[string]string{"auth-jwt": unverifiedJWT},
+			http.StatusForbidden,
+			nil,
+			problem.Forbidden(middleware.CodeUnverified, "Email is not verified"),
 		},
 		{
 			"order a non existent ticket",
@@ -174,7 +233,7 @@ func TestPostOrder(t *testing.T) {
 			map[string]string{"auth-jwt": testUserJWT},
 			http.StatusNotFound,
 			nil,
-			nil,
+			problem.NotFound("ticket_not_found", "could not find ticket: -1"),
 		},
 		{
 			"order a reserved ticket",
@@ -182,9 +241,9 @@ func TestPostOrder(t *testing.T) {
 			"/api/orders/create",
 			OrderReq{reservedTicket.Id},
 			map[string]string{"auth-jwt": testUserJWT},
-			http.StatusBadRequest,
+			http.StatusConflict,
 			nil,
-			&ErrorResp{[]string{"ticket already reserved"}},
+			problem.Conflict("ticket_reserved", "ticket already reserved"),
 		},
 		{
 			"order an available ticket",
@@ -198,6 +257,7 @@ func TestPostOrder(t *testing.T) {
 				allBalls,
 				availableTicket,
 				"1",
+				false,
 			},
 			nil,
 		},
@@ -214,7 +274,7 @@ func TestPublishOrderCreated(t *testing.T) {
 		t.Fatalf("unable to complete pre-test tasks: %v", err)
 	}
 
-	testUserJWT, err := middleware.NewUserClaims("foo@bar.com", "1").Tokenize(server.v)
+	testUserJWT, err := newTestJWT(server.v, "foo@bar.com", "1")
 	if err != nil {
 		t.Fatalf("unble to create test JWT: %v", err)
 	}
@@ -233,6 +293,7 @@ func TestPublishOrderCreated(t *testing.T) {
 				allBalls,
 				ticket,
 				"0",
+				false,
 			},
 			nil,
 		},
@@ -245,8 +306,11 @@ func TestPublishOrderCreated(t *testing.T) {
 	order, _ := fakeOC.read("0")
 	pbExpiresAt, _ := ptypes.TimestampProto(order.ExpiresAt)
 
-	// an event should have been published
-	// check our faked NATS conn (fakeStan) to verify this
+	// an event should have been saved to the outbox
+	// relay it and check our faked NATS conn (fakeStan) to verify this
+	if err := newRelay(fakeOC, fakeStan, relayInterval).relayPending(); err != nil {
+		t.Fatalf("relayPending: %v", err)
+	}
 	eventBytes := fakeStan.messages[orderCreatedSubject][0]
 	var got events.OrderCreated
 	if err := proto.Unmarshal(eventBytes, &got); err != nil {
@@ -278,11 +342,11 @@ func TestGetAnOrder(t *testing.T) {
 		t.Fatalf("unable to complete pre-test tasks: %v", err)
 	}
 
-	user1JWT, err := middleware.NewUserClaims("user1@example.com", "1").Tokenize(server.v)
+	user1JWT, err := newTestJWT(server.v, "user1@example.com", "1")
 	if err != nil {
 		t.Fatalf("unble to create test JWT: %v", err)
 	}
-	user2JWT, err := middleware.NewUserClaims("user2@example.com", "2").Tokenize(server.v)
+	user2JWT, err := newTestJWT(server.v, "user2@example.com", "2")
 	if err != nil {
 		t.Fatalf("unble to create test JWT: %v", err)
 	}
@@ -292,6 +356,7 @@ func TestGetAnOrder(t *testing.T) {
 
 	order1 := fakeOC.createWrapper("1", ticket1.Id, Created)
 	order2 := fakeOC.createWrapper("2", ticket2.Id, Created)
+	orphan := fakeOC.createWrapper("2", "unknown", Created)
 
 	tests := []test{
 		{
@@ -302,7 +367,7 @@ func TestGetAnOrder(t *testing.T) {
 			map[string]string{"auth-jwt": user1JWT},
 			http.StatusNotFound,
 			nil,
-			&ErrorResp{[]string{"no order found"}},
+			problem.NotFound("order_not_found", "no order found"),
 		},
 		{
 			"get someone elses order",
@@ -310,9 +375,9 @@ func TestGetAnOrder(t *testing.T) {
 			"/api/orders/" + order1.Id,
 			nil,
 			map[string]string{"auth-jwt": user2JWT},
-			http.StatusUnauthorized,
+			http.StatusForbidden,
 			nil,
-			&ErrorResp{[]string{"unauthorized"}},
+			problem.Forbidden("not_order_owner", "only the buyer can view an order"),
 		},
 		{
 			"get order",
@@ -326,6 +391,23 @@ func TestGetAnOrder(t *testing.T) {
 				order2.ExpiresAt,
 				ticket2,
 				order2.Id,
+				false,
+			},
+			nil,
+		},
+		{
+			"orders with a missing ticket are flagged",
+			http.MethodGet,
+			"/api/orders/" + orphan.Id,
+			nil,
+			map[string]string{"auth-jwt": user2JWT},
+			http.StatusOK,
+			OrderResp{
+				orphan.Status,
+				orphan.ExpiresAt,
+				Ticket{Id: "unknown"},
+				orphan.Id,
+				true,
 			},
 			nil,
 		},
@@ -342,15 +424,15 @@ func TestGetAllOrders(t *testing.T) {
 		t.Fatalf("unable to complete pre-test tasks: %v", err)
 	}
 
-	user1JWT, err := middleware.NewUserClaims("user1@example.com", "1").Tokenize(server.v)
+	user1JWT, err := newTestJWT(server.v, "user1@example.com", "1")
 	if err != nil {
 		t.Fatalf("unble to create test JWT: %v", err)
 	}
-	user2JWT, err := middleware.NewUserClaims("user2@example.com", "2").Tokenize(server.v)
+	user2JWT, err := newTestJWT(server.v, "user2@example.com", "2")
 	if err != nil {
 		t.Fatalf("unble to create test JWT: %v", err)
 	}
-	user3JWT, err := middleware.NewUserClaims("user3@example.com", "3").Tokenize(server.v)
+	user3JWT, err := newTestJWT(server.v, "user3@example.com", "3")
 	if err != nil {
 		t.Fatalf("unble to create test JWT: %v", err)
 	}
@@ -371,14 +453,15 @@ func TestGetAllOrders(t *testing.T) {
 			nil,
 			map[string]string{"auth-jwt": user1JWT},
 			http.StatusOK,
-			[]OrderResp{
+			OrdersPage{Orders: []OrderResp{
 				{
 					Created,
 					allBalls,
 					user1Ticket1,
 					user1Order1.Id,
+					false,
 				},
-			},
+			}},
 			nil,
 		},
 		{
@@ -388,20 +471,22 @@ func TestGetAllOrders(t *testing.T) {
 			nil,
 			map[string]string{"auth-jwt": user2JWT},
 			http.StatusOK,
-			[]OrderResp{
+			OrdersPage{Orders: []OrderResp{
 				{
 					Created,
 					allBalls,
 					user2Ticket1,
 					user2Order1.Id,
+					false,
 				},
 				{
 					Created,
 					allBalls,
 					user2Ticket2,
 					user2Order2.Id,
+					false,
 				},
-			},
+			}},
 			nil,
 		},
 		{
@@ -411,7 +496,7 @@ func TestGetAllOrders(t *testing.T) {
 			nil,
 			map[string]string{"auth-jwt": user3JWT},
 			http.StatusOK,
-			[]OrderResp{},
+			OrdersPage{Orders: []OrderResp{}},
 			nil,
 		},
 	}
@@ -421,13 +506,207 @@ func TestGetAllOrders(t *testing.T) {
 	}
 }
 
+func TestGetAllOrdersMissingTicket(t *testing.T) {
+	server, fakeTC, fakeOC, _, err := newTestInfra()
+	if err != nil {
+		t.Fatalf("unable to complete pre-test tasks: %v", err)
+	}
+
+	userJWT, err := newTestJWT(server.v, "user1@example.com", "1")
+	if err != nil {
+		t.Fatalf("unble to create test JWT: %v", err)
+	}
+
+	ticket1 := fakeTC.createWrapper("ticket1", 1.0, 1)
+	ticket2 := fakeTC.createWrapper("ticket2", 2.0, 1)
+	order1 := fakeOC.createWrapper("1", ticket1.Id, Created)
+	orphan := fakeOC.createWrapper("1", "unknown", Created)
+	order2 := fakeOC.createWrapper("1", ticket2.Id, Completed)
+	fakeTC.readCalls = 0
+
+	tests := []test{
+		{
+			"orders with a missing ticket are flagged",
+			http.MethodGet,
+			"/api/orders",
+			nil,
+			map[string]string{"auth-jwt": userJWT},
+			http.StatusOK,
+			OrdersPage{Orders: []OrderResp{
+				{Created, allBalls, ticket1, order1.Id, false},
+				{Created, allBalls, Ticket{Id: "unknown"}, orphan.Id, true},
+				{Completed, allBalls, ticket2, order2.Id, false},
+			}},
+			nil,
+		},
+	}
+	if err := runTest(tests, server.router, t); err != nil {
+		t.Fatalf("error running tests: %v", err)
+	}
+
+	// tickets should be fetched with one batched read rather than once per order
+	if got, want := fakeTC.readManyCalls, 1; got != want {
+		t.Errorf("readMany called %v times, want %v", got, want)
+	}
+	if got, want := fakeTC.readCalls, 0; got != want {
+		t.Errorf("read called %v times, want %v", got, want)
+	}
+}
+
+// readOrdersPage fetches a page of orders through the router
+func readOrdersPage(t *testing.T, router *gin.Engine, jwt, query string) (int, OrdersPage) {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/orders"+query, nil)
+	req.Header.Set("auth-jwt", jwt)
+	router.ServeHTTP(resp, req)
+
+	var page OrdersPage
+	if resp.Code == http.StatusOK {
+		if err := json.Unmarshal(resp.Body.Bytes(), &page); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+	}
+	return resp.Code, page
+}
+
+func orderIds(page OrdersPage) []string {
+	ids := make([]string, 0, len(page.Orders))
+	for _, order := range page.Orders {
+		ids = append(ids, order.Id)
+	}
+	return ids
+}
+
+func TestGetAllOrdersQuery(t *testing.T) {
+	server, fakeTC, fakeOC, _, err := newTestInfra()
+	if err != nil {
+		t.Fatalf("unable to complete pre-test tasks: %v", err)
+	}
+
+	userJWT, err := newTestJWT(server.v, "user1@example.com", "1")
+	if err != nil {
+		t.Fatalf("unble to create test JWT: %v", err)
+	}
+
+	ticket := fakeTC.createWrapper("many orders", 1.0, 1)
+	statuses := []orderStatus{Cancelled, Created, Completed, AwaitingPayment, Cancelled}
+	for i, status := range statuses {
+		order := fakeOC.createWrapper("1", ticket.Id, status)
+		// later orders expire sooner
+		order.ExpiresAt = allBalls.Add(time.Duration(len(statuses)-i) * time.Minute)
+		fakeOC.orders[order.Id] = order
+	}
+	// another user's order should never be returned
+	fakeOC.createWrapper("2", ticket.Id, Created)
+
+	t.Run("pages follow the next token", func(currTest *testing.T) {
+		var ids []string
+		query := "?limit=2"
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				currTest.Fatal("next token never ran out")
+			}
+			code, page := readOrdersPage(currTest, server.router, userJWT, query)
+			if code != http.StatusOK {
+				currTest.Fatalf("status code is %v, want %v", code, http.StatusOK)
+			}
+			ids = append(ids, orderIds(page)...)
+			if page.Next == "" {
+				break
+			}
+			query = "?limit=2&after=" + page.Next
+		}
+		if diff := cmp.Diff([]string{"0", "1", "2", "3", "4"}, ids); diff != "" {
+			currTest.Errorf("unexpected order ids: (-want, +got)\n%v", diff)
+		}
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"newest first", "?sort=-created", []string{"4", "3", "2", "1", "0"}},
+		{"expiring first", "?sort=expiresAt", []string{"4", "3", "2", "1", "0"}},
+		{"expiring last", "?sort=-expiresAt", []string{"0", "1", "2", "3", "4"}},
+		{"single status", "?status=Cancelled", []string{"0", "4"}},
+		{"active statuses", "?status=Created,AwaitingPayment", []string{"1", "3"}},
+		{"repeated status", "?status=Created&status=Completed", []string{"1", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			code, page := readOrdersPage(currTest, server.router, userJWT, tt.query)
+			if code != http.StatusOK {
+				currTest.Fatalf("status code is %v, want %v", code, http.StatusOK)
+			}
+			if diff := cmp.Diff(tt.want, orderIds(page)); diff != "" {
+				currTest.Errorf("unexpected order ids: (-want, +got)\n%v", diff)
+			}
+			if page.Next != "" {
+				currTest.Errorf("unexpected next token: %v", page.Next)
+			}
+		})
+	}
+
+	t.Run("sorted pages follow the next token", func(currTest *testing.T) {
+		_, first := readOrdersPage(currTest, server.router, userJWT, "?sort=expiresAt&limit=3")
+		_, second := readOrdersPage(currTest, server.router, userJWT, "?sort=expiresAt&limit=3&after="+first.Next)
+		ids := append(orderIds(first), orderIds(second)...)
+		if diff := cmp.Diff([]string{"4", "3", "2", "1", "0"}, ids); diff != "" {
+			currTest.Errorf("unexpected order ids: (-want, +got)\n%v", diff)
+		}
+	})
+
+	badQueries := []test{
+		{
+			"bad limit",
+			http.MethodGet,
+			"/api/orders?limit=1000",
+			nil,
+			map[string]string{"auth-jwt": userJWT},
+			http.StatusBadRequest,
+			nil,
+			problem.Validation(problem.CodeValidation, "query is not valid", problem.InvalidParam{Name: "limit", Reason: "limit must be a number between 1 and 100"}),
+		},
+		{
+			"bad status and sort",
+			http.MethodGet,
+			"/api/orders?status=Shipped&sort=price",
+			nil,
+			map[string]string{"auth-jwt": userJWT},
+			http.StatusBadRequest,
+			nil,
+			problem.Validation(problem.CodeValidation, "query is not valid",
+				problem.InvalidParam{Name: "status", Reason: "invalid status: Shipped"},
+				problem.InvalidParam{Name: "sort", Reason: "sort must be one of: created, -created, expiresAt, -expiresAt"}),
+		},
+		{
+			"bad cursor",
+			http.MethodGet,
+			"/api/orders?after=nope",
+			nil,
+			map[string]string{"auth-jwt": userJWT},
+			http.StatusBadRequest,
+			nil,
+			problem.Validation(problem.CodeValidation, "query is not valid", problem.InvalidParam{Name: "after", Reason: "invalid cursor"}),
+		},
+	}
+	if err := runTest(badQueries, server.router, t); err != nil {
+		t.Fatalf("error running tests: %v", err)
+	}
+}
+
 func TestCancelOrder(t *testing.T) {
 	server, fakeTC, fakeOC, _, err := newTestInfra()
 	if err != nil {
 		t.Fatalf("unable to init new server: %v", err)
 	}
 
-	testUserJWT, err := middleware.NewUserClaims("foo@bar.com", "1").Tokenize(server.v)
+	testUserJWT, err := newTestJWT(server.v, "foo@bar.com", "1")
+	if err != nil {
+		t.Fatalf("unble to create test JWT: %v", err)
+	}
+	adminJWT, err := newRoleJWT(server.v, "admin@bar.com", "2", middleware.RoleAdmin)
 	if err != nil {
 		t.Fatalf("unble to create test JWT: %v", err)
 	}
@@ -435,6 +714,7 @@ func TestCancelOrder(t *testing.T) {
 	user0Order := fakeOC.createWrapper("0", "0", Created)
 	user1Ticket := fakeTC.createWrapper("cancel me", 1.0, 1)
 	user1Order := fakeOC.createWrapper("1", user1Ticket.Id, Created)
+	paidOrder := fakeOC.createWrapper("1", "2", Completed)
 
 	// test various failure conditions as well as successful patch
 	patchTests := []test{
@@ -446,7 +726,7 @@ func TestCancelOrder(t *testing.T) {
 			map[string]string{"auth-jwt": testUserJWT},
 			http.StatusNotFound,
 			nil,
-			&ErrorResp{[]string{"order not found"}},
+			problem.NotFound("order_not_found", "order not found"),
 		},
 		{
 			"cancel a different users order",
@@ -454,9 +734,29 @@ func TestCancelOrder(t *testing.T) {
 			"/api/orders/" + user0Order.Id,
 			nil,
 			map[string]string{"auth-jwt": testUserJWT},
-			http.StatusUnauthorized,
+			http.StatusForbidden,
 			nil,
-			&ErrorResp{[]string{"unauthorized"}},
+			problem.Forbidden("not_order_owner", "only the buyer can cancel an order"),
+		},
+		{
+			"admin cancels a different users order",
+			http.MethodPatch,
+			"/api/orders/" + user0Order.Id,
+			nil,
+			map[string]string{"auth-jwt": adminJWT},
+			http.StatusNoContent,
+			nil,
+			nil,
+		},
+		{
+			"cancel a paid order",
+			http.MethodPatch,
+			"/api/orders/" + paidOrder.Id,
+			nil,
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusConflict,
+			nil,
+			problem.Conflict("order_paid", "cannot cancel an order that has been paid for"),
 		},
 		{
 			"cancel an order",
@@ -468,6 +768,16 @@ func TestCancelOrder(t *testing.T) {
 			nil,
 			nil,
 		},
+		{
+			"cancel an order twice",
+			http.MethodPatch,
+			"/api/orders/" + user1Order.Id,
+			nil,
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusNoContent,
+			nil,
+			nil,
+		},
 	}
 
 	if err := runTest(patchTests, server.router, t); err != nil {
@@ -488,6 +798,7 @@ func TestCancelOrder(t *testing.T) {
 				allBalls,
 				user1Ticket,
 				user1Order.Id,
+				false,
 			},
 			nil,
 		},
@@ -504,7 +815,7 @@ func TestPublishOrderCancelled(t *testing.T) {
 		t.Fatalf("unable to complete pre-test tasks: %v", err)
 	}
 
-	testUserJWT, err := middleware.NewUserClaims("foo@bar.com", "1").Tokenize(server.v)
+	testUserJWT, err := newTestJWT(server.v, "foo@bar.com", "1")
 	if err != nil {
 		t.Fatalf("unble to create test JWT: %v", err)
 	}
@@ -529,8 +840,11 @@ func TestPublishOrderCancelled(t *testing.T) {
 		t.Fatalf("error running tests: %v", err)
 	}
 
-	// an event should have been published
-	// check our faked NATS conn (fakeStan) to verify this
+	// an event should have been saved to the outbox
+	// relay it and check our faked NATS conn (fakeStan) to verify this
+	if err := newRelay(fakeOC, fakeStan, relayInterval).relayPending(); err != nil {
+		t.Fatalf("relayPending: %v", err)
+	}
 	eventBytes := fakeStan.messages[orderCancelledSubject][0]
 	var got events.OrderCancelled
 	if err := proto.Unmarshal(eventBytes, &got); err != nil {
@@ -8,4 +8,4 @@ go vet
 go test
 
 version=0.0.2
-docker build -t  basilnsage/mwn-ticketapp.orders:"$version" -t basilnsage/mwn-ticketapp.orders:latest .
+docker build -t  basilnsage/mwn-ticketapp.orders:"$version" -t basilnsage/mwn-ticketapp.orders:latest -f Dockerfile ..
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+
 	"github.com/basilnsage/mwn-ticketapp-common/events"
 	"github.com/basilnsage/mwn-ticketapp-common/subjects"
 	"github.com/golang/protobuf/ptypes"
@@ -55,3 +57,36 @@ func marshalOrderCancelled(ticket Ticket, order Order) ([]byte, error) {
 	}
 	return cancelledEventBytes, nil
 }
+
+func ticketFromProto(data []byte) (*Ticket, error) {
+	var ticketEvent events.CreateUpdateTicket
+	if err := proto.Unmarshal(data, &ticketEvent); err != nil {
+		return nil, err
+	}
+
+	return &Ticket{
+		Title:   ticketEvent.Title,
+		Price:   ticketEvent.Price,
+		Version: uint(ticketEvent.Version),
+		Id:      ticketEvent.Id,
+	}, nil
+}
+
+func orderIdFromExpirationComplete(data []byte) (string, error) {
+	var completeEvent events.ExpirationComplete
+	if err := proto.Unmarshal(data, &completeEvent); err != nil {
+		return "", err
+	}
+	return completeEvent.OrderId, nil
+}
+
+func orderIdFromPaymentCreated(data []byte) (string, error) {
+	var createdEvent events.PaymentCreated
+	if err := proto.Unmarshal(data, &createdEvent); err != nil {
+		return "", err
+	}
+	if createdEvent.Data == nil {
+		return "", errors.New("payment created event is missing payment data")
+	}
+	return createdEvent.Data.OrderId, nil
+}
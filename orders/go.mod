@@ -4,8 +4,8 @@ go 1.15
 
 require (
 	github.com/aws/aws-sdk-go v1.36.7 // indirect
-	github.com/basilnsage/mwn-ticketapp-common v0.0.0-20210214000111-67ba022dfe22
-	github.com/basilnsage/mwn-ticketapp/middleware v0.0.0-20201222181933-7a8953a61d59
+	github.com/basilnsage/mwn-ticketapp-common v0.0.0-00010101000000-000000000000
+	github.com/basilnsage/mwn-ticketapp/middleware v0.0.0-00010101000000-000000000000
 	github.com/basilnsage/prometheus-gin-metrics v0.1.0-alpha
 	github.com/gin-gonic/gin v1.6.3
 	github.com/golang/protobuf v1.4.3
@@ -28,3 +28,8 @@ require (
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
 )
+
+replace (
+	github.com/basilnsage/mwn-ticketapp-common => ../common
+	github.com/basilnsage/mwn-ticketapp/middleware => ../middleware
+)
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp/middleware/listen"
+	"github.com/nats-io/stan.go"
+)
+
+const (
+	queueGroup   = "orders-service"
+	eventAckWait = 30 * time.Second
+)
+
+type listener struct {
+	tc   ticketsCRUD
+	oc   ordersCRUD
+	eBus stan.Conn
+}
+
+func newListener(tc ticketsCRUD, oc ordersCRUD, eBus stan.Conn) (*listener, error) {
+	if err := setTicketSubjects(); err != nil {
+		return nil, fmt.Errorf("unable to set NATS subjects: %v", err)
+	}
+	if err := setExpirationComplete(&expirationCompleteSubject); err != nil {
+		return nil, fmt.Errorf("unable to set NATS subjects: %v", err)
+	}
+	if err := setPaymentCreated(&paymentCreatedSubject); err != nil {
+		return nil, fmt.Errorf("unable to set NATS subjects: %v", err)
+	}
+	if err := setOrderSubjects(); err != nil {
+		return nil, fmt.Errorf("unable to set NATS subjects: %v", err)
+	}
+
+	return &listener{
+		tc,
+		oc,
+		eBus,
+	}, nil
+}
+
+// listen subscribes to every subject the orders service consumes
+func (l *listener) listen() error {
+	handlers := map[string]listen.Handler{
+		ticketCreatedSubject:      l.onTicketCreated,
+		ticketUpdatedSubject:      l.onTicketUpdated,
+		expirationCompleteSubject: l.onExpirationComplete,
+		paymentCreatedSubject:     l.onPaymentCreated,
+	}
+
+	subscriber := listen.Subscriber{Group: queueGroup, AckWait: eventAckWait, Info: InfoLogger, Error: ErrorLogger}
+	return subscriber.Listen(l.eBus, handlers)
+}
+
+func (l *listener) onTicketCreated(data []byte) error {
+	ticket, err := ticketFromProto(data)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal ticket: %v", err)
+	}
+
+	tid, err := l.tc.create(*ticket)
+	if err != nil {
+		return fmt.Errorf("unable to save ticket: %v", err)
+	}
+	InfoLogger.Printf("saved ticket with id: %v", tid)
+
+	return nil
+}
+
+func (l *listener) onTicketUpdated(data []byte) error {
+	ticket, err := ticketFromProto(data)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal ticket: %v", err)
+	}
+
+	ok, err := l.tc.update(*ticket)
+	if err != nil {
+		return fmt.Errorf("unable to update ticket: %v", err)
+	}
+	if ok {
+		InfoLogger.Printf("updated ticket with id: %v, version: %v", ticket.Id, ticket.Version)
+		return nil
+	}
+
+	// the update was not applied, figure out if the event is a duplicate or arrived out of order
+	stored, err := l.tc.read(ticket.Id)
+	if err != nil {
+		return fmt.Errorf("unable to read ticket: %v", err)
+	}
+	if stored != nil && stored.Version >= ticket.Version {
+		// already applied, ack so the duplicate is not redelivered
+		InfoLogger.Printf("ignoring stale update for ticket: %v, version: %v, stored version: %v", ticket.Id, ticket.Version, stored.Version)
+		return nil
+	}
+	// an earlier version has not been processed yet, do not ack and wait for redelivery
+	return fmt.Errorf("out of order update for ticket: %v, version: %v", ticket.Id, ticket.Version)
+}
+
+// onExpirationComplete cancels the order unless it was already paid for or cancelled
+func (l *listener) onExpirationComplete(data []byte) error {
+	oid, err := orderIdFromExpirationComplete(data)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal expiration complete event: %v", err)
+	}
+
+	order, err := l.oc.read(oid)
+	if err != nil {
+		return fmt.Errorf("unable to read order: %v", err)
+	}
+	if order == nil {
+		// nothing to expire, ack so the event is not redelivered forever
+		ErrorLogger.Printf("expiration complete for unknown order: %v", oid)
+		return nil
+	}
+	if !order.Status.in(activeStatuses) {
+		InfoLogger.Printf("order %v is %v, ignoring expiration", oid, order.Status)
+		return nil
+	}
+
+	order.Status = Cancelled
+	eventBytes, err := marshalOrderCancelled(Ticket{Id: order.TicketId}, *order)
+	if err != nil {
+		return fmt.Errorf("unable to marshal orderCancelled event: %v", err)
+	}
+	ok, err := l.oc.update(oid, *order, activeStatuses, newOutboxEvent(orderCancelledSubject, eventBytes))
+	if err != nil {
+		return fmt.Errorf("unable to update order: %v", err)
+	}
+	if !ok {
+		// the order was paid for or cancelled since it was read, it must keep its reservation if it was paid for
+		InfoLogger.Printf("order %v is no longer active, ignoring expiration", oid)
+		return nil
+	}
+	InfoLogger.Printf("cancelled expired order: %v", oid)
+
+	return nil
+}
+
+// onPaymentCreated marks the order as paid for
+// payments for cancelled orders are refused, their ticket may already be reserved by another order
+func (l *listener) onPaymentCreated(data []byte) error {
+	oid, err := orderIdFromPaymentCreated(data)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal payment created event: %v", err)
+	}
+
+	order, err := l.oc.read(oid)
+	if err != nil {
+		return fmt.Errorf("unable to read order: %v", err)
+	}
+	if order == nil {
+		ErrorLogger.Printf("payment created for unknown order: %v", oid)
+		return nil
+	}
+	if !order.Status.in(activeStatuses) {
+		refusePayment(*order, oid)
+		return nil
+	}
+
+	order.Status = Completed
+	ok, err := l.oc.update(oid, *order, activeStatuses)
+	if err != nil {
+		return fmt.Errorf("unable to update order: %v", err)
+	}
+	if !ok {
+		// the order was paid for or cancelled since it was read
+		if order, err = l.oc.read(oid); err != nil {
+			return fmt.Errorf("unable to read order: %v", err)
+		} else if order != nil {
+			refusePayment(*order, oid)
+		}
+		return nil
+	}
+	InfoLogger.Printf("completed paid order: %v", oid)
+
+	return nil
+}
+
+// refusePayment flags a payment for an order that is no longer active
+// a payment for a cancelled order has to be refunded, a payment for a completed order is a duplicate event
+func refusePayment(order Order, oid string) {
+	if order.Status == Cancelled {
+		ErrorLogger.Printf("refusing payment for cancelled order %v, the charge must be refunded", oid)
+		return
+	}
+	InfoLogger.Printf("order %v is %v, ignoring payment", oid, order.Status)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestListener() (*listener, *fakeTicketsCollection, *fakeOrdersCollection, *fakeNatsConn, error) {
+	fakeTC := newFakeTicketsCollection()
+	fakeOC := newFakeOrdersCollection()
+	fakeStan := newFakeNatsConn()
+	l, err := newListener(fakeTC, fakeOC, fakeStan)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return l, fakeTC, fakeOC, fakeStan, nil
+}
+
+func marshalTicketEvent(t *testing.T, title string, price float64, version uint32, id string) []byte {
+	b, err := proto.Marshal(&events.CreateUpdateTicket{
+		Title:   title,
+		Price:   price,
+		Id:      id,
+		Owner:   "1",
+		Version: version,
+	})
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+	return b
+}
+
+func TestNewListener(t *testing.T) {
+	if _, _, _, _, err := newTestListener(); err != nil {
+		t.Fatalf("newListener: %v", err)
+	}
+	if ticketCreatedSubject == "" {
+		t.Fatal("ticketCreatedSubject is empty")
+	}
+	if ticketUpdatedSubject == "" {
+		t.Fatal("ticketUpdatedSubject is empty")
+	}
+	if expirationCompleteSubject == "" {
+		t.Fatal("expirationCompleteSubject is empty")
+	}
+}
+
+func TestOnTicketCreated(t *testing.T) {
+	l, fakeTC, _, _, err := newTestListener()
+	if err != nil {
+		t.Fatalf("unable to complete pre-test tasks: %v", err)
+	}
+
+	tid := "5f47ec2c86ed3ef991cdfd94"
+	if err := l.onTicketCreated(marshalTicketEvent(t, "new ticket", 10.0, 0, tid)); err != nil {
+		t.Fatalf("onTicketCreated: %v", err)
+	}
+
+	got, _ := fakeTC.read(tid)
+	if got == nil {
+		t.Fatalf("ticket %v was not saved", tid)
+	}
+	want := Ticket{Title: "new ticket", Price: 10.0, Id: tid}
+	if diff := cmp.Diff(want, *got); diff != "" {
+		t.Fatalf("saved ticket: (-want +got)\n%v", diff)
+	}
+
+	if err := l.onTicketCreated([]byte("not a proto")); err == nil {
+		t.Fatal("onTicketCreated should fail on a malformed event")
+	}
+}
+
+func TestOnTicketUpdated(t *testing.T) {
+	l, fakeTC, _, _, err := newTestListener()
+	if err != nil {
+		t.Fatalf("unable to complete pre-test tasks: %v", err)
+	}
+
+	tid := "5f47ec2c86ed3ef991cdfd94"
+	if err := l.onTicketCreated(marshalTicketEvent(t, "new ticket", 10.0, 0, tid)); err != nil {
+		t.Fatalf("onTicketCreated: %v", err)
+	}
+
+	// version 2 arrives before version 1 and must not be applied or acked
+	if err := l.onTicketUpdated(marshalTicketEvent(t, "second update", 30.0, 2, tid)); err == nil {
+		t.Fatal("onTicketUpdated should fail on an out of order update")
+	}
+	if err := l.onTicketUpdated(marshalTicketEvent(t, "first update", 20.0, 1, tid)); err != nil {
+		t.Fatalf("onTicketUpdated: %v", err)
+	}
+	// redelivered version 2 now applies
+	if err := l.onTicketUpdated(marshalTicketEvent(t, "second update", 30.0, 2, tid)); err != nil {
+		t.Fatalf("onTicketUpdated: %v", err)
+	}
+	// duplicate version 1 is acked without being applied
+	if err := l.onTicketUpdated(marshalTicketEvent(t, "first update", 20.0, 1, tid)); err != nil {
+		t.Fatalf("onTicketUpdated should ignore a duplicate update: %v", err)
+	}
+	// a redelivered created event must not roll the ticket back
+	if err := l.onTicketCreated(marshalTicketEvent(t, "new ticket", 10.0, 0, tid)); err != nil {
+		t.Fatalf("onTicketCreated: %v", err)
+	}
+
+	got, _ := fakeTC.read(tid)
+	if got == nil {
+		t.Fatalf("ticket %v was not saved", tid)
+	}
+	want := Ticket{Title: "second update", Price: 30.0, Version: 2, Id: tid}
+	if diff := cmp.Diff(want, *got); diff != "" {
+		t.Fatalf("updated ticket: (-want +got)\n%v", diff)
+	}
+}
+
+func TestOnExpirationComplete(t *testing.T) {
+	l, _, fakeOC, fakeStan, err := newTestListener()
+	if err != nil {
+		t.Fatalf("unable to complete pre-test tasks: %v", err)
+	}
+
+	created := fakeOC.createWrapper("1", "1", Created)
+	awaitingPayment := fakeOC.createWrapper("1", "2", AwaitingPayment)
+	completed := fakeOC.createWrapper("1", "3", Completed)
+
+	tests := []struct {
+		name       string
+		orderId    string
+		wantStatus orderStatus
+	}{
+		{"expire a created order", created.Id, Cancelled},
+		{"expire an order awaiting payment", awaitingPayment.Id, Cancelled},
+		{"expire a completed order", completed.Id, Completed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(currTest *testing.T) {
+			b, err := proto.Marshal(&events.ExpirationComplete{
+				Subject: subjects.Subject_EXPIRATION_COMPLETE,
+				OrderId: test.orderId,
+			})
+			if err != nil {
+				currTest.Fatalf("proto.Marshal: %v", err)
+			}
+			if err := l.onExpirationComplete(b); err != nil {
+				currTest.Fatalf("onExpirationComplete: %v", err)
+			}
+			order, _ := fakeOC.read(test.orderId)
+			if got, want := order.Status, test.wantStatus; got != want {
+				currTest.Fatalf("order status is %v, want %v", got, want)
+			}
+		})
+	}
+
+	// only the two orders that were cancelled should publish an event
+	if err := newRelay(fakeOC, fakeStan, relayInterval).relayPending(); err != nil {
+		t.Fatalf("relayPending: %v", err)
+	}
+	if got, want := len(fakeStan.messages[orderCancelledSubject]), 2; got != want {
+		t.Fatalf("published %v order cancelled events, want %v", got, want)
+	}
+}
+
+// staleOrders reads orders as they were before a concurrent write
+type staleOrders struct {
+	*fakeOrdersCollection
+	stale map[string]Order
+}
+
+func (s staleOrders) read(id string) (*Order, error) {
+	order := s.stale[id]
+	return &order, nil
+}
+
+func TestOnExpirationCompletePaidConcurrently(t *testing.T) {
+	fakeOC := newFakeOrdersCollection()
+	order := fakeOC.createWrapper("1", "1", AwaitingPayment)
+	oc := staleOrders{fakeOC, map[string]Order{order.Id: order}}
+	// the order is paid for after the listener reads it
+	paid := order
+	paid.Status = Completed
+	fakeOC.orders[order.Id] = paid
+
+	l, err := newListener(newFakeTicketsCollection(), oc, newFakeNatsConn())
+	if err != nil {
+		t.Fatalf("newListener: %v", err)
+	}
+	b, err := proto.Marshal(&events.ExpirationComplete{
+		Subject: subjects.Subject_EXPIRATION_COMPLETE,
+		OrderId: order.Id,
+	})
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+	if err := l.onExpirationComplete(b); err != nil {
+		t.Fatalf("onExpirationComplete: %v", err)
+	}
+
+	got, _ := fakeOC.read(order.Id)
+	if got, want := got.Status, Completed; got != want {
+		t.Fatalf("order status is %v, want %v", got, want)
+	}
+	if got := len(fakeOC.outbox); got != 0 {
+		t.Fatalf("saved %v events for a paid order", got)
+	}
+}
+
+func marshalPaymentCreated(t *testing.T, orderId string) []byte {
+	b, err := proto.Marshal(&events.PaymentCreated{
+		Subject: subjects.Subject_PAYMENT_CREATED,
+		Data: &events.PaymentData{
+			Id:       "1",
+			OrderId:  orderId,
+			ChargeId: "ch_1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+	return b
+}
+
+func TestOnPaymentCreated(t *testing.T) {
+	l, _, fakeOC, _, err := newTestListener()
+	if err != nil {
+		t.Fatalf("unable to complete pre-test tasks: %v", err)
+	}
+
+	created := fakeOC.createWrapper("1", "1", Created)
+	awaitingPayment := fakeOC.createWrapper("1", "2", AwaitingPayment)
+	completed := fakeOC.createWrapper("1", "3", Completed)
+	cancelled := fakeOC.createWrapper("1", "4", Cancelled)
+
+	tests := []struct {
+		name       string
+		orderId    string
+		wantStatus orderStatus
+	}{
+		{"pay for a created order", created.Id, Completed},
+		{"pay for an order awaiting payment", awaitingPayment.Id, Completed},
+		{"pay for a completed order again", completed.Id, Completed},
+		{"pay for a cancelled order", cancelled.Id, Cancelled},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(currTest *testing.T) {
+			if err := l.onPaymentCreated(marshalPaymentCreated(currTest, test.orderId)); err != nil {
+				currTest.Fatalf("onPaymentCreated: %v", err)
+			}
+			order, _ := fakeOC.read(test.orderId)
+			if got, want := order.Status, test.wantStatus; got != want {
+				currTest.Fatalf("order status is %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestOnPaymentCreatedCancelledConcurrently(t *testing.T) {
+	fakeOC := newFakeOrdersCollection()
+	order := fakeOC.createWrapper("1", "1", AwaitingPayment)
+	oc := staleOrders{fakeOC, map[string]Order{order.Id: order}}
+	// the order is cancelled after the listener reads it
+	cancelled := order
+	cancelled.Status = Cancelled
+	fakeOC.orders[order.Id] = cancelled
+
+	l, err := newListener(newFakeTicketsCollection(), oc, newFakeNatsConn())
+	if err != nil {
+		t.Fatalf("newListener: %v", err)
+	}
+	if err := l.onPaymentCreated(marshalPaymentCreated(t, order.Id)); err != nil {
+		t.Fatalf("onPaymentCreated: %v", err)
+	}
+
+	got, _ := fakeOC.read(order.Id)
+	if got, want := got.Status, Cancelled; got != want {
+		t.Fatalf("order status is %v, want %v", got, want)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/basilnsage/mwn-ticketapp/middleware"
 	"github.com/gin-gonic/gin"
 	"github.com/nats-io/stan.go"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -36,12 +37,13 @@ func init() {
 
 type groupCloser struct {
 	httpServer  *http.Server
+	relay       *relay
 	stan        stan.Conn
 	mongoClient *mongo.Client
 }
 
 func (gc groupCloser) shutdown(code int) {
-	// shutdown order: gin -> nats -> mongo
+	// shutdown order: gin -> outbox relay -> nats -> mongo
 	// allow 90 seconds for everything to shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
 	defer cancel()
@@ -53,6 +55,11 @@ func (gc groupCloser) shutdown(code int) {
 		}
 	}
 
+	InfoLogger.Print("stopping the outbox relay")
+	if gc.relay != nil {
+		gc.relay.stop()
+	}
+
 	InfoLogger.Print("shutting down the NATS connection")
 	if gc.stan != nil {
 		if err := gc.stan.Close(); err != nil {
@@ -78,7 +85,7 @@ func genMainConfig() (mainConfig, []string) {
 	conf := mainConfig{}
 	envToErrString := map[string]string{
 		"MONGO_CONN_STR":  "missing mongo connection: MONGO_CONN_STR",
-		"JWT_SIGN_KEY":    "missing JWT HS256 signing key: JWT_SIGN_KEY",
+		"JWKS_URL":        "missing auth JWKS endpoint: JWKS_URL",
 		"NATS_CLUSTER_ID": "missing NATS cluster ID: NATS_CLUSTER_ID",
 		"NATS_CLIENT_ID":  "missing NATS client ID: NATS_CLIENT_ID",
 		"NATS_CONN_STR":   "missing NATS connection string: NATS_CONN_STR",
@@ -128,6 +135,14 @@ func main() {
 
 	tc := newTicketCollection(db.Collection(ticketCollectionName), dbTimeout)
 	oc := newOrdersCollection(db.Collection(ordersCollectionName), dbTimeout)
+	if err := createOrderIndexes(db.Collection(ordersCollectionName), dbTimeout); err != nil {
+		ErrorLogger.Printf("unable to create orders indexes: %v", err)
+		gc.shutdown(1)
+	}
+	if err := createOutboxIndexes(db.Collection(outboxCollectionName), dbTimeout); err != nil {
+		ErrorLogger.Printf("unable to create outbox indexes: %v", err)
+		gc.shutdown(1)
+	}
 
 	// init NATS Streaming Server connection
 	natsClient, err := stan.Connect(conf["NATS_CLUSTER_ID"], conf["NATS_CLIENT_ID"], stan.NatsURL(conf["NATS_CONN_STR"]))
@@ -138,10 +153,37 @@ func main() {
 	InfoLogger.Print("connected to NATS Streaming Server")
 	gc.stan = natsClient
 
+	// publish order events saved to the outbox
+	outboxRelay := newRelay(newOutboxCollection(db.Collection(outboxCollectionName), dbTimeout), natsClient, relayInterval)
+	outboxRelay.start()
+	gc.relay = outboxRelay
+
+	// listen for events published by other services
+	eventListener, err := newListener(tc, oc, natsClient)
+	if err != nil {
+		ErrorLogger.Printf("could not create event listener: %v", err)
+		gc.shutdown(1)
+		return
+	}
+	if err := eventListener.listen(); err != nil {
+		ErrorLogger.Printf("could not subscribe to events: %v", err)
+		gc.shutdown(1)
+	}
+
+	// reject tokens revoked by the auth service
+	revoked := middleware.NewRevocationCache()
+	if err := revoked.ListenRevocations(natsClient, ErrorLogger); err != nil {
+		ErrorLogger.Printf("could not subscribe to token revocations: %v", err)
+		gc.shutdown(1)
+	}
+
+	// session tokens are signed by the auth service; only verify them here
+	jwtValidator := middleware.NewJWKSValidator(conf["JWKS_URL"], middleware.DefaultJWKSRefresh)
+
 	// create gin router and bind handlers/routes to it
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
-	server, err := newApiServer(conf["JWT_SIGN_KEY"], 15*time.Minute, r, tc, oc, natsClient)
+	server, err := newApiServer(jwtValidator, 15*time.Minute, r, tc, oc, revoked, middleware.DefaultTokenSources())
 	if err != nil {
 		ErrorLogger.Printf("could not create new API server")
 		gc.shutdown(1)
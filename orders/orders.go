@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -25,22 +27,38 @@ type OrderReq struct {
 	TicketId string `json:"ticketId"`
 }
 
+// TicketMissing is set when the order's ticket could not be found
+// Ticket then only carries the ticket id
 type OrderResp struct {
-	Status    orderStatus
-	ExpiresAt time.Time
-	Ticket    Ticket
-	Id        string
+	Status        orderStatus
+	ExpiresAt     time.Time
+	Ticket        Ticket
+	Id            string
+	TicketMissing bool `json:",omitempty"`
 }
 
+type OrdersPage struct {
+	Orders []OrderResp `json:"orders"`
+	Next   string      `json:"next"`
+}
+
+// alreadyReservedError is returned by reserve when another active order holds the ticket
+type alreadyReservedError struct {
+	ticketId string
+}
+
+func (e alreadyReservedError) Error() string {
+	return fmt.Sprintf("ticket already reserved: %v", e.ticketId)
+}
+
+// order writes also save the events describing the change to the outbox
 type ordersCRUD interface {
-	create(Order) (string, error)
+	reserve(Order, eventBuilder) (string, error)
 	read(string) (*Order, error)
-	search(int64, []string, []string, []orderStatus) ([]Order, error)
-	update(string, Order) (bool, error)
+	search(orderSearch) ([]Order, string, error)
+	update(string, Order, []orderStatus, ...outboxEvent) (bool, error)
 }
 
-//func (o ordersCollection) searchBy(limit int64, ticketIds, userIds []string, statuses []orderStatus) ([]Order, error) {
-
 type ordersCollection struct {
 	collection *mongo.Collection
 	timeout    time.Duration
@@ -53,16 +71,128 @@ func newOrdersCollection(collection *mongo.Collection, timeout time.Duration) or
 	}
 }
 
-func (o ordersCollection) create(order Order) (string, error) {
+// reservationIndex makes reservation atomic: only one order document may hold a given ticket
+// the reservation field is present on active and paid orders and is unset on cancellation
+var reservationIndex = mongo.IndexModel{
+	Keys: bson.M{"reservation": 1},
+	Options: options.Index().
+		SetName("active_ticket_reservation").
+		SetUnique(true).
+		SetPartialFilterExpression(bson.M{"reservation": bson.M{"$exists": true}}),
+}
+
+// createOrderIndexes backfills the reservation of orders saved before reservations existed, then indexes it
+// the index only covers documents with the field, so without the backfill those orders' tickets could be reserved again
+// the index cannot be built while a ticket is held by more than one order, those have to be cancelled by hand first
+func createOrderIndexes(collection *mongo.Collection, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if _, err := collection.UpdateMany(ctx, unreservedFilter(), backfillReservation); err != nil {
+		return fmt.Errorf("unable to backfill reservations: %v", err)
+	}
+
+	cursor, err := collection.Aggregate(ctx, duplicateReservations)
+	if err != nil {
+		return fmt.Errorf("unable to look for duplicate reservations: %v", err)
+	}
+	var conflicts []reservationConflict
+	if err := cursor.All(ctx, &conflicts); err != nil {
+		return fmt.Errorf("unable to look for duplicate reservations: %v", err)
+	}
+	if len(conflicts) > 0 {
+		return reservationConflictsError(conflicts)
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, reservationIndex)
+	return err
+}
+
+// duplicateReservations groups the orders of every ticket held by more than one order, oldest first
+var duplicateReservations = mongo.Pipeline{
+	{{Key: "$match", Value: bson.M{"reservation": bson.M{"$exists": true}}}},
+	{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	{{Key: "$group", Value: bson.M{"_id": "$reservation", "orders": bson.M{"$push": "$_id"}}}},
+	{{Key: "$match", Value: bson.M{"orders.1": bson.M{"$exists": true}}}},
+}
+
+// reservationConflict is a ticket held by more than one order
+type reservationConflict struct {
+	TicketId string               `bson:"_id"`
+	Orders   []primitive.ObjectID `bson:"orders"`
+}
+
+func reservationConflictsError(conflicts []reservationConflict) error {
+	details := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		ids := make([]string, len(c.Orders))
+		for j, id := range c.Orders {
+			ids[j] = id.Hex()
+		}
+		details[i] = fmt.Sprintf("ticket %v: orders %v", c.TicketId, strings.Join(ids, ", "))
+	}
+	return fmt.Errorf("%v tickets are held by more than one order, cancel all but one order of each before starting: %v", len(conflicts), strings.Join(details, "; "))
+}
+
+// unreservedFilter matches the orders that hold their ticket but have no reservation
+func unreservedFilter() bson.M {
+	return bson.M{
+		"status":      bson.M{"$in": statusStrings(append([]orderStatus{Completed}, activeStatuses...))},
+		"reservation": bson.M{"$exists": false},
+	}
+}
+
+// backfillReservation reserves an order's ticket
+var backfillReservation = mongo.Pipeline{{{Key: "$set", Value: bson.M{"reservation": "$ticketId"}}}}
+
+// reserve saves the order and reserves its ticket in a single write
+// if another active order already holds the ticket an alreadyReservedError is returned
+// the event built by newEvent is saved to the outbox in the same transaction
+func (o ordersCollection) reserve(order Order, newEvent eventBuilder) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
 	defer cancel()
 
-	res, err := o.collection.InsertOne(ctx, order)
+	// generate the id up front so the event can reference the order
+	mongoId := primitive.NewObjectID()
+	event, err := newEvent(mongoId.Hex())
 	if err != nil {
 		return "", err
 	}
 
-	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+	doc := bson.M{
+		"_id":         mongoId,
+		"userId":      order.UserId,
+		"status":      order.Status,
+		"expiresAt":   order.ExpiresAt,
+		"ticketId":    order.TicketId,
+		"reservation": order.TicketId,
+	}
+	err = withTransaction(ctx, o.collection, func(sc mongo.SessionContext) error {
+		if _, err := o.collection.InsertOne(sc, doc); err != nil {
+			return err
+		}
+		return insertEvents(sc, o.collection, event)
+	})
+	if isDuplicateKeyError(err) {
+		return "", alreadyReservedError{order.TicketId}
+	} else if err != nil {
+		return "", err
+	}
+
+	return mongoId.Hex(), nil
+}
+
+func isDuplicateKeyError(err error) bool {
+	var we mongo.WriteException
+	if !errors.As(err, &we) {
+		return false
+	}
+	for _, e := range we.WriteErrors {
+		if e.Code == 11000 {
+			return true
+		}
+	}
+	return false
 }
 
 func (o ordersCollection) read(id string) (*Order, error) {
@@ -76,7 +206,7 @@ func (o ordersCollection) read(id string) (*Order, error) {
 
 	res := o.collection.FindOne(ctx, bson.M{"_id": mongoId})
 	if res.Err() != nil && res.Err() != mongo.ErrNoDocuments {
-		return nil, err
+		return nil, res.Err()
 	} else if res.Err() == mongo.ErrNoDocuments {
 		return nil, nil
 	}
@@ -89,49 +219,92 @@ func (o ordersCollection) read(id string) (*Order, error) {
 	return &order, nil
 }
 
-func (o ordersCollection) search(limit int64, ticketIds, userIds []string, statuses []orderStatus) ([]Order, error) {
-	filter := bson.M{}
-
-	if len(ticketIds) == 1 {
-		filter["ticketId"] = ticketIds[0]
-	} else if len(ticketIds) > 1 {
-		filter["ticketId"] = bson.M{"$in": ticketIds}
+// search returns a page of orders and the token for the next page
+// pages are keyed on the sort field and the order id so results stay stable as orders are added
+func (o ordersCollection) search(query orderSearch) ([]Order, string, error) {
+	filter, err := orderFilter(query)
+	if err != nil {
+		return nil, "", err
 	}
 
-	if len(userIds) == 1 {
-		filter["userId"] = userIds[0]
-	} else if len(userIds) > 1 {
-		filter["userId"] = bson.M{"$in": userIds}
+	// ObjectIDs start with their creation time, so sorting by _id sorts by creation time
+	direction := 1
+	if query.descending() {
+		direction = -1
 	}
-
-	if len(statuses) == 1 {
-		filter["status"] = statuses[0].String()
-	} else if len(statuses) > 1 {
-		var statusStrings []string
-		for _, s := range statuses {
-			statusStrings = append(statusStrings, s.String())
-		}
-		filter["status"] = bson.M{"$in": statusStrings}
+	sort := bson.D{{Key: "_id", Value: direction}}
+	if query.byExpiresAt() {
+		sort = bson.D{{Key: "expiresAt", Value: direction}, {Key: "_id", Value: direction}}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
 	defer cancel()
 
-	cursor, err := o.collection.Find(ctx, filter, &options.FindOptions{Limit: &limit})
+	// read one extra order to find out if there is another page
+	opts := options.Find().SetSort(sort).SetLimit(query.limit + 1)
+	cursor, err := o.collection.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	var orders []Order
 	if err := cursor.All(ctx, &orders); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return orders, nil
+	orders, next := nextToken(orders, query.limit)
+	return orders, next, nil
+}
+
+func orderFilter(query orderSearch) (bson.M, error) {
+	filter := bson.M{}
+
+	if len(query.ticketIds) == 1 {
+		filter["ticketId"] = query.ticketIds[0]
+	} else if len(query.ticketIds) > 1 {
+		filter["ticketId"] = bson.M{"$in": query.ticketIds}
+	}
+
+	if len(query.userIds) == 1 {
+		filter["userId"] = query.userIds[0]
+	} else if len(query.userIds) > 1 {
+		filter["userId"] = bson.M{"$in": query.userIds}
+	}
+
+	if len(query.statuses) == 1 {
+		filter["status"] = query.statuses[0].String()
+	} else if len(query.statuses) > 1 {
+		filter["status"] = bson.M{"$in": statusStrings(query.statuses)}
+	}
+
+	if query.after != nil {
+		afterId, err := primitive.ObjectIDFromHex(query.after.Id)
+		if err != nil {
+			return nil, err
+		}
+		cmp := "$gt"
+		if query.descending() {
+			cmp = "$lt"
+		}
+		if query.byExpiresAt() {
+			filter["$or"] = []bson.M{
+				{"expiresAt": bson.M{cmp: query.after.ExpiresAt}},
+				{"expiresAt": query.after.ExpiresAt, "_id": bson.M{cmp: afterId}},
+			}
+		} else {
+			filter["_id"] = bson.M{cmp: afterId}
+		}
+	}
+
+	return filter, nil
 }
 
 // can only update statuses for now
-func (o ordersCollection) update(id string, order Order) (bool, error) {
+// cancelling an order releases its ticket reservation
+// the order is only updated while its status is one of from, so a transition cannot overwrite one made concurrently
+// a nil from updates the order whatever its status
+// events are saved to the outbox in the same transaction, and only if the order was updated
+func (o ordersCollection) update(id string, order Order, from []orderStatus, events ...outboxEvent) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
 	defer cancel()
 
@@ -140,16 +313,34 @@ func (o ordersCollection) update(id string, order Order) (bool, error) {
 		return false, err
 	}
 
-	filter := bson.M{"_id": mongoId}
+	filter := updateFilter(mongoId, from)
 	update := bson.M{"$set": bson.M{"status": order.Status.String()}}
-	res, err := o.collection.UpdateOne(ctx, filter, update)
+	if order.Status == Cancelled {
+		update["$unset"] = bson.M{"reservation": ""}
+	}
+	var matched bool
+	err = withTransaction(ctx, o.collection, func(sc mongo.SessionContext) error {
+		res, err := o.collection.UpdateOne(sc, filter, update)
+		if err != nil {
+			return err
+		}
+		if matched = res.MatchedCount > 0; !matched {
+			return nil
+		}
+		return insertEvents(sc, o.collection, events...)
+	})
 	if err != nil {
 		return false, err
 	}
-	if res.MatchedCount > 0 {
-		return true, nil
+	return matched, nil
+}
+
+func updateFilter(id primitive.ObjectID, from []orderStatus) bson.M {
+	filter := bson.M{"_id": id}
+	if from != nil {
+		filter["status"] = bson.M{"$in": statusStrings(from)}
 	}
-	return false, nil
+	return filter
 }
 
 type orderStatus int
@@ -161,6 +352,26 @@ const (
 	Completed
 )
 
+// activeStatuses are the statuses of orders that hold their ticket's reservation and can still be paid for or cancelled
+var activeStatuses = []orderStatus{Created, AwaitingPayment}
+
+func (s orderStatus) in(statuses []orderStatus) bool {
+	for _, status := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func statusStrings(statuses []orderStatus) []string {
+	var strs []string
+	for _, s := range statuses {
+		strs = append(strs, s.String())
+	}
+	return strs
+}
+
 func (s orderStatus) String() string {
 	return []string{
 		"Created",
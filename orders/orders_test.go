@@ -2,20 +2,30 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"strconv"
+	"testing"
 	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var allBalls = time.Unix(0, 0)
 
 type fakeOrdersCollection struct {
 	orders map[string]Order
+	outbox []outboxEvent
 	id     int
 }
 
 func newFakeOrdersCollection() *fakeOrdersCollection {
 	return &fakeOrdersCollection{
 		make(map[string]Order),
+		nil,
 		0,
 	}
 }
@@ -29,6 +39,20 @@ func (f *fakeOrdersCollection) create(order Order) (string, error) {
 	return currId, nil
 }
 
+func (f *fakeOrdersCollection) reserve(order Order, newEvent eventBuilder) (string, error) {
+	for _, o := range f.orders {
+		if o.TicketId == order.TicketId && o.Status != Cancelled {
+			return "", alreadyReservedError{order.TicketId}
+		}
+	}
+	event, err := newEvent(strconv.Itoa(f.id))
+	if err != nil {
+		return "", err
+	}
+	f.saveEvents(event)
+	return f.create(order)
+}
+
 func (f *fakeOrdersCollection) read(id string) (*Order, error) {
 	order, ok := f.orders[id]
 	if !ok {
@@ -37,55 +61,110 @@ func (f *fakeOrdersCollection) read(id string) (*Order, error) {
 	return &order, nil
 }
 
-func (f *fakeOrdersCollection) search(limit int64, ticketIds, userIds []string, statuses []orderStatus) ([]Order, error) {
+func (f *fakeOrdersCollection) search(query orderSearch) ([]Order, string, error) {
 	ticketMap := make(map[string]struct{})
-	for _, tid := range ticketIds {
+	for _, tid := range query.ticketIds {
 		ticketMap[tid] = struct{}{}
 	}
 
 	userMap := make(map[string]struct{})
-	for _, uid := range userIds {
+	for _, uid := range query.userIds {
 		userMap[uid] = struct{}{}
 	}
 
 	statusMap := make(map[string]struct{})
-	for _, s := range statuses {
+	for _, s := range query.statuses {
 		statusMap[s.String()] = struct{}{}
 	}
 
+	// fake ids are sequential so they sort by creation time
+	idNum := func(id string) int {
+		n, _ := strconv.Atoi(id)
+		return n
+	}
+	less := func(a, b Order) bool {
+		if query.byExpiresAt() && !a.ExpiresAt.Equal(b.ExpiresAt) {
+			return a.ExpiresAt.Before(b.ExpiresAt)
+		}
+		return idNum(a.Id) < idNum(b.Id)
+	}
+	inOrder := func(a, b Order) bool {
+		if query.descending() {
+			return less(b, a)
+		}
+		return less(a, b)
+	}
+
 	var res []Order
 	for _, order := range f.orders {
-		if limit > 0 && len(res) > int(limit) {
-			break
-		}
 		ticketIdOk, userIdOk, statusOk := true, true, true
-		if len(ticketIds) > 0 {
+		if len(query.ticketIds) > 0 {
 			_, ticketIdOk = ticketMap[order.TicketId]
 		}
-		if len(userIds) > 0 {
+		if len(query.userIds) > 0 {
 			_, userIdOk = userMap[order.UserId]
 		}
-		if len(statuses) > 0 {
+		if len(query.statuses) > 0 {
 			_, statusOk = statusMap[order.Status.String()]
 		}
-		if ticketIdOk && userIdOk && statusOk {
+		afterOk := query.after == nil || inOrder(Order{ExpiresAt: query.after.ExpiresAt, Id: query.after.Id}, order)
+		if ticketIdOk && userIdOk && statusOk && afterOk {
 			res = append(res, order)
 		}
 	}
-	return res, nil
+	sort.Slice(res, func(i, j int) bool {
+		return inOrder(res[i], res[j])
+	})
+
+	res, next := nextToken(res, query.limit)
+	return res, next, nil
 }
 
-func (f *fakeOrdersCollection) update(id string, order Order) (bool, error) {
+func (f *fakeOrdersCollection) update(id string, order Order, from []orderStatus, events ...outboxEvent) (bool, error) {
 	if order.Id != "" && order.Id != id {
 		return false, errors.New("provided order does not match provided order ID")
 	}
-	if _, ok := f.orders[id]; !ok {
+	stored, ok := f.orders[id]
+	if !ok {
+		return false, nil
+	}
+	if from != nil && !stored.Status.in(from) {
 		return false, nil
 	}
 	f.orders[id] = order
+	f.saveEvents(events...)
 	return true, nil
 }
 
+func (f *fakeOrdersCollection) saveEvents(events ...outboxEvent) {
+	for _, event := range events {
+		event.Id = strconv.Itoa(len(f.outbox))
+		f.outbox = append(f.outbox, event)
+	}
+}
+
+func (f *fakeOrdersCollection) pending(limit int64) ([]outboxEvent, error) {
+	var pending []outboxEvent
+	for _, event := range f.outbox {
+		if int64(len(pending)) == limit {
+			break
+		}
+		if !event.Sent {
+			pending = append(pending, event)
+		}
+	}
+	return pending, nil
+}
+
+func (f *fakeOrdersCollection) markSent(id string) error {
+	idx, err := strconv.Atoi(id)
+	if err != nil || idx >= len(f.outbox) {
+		return errors.New("no event with matching ID found")
+	}
+	f.outbox[idx].Sent = true
+	return nil
+}
+
 // a wrapper around the create method
 func (f *fakeOrdersCollection) createWrapper(uid, tid string, status orderStatus) Order {
 	order := Order{
@@ -98,3 +177,107 @@ func (f *fakeOrdersCollection) createWrapper(uid, tid string, status orderStatus
 	order.Id = oid
 	return order
 }
+
+func TestIsDuplicateKeyError(t *testing.T) {
+	dupKey := mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+	otherWrite := mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121}}}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"duplicate key", dupKey, true},
+		{"wrapped duplicate key", fmt.Errorf("insert: %w", dupKey), true},
+		{"other write error", otherWrite, false},
+		{"other error", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		if got := isDuplicateKeyError(tt.err); got != tt.want {
+			t.Errorf("%v: isDuplicateKeyError() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrderFilter(t *testing.T) {
+	afterId := primitive.NewObjectID()
+	expiresAt := time.Unix(60, 0)
+
+	tests := []struct {
+		name  string
+		query orderSearch
+		want  bson.M
+	}{
+		{"no filters", orderSearch{}, bson.M{}},
+		{
+			"user and statuses",
+			orderSearch{userIds: []string{"1"}, statuses: []orderStatus{Created, Completed}},
+			bson.M{"userId": "1", "status": bson.M{"$in": []string{"Created", "Completed"}}},
+		},
+		{
+			"newest first after cursor",
+			orderSearch{after: &orderCursor{Id: afterId.Hex()}, sort: sortCreatedDesc},
+			bson.M{"_id": bson.M{"$lt": afterId}},
+		},
+		{
+			"expiring first after cursor",
+			orderSearch{after: &orderCursor{expiresAt, afterId.Hex()}, sort: sortExpiresAt},
+			bson.M{"$or": []bson.M{
+				{"expiresAt": bson.M{"$gt": expiresAt}},
+				{"expiresAt": expiresAt, "_id": bson.M{"$gt": afterId}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			got, err := orderFilter(tt.query)
+			if err != nil {
+				currTest.Fatalf("orderFilter: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				currTest.Errorf("unexpected filter: (-want, +got)\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestUpdateFilter(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	tests := []struct {
+		name string
+		from []orderStatus
+		want bson.M
+	}{
+		{"any status", nil, bson.M{"_id": id}},
+		{"active orders", activeStatuses, bson.M{"_id": id, "status": bson.M{"$in": []string{"Created", "AwaitingPayment"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			if diff := cmp.Diff(tt.want, updateFilter(id, tt.from)); diff != "" {
+				currTest.Errorf("unexpected filter: (-want, +got)\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestUnreservedFilter(t *testing.T) {
+	want := bson.M{
+		"status":      bson.M{"$in": []string{"Completed", "Created", "AwaitingPayment"}},
+		"reservation": bson.M{"$exists": false},
+	}
+	if diff := cmp.Diff(want, unreservedFilter()); diff != "" {
+		t.Errorf("unexpected filter: (-want, +got)\n%v", diff)
+	}
+}
+
+func TestReservationConflictsError(t *testing.T) {
+	oldest, _ := primitive.ObjectIDFromHex("5f47ec2c86ed3ef991cdfd94")
+	newest, _ := primitive.ObjectIDFromHex("5f47ec2c86ed3ef991cdfd95")
+	err := reservationConflictsError([]reservationConflict{{"1", []primitive.ObjectID{oldest, newest}}})
+	want := "1 tickets are held by more than one order, cancel all but one order of each before starting: ticket 1: orders 5f47ec2c86ed3ef991cdfd94, 5f47ec2c86ed3ef991cdfd95"
+	if got := err.Error(); got != want {
+		t.Errorf("wrong error: %v, want %v", got, want)
+	}
+}
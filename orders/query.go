@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// orders can be sorted by creation time or expiration time
+// a leading '-' sorts in descending order
+const (
+	sortCreated       = "created"
+	sortCreatedDesc   = "-created"
+	sortExpiresAt     = "expiresAt"
+	sortExpiresAtDesc = "-expiresAt"
+)
+
+// orderSearch describes a page of orders to read
+// empty id and status lists are not used to filter
+type orderSearch struct {
+	limit     int64
+	ticketIds []string
+	userIds   []string
+	statuses  []orderStatus
+	after     *orderCursor
+	sort      string
+}
+
+func (s orderSearch) descending() bool {
+	return s.sort == sortCreatedDesc || s.sort == sortExpiresAtDesc
+}
+
+func (s orderSearch) byExpiresAt() bool {
+	return s.sort == sortExpiresAt || s.sort == sortExpiresAtDesc
+}
+
+// orderCursor points at the last order of a page
+// the next page starts after it in the requested sort order
+type orderCursor struct {
+	ExpiresAt time.Time `json:"e"`
+	Id        string    `json:"i"`
+}
+
+func (c orderCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeOrderCursor(s string) (*orderCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c orderCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if c.Id == "" {
+		return nil, fmt.Errorf("cursor is missing an order id")
+	}
+	return &c, nil
+}
+
+// nextToken trims a page read with one extra order and returns the token for the following page
+// the token is empty if there are no more orders
+func nextToken(orders []Order, limit int64) ([]Order, string) {
+	if int64(len(orders)) <= limit {
+		return orders, ""
+	}
+	orders = orders[:limit]
+	last := orders[len(orders)-1]
+	return orders, orderCursor{last.ExpiresAt, last.Id}.encode()
+}
+
+// orderSearchFromParams parses the GET /api/orders query parameters
+// status may be repeated or comma separated, the parameters that are not valid are returned
+func orderSearchFromParams(params url.Values) (orderSearch, []problem.InvalidParam) {
+	var issues []problem.InvalidParam
+	s := orderSearch{
+		limit: defaultPageSize,
+		sort:  sortCreated,
+	}
+
+	if _, ok := params["limit"]; ok {
+		limit, err := strconv.ParseInt(params.Get("limit"), 10, 64)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			issues = append(issues, problem.InvalidParam{Name: "limit", Reason: fmt.Sprintf("limit must be a number between 1 and %v", maxPageSize)})
+		} else {
+			s.limit = limit
+		}
+	}
+
+	if _, ok := params["after"]; ok {
+		cursor, err := decodeOrderCursor(params.Get("after"))
+		if err != nil {
+			issues = append(issues, problem.InvalidParam{Name: "after", Reason: "invalid cursor"})
+		} else {
+			s.after = cursor
+		}
+	}
+
+	for _, v := range params["status"] {
+		for _, name := range strings.Split(v, ",") {
+			status, err := statusFromString(name)
+			if err != nil {
+				issues = append(issues, problem.InvalidParam{Name: "status", Reason: err.Error()})
+				continue
+			}
+			s.statuses = append(s.statuses, *status)
+		}
+	}
+
+	if _, ok := params["sort"]; ok {
+		switch v := params.Get("sort"); v {
+		case sortCreated, sortCreatedDesc, sortExpiresAt, sortExpiresAtDesc:
+			s.sort = v
+		default:
+			issues = append(issues, problem.InvalidParam{Name: "sort", Reason: "sort must be one of: created, -created, expiresAt, -expiresAt"})
+		}
+	}
+
+	return s, issues
+}
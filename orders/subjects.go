@@ -36,3 +36,59 @@ func setOrderSubjects() error {
 	}
 	return nil
 }
+
+var (
+	ticketCreatedSubject string
+	ticketUpdatedSubject string
+)
+
+func setTicketCreated(subj *string) error {
+	tcs, err := subjects.StringifySubject(subjects.Subject_TICKET_CREATED)
+	if err != nil {
+		return err
+	}
+	*subj = tcs
+	return nil
+}
+
+func setTicketUpdated(subj *string) error {
+	tus, err := subjects.StringifySubject(subjects.Subject_TICKET_UPDATED)
+	if err != nil {
+		return err
+	}
+	*subj = tus
+	return nil
+}
+
+func setTicketSubjects() error {
+	if err := setTicketCreated(&ticketCreatedSubject); err != nil {
+		return err
+	}
+	if err := setTicketUpdated(&ticketUpdatedSubject); err != nil {
+		return err
+	}
+	return nil
+}
+
+var (
+	expirationCompleteSubject string
+	paymentCreatedSubject     string
+)
+
+func setExpirationComplete(subj *string) error {
+	ecs, err := subjects.StringifySubject(subjects.Subject_EXPIRATION_COMPLETE)
+	if err != nil {
+		return err
+	}
+	*subj = ecs
+	return nil
+}
+
+func setPaymentCreated(subj *string) error {
+	pcs, err := subjects.StringifySubject(subjects.Subject_PAYMENT_CREATED)
+	if err != nil {
+		return err
+	}
+	*subj = pcs
+	return nil
+}
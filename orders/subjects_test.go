@@ -21,3 +21,43 @@ func TestSetOrderCancelled(t *testing.T) {
 		t.Fatalf("wrong subject: %v, want %v", got, want)
 	}
 }
+
+func TestSetTicketCreated(t *testing.T) {
+	var createdSubj string
+	if err := setTicketCreated(&createdSubj); err != nil {
+		t.Fatalf("setTicketCreated: %v", err)
+	}
+	if got, want := createdSubj, "ticket:created"; got != want {
+		t.Fatalf("wrong subject: %v, want %v", got, want)
+	}
+}
+
+func TestSetTicketUpdated(t *testing.T) {
+	var updatedSubj string
+	if err := setTicketUpdated(&updatedSubj); err != nil {
+		t.Fatalf("setTicketUpdated: %v", err)
+	}
+	if got, want := updatedSubj, "ticket:updated"; got != want {
+		t.Fatalf("wrong subject: %v, want %v", got, want)
+	}
+}
+
+func TestSetExpirationComplete(t *testing.T) {
+	var completeSubj string
+	if err := setExpirationComplete(&completeSubj); err != nil {
+		t.Fatalf("setExpirationComplete: %v", err)
+	}
+	if got, want := completeSubj, "expiration:complete"; got != want {
+		t.Fatalf("wrong subject: %v, want %v", got, want)
+	}
+}
+
+func TestSetPaymentCreated(t *testing.T) {
+	var createdSubj string
+	if err := setPaymentCreated(&createdSubj); err != nil {
+		t.Fatalf("setPaymentCreated: %v", err)
+	}
+	if got, want := createdSubj, "payment:created"; got != want {
+		t.Fatalf("wrong subject: %v, want %v", got, want)
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"time"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Ticket struct {
@@ -18,6 +21,8 @@ type Ticket struct {
 type ticketsCRUD interface {
 	create(Ticket) (string, error)
 	read(string) (*Ticket, error)
+	readMany([]string) (map[string]Ticket, error)
+	update(Ticket) (bool, error)
 }
 
 type ticketsCollection struct {
@@ -32,8 +37,29 @@ func newTicketCollection(collection *mongo.Collection, timeout time.Duration) ti
 	}
 }
 
+// tickets are created by the ticket-crud service, this collection is only a local replica
+// so create is keyed by the upstream ID and only inserts if the ticket is unknown
+// this makes redelivered ticket:created events a no-op instead of clobbering newer versions
 func (t ticketsCollection) create(ticket Ticket) (string, error) {
-	return "", nil
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	mongoId, err := primitive.ObjectIDFromHex(ticket.Id)
+	if err != nil {
+		return "", err
+	}
+
+	filter := bson.M{"_id": mongoId}
+	update := bson.M{"$setOnInsert": bson.M{
+		"title":   ticket.Title,
+		"price":   ticket.Price,
+		"version": ticket.Version,
+	}}
+	if _, err := t.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return "", err
+	}
+
+	return mongoId.Hex(), nil
 }
 
 func (t ticketsCollection) read(ticketId string) (*Ticket, error) {
@@ -59,3 +85,70 @@ func (t ticketsCollection) read(ticketId string) (*Ticket, error) {
 
 	return &ticket, nil
 }
+
+// readMany fetches tickets by id in a single query
+// the result is keyed by ticket id, unknown and malformed ids are left out
+func (t ticketsCollection) readMany(ticketIds []string) (map[string]Ticket, error) {
+	tickets := make(map[string]Ticket)
+
+	mongoIds := make([]primitive.ObjectID, 0, len(ticketIds))
+	for _, tid := range ticketIds {
+		mongoId, err := primitive.ObjectIDFromHex(tid)
+		if err != nil {
+			continue
+		}
+		mongoIds = append(mongoIds, mongoId)
+	}
+	if len(mongoIds) == 0 {
+		return tickets, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	cursor, err := t.collection.Find(ctx, bson.M{"_id": bson.M{"$in": mongoIds}})
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Ticket
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	for _, ticket := range found {
+		tickets[ticket.Id] = ticket
+	}
+
+	return tickets, nil
+}
+
+// update applies the ticket only if it is the next version of the stored ticket
+// returns false if the stored ticket is missing or not at ticket.Version - 1
+func (t ticketsCollection) update(ticket Ticket) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	if ticket.Version == 0 {
+		return false, fmt.Errorf("cannot update ticket %v to version 0", ticket.Id)
+	}
+
+	mongoId, err := primitive.ObjectIDFromHex(ticket.Id)
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{"_id": mongoId, "version": ticket.Version - 1}
+	update := bson.M{"$set": bson.M{
+		"title":   ticket.Title,
+		"price":   ticket.Price,
+		"version": ticket.Version,
+	}}
+	res, err := t.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	if res.MatchedCount > 0 {
+		return true, nil
+	}
+	return false, nil
+}
@@ -8,12 +8,14 @@ import (
 type fakeTicketsCollection struct {
 	tickets map[string]Ticket
 	id      int
+	// count reads so tests can check tickets are fetched in batches
+	readCalls     int
+	readManyCalls int
 }
 
 func newFakeTicketsCollection() *fakeTicketsCollection {
 	return &fakeTicketsCollection{
-		make(map[string]Ticket),
-		0,
+		tickets: make(map[string]Ticket),
 	}
 }
 
@@ -21,6 +23,13 @@ func (f *fakeTicketsCollection) create(ticket Ticket) (string, error) {
 	if ticket.Title == "should error" {
 		return "", errors.New("unable to create ticket")
 	}
+	// tickets replicated from events carry their own ID and are only inserted once
+	if ticket.Id != "" {
+		if _, ok := f.tickets[ticket.Id]; !ok {
+			f.tickets[ticket.Id] = ticket
+		}
+		return ticket.Id, nil
+	}
 	currId := strconv.Itoa(f.id)
 	ticket.Id = currId
 	f.id++
@@ -29,6 +38,7 @@ func (f *fakeTicketsCollection) create(ticket Ticket) (string, error) {
 }
 
 func (f *fakeTicketsCollection) read(id string) (*Ticket, error) {
+	f.readCalls++
 	ticket, ok := f.tickets[id]
 	if !ok {
 		return nil, nil
@@ -36,6 +46,29 @@ func (f *fakeTicketsCollection) read(id string) (*Ticket, error) {
 	return &ticket, nil
 }
 
+func (f *fakeTicketsCollection) readMany(ids []string) (map[string]Ticket, error) {
+	f.readManyCalls++
+	tickets := make(map[string]Ticket)
+	for _, id := range ids {
+		if ticket, ok := f.tickets[id]; ok {
+			tickets[id] = ticket
+		}
+	}
+	return tickets, nil
+}
+
+func (f *fakeTicketsCollection) update(ticket Ticket) (bool, error) {
+	if ticket.Version == 0 {
+		return false, errors.New("cannot update ticket to version 0")
+	}
+	stored, ok := f.tickets[ticket.Id]
+	if !ok || stored.Version != ticket.Version-1 {
+		return false, nil
+	}
+	f.tickets[ticket.Id] = ticket
+	return true, nil
+}
+
 func (f *fakeTicketsCollection) createWrapper(title string, price float64, version uint) Ticket {
 	ticket := Ticket{
 		Title:   title,
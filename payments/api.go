@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	prometrics "github.com/basilnsage/prometheus-gin-metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// codes of the problems the payment routes respond with
+const (
+	codeOrderNotFound   = "order_not_found"
+	codeNotOrderOwner   = "not_order_owner"
+	codeOrderCancelled  = "order_cancelled"
+	codeOrderPaid       = "order_paid"
+	codePaymentDeclined = "payment_declined"
+)
+
+type apiServer struct {
+	oc       ordersCRUD
+	pc       paymentsCRUD
+	provider PaymentProvider
+	router   *gin.Engine
+	v        *middleware.JWTValidator
+	revoked  *middleware.RevocationCache
+	// sources are where session tokens are read from
+	sources []middleware.TokenSource
+}
+
+func newApiServer(v *middleware.JWTValidator, r *gin.Engine, oc ordersCRUD, pc paymentsCRUD, provider PaymentProvider, revoked *middleware.RevocationCache, sources []middleware.TokenSource) (*apiServer, error) {
+	a := &apiServer{}
+
+	if err := setSubjects(); err != nil {
+		return nil, fmt.Errorf("unable to set NATS subjects: %v", err)
+	}
+
+	a.v = v
+	a.revoked = revoked
+	a.sources = sources
+
+	a.router = r
+	a.bindRoutes()
+
+	a.oc = oc
+	a.pc = pc
+	a.provider = provider
+
+	return a, nil
+}
+
+func (a *apiServer) bindRoutes() {
+	promRegistry := prometrics.NewRegistry()
+	a.router.Use(promRegistry.ReportDuration(
+		[]float64{0.005, 0.01, 0.05, 0.1, 0.5, 1.0, 2.0, 5.0},
+	))
+	a.router.GET("/payments/metrics", promRegistry.DefaultHandler)
+	a.router.Use(problem.Handler())
+
+	userValidationMiddleware := middleware.UserValidatorFrom(a.v, a.revoked, a.sources...)
+	paymentRoutes := a.router.Group("/api/payments")
+	paymentRoutes.POST("", userValidationMiddleware, a.postPayment)
+}
+
+func (a *apiServer) postPayment(c *gin.Context) {
+	// extract user ID from JWT
+	userClaims, ok := middleware.ClaimsFromContext(c)
+	if !ok {
+		problem.Abort(c, problem.Internal("Internal Server Error", errors.New("no user claims found, this should never happen")))
+		return
+	}
+	uid := userClaims.ID
+
+	// get the order ID and payment token from the request
+	req := PaymentReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "Could not parse request").WithCause(err))
+		return
+	}
+	if params := req.validate(); len(params) > 0 {
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "please specify an order id and payment token", params...))
+		return
+	}
+
+	// do we know about the order?
+	order, err := a.oc.read(req.OrderId)
+	if errors.Is(err, errInvalidOrderId) {
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "order id is not valid", problem.InvalidParam{Name: "orderId", Reason: "order id is not valid"}))
+		return
+	} else if err != nil {
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("failed to read order from DB: %v", err)))
+		return
+	} else if order == nil {
+		problem.Abort(c, problem.NotFound(codeOrderNotFound, "could not find order: "+req.OrderId))
+		return
+	}
+
+	// check if the user owns the order and can still pay for it
+	if order.UserId != uid {
+		problem.Abort(c, problem.Forbidden(codeNotOrderOwner, "only the buyer can pay for an order"))
+		return
+	}
+	if order.Status == events.Status_Cancelled {
+		problem.Abort(c, problem.Conflict(codeOrderCancelled, "cannot pay for a cancelled order"))
+		return
+	}
+	if order.Status == events.Status_Completed {
+		problem.Abort(c, problem.Conflict(codeOrderPaid, "order has already been paid for"))
+		return
+	}
+
+	// save the payment as pending before charging, an order can only have one payment
+	// so of two concurrent requests only one gets to charge the user
+	payment := Payment{
+		OrderId: order.Id,
+		Pending: true,
+	}
+	paymentId, err := a.pc.create(payment)
+	if err == errPaymentExists {
+		problem.Abort(c, problem.Conflict(codeOrderPaid, "order has already been paid for"))
+		return
+	} else if err != nil {
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("failed to save pending payment for order %v: %v", order.Id, err)))
+		return
+	}
+	payment.Id = paymentId
+
+	// charge the user, free tickets do not need to go through the provider
+	if amount := toCents(order.Price); amount > 0 {
+		payment.ChargeId, err = a.provider.Charge(amount, req.Token)
+		if errors.Is(err, ErrPaymentDeclined) {
+			// nothing was charged, let the user try again
+			if err := a.pc.remove(paymentId); err != nil {
+				ErrorLogger.Printf("failed to remove declined payment %v: %v", paymentId, err)
+			}
+			problem.Abort(c, problem.New(http.StatusPaymentRequired, codePaymentDeclined, "payment was declined"))
+			return
+		} else if err != nil {
+			// the charge may have gone through, the pending payment stays so the order is not charged twice
+			problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("failed to charge order %v, payment %v is left pending: %v", order.Id, paymentId, err)))
+			return
+		}
+	}
+
+	// save the charge along with its event, the outbox relay publishes it
+	// the order is marked paid when the event comes back from NATS, see listener.onPaymentCreated
+	eventBytes, err := marshalPaymentCreated(payment)
+	if err != nil {
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("could not create payment created event: %v", err)))
+		return
+	}
+	if err := a.pc.complete(paymentId, payment.ChargeId, newOutboxEvent(paymentCreatedSubject, eventBytes)); err != nil {
+		problem.Abort(c, problem.Internal("Internal Server Error", fmt.Errorf("failed to save payment for charge %v: %v", payment.ChargeId, err)))
+		return
+	}
+	payment.Pending = false
+	InfoLogger.Printf("saved payment with id: %v", paymentId)
+
+	c.JSON(http.StatusCreated, PaymentResp{
+		payment.OrderId,
+		payment.ChargeId,
+		payment.Id,
+	})
+}
+
+// validate returns the fields of the request that are missing
+func (r PaymentReq) validate() (params []problem.InvalidParam) {
+	if r.OrderId == "" {
+		params = append(params, problem.InvalidParam{Name: "orderId", Reason: "please specify an order id"})
+	}
+	if r.Token == "" {
+		params = append(params, problem.InvalidParam{Name: "token", Reason: "please specify a payment token"})
+	}
+	return params
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func newTestInfra() (*apiServer, *fakeOrdersCollection, *fakePaymentsCollection, error) {
+	fakeOC := newFakeOrdersCollection()
+	fakePC := newFakePaymentsCollection()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	v, err := middleware.NewJWTValidator([]byte("password"), "HS256")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	server, err := newApiServer(v, r, fakeOC, fakePC, newFakeProvider(), middleware.NewRevocationCache(), middleware.DefaultTokenSources())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return server, fakeOC, fakePC, nil
+}
+
+// newTestJWT signs a session token for a test user
+func newTestJWT(v *middleware.JWTValidator, email, id string) (string, error) {
+	claims, err := middleware.NewClaims(email, id, middleware.DefaultTokenTTL)
+	if err != nil {
+		return "", err
+	}
+	return claims.Tokenize(v)
+}
+
+type test struct {
+	name         string
+	method       string
+	route        string
+	body         interface{}
+	headers      map[string]string
+	expectedCode int
+	expectedResp *PaymentResp
+	expectedErr  *problem.Error
+}
+
+func runTest(tests []test, router *gin.Engine, t *testing.T) (err error) {
+	for _, test := range tests {
+		// if body is not nil convert it into bytes
+		var body []byte
+		if test.body != nil {
+			if body, err = json.Marshal(test.body); err != nil {
+				return err
+			}
+		}
+
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(test.method, test.route, bytes.NewReader(body))
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(resp, req)
+
+		t.Run(test.name, func(currTest *testing.T) {
+			// check resp code if expected value specified by test
+			if test.expectedCode != -1 {
+				if got, want := resp.Code, test.expectedCode; got != want {
+					currTest.Fatalf("status code is %v, want %v", got, want)
+				}
+			}
+
+			// check resp body if specified by test
+			if test.expectedResp != nil {
+				var respBody PaymentResp
+				respBytes, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					currTest.Fatalf("ioutil.Readall: %v", err)
+				}
+				if err := json.Unmarshal(respBytes, &respBody); err != nil {
+					currTest.Fatalf("json.Unmarshal: %v", err)
+				}
+				if diff := cmp.Diff(*test.expectedResp, respBody); diff != "" {
+					currTest.Fatalf("unexpected response: (-want, +got)\n%v", diff)
+				}
+			}
+
+			// check resp body if an err is expected
+			if test.expectedErr != nil {
+				if got, want := resp.Header().Get("Content-Type"), problem.ContentType; got != want {
+					currTest.Errorf("wrong content type: %v, want %v", got, want)
+				}
+				var respBody problem.Error
+				respBytes, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					currTest.Fatalf("ioutil.Readall: %v", err)
+				}
+				if err := json.Unmarshal(respBytes, &respBody); err != nil {
+					currTest.Fatalf("json.Unmarshal: %v", err)
+				}
+				if diff := cmp.Diff(*test.expectedErr, respBody, cmpopts.IgnoreUnexported(problem.Error{}), cmpopts.IgnoreFields(problem.Error{}, "Instance")); diff != "" {
+					currTest.Fatalf("unexpected error: (-want, +got)\n%v", diff)
+				}
+			}
+		})
+	}
+	return nil
+}
+
+func TestPostPayment(t *testing.T) {
+	server, fakeOC, fakePC, err := newTestInfra()
+	if err != nil {
+		t.Fatalf("unable to complete pre-test tasks: %v", err)
+	}
+
+	testUserJWT, err := newTestJWT(server.v, "foo@bar.com", "1")
+	if err != nil {
+		t.Fatalf("unble to create test JWT: %v", err)
+	}
+
+	otherUsersOrder := fakeOC.createWrapper("2", events.Status_Created, 10.0)
+	cancelledOrder := fakeOC.createWrapper("1", events.Status_Cancelled, 10.0)
+	order := fakeOC.createWrapper("1", events.Status_Created, 10.0)
+	freeOrder := fakeOC.createWrapper("1", events.Status_Created, 0)
+	// another request is charging this order
+	pendingOrder := fakeOC.createWrapper("1", events.Status_Created, 10.0)
+	if _, err := fakePC.create(Payment{OrderId: pendingOrder.Id, Pending: true}); err != nil {
+		t.Fatalf("unable to save pending payment: %v", err)
+	}
+
+	tests := []test{
+		{
+			"malformed request",
+			http.MethodPost,
+			"/api/payments",
+			nil,
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusBadRequest,
+			nil,
+			problem.Validation(problem.CodeValidation, "Could not parse request"),
+		},
+		{
+			"missing payment token",
+			http.MethodPost,
+			"/api/payments",
+			PaymentReq{order.Id, ""},
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusBadRequest,
+			nil,
+			problem.Validation(problem.CodeValidation, "please specify an order id and payment token", problem.InvalidParam{Name: "token", Reason: "please specify a payment token"}),
+		},
+		{
+			"pay for a non existent order",
+			http.MethodPost,
+			"/api/payments",
+			PaymentReq{"-1", "tok_visa"},
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusNotFound,
+			nil,
+			problem.NotFound("order_not_found", "could not find order: -1"),
+		},
+		{
+			"malformed order id",
+			http.MethodPost,
+			"/api/payments",
+			PaymentReq{"not-an-id", "tok_visa"},
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusBadRequest,
+			nil,
+			problem.Validation(problem.CodeValidation, "order id is not valid", problem.InvalidParam{Name: "orderId", Reason: "order id is not valid"}),
+		},
+		{
+			"pay for a different users order",
+			http.MethodPost,
+			"/api/payments",
+			PaymentReq{otherUsersOrder.Id, "tok_visa"},
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusForbidden,
+			nil,
+			problem.Forbidden("not_order_owner", "only the buyer can pay for an order"),
+		},
+		{
+			"pay for a cancelled order",
+			http.MethodPost,
+			"/api/payments",
+			PaymentReq{cancelledOrder.Id, "tok_visa"},
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusConflict,
+			nil,
+			problem.Conflict("order_cancelled", "cannot pay for a cancelled order"),
+		},
+		{
+			"declined payment",
+			http.MethodPost,
+			"/api/payments",
+			PaymentReq{order.Id, fakeDeclinedToken},
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusPaymentRequired,
+			nil,
+			problem.New(http.StatusPaymentRequired, "payment_declined", "payment was declined"),
+		},
+		{
+			"pay for an order",
+			http.MethodPost,
+			"/api/payments",
+			PaymentReq{order.Id, "tok_visa"},
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusCreated,
+			&PaymentResp{order.Id, "ch_fake_0", "2"},
+			nil,
+		},
+		{
+			"pay for an order twice",
+			http.MethodPost,
+			"/api/payments",
+			PaymentReq{order.Id, "tok_visa"},
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusConflict,
+			nil,
+			problem.Conflict("order_paid", "order has already been paid for"),
+		},
+		{
+			"pay for a free order",
+			http.MethodPost,
+			"/api/payments",
+			PaymentReq{freeOrder.Id, "tok_visa"},
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusCreated,
+			&PaymentResp{freeOrder.Id, "", "3"},
+			nil,
+		},
+		{
+			"pay for an order with a pending payment",
+			http.MethodPost,
+			"/api/payments",
+			PaymentReq{pendingOrder.Id, "tok_visa"},
+			map[string]string{"auth-jwt": testUserJWT},
+			http.StatusConflict,
+			nil,
+			problem.Conflict("order_paid", "order has already been paid for"),
+		},
+	}
+
+	if err := runTest(tests, server.router, t); err != nil {
+		t.Fatalf("error running tests: %v", err)
+	}
+
+	// the order is only marked paid once the event has been published
+	paidOrder, _ := fakeOC.read(order.Id)
+	if got, want := paidOrder.Status, events.Status_Created; got != want {
+		t.Fatalf("paid order status is %v, want %v", got, want)
+	}
+
+	// the event should have been saved to the outbox with the payment
+	pending, _ := fakePC.pending(outboxBatchSize)
+	if len(pending) != 2 {
+		t.Fatalf("wrong number of outbox events: %v, want 2", len(pending))
+	}
+	if got, want := pending[0].Subject, paymentCreatedSubject; got != want {
+		t.Fatalf("outbox event subject is %v, want %v", got, want)
+	}
+	eventBytes := pending[0].Data
+	var got events.PaymentCreated
+	if err := proto.Unmarshal(eventBytes, &got); err != nil {
+		t.Fatalf("proto.Unmarshal: %v", err)
+	}
+
+	want := &events.PaymentCreated{
+		Subject: subjects.Subject_PAYMENT_CREATED,
+		Data: &events.PaymentData{
+			Id:       "2",
+			OrderId:  order.Id,
+			ChargeId: "ch_fake_0",
+		},
+	}
+	if diff := cmp.Diff(want, &got, protocmp.Transform()); diff != "" {
+		t.Fatalf("paymentCreated event: (-want +got)\n%v", diff)
+	}
+}
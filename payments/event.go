@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"google.golang.org/protobuf/proto"
+)
+
+func orderFromCreated(data []byte) (*Order, error) {
+	var createdEvent events.OrderCreated
+	if err := proto.Unmarshal(data, &createdEvent); err != nil {
+		return nil, err
+	}
+	if createdEvent.Data == nil || createdEvent.Data.Ticket == nil {
+		return nil, errors.New("order created event is missing order data")
+	}
+
+	return &Order{
+		UserId: createdEvent.Data.UserId,
+		Status: createdEvent.Data.Status,
+		Price:  createdEvent.Data.Ticket.Price,
+		Id:     createdEvent.Data.Id,
+	}, nil
+}
+
+func orderIdFromCancelled(data []byte) (string, error) {
+	var cancelledEvent events.OrderCancelled
+	if err := proto.Unmarshal(data, &cancelledEvent); err != nil {
+		return "", err
+	}
+	if cancelledEvent.Data == nil {
+		return "", errors.New("order cancelled event is missing order data")
+	}
+	return cancelledEvent.Data.Id, nil
+}
+
+func orderIdFromPaymentCreated(data []byte) (string, error) {
+	var createdEvent events.PaymentCreated
+	if err := proto.Unmarshal(data, &createdEvent); err != nil {
+		return "", err
+	}
+	if createdEvent.Data == nil {
+		return "", errors.New("payment created event is missing payment data")
+	}
+	return createdEvent.Data.OrderId, nil
+}
+
+func marshalPaymentCreated(payment Payment) ([]byte, error) {
+	createdEvent := &events.PaymentCreated{
+		Subject: subjects.Subject_PAYMENT_CREATED,
+		Data: &events.PaymentData{
+			Id:       payment.Id,
+			OrderId:  payment.OrderId,
+			ChargeId: payment.ChargeId,
+		},
+	}
+
+	createdEventBytes, err := proto.Marshal(createdEvent)
+	if err != nil {
+		return nil, err
+	}
+	return createdEventBytes, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func marshalOrderCreated(t *testing.T, order Order) []byte {
+	b, err := proto.Marshal(&events.OrderCreated{
+		Subject: subjects.Subject_ORDER_CREATED,
+		Data: &events.CreatedData{
+			Id:        order.Id,
+			Status:    order.Status,
+			UserId:    order.UserId,
+			ExpiresAt: ptypes.TimestampNow(),
+			Ticket: &events.CreatedData_Ticket{
+				Id:    "1",
+				Price: order.Price,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+	return b
+}
+
+func marshalOrderCancelled(t *testing.T, orderId string) []byte {
+	b, err := proto.Marshal(&events.OrderCancelled{
+		Subject: subjects.Subject_ORDER_CANCELLED,
+		Data: &events.CancelledData{
+			Id: orderId,
+			Ticket: &events.CancelledData_Ticket{
+				Id: "1",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+	return b
+}
+
+func TestOrderFromCreated(t *testing.T) {
+	want := Order{"1", events.Status_Created, 10.0, "2"}
+	got, err := orderFromCreated(marshalOrderCreated(t, want))
+	if err != nil {
+		t.Fatalf("orderFromCreated: %v", err)
+	}
+	if diff := cmp.Diff(want, *got); diff != "" {
+		t.Fatalf("diff: (-want +got)\n%v", diff)
+	}
+}
+
+func TestOrderIdFromCancelled(t *testing.T) {
+	got, err := orderIdFromCancelled(marshalOrderCancelled(t, "2"))
+	if err != nil {
+		t.Fatalf("orderIdFromCancelled: %v", err)
+	}
+	if want := "2"; got != want {
+		t.Fatalf("wrong order id: %v, want %v", got, want)
+	}
+}
+
+func TestMarshalPaymentCreated(t *testing.T) {
+	payment := Payment{OrderId: "1", ChargeId: "ch_1", Id: "2"}
+	want := &events.PaymentCreated{
+		Subject: subjects.Subject_PAYMENT_CREATED,
+		Data: &events.PaymentData{
+			Id:       payment.Id,
+			OrderId:  payment.OrderId,
+			ChargeId: payment.ChargeId,
+		},
+	}
+
+	b, err := marshalPaymentCreated(payment)
+	if err != nil {
+		t.Fatalf("marshalPaymentCreated: %v", err)
+	}
+
+	var got events.PaymentCreated
+	if err := proto.Unmarshal(b, &got); err != nil {
+		t.Fatalf("proto.Unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(want, &got, protocmp.Transform()); diff != "" {
+		t.Fatalf("diff: (-want +got)\n%v", diff)
+	}
+}
@@ -0,0 +1,35 @@
+module github.com/basilnsage/mwn-ticketapp/payments
+
+go 1.15
+
+require (
+	github.com/aws/aws-sdk-go v1.36.7 // indirect
+	github.com/basilnsage/mwn-ticketapp-common v0.0.0-00010101000000-000000000000
+	github.com/basilnsage/mwn-ticketapp/middleware v0.0.0-00010101000000-000000000000
+	github.com/basilnsage/prometheus-gin-metrics v0.1.0-alpha
+	github.com/gin-gonic/gin v1.6.3
+	github.com/golang/protobuf v1.4.3
+	github.com/golang/snappy v0.0.2 // indirect
+	github.com/google/go-cmp v0.5.4
+	github.com/klauspost/compress v1.11.3 // indirect
+	github.com/leodido/go-urn v1.2.1 // indirect
+	github.com/nats-io/jwt v1.2.2 // indirect
+	github.com/nats-io/nats-streaming-server v0.20.0 // indirect
+	github.com/nats-io/nats.go v1.10.0
+	github.com/nats-io/stan.go v0.8.1
+	github.com/prometheus/client_golang v1.9.0 // indirect
+	github.com/ugorji/go v1.2.2 // indirect
+	go.mongodb.org/mongo-driver v1.4.4
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad // indirect
+	golang.org/x/sync v0.0.0-20201207232520-09787c993a3a // indirect
+	golang.org/x/sys v0.0.0-20201221093633-bc327ba9c2f0 // indirect
+	golang.org/x/text v0.3.4 // indirect
+	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
+)
+
+replace (
+	github.com/basilnsage/mwn-ticketapp-common => ../common
+	github.com/basilnsage/mwn-ticketapp/middleware => ../middleware
+)
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp/middleware/listen"
+	"github.com/nats-io/stan.go"
+)
+
+const (
+	queueGroup   = "payments-service"
+	eventAckWait = 30 * time.Second
+)
+
+type listener struct {
+	oc   ordersCRUD
+	eBus stan.Conn
+}
+
+func newListener(oc ordersCRUD, eBus stan.Conn) (*listener, error) {
+	if err := setSubjects(); err != nil {
+		return nil, fmt.Errorf("unable to set NATS subjects: %v", err)
+	}
+
+	return &listener{
+		oc,
+		eBus,
+	}, nil
+}
+
+// listen subscribes to every subject the payments service consumes
+func (l *listener) listen() error {
+	handlers := map[string]listen.Handler{
+		orderCreatedSubject:   l.onOrderCreated,
+		orderCancelledSubject: l.onOrderCancelled,
+		paymentCreatedSubject: l.onPaymentCreated,
+	}
+
+	subscriber := listen.Subscriber{Group: queueGroup, AckWait: eventAckWait, Info: InfoLogger, Error: ErrorLogger}
+	return subscriber.Listen(l.eBus, handlers)
+}
+
+func (l *listener) onOrderCreated(data []byte) error {
+	order, err := orderFromCreated(data)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal order created event: %v", err)
+	}
+
+	oid, err := l.oc.create(*order)
+	if err != nil {
+		return fmt.Errorf("unable to save order: %v", err)
+	}
+	InfoLogger.Printf("saved order with id: %v", oid)
+
+	return nil
+}
+
+func (l *listener) onOrderCancelled(data []byte) error {
+	oid, err := orderIdFromCancelled(data)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal order cancelled event: %v", err)
+	}
+
+	ok, err := l.oc.updateStatus(oid, events.Status_Cancelled)
+	if err != nil {
+		return fmt.Errorf("unable to cancel order: %v", err)
+	}
+	// the order:created event has not been processed yet, wait for redelivery
+	if !ok {
+		return fmt.Errorf("cancelled order not found: %v", oid)
+	}
+	InfoLogger.Printf("cancelled order with id: %v", oid)
+
+	return nil
+}
+
+// onPaymentCreated marks the order paid once the outbox relay has published its payment
+func (l *listener) onPaymentCreated(data []byte) error {
+	oid, err := orderIdFromPaymentCreated(data)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal payment created event: %v", err)
+	}
+
+	ok, err := l.oc.updateStatus(oid, events.Status_Completed)
+	if err != nil {
+		return fmt.Errorf("unable to complete order: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("paid order not found: %v", oid)
+	}
+	InfoLogger.Printf("completed order with id: %v", oid)
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOnOrderCreatedAndCancelled(t *testing.T) {
+	fakeOC := newFakeOrdersCollection()
+	l, err := newListener(fakeOC, newFakeNatsConn())
+	if err != nil {
+		t.Fatalf("newListener: %v", err)
+	}
+
+	order := Order{"1", events.Status_Created, 10.0, "5f47ec2c86ed3ef991cdfd94"}
+
+	// a cancellation for an unknown order must be redelivered
+	if err := l.onOrderCancelled(marshalOrderCancelled(t, order.Id)); err == nil {
+		t.Fatal("onOrderCancelled should fail for an unknown order")
+	}
+
+	if err := l.onOrderCreated(marshalOrderCreated(t, order)); err != nil {
+		t.Fatalf("onOrderCreated: %v", err)
+	}
+	got, _ := fakeOC.read(order.Id)
+	if got == nil {
+		t.Fatalf("order %v was not saved", order.Id)
+	}
+	if diff := cmp.Diff(order, *got); diff != "" {
+		t.Fatalf("saved order: (-want +got)\n%v", diff)
+	}
+
+	if err := l.onOrderCancelled(marshalOrderCancelled(t, order.Id)); err != nil {
+		t.Fatalf("onOrderCancelled: %v", err)
+	}
+	got, _ = fakeOC.read(order.Id)
+	if got, want := got.Status, events.Status_Cancelled; got != want {
+		t.Fatalf("order status is %v, want %v", got, want)
+	}
+}
+
+func TestOnPaymentCreated(t *testing.T) {
+	fakeOC := newFakeOrdersCollection()
+	l, err := newListener(fakeOC, newFakeNatsConn())
+	if err != nil {
+		t.Fatalf("newListener: %v", err)
+	}
+
+	order := fakeOC.createWrapper("1", events.Status_Created, 10.0)
+	paymentEvent, err := marshalPaymentCreated(Payment{OrderId: order.Id, ChargeId: "ch_fake_0", Id: "2"})
+	if err != nil {
+		t.Fatalf("marshalPaymentCreated: %v", err)
+	}
+
+	// a payment for an unknown order must be redelivered
+	unknownEvent, err := marshalPaymentCreated(Payment{OrderId: "-1", Id: "3"})
+	if err != nil {
+		t.Fatalf("marshalPaymentCreated: %v", err)
+	}
+	if err := l.onPaymentCreated(unknownEvent); err == nil {
+		t.Fatal("onPaymentCreated should fail for an unknown order")
+	}
+
+	if err := l.onPaymentCreated(paymentEvent); err != nil {
+		t.Fatalf("onPaymentCreated: %v", err)
+	}
+	got, _ := fakeOC.read(order.Id)
+	if got, want := got.Status, events.Status_Completed; got != want {
+		t.Fatalf("order status is %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/stan.go"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	dbName                 = "app"
+	ordersCollectionName   = "orders"
+	paymentsCollectionName = "payments"
+	dbTimeout              = 3 * time.Second
+)
+
+var (
+	InfoLogger *log.Logger
+	//WarningLogger *log.Logger
+	ErrorLogger *log.Logger
+)
+
+func init() {
+	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
+	//WarningLogger = log.New(os.Stdout, "WARNING: ", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
+	ErrorLogger = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
+}
+
+type groupCloser struct {
+	httpServer  *http.Server
+	relay       *relay
+	stan        stan.Conn
+	mongoClient *mongo.Client
+}
+
+func (gc groupCloser) shutdown(code int) {
+	// shutdown order: gin -> outbox relay -> nats -> mongo
+	// allow 90 seconds for everything to shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	InfoLogger.Print("shutting down the gin HTTP server")
+	if gc.httpServer != nil {
+		if err := gc.httpServer.Shutdown(ctx); err != nil {
+			panic(err)
+		}
+	}
+
+	InfoLogger.Print("stopping the outbox relay")
+	if gc.relay != nil {
+		gc.relay.stop()
+	}
+
+	InfoLogger.Print("shutting down the NATS connection")
+	if gc.stan != nil {
+		if err := gc.stan.Close(); err != nil {
+			panic(err)
+		}
+	}
+
+	InfoLogger.Print("shutting down the MongoDB connection")
+	if gc.mongoClient != nil {
+		if err := gc.mongoClient.Disconnect(ctx); err != nil {
+			panic(err)
+		}
+	}
+
+	InfoLogger.Print("all service connections shut down")
+	os.Exit(code)
+}
+
+type mainConfig map[string]string
+
+func genMainConfig() (mainConfig, []string) {
+	var missingEnvs []string
+	conf := mainConfig{}
+	envToErrString := map[string]string{
+		"MONGO_CONN_STR":   "missing mongo connection: MONGO_CONN_STR",
+		"JWKS_URL":         "missing auth JWKS endpoint: JWKS_URL",
+		"NATS_CLUSTER_ID":  "missing NATS cluster ID: NATS_CLUSTER_ID",
+		"NATS_CLIENT_ID":   "missing NATS client ID: NATS_CLIENT_ID",
+		"NATS_CONN_STR":    "missing NATS connection string: NATS_CONN_STR",
+		"PAYMENT_PROVIDER": "missing payment provider: PAYMENT_PROVIDER",
+	}
+	for key, errStr := range envToErrString {
+		if val, ok := os.LookupEnv(key); !ok {
+			missingEnvs = append(missingEnvs, errStr)
+		} else {
+			conf[key] = val
+		}
+	}
+	return conf, missingEnvs
+}
+
+func main() {
+	// for handling graceful shutdown of all required services
+	gc := groupCloser{}
+
+	// parse environment variables for startup info
+	conf, missingEnvs := genMainConfig()
+	if len(missingEnvs) > 0 {
+		for _, errStr := range missingEnvs {
+			ErrorLogger.Print(errStr)
+		}
+		os.Exit(1)
+	}
+
+	// init MongoDB collections
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	client, err := mongo.NewClient(options.Client().ApplyURI(conf["MONGO_CONN_STR"]))
+	if err != nil {
+		ErrorLogger.Printf("mongo.NewClient: %v", err)
+		gc.shutdown(1)
+	}
+	if err := client.Connect(ctx); err != nil {
+		ErrorLogger.Printf("mongo client.Connect: %v", err)
+		gc.shutdown(1)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		ErrorLogger.Printf("mongo client.Ping: %v", err)
+		gc.shutdown(1)
+	}
+	InfoLogger.Print("connected to MongoDB")
+	gc.mongoClient = client
+	db := client.Database(dbName)
+
+	oc := newOrdersCollection(db.Collection(ordersCollectionName), dbTimeout)
+	pc := newPaymentsCollection(db.Collection(paymentsCollectionName), dbTimeout)
+	if err := createPaymentIndexes(db.Collection(paymentsCollectionName), dbTimeout); err != nil {
+		ErrorLogger.Printf("could not create payment indexes: %v", err)
+		gc.shutdown(1)
+	}
+	if err := createOutboxIndexes(db.Collection(outboxCollectionName), dbTimeout); err != nil {
+		ErrorLogger.Printf("unable to create outbox indexes: %v", err)
+		gc.shutdown(1)
+	}
+
+	// init the payment provider used to charge users
+	provider, err := newPaymentProvider(conf["PAYMENT_PROVIDER"])
+	if err != nil {
+		ErrorLogger.Printf("could not create payment provider: %v", err)
+		gc.shutdown(1)
+	}
+
+	// init NATS Streaming Server connection
+	natsClient, err := stan.Connect(conf["NATS_CLUSTER_ID"], conf["NATS_CLIENT_ID"], stan.NatsURL(conf["NATS_CONN_STR"]))
+	if err != nil {
+		ErrorLogger.Printf("stan.Connect: %v", err)
+		gc.shutdown(1)
+	}
+	InfoLogger.Print("connected to NATS Streaming Server")
+	gc.stan = natsClient
+
+	// publish payment events saved to the outbox
+	outboxRelay := newRelay(newOutboxCollection(db.Collection(outboxCollectionName), dbTimeout), natsClient, relayInterval)
+	outboxRelay.start()
+	gc.relay = outboxRelay
+
+	// listen for order events and for our own payment events once they are published
+	eventListener, err := newListener(oc, natsClient)
+	if err != nil {
+		ErrorLogger.Printf("could not create event listener: %v", err)
+		gc.shutdown(1)
+		return
+	}
+	if err := eventListener.listen(); err != nil {
+		ErrorLogger.Printf("could not subscribe to events: %v", err)
+		gc.shutdown(1)
+	}
+
+	// reject tokens revoked by the auth service
+	revoked := middleware.NewRevocationCache()
+	if err := revoked.ListenRevocations(natsClient, ErrorLogger); err != nil {
+		ErrorLogger.Printf("could not subscribe to token revocations: %v", err)
+		gc.shutdown(1)
+	}
+
+	// session tokens are signed by the auth service; only verify them here
+	jwtValidator := middleware.NewJWKSValidator(conf["JWKS_URL"], middleware.DefaultJWKSRefresh)
+
+	// create gin router and bind handlers/routes to it
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+	server, err := newApiServer(jwtValidator, r, oc, pc, provider, revoked, middleware.DefaultTokenSources())
+	if err != nil {
+		ErrorLogger.Printf("could not create new API server")
+		gc.shutdown(1)
+		return // this will never be called but it makes the IDE happy
+	}
+	// start HTTP server and set the gin router as the server handler
+	httpServer := &http.Server{
+		Addr:    ":4000",
+		Handler: server.router,
+	}
+	gc.httpServer = httpServer
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			ErrorLogger.Printf("unable to start HTTP server: %v", err)
+			gc.shutdown(1)
+		}
+	}()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	// SIGINT signal received, begin graceful shutdown
+	case <-c:
+		InfoLogger.Print("beginning graceful shutdown")
+		gc.shutdown(0)
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Order is the payments service's replica of an order owned by the orders service
+type Order struct {
+	UserId string        `bson:"userId"`
+	Status events.Status `bson:"status"`
+	Price  float64       `bson:"price"`
+	Id     string        `bson:"_id,omitempty"`
+}
+
+// errInvalidOrderId is returned by read for ids that cannot belong to an order
+var errInvalidOrderId = errors.New("invalid order id")
+
+type ordersCRUD interface {
+	create(Order) (string, error)
+	read(string) (*Order, error)
+	updateStatus(string, events.Status) (bool, error)
+}
+
+type ordersCollection struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func newOrdersCollection(collection *mongo.Collection, timeout time.Duration) ordersCRUD {
+	return ordersCollection{
+		collection,
+		timeout,
+	}
+}
+
+// orders are keyed by the ID assigned by the orders service
+// create only inserts if the order is unknown so redelivered order:created events are a no-op
+func (o ordersCollection) create(order Order) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	mongoId, err := primitive.ObjectIDFromHex(order.Id)
+	if err != nil {
+		return "", err
+	}
+
+	filter := bson.M{"_id": mongoId}
+	update := bson.M{"$setOnInsert": bson.M{
+		"userId": order.UserId,
+		"status": order.Status,
+		"price":  order.Price,
+	}}
+	if _, err := o.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return "", err
+	}
+
+	return mongoId.Hex(), nil
+}
+
+func (o ordersCollection) read(id string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	mongoId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errInvalidOrderId
+	}
+
+	res := o.collection.FindOne(ctx, bson.M{"_id": mongoId})
+	if res.Err() != nil && res.Err() != mongo.ErrNoDocuments {
+		return nil, res.Err()
+	} else if res.Err() == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	var order Order
+	if err := res.Decode(&order); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func (o ordersCollection) updateStatus(id string, status events.Status) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	mongoId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{"_id": mongoId}
+	update := bson.M{"$set": bson.M{"status": status}}
+	res, err := o.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	if res.MatchedCount > 0 {
+		return true, nil
+	}
+	return false, nil
+}
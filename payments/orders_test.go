@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakeOrdersCollection struct {
+	orders map[string]Order
+	id     int
+}
+
+func newFakeOrdersCollection() *fakeOrdersCollection {
+	return &fakeOrdersCollection{
+		make(map[string]Order),
+		0,
+	}
+}
+
+func (f *fakeOrdersCollection) create(order Order) (string, error) {
+	// orders replicated from events carry their own ID and are only inserted once
+	if order.Id != "" {
+		if _, ok := f.orders[order.Id]; !ok {
+			f.orders[order.Id] = order
+		}
+		return order.Id, nil
+	}
+	currId := strconv.Itoa(f.id)
+	order.Id = currId
+	f.id++
+	f.orders[currId] = order
+	return currId, nil
+}
+
+func (f *fakeOrdersCollection) read(id string) (*Order, error) {
+	// fake order ids are numbers, orders replicated from events carry an ObjectID
+	if _, err := strconv.Atoi(id); err != nil {
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			return nil, errInvalidOrderId
+		}
+	}
+	order, ok := f.orders[id]
+	if !ok {
+		return nil, nil
+	}
+	return &order, nil
+}
+
+func (f *fakeOrdersCollection) updateStatus(id string, status events.Status) (bool, error) {
+	order, ok := f.orders[id]
+	if !ok {
+		return false, nil
+	}
+	order.Status = status
+	f.orders[id] = order
+	return true, nil
+}
+
+// a wrapper around the create method
+func (f *fakeOrdersCollection) createWrapper(uid string, status events.Status, price float64) Order {
+	order := Order{
+		UserId: uid,
+		Status: status,
+		Price:  price,
+	}
+	oid, _ := f.create(order)
+	order.Id = oid
+	return order
+}
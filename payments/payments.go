@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errPaymentExists is returned by create when the order already has a payment, pending or not
+var errPaymentExists = errors.New("order already has a payment")
+
+// Payment records a charge against an order
+// it is saved as pending before the provider is charged, so only one request can charge an order
+type Payment struct {
+	OrderId  string `bson:"orderId"`
+	ChargeId string `bson:"chargeId"`
+	Pending  bool   `bson:"pending"`
+	Id       string `bson:"_id,omitempty"`
+}
+
+type PaymentReq struct {
+	OrderId string `json:"orderId"`
+	Token   string `json:"token"`
+}
+
+type PaymentResp struct {
+	OrderId  string
+	ChargeId string
+	Id       string
+}
+
+type paymentsCRUD interface {
+	create(Payment) (string, error)
+	complete(id, chargeId string, events ...outboxEvent) error
+	remove(id string) error
+}
+
+type paymentsCollection struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+func newPaymentsCollection(collection *mongo.Collection, timeout time.Duration) paymentsCRUD {
+	return paymentsCollection{
+		collection,
+		timeout,
+	}
+}
+
+// orderPaymentIndex allows a single payment per order, so concurrent requests cannot both charge it
+var orderPaymentIndex = mongo.IndexModel{
+	Keys: bson.M{"orderId": 1},
+	Options: options.Index().
+		SetName("order_payment").
+		SetUnique(true),
+}
+
+func createPaymentIndexes(collection *mongo.Collection, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, orderPaymentIndex)
+	return err
+}
+
+// create saves the payment, if the order already has one errPaymentExists is returned
+func (p paymentsCollection) create(payment Payment) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	res, err := p.collection.InsertOne(ctx, payment)
+	if isDuplicateKeyError(err) {
+		return "", errPaymentExists
+	} else if err != nil {
+		return "", err
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func isDuplicateKeyError(err error) bool {
+	var we mongo.WriteException
+	if !errors.As(err, &we) {
+		return false
+	}
+	for _, e := range we.WriteErrors {
+		if e.Code == 11000 {
+			return true
+		}
+	}
+	return false
+}
+
+// complete records the provider's charge on a pending payment
+// events are saved to the outbox in the same transaction, so the payment is never saved without them
+func (p paymentsCollection) complete(id, chargeId string, events ...outboxEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	mongoId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": mongoId, "pending": true}
+	update := bson.M{"$set": bson.M{"chargeId": chargeId, "pending": false}}
+	return withTransaction(ctx, p.collection, func(sc mongo.SessionContext) error {
+		res, err := p.collection.UpdateOne(sc, filter, update)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return fmt.Errorf("no pending payment with id: %v", id)
+		}
+		return insertEvents(sc, p.collection, events...)
+	})
+}
+
+// remove deletes a pending payment whose charge failed, so the order can be paid for again
+func (p paymentsCollection) remove(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	mongoId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.collection.DeleteOne(ctx, bson.M{"_id": mongoId, "pending": true})
+	return err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+type fakePaymentsCollection struct {
+	payments map[string]Payment
+	id       int
+	outbox   []outboxEvent
+}
+
+func newFakePaymentsCollection() *fakePaymentsCollection {
+	return &fakePaymentsCollection{
+		make(map[string]Payment),
+		0,
+		nil,
+	}
+}
+
+func (f *fakePaymentsCollection) create(payment Payment) (string, error) {
+	for _, p := range f.payments {
+		if p.OrderId == payment.OrderId {
+			return "", errPaymentExists
+		}
+	}
+	currId := strconv.Itoa(f.id)
+	payment.Id = currId
+	f.id++
+	f.payments[currId] = payment
+	return currId, nil
+}
+
+func (f *fakePaymentsCollection) complete(id, chargeId string, events ...outboxEvent) error {
+	payment, ok := f.payments[id]
+	if !ok || !payment.Pending {
+		return errors.New("no pending payment with matching ID found")
+	}
+	payment.ChargeId = chargeId
+	payment.Pending = false
+	f.payments[id] = payment
+	f.saveEvents(events...)
+	return nil
+}
+
+func (f *fakePaymentsCollection) remove(id string) error {
+	if payment, ok := f.payments[id]; ok && payment.Pending {
+		delete(f.payments, id)
+	}
+	return nil
+}
+
+func (f *fakePaymentsCollection) saveEvents(events ...outboxEvent) {
+	for _, event := range events {
+		event.Id = strconv.Itoa(len(f.outbox))
+		f.outbox = append(f.outbox, event)
+	}
+}
+
+func (f *fakePaymentsCollection) pending(limit int64) ([]outboxEvent, error) {
+	var pending []outboxEvent
+	for _, event := range f.outbox {
+		if int64(len(pending)) == limit {
+			break
+		}
+		if !event.Sent {
+			pending = append(pending, event)
+		}
+	}
+	return pending, nil
+}
+
+func (f *fakePaymentsCollection) markSent(id string) error {
+	idx, err := strconv.Atoi(id)
+	if err != nil || idx >= len(f.outbox) {
+		return errors.New("no event with matching ID found")
+	}
+	f.outbox[idx].Sent = true
+	return nil
+}
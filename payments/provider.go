@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// ErrPaymentDeclined is returned by a PaymentProvider when the payment token was rejected
+var ErrPaymentDeclined = errors.New("payment declined")
+
+// PaymentProvider charges a payment token on behalf of the payments service
+// amount is in cents, the returned string is the provider's charge ID
+type PaymentProvider interface {
+	Charge(amount int64, token string) (string, error)
+}
+
+func newPaymentProvider(name string) (PaymentProvider, error) {
+	switch name {
+	case "fake":
+		return newFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unsupported payment provider: %v", name)
+	}
+}
+
+// fakeDeclinedToken is always declined by the fake provider
+const fakeDeclinedToken = "tok_declined"
+
+// fakeProvider is an in-process payment processor for local development and tests
+// every token except fakeDeclinedToken is charged successfully
+type fakeProvider struct {
+	mu      sync.Mutex
+	charges map[string]int64
+}
+
+func newFakeProvider() *fakeProvider {
+	return &fakeProvider{
+		charges: make(map[string]int64),
+	}
+}
+
+func (f *fakeProvider) Charge(amount int64, token string) (string, error) {
+	if token == "" || token == fakeDeclinedToken {
+		return "", ErrPaymentDeclined
+	}
+	if amount <= 0 {
+		return "", fmt.Errorf("invalid charge amount: %v", amount)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	chargeId := "ch_fake_" + strconv.Itoa(len(f.charges))
+	f.charges[chargeId] = amount
+	return chargeId, nil
+}
+
+// toCents converts a ticket price into the smallest currency unit for a PaymentProvider
+func toCents(price float64) int64 {
+	return int64(math.Round(price * 100))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewPaymentProvider(t *testing.T) {
+	if _, err := newPaymentProvider("fake"); err != nil {
+		t.Fatalf("newPaymentProvider: %v", err)
+	}
+	if _, err := newPaymentProvider("DNE"); err == nil {
+		t.Fatal("newPaymentProvider should fail for an unknown provider")
+	}
+}
+
+func TestFakeProviderCharge(t *testing.T) {
+	provider := newFakeProvider()
+
+	chargeId, err := provider.Charge(1000, "tok_visa")
+	if err != nil {
+		t.Fatalf("Charge: %v", err)
+	}
+	if got, want := provider.charges[chargeId], int64(1000); got != want {
+		t.Fatalf("charged %v, want %v", got, want)
+	}
+
+	if _, err := provider.Charge(1000, fakeDeclinedToken); !errors.Is(err, ErrPaymentDeclined) {
+		t.Fatalf("Charge with a declined token: %v, want %v", err, ErrPaymentDeclined)
+	}
+	if _, err := provider.Charge(0, "tok_visa"); err == nil {
+		t.Fatal("Charge should fail for a zero amount")
+	}
+}
+
+func TestToCents(t *testing.T) {
+	tests := []struct {
+		price float64
+		want  int64
+	}{
+		{0, 0},
+		{1.0, 100},
+		{10.99, 1099},
+		{0.1 + 0.2, 30},
+	}
+	for _, test := range tests {
+		if got := toCents(test.price); got != test.want {
+			t.Errorf("toCents(%v) = %v, want %v", test.price, got, test.want)
+		}
+	}
+}
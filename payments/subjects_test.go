@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestSetOrderCreated(t *testing.T) {
+	var createdSubj string
+	if err := setOrderCreated(&createdSubj); err != nil {
+		t.Fatalf("setOrderCreated: %v", err)
+	}
+	if got, want := createdSubj, "order:created"; got != want {
+		t.Fatalf("wrong subject: %v, want %v", got, want)
+	}
+}
+
+func TestSetOrderCancelled(t *testing.T) {
+	var cancelledSubj string
+	if err := setOrderCancelled(&cancelledSubj); err != nil {
+		t.Fatalf("setOrderCancelled: %v", err)
+	}
+	if got, want := cancelledSubj, "order:cancelled"; got != want {
+		t.Fatalf("wrong subject: %v, want %v", got, want)
+	}
+}
+
+func TestSetPaymentCreated(t *testing.T) {
+	var createdSubj string
+	if err := setPaymentCreated(&createdSubj); err != nil {
+		t.Fatalf("setPaymentCreated: %v", err)
+	}
+	if got, want := createdSubj, "payment:created"; got != want {
+		t.Fatalf("wrong subject: %v, want %v", got, want)
+	}
+}
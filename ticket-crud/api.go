@@ -1,113 +1,90 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/basilnsage/mwn-ticketapp-common/events"
-	"github.com/basilnsage/mwn-ticketapp-common/subjects"
 	"github.com/basilnsage/mwn-ticketapp/middleware"
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
 	prometrics "github.com/basilnsage/prometheus-gin-metrics"
 	"github.com/gin-gonic/gin"
-	"github.com/nats-io/stan.go"
 	"google.golang.org/protobuf/proto"
 )
 
+// codes of the problems the ticket routes respond with
+const (
+	codeTicketNotFound = "ticket_not_found"
+	codeNotTicketOwner = "not_ticket_owner"
+	codeTicketReserved = "ticket_reserved"
+	codeTicketModified = "ticket_modified"
+)
+
 type apiServer struct {
-	db     CRUD
-	eBus   stan.Conn
-	router *gin.Engine
+	db      CRUD
+	router  *gin.Engine
+	revoked *middleware.RevocationCache
+	// sources are where session tokens are read from
+	sources []middleware.TokenSource
 }
 
-func newApiServer(pass string, r *gin.Engine, crud CRUD, stan stan.Conn) (*apiServer, error) {
+func newApiServer(v *middleware.JWTValidator, r *gin.Engine, crud CRUD, revoked *middleware.RevocationCache, sources []middleware.TokenSource) (*apiServer, error) {
 	a := &apiServer{}
+	a.revoked = revoked
+	a.sources = sources
 
 	if err := setSubjects(); err != nil {
 		return nil, fmt.Errorf("could not set NATS subscription subjects: %v", err)
 	}
 
 	a.router = r
-	if err := a.bindRoutes(pass); err != nil {
+	if err := a.bindRoutes(v); err != nil {
 		return nil, fmt.Errorf("unable to bind routes to router: %v", err)
 	}
 
 	a.db = crud
-	a.eBus = stan
 
 	return a, nil
 }
 
-func (a *apiServer) bindRoutes(jwtKey string) error {
-	jwtValidator, err := middleware.NewJWTValidator([]byte(jwtKey), "HS256")
-	if err != nil {
-		return fmt.Errorf("NewJWTValidator: %v", err)
-	}
-
+func (a *apiServer) bindRoutes(jwtValidator *middleware.JWTValidator) error {
 	promRegistry := prometrics.NewRegistry()
 	a.router.Use(promRegistry.ReportDuration(
 		[]float64{0.005, 0.01, 0.05, 0.1, 0.5, 1.0, 2.0, 5.0},
 	))
 	a.router.GET("/tickets/metrics", promRegistry.DefaultHandler)
+	a.router.Use(problem.Handler())
 
-	userValidationMiddleware := middleware.UserValidator(jwtValidator, "auth-jwt")
+	userValidationMiddleware := middleware.UserValidatorFrom(jwtValidator, a.revoked, a.sources...)
 	ticketRoutes := a.router.Group("/api/tickets")
-	ticketRoutes.POST(
-		"/create",
-		userValidationMiddleware,
-		func(c *gin.Context) {
-			a.serveCreate(c, jwtValidator)
-		},
-	)
+	ticketRoutes.POST("/create", userValidationMiddleware, middleware.RequireRole(middleware.RoleSeller), middleware.RequireVerified(), a.serveCreate)
 	ticketRoutes.GET("", a.serveReadAll)
 	ticketRoutes.GET("/:id", a.serveReadOne)
-	ticketRoutes.PUT(
-		"/:id",
-		userValidationMiddleware,
-		func(c *gin.Context) {
-			a.serveUpdate(c, jwtValidator)
-		},
-	)
+	ticketRoutes.PUT("/:id", userValidationMiddleware, a.serveUpdate)
 
 	return nil
 }
 
-func (a *apiServer) serveCreate(c *gin.Context, v *middleware.JWTValidator) {
+func (a *apiServer) serveCreate(c *gin.Context) {
 	// parse gin context for JSON body
 	var tik TicketReq
-	if err := c.BindJSON(&tik); err != nil {
-		WarningLogger.Printf("could not parse body of request, err: %v", err)
-		c.JSON(http.StatusBadRequest, ErrorResp{[]string{"unable to process request"}})
+	if err := c.ShouldBindJSON(&tik); err != nil {
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "unable to process request").WithCause(err))
 		return
 	}
 
-	// parse user id from auth-jwt header
-	jwtHeader := c.GetHeader("auth-jwt")
-	if jwtHeader == "" {
-		ErrorLogger.Print("no auth-jwt header found while creating ticket. This should never happen")
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal server error"}})
+	// user id from the session token, parsed by the user validation middleware
+	userClaims, ok := middleware.ClaimsFromContext(c)
+	if !ok {
+		problem.Abort(c, problem.Internal("internal server error", errors.New("no user claims found while creating ticket, this should never happen")))
 		return
 	}
-
-	var userClaims middleware.UserClaims
-	if err := userClaims.NewFromToken(v, jwtHeader); err != nil {
-		ErrorLogger.Printf("could not parse auth-jwt header while creating ticket: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal server error"}})
-	}
-	uid := userClaims.Id
+	uid := userClaims.ID
 
 	// validate fields
-	if ok, validationErrors := tik.isValid(); !ok {
-		WarningLogger.Printf("ticket validation failed, err: %v", strings.Join(validationErrors, " | "))
-		c.JSON(http.StatusBadRequest, ErrorResp{validationErrors})
-		return
-	}
-
-	// insert new ticket object into DB
-	tikId, err := a.db.Create(tik.Title, tik.Price, uid)
-	if err != nil {
-		ErrorLogger.Printf("failed to write ticket to database, err: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"unable to save ticket"}})
+	if params := tik.validate(); len(params) > 0 {
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "ticket is not valid", params...))
 		return
 	}
 
@@ -115,32 +92,43 @@ func (a *apiServer) serveCreate(c *gin.Context, v *middleware.JWTValidator) {
 		Title: tik.Title,
 		Price: tik.Price,
 		Owner: uid,
-		Id:    tikId,
 	}
 
-	createTicketSubject, _ := subjects.StringifySubject(subjects.Subject_TICKET_CREATED)
-	// publish new ticket to event bus
-	if err := resp.publish(a.eBus, createTicketSubject); err != nil {
-		ErrorLogger.Printf("unable to publish create ticket event: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal server error"}})
+	// insert new ticket object into DB, the created event is saved with it and published by the relay
+	tikId, err := a.db.Create(tik.Title, tik.Price, uid, func(id string) (outboxEvent, error) {
+		created := resp
+		created.Id = id
+		return created.event(createTicketSubject)
+	})
+	if err != nil {
+		problem.Abort(c, problem.Internal("unable to save ticket", fmt.Errorf("failed to write ticket to database: %v", err)))
 		return
 	}
+	resp.Id = tikId
 
 	// return object ID, title, price
 	c.JSON(http.StatusCreated, resp)
 	InfoLogger.Printf("new ticket saved with id: %v", tikId)
 }
 
+// serveReadAll returns a page of tickets
+// pass the returned next cursor as the after query parameter to fetch the following page
 func (a *apiServer) serveReadAll(c *gin.Context) {
-	tickets, err := a.db.ReadAll()
+	query, params := ticketQueryFromParams(c.Request.URL.Query())
+	if len(params) > 0 {
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "query is not valid", params...))
+		return
+	}
+
+	tickets, next, err := a.db.ReadAll(query)
 	if err != nil {
-		ErrorLogger.Printf("unable to fetch all tickets from DB: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal server error"}})
+		problem.Abort(c, problem.Internal("internal server error", fmt.Errorf("unable to fetch tickets from DB: %v", err)))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"tickets": tickets,
+		"next":    next,
 	})
 }
 
@@ -149,89 +137,83 @@ func (a *apiServer) serveReadOne(c *gin.Context) {
 	tik, err := a.db.ReadOne(id)
 
 	if err != nil {
-		ErrorLogger.Printf("unable to fetch ticket from DB: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal server error"}})
+		problem.Abort(c, problem.Internal("internal server error", fmt.Errorf("unable to fetch ticket from DB: %v", err)))
 		return
 	}
 
 	if tik == nil {
-		c.Status(http.StatusNotFound)
+		problem.Abort(c, problem.NotFound(codeTicketNotFound, "could not find ticket: "+id))
 		return
 	}
 
 	c.JSON(http.StatusOK, tik)
 }
 
-func (a *apiServer) serveUpdate(c *gin.Context, v *middleware.JWTValidator) {
+func (a *apiServer) serveUpdate(c *gin.Context) {
 	id := c.Param("id")
 	tik, err := a.db.ReadOne(id)
-	if tik == nil {
-		c.Status(http.StatusNotFound)
+	if err != nil {
+		problem.Abort(c, problem.Internal("internal server error", fmt.Errorf("could not read ticket from DB: %v", err)))
 		return
 	}
-	if err != nil {
-		ErrorLogger.Printf("could not read ticket from DB: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal server error"}})
+	if tik == nil {
+		problem.Abort(c, problem.NotFound(codeTicketNotFound, "could not find ticket: "+id))
 		return
 	}
 
 	// read ticket from DB without error
-	// make sure ticket owner matches originating user id
-	userJWT := c.GetHeader("auth-jwt")
-	if userJWT == "" {
-		ErrorLogger.Print("no auth-jwt header found! this should never happen")
-		c.JSON(http.StatusUnauthorized, ErrorResp{[]string{"Internal server error"}})
+	// make sure ticket owner matches originating user id, admins can moderate any ticket
+	reqUser, ok := middleware.ClaimsFromContext(c)
+	if !ok {
+		problem.Abort(c, problem.Internal("internal server error", errors.New("no user claims found while updating ticket, this should never happen")))
 		return
 	}
 
-	reqUser := new(middleware.UserClaims)
-	if err = reqUser.NewFromToken(v, userJWT); err != nil {
-		ErrorLogger.Printf("unable to parse auth-jwt header! This should never happen")
-		c.JSON(http.StatusUnauthorized, ErrorResp{[]string{"Unauthorized"}})
+	if tik.Owner != reqUser.ID && !reqUser.HasRole(middleware.RoleAdmin) {
+		problem.Abort(c, problem.Forbidden(codeNotTicketOwner, "only the owner can edit a ticket"))
 		return
 	}
 
-	if tik.Owner != reqUser.Id {
-		c.JSON(http.StatusUnauthorized, ErrorResp{[]string{"Unauthorized"}})
+	// buyers must be charged the price they reserved the ticket at
+	if tik.OrderId != "" {
+		problem.Abort(c, problem.Conflict(codeTicketReserved, "ticket is reserved and cannot be edited"))
 		return
 	}
 
 	var tikReq TicketReq
-	if err := c.BindJSON(&tikReq); err != nil {
-		WarningLogger.Printf("could not parse body of request, err: %v", err)
-		c.JSON(http.StatusBadRequest, ErrorResp{[]string{"unable to process request"}})
+	if err := c.ShouldBindJSON(&tikReq); err != nil {
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "unable to process request").WithCause(err))
 		return
 	}
 
 	// validate fields
-	if ok, validationErrors := tikReq.isValid(); !ok {
-		WarningLogger.Printf("ticket validation failed, err: %v", strings.Join(validationErrors, " | "))
-		c.JSON(http.StatusBadRequest, ErrorResp{validationErrors})
+	if params := tikReq.validate(); len(params) > 0 {
+		problem.Abort(c, problem.Validation(problem.CodeValidation, "ticket is not valid", params...))
 		return
 	}
 
-	ok, err := a.db.Update(id, tikReq.Title, tikReq.Price)
-	if !ok {
-		WarningLogger.Printf("no DB record modified")
-		c.Status(http.StatusNotFound)
-		return
+	resp := TicketResp{
+		Title:   tikReq.Title,
+		Price:   tikReq.Price,
+		Owner:   tik.Owner,
+		Version: tik.Version + 1,
+		Id:      tik.Id,
 	}
+	event, err := resp.event(updateTicketSubject)
 	if err != nil {
-		ErrorLogger.Printf("unable to update ticket in DB: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal server error"}})
+		problem.Abort(c, problem.Internal("internal server error", fmt.Errorf("unable to create update ticket event: %v", err)))
 		return
 	}
 
-	resp := TicketResp{
-		Title: tikReq.Title,
-		Price: tikReq.Price,
-		Owner: tik.Owner,
-		Id:    tik.Id,
+	ok, err = a.db.Update(id, tik.Version, tikReq.Title, tikReq.Price, event)
+	if err != nil {
+		problem.Abort(c, problem.Internal("internal server error", fmt.Errorf("unable to update ticket in DB: %v", err)))
+		return
 	}
-	updateTicketSubject, _ := subjects.StringifySubject(subjects.Subject_TICKET_UPDATED)
-	if err := resp.publish(a.eBus, updateTicketSubject); err != nil {
-		ErrorLogger.Printf("unable to publish update ticket event: %v", err)
-		c.JSON(http.StatusInternalServerError, ErrorResp{[]string{"Internal server error"}})
+	// the ticket was read above so a miss here means someone else updated it in the meantime
+	if !ok {
+		WarningLogger.Printf("no DB record modified, ticket version %v is stale", tik.Version)
+		problem.Abort(c, problem.Conflict(codeTicketModified, "ticket was modified, please try again"))
 		return
 	}
 
@@ -243,25 +225,25 @@ type TicketReq struct {
 	Price float64
 }
 
-// checks a TicketReq struct to ensure all fields are non-empty and within proper bounds
-func (t TicketReq) isValid() (res bool, issues []string) {
-	res = true
+// validate checks a TicketReq struct to ensure all fields are non-empty and within proper bounds
+// it returns the fields that are not
+func (t TicketReq) validate() (params []problem.InvalidParam) {
 	if t.Title == "" {
-		issues = append(issues, "please specify a title")
-		res = false
+		params = append(params, problem.InvalidParam{Name: "title", Reason: "please specify a title"})
 	}
 	if t.Price < 0.0 {
-		issues = append(issues, "price cannot be less than 0")
-		res = false
+		params = append(params, problem.InvalidParam{Name: "price", Reason: "price cannot be less than 0"})
 	}
-	return res, issues
+	return params
 }
 
 type TicketResp struct {
-	Title string
-	Price float64
-	Owner string
-	Id    string `bson:"_id"`
+	Title   string
+	Price   float64
+	Owner   string
+	Version uint
+	OrderId string `bson:"orderId,omitempty"`
+	Id      string `bson:"_id"`
 }
 
 func ticketRespFromProto(data []byte) (*TicketResp, error) {
@@ -273,26 +255,24 @@ func ticketRespFromProto(data []byte) (*TicketResp, error) {
 		resp.Title,
 		resp.Price,
 		resp.Owner,
+		uint(resp.Version),
+		resp.OrderId,
 		resp.Id,
 	}, nil
 }
 
-func (t TicketResp) publish(stan stan.Conn, subj string) error {
-	createEvent, err := proto.Marshal(&events.CreateUpdateTicket{
-		Title: t.Title,
-		Price: t.Price,
-		Owner: t.Owner,
-		Id:    t.Id,
+// event marshals the ticket into an outbox event for subj
+func (t TicketResp) event(subj string) (outboxEvent, error) {
+	data, err := proto.Marshal(&events.CreateUpdateTicket{
+		Title:   t.Title,
+		Price:   t.Price,
+		Owner:   t.Owner,
+		Id:      t.Id,
+		Version: uint32(t.Version),
+		OrderId: t.OrderId,
 	})
 	if err != nil {
-		return err
+		return outboxEvent{}, err
 	}
-	if err := stan.Publish(subj, createEvent); err != nil {
-		return err
-	}
-	return nil
-}
-
-type ErrorResp struct {
-	Errors []string `json:"errors"`
+	return newOutboxEvent(subj, data), nil
 }
@@ -1,4 +1,4 @@
 #!/bin/bash
 
 version=0.0.3
-docker build -t basilnsage/mwn-ticketapp.crud:"$version" -t basilnsage/mwn-ticketapp.crud:latest .
+docker build -t basilnsage/mwn-ticketapp.crud:"$version" -t basilnsage/mwn-ticketapp.crud:latest -f Dockerfile ..
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"regexp"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -10,11 +11,14 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ticket writes also save the event describing the change to the outbox
 type CRUD interface {
-	Create(string, float64, string) (string, error)
+	Create(string, float64, string, eventBuilder) (string, error)
 	ReadOne(string) (*TicketResp, error)
-	ReadAll() ([]TicketResp, error)
-	Update(string, string, float64) (bool, error)
+	ReadAll(TicketQuery) ([]TicketResp, string, error)
+	Update(string, uint, string, float64, outboxEvent) (bool, error)
+	SetOrder(string, uint, string, outboxEvent) (bool, error)
+	outboxStore
 	Closer
 }
 
@@ -24,6 +28,7 @@ type Closer interface {
 
 type MongoColl struct {
 	coll    *mongo.Collection
+	outbox  *mongo.Collection
 	timeout time.Duration
 }
 
@@ -42,17 +47,35 @@ func newCrud(timeout time.Duration, connStr, db, coll string) (CRUD, error) {
 		return nil, err
 	}
 
-	return &MongoColl{client.Database(db).Collection(coll), timeout}, nil
+	database := client.Database(db)
+	outbox := database.Collection(outboxCollectionName)
+	if err := createOutboxIndexes(outbox, timeout); err != nil {
+		return nil, err
+	}
+	return &MongoColl{database.Collection(coll), outbox, timeout}, nil
 }
 
-func (c *MongoColl) Create(title string, price float64, owner string) (string, error) {
+func (c *MongoColl) Create(title string, price float64, owner string, newEvent eventBuilder) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
-	res, err := c.coll.InsertOne(ctx, bson.M{"title": title, "price": price, "owner": owner})
+
+	// generate the id up front so the event can reference the ticket
+	id := primitive.NewObjectID()
+	event, err := newEvent(id.Hex())
+	if err != nil {
+		return "", err
+	}
+
+	err = c.withTransaction(ctx, func(sc mongo.SessionContext) error {
+		doc := bson.M{"_id": id, "title": title, "price": price, "owner": owner, "version": 0}
+		if _, err := c.coll.InsertOne(sc, doc); err != nil {
+			return err
+		}
+		return c.insertEvent(sc, event)
+	})
 	if err != nil {
 		return "", err
 	}
-	id := res.InsertedID.(primitive.ObjectID)
 	return id.Hex(), nil
 }
 
@@ -76,24 +99,95 @@ func (c *MongoColl) ReadOne(id string) (*TicketResp, error) {
 	return tik, nil
 }
 
-func (c *MongoColl) ReadAll() ([]TicketResp, error) {
+// ReadAll returns a page of tickets matching the query and the cursor for the next page
+// pages are keyed on the sort field and the ticket id so results stay stable as tickets are added
+func (c *MongoColl) ReadAll(q TicketQuery) ([]TicketResp, string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
-	var results []TicketResp
-	cursor, err := c.coll.Find(ctx, bson.D{})
+	filter, err := ticketFilter(q)
 	if err != nil {
-		return []TicketResp{}, err
+		return nil, "", err
 	}
 
+	// ObjectIDs start with their creation time, so sorting by _id sorts by creation time
+	direction := 1
+	if q.descending() {
+		direction = -1
+	}
+	sort := bson.D{{Key: "_id", Value: direction}}
+	if q.byPrice() {
+		sort = bson.D{{Key: "price", Value: direction}, {Key: "_id", Value: direction}}
+	}
+
+	// read one extra ticket to find out if there is another page
+	opts := options.Find().SetSort(sort).SetLimit(q.Limit + 1)
+	cursor, err := c.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	results := make([]TicketResp, 0)
 	if err := cursor.All(ctx, &results); err != nil {
-		return []TicketResp{}, err
+		return nil, "", err
 	}
 
-	return results, nil
+	results, next := nextCursor(results, q.Limit)
+	return results, next, nil
 }
 
-func (c *MongoColl) Update(id string, title string, price float64) (bool, error) {
+func ticketFilter(q TicketQuery) (bson.M, error) {
+	var conditions []bson.M
+
+	price := bson.M{}
+	if q.MinPrice != nil {
+		price["$gte"] = *q.MinPrice
+	}
+	if q.MaxPrice != nil {
+		price["$lte"] = *q.MaxPrice
+	}
+	if len(price) > 0 {
+		conditions = append(conditions, bson.M{"price": price})
+	}
+	if q.Owner != "" {
+		conditions = append(conditions, bson.M{"owner": q.Owner})
+	}
+	if q.Title != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q.Title), Options: "i"}
+		conditions = append(conditions, bson.M{"title": pattern})
+	}
+	if q.AvailableOnly {
+		conditions = append(conditions, bson.M{"orderId": bson.M{"$exists": false}})
+	}
+
+	if q.After != nil {
+		afterId, err := primitive.ObjectIDFromHex(q.After.Id)
+		if err != nil {
+			return nil, err
+		}
+		cmp := "$gt"
+		if q.descending() {
+			cmp = "$lt"
+		}
+		if q.byPrice() {
+			conditions = append(conditions, bson.M{"$or": []bson.M{
+				{"price": bson.M{cmp: q.After.Price}},
+				{"price": q.After.Price, "_id": bson.M{cmp: afterId}},
+			}})
+		} else {
+			conditions = append(conditions, bson.M{"_id": bson.M{cmp: afterId}})
+		}
+	}
+
+	if len(conditions) == 0 {
+		return bson.M{}, nil
+	}
+	return bson.M{"$and": conditions}, nil
+}
+
+// Update only applies if the stored ticket is still at the provided version
+// every successful update increments the version so other services can order ticket:updated events
+func (c *MongoColl) Update(id string, version uint, title string, price float64, event outboxEvent) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
@@ -103,15 +197,62 @@ func (c *MongoColl) Update(id string, title string, price float64) (bool, error)
 		return false, err
 	}
 
-	res, err := c.coll.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": bson.M{"title": title, "price": price}})
+	filter := bson.M{"_id": objId, "version": versionFilter(version)}
+	update := bson.M{
+		"$set": bson.M{"title": title, "price": price},
+		"$inc": bson.M{"version": 1},
+	}
+	return c.updateWithEvent(ctx, filter, update, event)
+}
+
+// SetOrder reserves the ticket for an order, an empty orderId releases the reservation
+// like Update, it only applies if the stored ticket is still at the provided version and increments the version
+func (c *MongoColl) SetOrder(id string, version uint, orderId string, event outboxEvent) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	objId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return false, err
 	}
-	if res.MatchedCount == 0 || res.ModifiedCount == 0 {
-		return false, nil
+
+	filter := bson.M{"_id": objId, "version": versionFilter(version)}
+	update := bson.M{"$inc": bson.M{"version": 1}}
+	if orderId == "" {
+		update["$unset"] = bson.M{"orderId": ""}
+	} else {
+		update["$set"] = bson.M{"orderId": orderId}
+	}
+	return c.updateWithEvent(ctx, filter, update, event)
+}
+
+// versionFilter matches a ticket at the given version
+// tickets created before tickets were versioned have no version field, they are at version 0
+func versionFilter(version uint) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
 	}
+	return version
+}
 
-	return true, nil
+// updateWithEvent applies the update and saves the event in one transaction
+// the event is only saved if the update matched a ticket
+func (c *MongoColl) updateWithEvent(ctx context.Context, filter, update bson.M, event outboxEvent) (bool, error) {
+	var matched bool
+	err := c.withTransaction(ctx, func(sc mongo.SessionContext) error {
+		res, err := c.coll.UpdateOne(sc, filter, update)
+		if err != nil {
+			return err
+		}
+		if matched = res.MatchedCount > 0; !matched {
+			return nil
+		}
+		return c.insertEvent(sc, event)
+	})
+	if err != nil {
+		return false, err
+	}
+	return matched, nil
 }
 
 func (c *MongoColl) Close(ctx context.Context) error {
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestVersionFilter(t *testing.T) {
+	// tickets saved before they were versioned have no version field
+	if diff := cmp.Diff(versionFilter(0), bson.M{"$in": bson.A{0, nil}}); diff != "" {
+		t.Errorf("bad filter for version 0: %v", diff)
+	}
+	if diff := cmp.Diff(versionFilter(3), uint(3)); diff != "" {
+		t.Errorf("bad filter for version 3: %v", diff)
+	}
+}
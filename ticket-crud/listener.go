@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp/middleware/listen"
+	"github.com/nats-io/stan.go"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	queueGroup   = "tickets-service"
+	eventAckWait = 30 * time.Second
+)
+
+type listener struct {
+	db   CRUD
+	eBus stan.Conn
+}
+
+func newListener(db CRUD, eBus stan.Conn) (*listener, error) {
+	if err := setSubjects(); err != nil {
+		return nil, fmt.Errorf("unable to set NATS subjects: %v", err)
+	}
+
+	return &listener{
+		db,
+		eBus,
+	}, nil
+}
+
+// listen subscribes to the order events that reserve and release tickets
+func (l *listener) listen() error {
+	handlers := map[string]listen.Handler{
+		orderCreatedSubject:   l.onOrderCreated,
+		orderCancelledSubject: l.onOrderCancelled,
+	}
+
+	subscriber := listen.Subscriber{Group: queueGroup, AckWait: eventAckWait, Info: InfoLogger, Error: ErrorLogger}
+	return subscriber.Listen(l.eBus, handlers)
+}
+
+func (l *listener) onOrderCreated(data []byte) error {
+	var event events.OrderCreated
+	if err := proto.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("unable to unmarshal order: %v", err)
+	}
+	orderId, ticketId := event.GetData().GetId(), event.GetData().GetTicket().GetId()
+	if orderId == "" || ticketId == "" {
+		return fmt.Errorf("order event is missing the order or ticket id")
+	}
+
+	return l.setOrder(ticketId, orderId, func(tik *TicketResp) bool {
+		// redelivered event, the ticket is already reserved for this order
+		return tik.OrderId != orderId
+	})
+}
+
+func (l *listener) onOrderCancelled(data []byte) error {
+	var event events.OrderCancelled
+	if err := proto.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("unable to unmarshal order: %v", err)
+	}
+	orderId, ticketId := event.GetData().GetId(), event.GetData().GetTicket().GetId()
+	if orderId == "" || ticketId == "" {
+		return fmt.Errorf("order event is missing the order or ticket id")
+	}
+
+	return l.setOrder(ticketId, "", func(tik *TicketResp) bool {
+		// only release the ticket if it is still reserved by the cancelled order
+		return tik.OrderId == orderId
+	})
+}
+
+// setOrder sets the ticket reservation to orderId if shouldApply returns true for the stored ticket
+// the ticket:updated event is saved with the change so other services see the new version
+func (l *listener) setOrder(ticketId, orderId string, shouldApply func(*TicketResp) bool) error {
+	tik, err := l.db.ReadOne(ticketId)
+	if err != nil {
+		return fmt.Errorf("unable to read ticket: %v", err)
+	}
+	if tik == nil {
+		return fmt.Errorf("no ticket with id: %v", ticketId)
+	}
+	if !shouldApply(tik) {
+		InfoLogger.Printf("ticket reservation unchanged, id: %v", ticketId)
+		return nil
+	}
+
+	updated := *tik
+	updated.OrderId = orderId
+	updated.Version++
+	event, err := updated.event(updateTicketSubject)
+	if err != nil {
+		return fmt.Errorf("unable to create ticket update event: %v", err)
+	}
+
+	ok, err := l.db.SetOrder(ticketId, tik.Version, orderId, event)
+	if err != nil {
+		return fmt.Errorf("unable to update ticket: %v", err)
+	}
+	if !ok {
+		// the ticket changed between the read and the update, let NATS redeliver the event
+		return fmt.Errorf("ticket was modified, id: %v", ticketId)
+	}
+	InfoLogger.Printf("set reservation on ticket: %v, order: %v", ticketId, orderId)
+
+	return nil
+}
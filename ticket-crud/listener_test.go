@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/basilnsage/mwn-ticketapp-common/events"
+	"github.com/basilnsage/mwn-ticketapp-common/subjects"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestListener() (*listener, *fakeMongoCollection, *fakeNatsConn, error) {
+	fakeMongo := newFakeMongoCollection()
+	fakeStan := newFakeNatsConn()
+	l, err := newListener(fakeMongo, fakeStan)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return l, fakeMongo, fakeStan, nil
+}
+
+func marshalOrderCreated(t *testing.T, orderId, ticketId string) []byte {
+	data, err := proto.Marshal(&events.OrderCreated{
+		Subject: subjects.Subject_ORDER_CREATED,
+		Data: &events.CreatedData{
+			Id:     orderId,
+			Ticket: &events.CreatedData_Ticket{Id: ticketId},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to marshal order created event: %v", err)
+	}
+	return data
+}
+
+func marshalOrderCancelled(t *testing.T, orderId, ticketId string) []byte {
+	data, err := proto.Marshal(&events.OrderCancelled{
+		Subject: subjects.Subject_ORDER_CANCELLED,
+		Data: &events.CancelledData{
+			Id:     orderId,
+			Ticket: &events.CancelledData_Ticket{Id: ticketId},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to marshal order cancelled event: %v", err)
+	}
+	return data
+}
+
+func TestOnOrderCreated(t *testing.T) {
+	l, fakeMongo, fakeStan, err := newTestListener()
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	tid, _ := fakeMongo.Create("concert", 10.0, "1", noEvent)
+
+	if err := l.onOrderCreated(marshalOrderCreated(t, "order-1", tid)); err != nil {
+		t.Fatalf("unable to handle order created event: %v", err)
+	}
+
+	want := TicketResp{"concert", 10.0, "1", 1, "order-1", tid}
+	if diff := cmp.Diff(*fakeMongo.tickets[tid], want); diff != "" {
+		t.Errorf("ticket not reserved: %v", diff)
+	}
+
+	if err := newRelay(fakeMongo, fakeStan, relayInterval).relayPending(); err != nil {
+		t.Fatalf("unable to relay outbox: %v", err)
+	}
+	published := fakeStan.messages[updateTicketSubject]
+	if got, want := len(published), 1; got != want {
+		t.Fatalf("wrong number of published ticket updates: %v, want %v", got, want)
+	}
+	resp, err := ticketRespFromProto(published[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(*resp, want); diff != "" {
+		t.Errorf("bad published ticket: %v", diff)
+	}
+
+	// a redelivered event should not bump the version or publish again
+	if err := l.onOrderCreated(marshalOrderCreated(t, "order-1", tid)); err != nil {
+		t.Fatalf("unable to handle duplicate order created event: %v", err)
+	}
+	if got, want := fakeMongo.tickets[tid].Version, uint(1); got != want {
+		t.Errorf("duplicate event changed version: %v, want %v", got, want)
+	}
+	if err := newRelay(fakeMongo, fakeStan, relayInterval).relayPending(); err != nil {
+		t.Fatalf("unable to relay outbox: %v", err)
+	}
+	if got, want := len(fakeStan.messages[updateTicketSubject]), 1; got != want {
+		t.Errorf("duplicate event published update: %v, want %v", got, want)
+	}
+
+	if err := l.onOrderCreated(marshalOrderCreated(t, "order-2", "missing")); err == nil {
+		t.Error("expected error for an unknown ticket")
+	}
+}
+
+func TestOnOrderCancelled(t *testing.T) {
+	l, fakeMongo, fakeStan, err := newTestListener()
+	if err != nil {
+		t.Fatalf("unable to create listener: %v", err)
+	}
+	tid, _ := fakeMongo.Create("concert", 10.0, "1", noEvent)
+	if err := l.onOrderCreated(marshalOrderCreated(t, "order-1", tid)); err != nil {
+		t.Fatalf("unable to handle order created event: %v", err)
+	}
+
+	// cancelling a different order must not release the reservation
+	if err := l.onOrderCancelled(marshalOrderCancelled(t, "order-2", tid)); err != nil {
+		t.Fatalf("unable to handle order cancelled event: %v", err)
+	}
+	if got, want := fakeMongo.tickets[tid].OrderId, "order-1"; got != want {
+		t.Errorf("reservation released by another order: %v, want %v", got, want)
+	}
+
+	if err := l.onOrderCancelled(marshalOrderCancelled(t, "order-1", tid)); err != nil {
+		t.Fatalf("unable to handle order cancelled event: %v", err)
+	}
+	want := TicketResp{"concert", 10.0, "1", 2, "", tid}
+	if diff := cmp.Diff(*fakeMongo.tickets[tid], want); diff != "" {
+		t.Errorf("ticket not released: %v", diff)
+	}
+
+	if err := newRelay(fakeMongo, fakeStan, relayInterval).relayPending(); err != nil {
+		t.Fatalf("unable to relay outbox: %v", err)
+	}
+	published := fakeStan.messages[updateTicketSubject]
+	if got, want := len(published), 2; got != want {
+		t.Fatalf("wrong number of published ticket updates: %v, want %v", got, want)
+	}
+	resp, err := ticketRespFromProto(published[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(*resp, want); diff != "" {
+		t.Errorf("bad published ticket: %v", diff)
+	}
+}
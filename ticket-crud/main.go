@@ -10,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/basilnsage/mwn-ticketapp/middleware"
 	"github.com/gin-gonic/gin"
 	"github.com/nats-io/stan.go"
 )
@@ -32,8 +33,8 @@ func init() {
 	ErrorLogger = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
 }
 
-func gracefulShutdown(m Closer, n stan.Conn, h *http.Server) (errs []string) {
-	// shutdown order: gin -> nats -> mongo
+func gracefulShutdown(m Closer, rl *relay, n stan.Conn, h *http.Server) (errs []string) {
+	// shutdown order: gin -> outbox relay -> nats -> mongo
 	// allow 30 seconds for each service to shutdown
 	httpCtx, httpCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer httpCancel()
@@ -42,6 +43,9 @@ func gracefulShutdown(m Closer, n stan.Conn, h *http.Server) (errs []string) {
 		errs = append(errs, err.Error())
 	}
 
+	InfoLogger.Print("stopping the outbox relay")
+	rl.stop()
+
 	InfoLogger.Print("shutting down the NATS connection")
 	if err := n.Close(); err != nil {
 		errs = append(errs, err.Error())
@@ -63,16 +67,16 @@ func genMainConfig() (mainConfig, []string) {
 	conf := mainConfig{}
 	envToErrString := map[string]string{
 		"MONGO_CONN_STR":  "missing mongo connection: MONGO_CONN_STR",
-		"JWT_SIGN_KEY":    "missing JWT HS256 signing key: JWT_SIGN_KEY",
+		"JWKS_URL":        "missing auth JWKS endpoint: JWKS_URL",
 		"NATS_CLUSTER_ID": "missing NATS cluster ID: NATS_CLUSTER_ID",
 		"NATS_CLIENT_ID":  "missing NATS client ID: NATS_CLIENT_ID",
 		"NATS_CONN_STR":   "missing NATS connection string: NATS_CONN_STR",
 	}
 	for key, errStr := range envToErrString {
 		if val, ok := os.LookupEnv(key); !ok {
-			conf[key] = val
-		} else {
 			missingEnvs = append(missingEnvs, errStr)
+		} else {
+			conf[key] = val
 		}
 	}
 	return conf, missingEnvs
@@ -109,10 +113,35 @@ func main() {
 		}
 	}()
 
+	// publish ticket events saved to the outbox
+	outboxRelay := newRelay(mongoCRUD, natsClient, relayInterval)
+	outboxRelay.start()
+
+	// reserve and release tickets as orders are created and cancelled
+	l, err := newListener(mongoCRUD, natsClient)
+	if err != nil {
+		ErrorLogger.Printf("unable to create event listener: %v", err)
+		os.Exit(1)
+	}
+	if err := l.listen(); err != nil {
+		ErrorLogger.Printf("unable to listen for events: %v", err)
+		os.Exit(1)
+	}
+
+	// reject tokens revoked by the auth service
+	revoked := middleware.NewRevocationCache()
+	if err := revoked.ListenRevocations(natsClient, ErrorLogger); err != nil {
+		ErrorLogger.Printf("unable to listen for token revocations: %v", err)
+		os.Exit(1)
+	}
+
+	// session tokens are signed by the auth service; only verify them here
+	jwtValidator := middleware.NewJWKSValidator(conf["JWKS_URL"], middleware.DefaultJWKSRefresh)
+
 	// create gin router and bind handlers/routes to it
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
-	server, err := newApiServer(conf["JWT_SIGN_KEY"], r, mongoCRUD, natsClient)
+	server, err := newApiServer(jwtValidator, r, mongoCRUD, revoked, middleware.DefaultTokenSources())
 	if err != nil {
 		ErrorLogger.Printf("could not create new API server")
 		os.Exit(1)
@@ -137,7 +166,7 @@ func main() {
 	case <-c:
 		cancel()
 		InfoLogger.Print("beginning graceful shutdown")
-		if errs := gracefulShutdown(mongoCRUD, natsClient, httpServer); len(errs) != 0 {
+		if errs := gracefulShutdown(mongoCRUD, outboxRelay, natsClient, httpServer); len(errs) != 0 {
 			ErrorLogger.Printf("unable to perform graceful shutdown:\n%v", strings.Join(errs, "\n"))
 			os.Exit(1)
 		}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/stan.go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	outboxCollectionName = "outbox"
+	outboxBatchSize      = 100
+	relayInterval        = 500 * time.Millisecond
+	// sentEventRetention is how long sent events are kept before they are dropped
+	sentEventRetention = 24 * time.Hour
+)
+
+// outboxEvent is an event waiting to be published to NATS
+// it is written in the same transaction as the ticket change that produced it
+type outboxEvent struct {
+	Subject   string    `bson:"subject"`
+	Data      []byte    `bson:"data"`
+	CreatedAt time.Time `bson:"createdAt"`
+	Sent      bool      `bson:"sent"`
+	Id        string    `bson:"_id,omitempty"`
+}
+
+func newOutboxEvent(subj string, data []byte) outboxEvent {
+	return outboxEvent{
+		Subject:   subj,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+}
+
+// eventBuilder creates the outbox event for a new ticket once its id is known
+type eventBuilder func(id string) (outboxEvent, error)
+
+type outboxStore interface {
+	pending(int64) ([]outboxEvent, error)
+	markSent(string) error
+}
+
+// pendingEventsIndex serves the relay's query for unsent events in the order they were written
+var pendingEventsIndex = mongo.IndexModel{
+	Keys:    bson.D{{Key: "sent", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}},
+	Options: options.Index().SetName("pending_events"),
+}
+
+// sentEventsIndex drops events sentEventRetention after they were sent
+// unsent events have no sentAt so they are never dropped
+var sentEventsIndex = mongo.IndexModel{
+	Keys:    bson.D{{Key: "sentAt", Value: 1}},
+	Options: options.Index().SetName("sent_events").SetExpireAfterSeconds(int32(sentEventRetention / time.Second)),
+}
+
+func createOutboxIndexes(collection *mongo.Collection, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{pendingEventsIndex, sentEventsIndex})
+	return err
+}
+
+// withTransaction runs fn inside a transaction so ticket and outbox writes are applied together
+func (c *MongoColl) withTransaction(ctx context.Context, fn func(mongo.SessionContext) error) error {
+	session, err := c.coll.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+func (c *MongoColl) insertEvent(ctx context.Context, event outboxEvent) error {
+	event.Id = ""
+	_, err := c.outbox.InsertOne(ctx, event)
+	return err
+}
+
+// pending returns unsent events, oldest first
+func (c *MongoColl) pending(limit int64) ([]outboxEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(limit)
+	cursor, err := c.outbox.Find(ctx, bson.M{"sent": false}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []outboxEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (c *MongoColl) markSent(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	objId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.outbox.UpdateOne(ctx, bson.M{"_id": objId}, bson.M{"$set": bson.M{"sent": true, "sentAt": time.Now()}})
+	return err
+}
+
+// relay publishes pending outbox events to NATS
+// events stay pending until NATS acks the publish so delivery is at-least-once
+type relay struct {
+	store    outboxStore
+	eBus     stan.Conn
+	interval time.Duration
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newRelay(store outboxStore, eBus stan.Conn, interval time.Duration) *relay {
+	return &relay{
+		store:    store,
+		eBus:     eBus,
+		interval: interval,
+		quit:     make(chan struct{}),
+	}
+}
+
+func (r *relay) start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.quit:
+				return
+			case <-ticker.C:
+				if err := r.relayPending(); err != nil {
+					ErrorLogger.Printf("unable to relay outbox events, will retry: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// relayPending publishes pending events in the order they were written
+// it stops at the first failure so a retry does not publish later events ahead of earlier ones
+func (r *relay) relayPending() error {
+	events, err := r.store.pending(outboxBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if err := r.eBus.Publish(event.Subject, event.Data); err != nil {
+			return err
+		}
+		if err := r.store.markSent(event.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stop waits for an in-flight relay pass to finish
+func (r *relay) stop() {
+	close(r.quit)
+	r.wg.Wait()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// flakyNatsConn fails every publish while down is set
+type flakyNatsConn struct {
+	*fakeNatsConn
+	down bool
+}
+
+func (f *flakyNatsConn) Publish(subj string, data []byte) error {
+	if f.down {
+		return errors.New("nats unavailable")
+	}
+	return f.fakeNatsConn.Publish(subj, data)
+}
+
+func TestRelayPending(t *testing.T) {
+	fakeMongo := newFakeMongoCollection()
+	fakeStan := &flakyNatsConn{newFakeNatsConn(), true}
+	outboxRelay := newRelay(fakeMongo, fakeStan, relayInterval)
+
+	fakeMongo.saveEvent(newOutboxEvent("ticket:created", []byte("first")))
+	fakeMongo.saveEvent(newOutboxEvent("ticket:updated", []byte("second")))
+
+	// publishing fails so every event stays pending
+	if err := outboxRelay.relayPending(); err == nil {
+		t.Fatal("expected relay to fail while NATS is down")
+	}
+	if pending, _ := fakeMongo.pending(outboxBatchSize); len(pending) != 2 {
+		t.Fatalf("wrong number of pending events: %v, want 2", len(pending))
+	}
+
+	// the retry publishes the events in order and marks them sent
+	fakeStan.down = false
+	if err := outboxRelay.relayPending(); err != nil {
+		t.Fatalf("unable to relay outbox: %v", err)
+	}
+	want := map[string][][]byte{
+		"ticket:created": {[]byte("first")},
+		"ticket:updated": {[]byte("second")},
+	}
+	if diff := cmp.Diff(fakeStan.messages, want); diff != "" {
+		t.Errorf("bad published events: %v", diff)
+	}
+	if pending, _ := fakeMongo.pending(outboxBatchSize); len(pending) != 0 {
+		t.Errorf("wrong number of pending events: %v, want 0", len(pending))
+	}
+
+	// sent events are not published again
+	if err := outboxRelay.relayPending(); err != nil {
+		t.Fatalf("unable to relay outbox: %v", err)
+	}
+	if diff := cmp.Diff(fakeStan.messages, want); diff != "" {
+		t.Errorf("sent events were republished: %v", diff)
+	}
+}
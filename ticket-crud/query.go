@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/basilnsage/mwn-ticketapp/middleware/problem"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// ticket listings can be sorted by price or by creation time
+// a leading '-' sorts in descending order
+const (
+	sortCreated     = "created"
+	sortCreatedDesc = "-created"
+	sortPrice       = "price"
+	sortPriceDesc   = "-price"
+)
+
+// TicketQuery describes a page of tickets to read
+// nil price bounds and empty strings are not used to filter
+type TicketQuery struct {
+	Limit         int64
+	After         *ticketCursor
+	MinPrice      *float64
+	MaxPrice      *float64
+	Owner         string
+	Title         string
+	AvailableOnly bool
+	Sort          string
+}
+
+func (q TicketQuery) descending() bool {
+	return q.Sort == sortCreatedDesc || q.Sort == sortPriceDesc
+}
+
+func (q TicketQuery) byPrice() bool {
+	return q.Sort == sortPrice || q.Sort == sortPriceDesc
+}
+
+// ticketCursor points at the last ticket of a page
+// the next page starts after it in the requested sort order
+type ticketCursor struct {
+	Price float64 `json:"p,omitempty"`
+	Id    string  `json:"i"`
+}
+
+func newTicketCursor(t TicketResp) *ticketCursor {
+	return &ticketCursor{t.Price, t.Id}
+}
+
+func (c ticketCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTicketCursor(s string) (*ticketCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c ticketCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if c.Id == "" {
+		return nil, fmt.Errorf("cursor is missing a ticket id")
+	}
+	return &c, nil
+}
+
+// nextCursor trims a page read with one extra ticket and returns the cursor for the following page
+// the cursor is empty if there are no more tickets
+func nextCursor(tickets []TicketResp, limit int64) ([]TicketResp, string) {
+	if int64(len(tickets)) <= limit {
+		return tickets, ""
+	}
+	tickets = tickets[:limit]
+	return tickets, newTicketCursor(tickets[len(tickets)-1]).encode()
+}
+
+// ticketQueryFromParams parses the GET /api/tickets query parameters
+// it returns the parameters that are not valid
+func ticketQueryFromParams(params url.Values) (TicketQuery, []problem.InvalidParam) {
+	var issues []problem.InvalidParam
+	q := TicketQuery{
+		Limit: defaultPageSize,
+		Owner: params.Get("owner"),
+		Title: params.Get("title"),
+		Sort:  sortCreated,
+	}
+	param := func(name string) (string, bool) {
+		if _, ok := params[name]; !ok {
+			return "", false
+		}
+		return params.Get(name), true
+	}
+
+	if v, ok := param("limit"); ok {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			issues = append(issues, problem.InvalidParam{Name: "limit", Reason: fmt.Sprintf("limit must be a number between 1 and %v", maxPageSize)})
+		} else {
+			q.Limit = limit
+		}
+	}
+
+	if v, ok := param("after"); ok {
+		cursor, err := decodeTicketCursor(v)
+		if err != nil {
+			issues = append(issues, problem.InvalidParam{Name: "after", Reason: "invalid cursor"})
+		} else {
+			q.After = cursor
+		}
+	}
+
+	priceBounds := []struct {
+		param string
+		bound **float64
+	}{
+		{"minPrice", &q.MinPrice},
+		{"maxPrice", &q.MaxPrice},
+	}
+	for _, pb := range priceBounds {
+		v, ok := param(pb.param)
+		if !ok {
+			continue
+		}
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil || price < 0 {
+			issues = append(issues, problem.InvalidParam{Name: pb.param, Reason: pb.param + " must be a number greater than or equal to 0"})
+			continue
+		}
+		*pb.bound = &price
+	}
+	if q.MinPrice != nil && q.MaxPrice != nil && *q.MinPrice > *q.MaxPrice {
+		issues = append(issues, problem.InvalidParam{Name: "minPrice", Reason: "minPrice cannot be greater than maxPrice"})
+	}
+
+	if v, ok := param("available"); ok {
+		available, err := strconv.ParseBool(v)
+		if err != nil {
+			issues = append(issues, problem.InvalidParam{Name: "available", Reason: "available must be true or false"})
+		} else {
+			q.AvailableOnly = available
+		}
+	}
+
+	if v, ok := param("sort"); ok {
+		switch v {
+		case sortCreated, sortCreatedDesc, sortPrice, sortPriceDesc:
+			q.Sort = v
+		default:
+			issues = append(issues, problem.InvalidParam{Name: "sort", Reason: "sort must be one of: created, -created, price, -price"})
+		}
+	}
+
+	return q, issues
+}
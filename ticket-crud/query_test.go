@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTicketCursor(t *testing.T) {
+	want := ticketCursor{12.5, "5f47ec2c86ed3ef991cdfd94"}
+	got, err := decodeTicketCursor(want.encode())
+	if err != nil {
+		t.Fatalf("unable to decode cursor: %v", err)
+	}
+	if diff := cmp.Diff(*got, want); diff != "" {
+		t.Errorf("bad decoded cursor: %v", diff)
+	}
+
+	if _, err := decodeTicketCursor(ticketCursor{Price: 1.0}.encode()); err == nil {
+		t.Error("expected error decoding a cursor without an id")
+	}
+}
+
+func TestTicketFilter(t *testing.T) {
+	afterId := primitive.NewObjectID()
+	minPrice := 10.0
+
+	tests := []struct {
+		name  string
+		query TicketQuery
+		want  bson.M
+	}{
+		{"no filters", TicketQuery{}, bson.M{}},
+		{
+			"price and availability",
+			TicketQuery{MinPrice: &minPrice, AvailableOnly: true},
+			bson.M{"$and": []bson.M{
+				{"price": bson.M{"$gte": 10.0}},
+				{"orderId": bson.M{"$exists": false}},
+			}},
+		},
+		{
+			"newest first after cursor",
+			TicketQuery{After: &ticketCursor{Id: afterId.Hex()}, Sort: sortCreatedDesc},
+			bson.M{"$and": []bson.M{
+				{"_id": bson.M{"$lt": afterId}},
+			}},
+		},
+		{
+			"cheapest first after cursor",
+			TicketQuery{After: &ticketCursor{20.0, afterId.Hex()}, Sort: sortPrice},
+			bson.M{"$and": []bson.M{
+				{"$or": []bson.M{
+					{"price": bson.M{"$gt": 20.0}},
+					{"price": 20.0, "_id": bson.M{"$gt": afterId}},
+				}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(currTest *testing.T) {
+			got, err := ticketFilter(tt.query)
+			if err != nil {
+				currTest.Fatalf("unable to build filter: %v", err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				currTest.Errorf("bad filter: %v", diff)
+			}
+		})
+	}
+}
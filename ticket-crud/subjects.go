@@ -4,8 +4,10 @@ package main
 import "github.com/basilnsage/mwn-ticketapp-common/subjects"
 
 var (
-	createTicketSubject string
-	updateTicketSubject string
+	createTicketSubject   string
+	updateTicketSubject   string
+	orderCreatedSubject   string
+	orderCancelledSubject string
 )
 
 func setCreateTicketSubject(receiver *string) error {
@@ -26,6 +28,24 @@ func setUpdateTicketSubject(receiver *string) error {
 	return nil
 }
 
+func setOrderCreatedSubject(receiver *string) error {
+	ocs, err := subjects.StringifySubject(subjects.Subject_ORDER_CREATED)
+	if err != nil {
+		return err
+	}
+	*receiver = ocs
+	return nil
+}
+
+func setOrderCancelledSubject(receiver *string) error {
+	ocs, err := subjects.StringifySubject(subjects.Subject_ORDER_CANCELLED)
+	if err != nil {
+		return err
+	}
+	*receiver = ocs
+	return nil
+}
+
 func setSubjects() error {
 	if err := setCreateTicketSubject(&createTicketSubject); err != nil {
 		return err
@@ -33,5 +53,11 @@ func setSubjects() error {
 	if err := setUpdateTicketSubject(&updateTicketSubject); err != nil {
 		return err
 	}
+	if err := setOrderCreatedSubject(&orderCreatedSubject); err != nil {
+		return err
+	}
+	if err := setOrderCancelledSubject(&orderCancelledSubject); err != nil {
+		return err
+	}
 	return nil
 }
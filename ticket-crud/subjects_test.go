@@ -18,4 +18,20 @@ func TestSetSubjects(t *testing.T) {
 	if got, want := updateSubj, "ticket:updated"; got != want {
 		t.Errorf("incorrect updateTicket subject: %v, want %v", got, want)
 	}
+
+	var orderCreatedSubj, orderCancelledSubj string
+
+	if err := setOrderCreatedSubject(&orderCreatedSubj); err != nil {
+		t.Errorf("error setting orderCreated subject: %v", err)
+	}
+	if got, want := orderCreatedSubj, "order:created"; got != want {
+		t.Errorf("incorrect orderCreated subject: %v, want %v", got, want)
+	}
+
+	if err := setOrderCancelledSubject(&orderCancelledSubj); err != nil {
+		t.Errorf("error setting orderCancelled subject: %v", err)
+	}
+	if got, want := orderCancelledSubj, "order:cancelled"; got != want {
+		t.Errorf("incorrect orderCancelled subject: %v, want %v", got, want)
+	}
 }
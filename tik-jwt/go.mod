@@ -1,8 +0,0 @@
-module github.com/basilnsage/mwn-ticketapp/tik-jwt
-
-go 1.15
-
-require (
-	github.com/dgrijalva/jwt-go v3.2.0+incompatible
-	github.com/google/go-cmp v0.5.4
-)